@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+)
+
+const (
+	// auditBeforeKey is the key of the request context where the state of
+	// the resource targeted by the request before the change is stored.
+	auditBeforeKey = "audit_before"
+
+	// auditMaxResponseSize is the maximum size of the responses kept to
+	// record the state of the resources after a change.
+	auditMaxResponseSize = 1 << 20
+)
+
+var (
+	// auditVerbs maps the methods of the requests recorded in the audit log
+	// to the verb used in their action.
+	auditVerbs = map[string]string{
+		http.MethodPost:   "create",
+		http.MethodPut:    "update",
+		http.MethodDelete: "delete",
+	}
+
+	// auditRedactedFields are the fields never recorded in the audit log,
+	// like the secret of the API tokens created.
+	auditRedactedFields = []string{"token", "password", "secret"}
+)
+
+// auditResponseWriter keeps a copy of the response body, used as the state of
+// the resource after the change.
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	w.keep(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *auditResponseWriter) WriteString(s string) (int, error) {
+	w.keep([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *auditResponseWriter) keep(data []byte) {
+	if w.truncated || w.body.Len()+len(data) > auditMaxResponseSize {
+		w.truncated = true
+		return
+	}
+	w.body.Write(data)
+}
+
+// recordAuditEntry is a middleware handler recording the POST, PUT and DELETE
+// requests in the audit log once they have been processed, whether they
+// succeeded or not.
+func (ctl *controller) recordAuditEntry(c *gin.Context) {
+	verb, ok := auditVerbs[c.Request.Method]
+	if !ok {
+		c.Next()
+		return
+	}
+	writer := &auditResponseWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	c.Next()
+
+	targetType, targetID := auditTarget(c)
+	entry := &api.AuditEntry{
+		TeamID:     c.GetString("team_id"),
+		Actor:      getUsername(c),
+		Action:     targetType + "." + verb,
+		Method:     c.Request.Method,
+		Route:      c.FullPath(),
+		TargetType: targetType,
+		TargetID:   targetID,
+		Status:     writer.Status(),
+		RequestID:  writer.Header().Get("X-Request-ID"),
+	}
+	if appID := c.Param("app_id"); appID != "" {
+		entry.ApplicationID = null.StringFrom(appID)
+	}
+	if before, ok := c.Get(auditBeforeKey); ok {
+		entry.Before, _ = before.(api.AuditData)
+	}
+	if entry.Status < http.StatusMultipleChoices && verb != "delete" && !writer.truncated {
+		entry.After = auditData(writer.body.Bytes())
+		if entry.TargetID == "" && entry.After["id"] != nil {
+			entry.TargetID = fmt.Sprint(entry.After["id"])
+		}
+	}
+
+	if err := ctl.api.AddAuditEntry(entry); err != nil {
+		logger.Error().Err(err).Str("request_id", entry.RequestID).Msgf("recordAuditEntry - adding audit entry for %s %s", entry.Method, entry.Route)
+	}
+}
+
+// captureAuditState is a middleware handler storing the state of the resource
+// targeted by PUT and DELETE requests, so the audit log can record the
+// changes made. It must run once the request has been authorized.
+func (ctl *controller) captureAuditState(c *gin.Context) {
+	if c.Request.Method == http.MethodPut || c.Request.Method == http.MethodDelete {
+		targetType, targetID := auditTarget(c)
+		state, err := ctl.getAuditState(c, targetType, targetID)
+		switch {
+		case err != nil:
+			logger.Debug().Err(err).Str("targetType", targetType).Str("targetID", targetID).Msg("captureAuditState - getting state before change")
+		case state != nil:
+			data, err := json.Marshal(state)
+			if err == nil {
+				c.Set(auditBeforeKey, auditData(data))
+			}
+		}
+	}
+	c.Next()
+}
+
+// getAuditState returns the current state of the resource provided, if it's
+// one of the resources whose changes are recorded in detail.
+func (ctl *controller) getAuditState(c *gin.Context, targetType, targetID string) (interface{}, error) {
+	teamID := c.GetString("team_id")
+	switch targetType {
+	case "apps":
+		return ctl.api.GetApp(targetID)
+	case "groups":
+		return ctl.api.GetGroup(targetID)
+	case "channels":
+		return ctl.api.GetChannel(targetID)
+	case "packages":
+		return ctl.api.GetPackage(targetID)
+	case "override":
+		return ctl.api.GetInstanceOverride(targetID, c.Param("app_id"))
+	case "roles":
+		return ctl.api.GetRole(teamID, targetID)
+	case "tokens":
+		return ctl.api.GetAPIToken(teamID, targetID)
+	}
+	return nil, nil
+}
+
+// auditTarget returns the type of the resource targeted by the request, named
+// after the last static segment of its route, and its id: the last parameter
+// of the route, if the route ends with it or the request is not creating a
+// new resource.
+func auditTarget(c *gin.Context) (targetType, targetID string) {
+	var lastParam string
+	for _, segment := range strings.Split(strings.Trim(c.FullPath(), "/"), "/") {
+		if strings.HasPrefix(segment, ":") {
+			lastParam = c.Param(segment[1:])
+			targetID = lastParam
+			continue
+		}
+		targetType = segment
+		targetID = ""
+	}
+	if targetID == "" && c.Request.Method != http.MethodPost {
+		targetID = lastParam
+	}
+	return targetType, targetID
+}
+
+// auditData returns the JSON object provided as audit data, without the
+// fields that must not be recorded. Anything but an object is ignored.
+func auditData(data []byte) api.AuditData {
+	var result api.AuditData
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil
+	}
+	for _, field := range auditRedactedFields {
+		delete(result, field)
+	}
+	return result
+}
@@ -7,6 +7,28 @@ import (
 	"github.com/kinvolk/nebraska/backend/pkg/util"
 )
 
+const (
+	// groupsKey is the key of the request context where the groups the
+	// authenticated user belongs to are stored.
+	groupsKey = "auth_groups"
+	// accessLevelKey is the key of the request context where the access
+	// level of the authenticated user is stored.
+	accessLevelKey = "auth_access_level"
+	// usernameKey is the key of the request context where the name of
+	// the authenticated user is stored by authenticators not keeping it
+	// in the session.
+	usernameKey = "auth_username"
+	// scopesKey is the key of the request context where the scopes of the
+	// API token used to authenticate the request are stored.
+	scopesKey = "auth_scopes"
+
+	// AccessLevelAdmin gives users full access to their teams' resources.
+	AccessLevelAdmin = "admin"
+	// AccessLevelViewer gives users read-only access to their teams'
+	// resources, further permissions can be granted through roles.
+	AccessLevelViewer = "viewer"
+)
+
 var (
 	logger = util.NewLogger("auth")
 )
@@ -28,3 +50,61 @@ type Authenticator interface {
 	// reply and return true for "replied".
 	Authenticate(c *gin.Context) (teamID string, replied bool)
 }
+
+// SetGroups stores in the request context the groups the authenticated user
+// belongs to according to the identity provider, which may be mapped to
+// Nebraska teams.
+func SetGroups(c *gin.Context, groups []string) {
+	c.Set(groupsKey, groups)
+}
+
+// Groups returns the groups stored in the request context by SetGroups.
+func Groups(c *gin.Context) []string {
+	groups, _ := c.Get(groupsKey)
+	result, _ := groups.([]string)
+	return result
+}
+
+// SetAccessLevel stores in the request context the access level of the
+// authenticated user. Authenticators don't restrict the requests users can
+// make, that is up to the authorization done based on the access level and
+// the roles granted to the user.
+func SetAccessLevel(c *gin.Context, level string) {
+	c.Set(accessLevelKey, level)
+}
+
+// AccessLevel returns the access level stored in the request context by
+// SetAccessLevel.
+func AccessLevel(c *gin.Context) string {
+	return c.GetString(accessLevelKey)
+}
+
+// SetUsername stores in the request context the name of the authenticated
+// user, for authenticators not keeping it in the session.
+func SetUsername(c *gin.Context, username string) {
+	c.Set(usernameKey, username)
+}
+
+// Username returns the username stored in the request context by
+// SetUsername.
+func Username(c *gin.Context) string {
+	return c.GetString(usernameKey)
+}
+
+// SetScopes stores in the request context the scopes of the API token used to
+// authenticate the request. Such requests are only granted the permissions in
+// the token's scopes, in the team the token belongs to.
+func SetScopes(c *gin.Context, scopes []string) {
+	c.Set(scopesKey, scopes)
+}
+
+// Scopes returns the scopes stored in the request context by SetScopes, and
+// whether the request was authenticated with an API token at all.
+func Scopes(c *gin.Context) ([]string, bool) {
+	scopes, ok := c.Get(scopesKey)
+	if !ok {
+		return nil, false
+	}
+	result, _ := scopes.([]string)
+	return result, true
+}
@@ -136,14 +136,7 @@ func (gha *githubAuth) SetupRouter(router ginhelpers.Router) {
 func (gha *githubAuth) Authenticate(c *gin.Context) (teamID string, replied bool) {
 	session := ginsessions.GetSession(c)
 	if session.Has("teamID") {
-		if session.Get("accesslevel") != "rw" {
-			if c.Request.Method != "HEAD" && c.Request.Method != "GET" {
-				httpError(c, http.StatusForbidden)
-				teamID = ""
-				replied = true
-				return
-			}
-		}
+		setGithubAccessLevel(c, session)
 		teamID = session.Get("teamID").(string)
 		replied = false
 		return
@@ -188,6 +181,7 @@ func (gha *githubAuth) Authenticate(c *gin.Context) (teamID string, replied bool
 		oauthClient := oauth2.NewClient(c.Request.Context(), tokenSource)
 		failed = false
 		if replied = gha.doLoginDance(c, oauthClient); !replied {
+			setGithubAccessLevel(c, session)
 			teamID = session.Get("teamID").(string)
 		} else {
 			teamID = ""
@@ -196,6 +190,16 @@ func (gha *githubAuth) Authenticate(c *gin.Context) (teamID string, replied bool
 	return
 }
 
+// setGithubAccessLevel sets the access level of the user according to the
+// kind of GitHub team (read-write or read-only) they were found in.
+func setGithubAccessLevel(c *gin.Context, session *sessions.Session) {
+	if session.Get("accesslevel") == "rw" {
+		SetAccessLevel(c, AccessLevelAdmin)
+	} else {
+		SetAccessLevel(c, AccessLevelViewer)
+	}
+}
+
 func (gha *githubAuth) loginCb(c *gin.Context) {
 	const (
 		resultOK = iota
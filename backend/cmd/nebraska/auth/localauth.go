@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kinvolk/nebraska/backend/cmd/nebraska/ginhelpers"
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+	"github.com/kinvolk/nebraska/backend/pkg/sessions"
+	ginsessions "github.com/kinvolk/nebraska/backend/pkg/sessions/gin"
+	"github.com/kinvolk/nebraska/backend/pkg/sessions/memcache"
+	memcachegob "github.com/kinvolk/nebraska/backend/pkg/sessions/memcache/gob"
+	"github.com/kinvolk/nebraska/backend/pkg/sessions/securecookie"
+)
+
+type (
+	// LocalUserStore authenticates the users with an account in
+	// Nebraska's database.
+	LocalUserStore interface {
+		AuthenticateUser(username, password string) (*api.User, error)
+	}
+
+	// LocalAuthConfig is used to configure the local accounts
+	// authenticator.
+	LocalAuthConfig struct {
+		SessionAuthKey  []byte
+		SessionCryptKey []byte
+		Users           LocalUserStore
+		// AccessLevel is the access level given to all local
+		// accounts, further permissions are granted through roles.
+		// Local accounts get no base permissions when empty.
+		AccessLevel string
+		// AdminUsers are the local accounts given full access to
+		// their team.
+		AdminUsers []string
+	}
+
+	localCredentials struct {
+		Username string `json:"username" form:"username"`
+		Password string `json:"password" form:"password"`
+	}
+
+	localAuth struct {
+		users         LocalUserStore
+		sessionsStore *sessions.Store
+		accessLevel   string
+		adminUsers    map[string]bool
+		limiter       *loginLimiter
+	}
+
+	// loginLimiter throttles the login attempts of the clients failing to
+	// authenticate too many times, and how many passwords are checked at
+	// the same time, as hashing them is expensive on purpose.
+	loginLimiter struct {
+		mu       sync.Mutex
+		failures map[string]*loginFailures
+		hashing  chan struct{}
+	}
+
+	loginFailures struct {
+		count int
+		since time.Time
+	}
+)
+
+const (
+	// maxLoginFailures is how many failed login attempts a client can
+	// make in loginFailuresWindow before being throttled.
+	maxLoginFailures    = 10
+	loginFailuresWindow = 15 * time.Minute
+	// maxConcurrentLogins is how many passwords are checked at the same
+	// time, each hash takes ~19 MiB of memory.
+	maxConcurrentLogins = 4
+	// maxTrackedLoginClients is the number of clients with failed login
+	// attempts above which the expired ones are forgotten.
+	maxTrackedLoginClients = 10000
+)
+
+var (
+	_ Authenticator = &localAuth{}
+)
+
+// NewLocalAuthenticator is an authenticator checking the credentials of
+// the users against the accounts stored in Nebraska's database, for
+// deployments without an identity provider. Users log in with a POST to
+// /login or with HTTP basic authentication, and stay logged in through
+// a session cookie afterwards.
+func NewLocalAuthenticator(config *LocalAuthConfig) Authenticator {
+	cache := memcache.New(memcachegob.New())
+	codec := securecookie.New(config.SessionAuthKey, config.SessionCryptKey)
+	adminUsers := make(map[string]bool, len(config.AdminUsers))
+	for _, username := range config.AdminUsers {
+		if username != "" {
+			adminUsers[username] = true
+		}
+	}
+	return &localAuth{
+		users:         config.Users,
+		sessionsStore: sessions.NewStore(cache, codec),
+		accessLevel:   config.AccessLevel,
+		adminUsers:    adminUsers,
+		limiter: &loginLimiter{
+			failures: make(map[string]*loginFailures),
+			hashing:  make(chan struct{}, maxConcurrentLogins),
+		},
+	}
+}
+
+// SetupRouter is a part of the Authenticator interface
+// implementation.
+func (la *localAuth) SetupRouter(router ginhelpers.Router) {
+	router.Use(ginsessions.SessionsMiddleware(la.sessionsStore, "localauth"))
+	router.POST("/login", la.login)
+	router.POST("/logout", la.logout)
+}
+
+// Authenticate is a part of the Authenticator interface
+// implementation.
+func (la *localAuth) Authenticate(c *gin.Context) (teamID string, replied bool) {
+	session := ginsessions.GetSession(c)
+	if teamID, ok := session.Get("teamID").(string); ok {
+		la.setLocalUser(c, session)
+		return teamID, false
+	}
+
+	username, password, ok := c.Request.BasicAuth()
+	if !ok {
+		c.Header("WWW-Authenticate", `Basic realm="`+api.Realm+`", charset="UTF-8"`)
+		httpError(c, http.StatusUnauthorized)
+		return "", true
+	}
+	if !la.startSession(c, localCredentials{Username: username, Password: password}) {
+		return "", true
+	}
+	la.setLocalUser(c, session)
+	return session.Get("teamID").(string), false
+}
+
+// setLocalUser stores in the request context the user logged in, with the
+// access level configured for local accounts, or full access to their team
+// for the admin users.
+func (la *localAuth) setLocalUser(c *gin.Context, session *sessions.Session) {
+	username, _ := session.Get("username").(string)
+	SetUsername(c, username)
+	if la.adminUsers[username] {
+		SetAccessLevel(c, AccessLevelAdmin)
+	} else {
+		SetAccessLevel(c, la.accessLevel)
+	}
+}
+
+func (la *localAuth) login(c *gin.Context) {
+	var credentials localCredentials
+	if err := c.ShouldBind(&credentials); err != nil {
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	if la.startSession(c, credentials) {
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func (la *localAuth) logout(c *gin.Context) {
+	session := ginsessions.GetSession(c)
+	session.Mark()
+	sessionSave(c, session, "logout")
+	c.Status(http.StatusNoContent)
+}
+
+// startSession checks the credentials provided and stores the user in the
+// session if they are valid. Otherwise it replies to the request and
+// returns false.
+func (la *localAuth) startSession(c *gin.Context, credentials localCredentials) bool {
+	client := c.ClientIP()
+	if retryAfter := la.limiter.throttled(client); retryAfter > 0 {
+		logger.Debug().Str("client", client).Msg("local auth - too many failed login attempts")
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds()+1)))
+		httpError(c, http.StatusTooManyRequests)
+		return false
+	}
+	select {
+	case la.limiter.hashing <- struct{}{}:
+	case <-c.Request.Context().Done():
+		httpError(c, http.StatusServiceUnavailable)
+		return false
+	}
+	user, err := la.users.AuthenticateUser(credentials.Username, credentials.Password)
+	<-la.limiter.hashing
+	if err != nil {
+		if err != api.ErrInvalidCredentials {
+			logger.Error().Err(err).Str("username", credentials.Username).Msg("local auth - authenticating user")
+		} else {
+			la.limiter.failed(client)
+			logger.Debug().Str("username", credentials.Username).Msg("local auth - invalid credentials")
+		}
+		httpError(c, http.StatusUnauthorized)
+		return false
+	}
+	session := ginsessions.GetSession(c)
+	session.Set("username", user.Username)
+	session.Set("teamID", user.TeamID)
+	if err := ginsessions.SaveSession(c, session); err != nil {
+		logger.Error().Err(err).Str("username", user.Username).Msg("local auth - saving session")
+		httpError(c, http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// throttled returns how long the client provided has to wait before trying
+// to log in again, or zero if it can try now.
+func (l *loginLimiter) throttled(client string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	failures, ok := l.failures[client]
+	if !ok {
+		return 0
+	}
+	remaining := loginFailuresWindow - time.Since(failures.since)
+	if remaining <= 0 {
+		delete(l.failures, client)
+		return 0
+	}
+	if failures.count < maxLoginFailures {
+		return 0
+	}
+	return remaining
+}
+
+// failed records a failed login attempt of the client provided.
+func (l *loginLimiter) failed(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if len(l.failures) >= maxTrackedLoginClients {
+		for key, failures := range l.failures {
+			if now.Sub(failures.since) >= loginFailuresWindow {
+				delete(l.failures, key)
+			}
+		}
+	}
+	failures, ok := l.failures[client]
+	if !ok || now.Sub(failures.since) >= loginFailuresWindow {
+		failures = &loginFailures{since: now}
+		l.failures[client] = failures
+	}
+	failures.count++
+}
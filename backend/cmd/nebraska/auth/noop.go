@@ -41,6 +41,7 @@ func (noa *noopAuth) SetupRouter(router ginhelpers.Router) {
 // Authenticate is a part of the Authenticator interface
 // implementation.
 func (noa *noopAuth) Authenticate(c *gin.Context) (teamID string, replied bool) {
+	SetAccessLevel(c, AccessLevelAdmin)
 	teamID = noa.defaultTeamID
 	replied = false
 	return
@@ -48,6 +48,7 @@ type OIDCAuthConfig struct {
 	SessionAuthKey    []byte
 	SessionCryptKey   []byte
 	RolesPath         string
+	GroupsPath        string
 	Scopes            []string
 }
 
@@ -65,6 +66,7 @@ type oidcAuth struct {
 	scopes            []string  // List of OIDC scopes
 	stateMap          *sync.Map // Map used to store state between nebraska and oidc provider, used to prevent fake authentication response
 	rolesPath         string    // Json Path in which the roles will be found in ID Token
+	groupsPath        string    // Json Path in which the groups mapped to Nebraska teams will be found in ID Token
 	sessionStore      *sessions.Store
 }
 
@@ -115,6 +117,7 @@ func NewOIDCAuthenticator(config *OIDCAuthConfig) Authenticator {
 		scopes:            config.Scopes,
 		stateMap:          &stateMap,
 		rolesPath:         config.RolesPath,
+		groupsPath:        config.GroupsPath,
 		sessionStore:      sessionStore,
 	}
 
@@ -293,7 +296,8 @@ func tokenFromRequest(c *gin.Context) string {
 	return c.Request.URL.Query().Get("id_token")
 }
 
-// rolesFromToken extracts roles from a token. Returns empty array if not present.
+// rolesFromToken extracts roles (or any other array of strings, like groups)
+// from a token. Returns empty array if not present.
 func rolesFromToken(token *oidc.IDToken, rolesPath string) ([]string, error) {
 	roles := []string{}
 	var claimsString interface{}
@@ -381,15 +385,25 @@ func (oa *oidcAuth) Authenticate(c *gin.Context) (teamID string, replied bool) {
 		return "", true
 	}
 
+	if oa.groupsPath != "" {
+		groups, err := rolesFromToken(tk, oa.groupsPath)
+		if err != nil {
+			logger.Error().Str("request_id", requestID).AnErr("error", err).Msg("Can't extract groups from token")
+			httpError(c, http.StatusInternalServerError)
+			return "", true
+		}
+		SetGroups(c, groups)
+	}
+
 	accessLevel := ""
 
 	// Check and set access level
 checkloop:
 	for _, role := range roles {
-		if accessLevel != "viewer" {
+		if accessLevel != AccessLevelViewer {
 			for _, roRole := range oa.viewerRoles {
 				if roRole == role {
-					accessLevel = "viewer"
+					accessLevel = AccessLevelViewer
 					break
 				}
 			}
@@ -397,7 +411,7 @@ checkloop:
 
 		for _, rwRole := range oa.adminRoles {
 			if rwRole == role {
-				accessLevel = "admin"
+				accessLevel = AccessLevelAdmin
 				break checkloop
 			}
 		}
@@ -408,13 +422,8 @@ checkloop:
 		logger.Debug().Msg("Misconfigured Roles, Can't get access level from token")
 		httpError(c, http.StatusForbidden)
 		return "", true
-	} else if accessLevel != "admin" {
-		if c.Request.Method != "HEAD" && c.Request.Method != "GET" {
-			logger.Error().Str("request_id", requestID).Msg("User doesn't have admin access")
-			httpError(c, http.StatusForbidden)
-			return "", true
-		}
 	}
+	SetAccessLevel(c, accessLevel)
 
 	return oa.defaultTeamID, false
 }
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kinvolk/nebraska/backend/cmd/nebraska/ginhelpers"
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+)
+
+type (
+	// APITokenStore is used by the token authenticator to look up the
+	// API tokens sent in the requests.
+	APITokenStore interface {
+		AuthenticateAPIToken(secret string) (*api.APIToken, error)
+	}
+
+	tokenAuth struct {
+		tokens   APITokenStore
+		fallback Authenticator
+	}
+)
+
+var (
+	_ Authenticator = &tokenAuth{}
+)
+
+// NewTokenAuthenticator returns an authenticator accepting the API tokens
+// stored in Nebraska as bearer tokens in the Authorization header. Requests
+// without an API token are authenticated by the fallback authenticator, so
+// API tokens can be used alongside any other authentication mode.
+func NewTokenAuthenticator(tokens APITokenStore, fallback Authenticator) Authenticator {
+	return &tokenAuth{
+		tokens:   tokens,
+		fallback: fallback,
+	}
+}
+
+// SetupRouter is a part of the Authenticator interface
+// implementation.
+func (ta *tokenAuth) SetupRouter(router ginhelpers.Router) {
+	ta.fallback.SetupRouter(router)
+}
+
+// Authenticate is a part of the Authenticator interface
+// implementation.
+func (ta *tokenAuth) Authenticate(c *gin.Context) (teamID string, replied bool) {
+	secret, ok := bearerAPIToken(c.Request)
+	if !ok {
+		return ta.fallback.Authenticate(c)
+	}
+	token, err := ta.tokens.AuthenticateAPIToken(secret)
+	if err != nil {
+		if err != api.ErrAPITokenRejected {
+			logger.Error().Err(err).Msg("authenticating api token")
+		}
+		httpError(c, http.StatusUnauthorized)
+		return "", true
+	}
+	SetUsername(c, token.Username())
+	SetScopes(c, token.Scopes)
+	return token.TeamID, false
+}
+
+// bearerAPIToken returns the API token sent as bearer token in the request,
+// if any. Other bearer tokens, like the ones issued by identity providers,
+// are left to the other authenticators.
+func bearerAPIToken(r *http.Request) (string, bool) {
+	fields := strings.Fields(r.Header.Get("Authorization"))
+	if len(fields) != 2 || strings.ToLower(fields[0]) != "bearer" {
+		return "", false
+	}
+	if !strings.HasPrefix(fields[1], api.APITokenPrefix) {
+		return "", false
+	}
+	return fields[1], true
+}
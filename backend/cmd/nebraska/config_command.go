@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+	"github.com/kinvolk/nebraska/backend/pkg/declarative"
+)
+
+const configUsage = `usage: nebraska config <command> [flags]
+
+Commands:
+  export  Write the configuration of the team's applications as YAML
+  apply   Create or update the applications described in a YAML file
+
+Run "nebraska config <command> -h" for the flags of a command.
+`
+
+// runConfigCommand runs the "nebraska config" subcommand, which exports or
+// applies the declarative configuration of a team's applications directly
+// against the database.
+func runConfigCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, configUsage)
+		return errors.New("missing config command")
+	}
+	switch args[0] {
+	case "export":
+		return runConfigExport(args[1:])
+	case "apply":
+		return runConfigApply(args[1:])
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, configUsage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, configUsage)
+		return fmt.Errorf("unknown config command %q", args[0])
+	}
+}
+
+func runConfigExport(args []string) error {
+	flags := flag.NewFlagSet("nebraska config export", flag.ContinueOnError)
+	team := flags.String("team", "", "Name of the team whose applications are exported, the default team if empty")
+	appIDs := flags.String("app-ids", "", "Comma-separated list of the IDs of the applications to export, all of them if empty")
+	output := flags.String("o", "-", "File where the configuration is written, - for the standard output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	a, teamID, err := configCommandAPI(*team)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	var ids []string
+	if *appIDs != "" {
+		ids = strings.Split(*appIDs, ",")
+	}
+	config, err := declarative.Export(a, teamID, ids...)
+	if err != nil {
+		return fmt.Errorf("exporting configuration: %w", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return declarative.Write(w, config)
+}
+
+func runConfigApply(args []string) error {
+	flags := flag.NewFlagSet("nebraska config apply", flag.ContinueOnError)
+	team := flags.String("team", "", "Name of the team owning the applications, the default team if empty")
+	file := flags.String("f", "", "File with the configuration to apply, - for the standard input")
+	dryRun := flags.Bool("dry-run", false, "Only print the changes that would be made")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("the file to apply must be passed with -f")
+	}
+
+	var r io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	config, err := declarative.Read(r)
+	if err != nil {
+		return err
+	}
+
+	a, teamID, err := configCommandAPI(*team)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	changes, err := declarative.Apply(a, teamID, config, *dryRun, nil)
+	if err != nil {
+		return fmt.Errorf("applying configuration: %w", err)
+	}
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	if len(changes) == 0 {
+		fmt.Println("no changes")
+	}
+	return nil
+}
+
+// configCommandAPI connects to the database and returns the ID of the team
+// with the name provided, or of the default team.
+func configCommandAPI(teamName string) (*api.API, string, error) {
+	a, err := api.New()
+	if err != nil {
+		return nil, "", fmt.Errorf("connecting to the database: %w", err)
+	}
+	if teamName == "" {
+		team, err := a.GetTeam()
+		if err != nil {
+			a.Close()
+			return nil, "", fmt.Errorf("getting default team: %w", err)
+		}
+		return a, team.ID, nil
+	}
+	teams, err := a.GetTeams()
+	if err != nil {
+		a.Close()
+		return nil, "", fmt.Errorf("getting teams: %w", err)
+	}
+	for _, team := range teams {
+		if team.Name == teamName {
+			return a, team.ID, nil
+		}
+	}
+	a.Close()
+	return nil, "", fmt.Errorf("team %q not found", teamName)
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -19,8 +21,10 @@ import (
 
 	"github.com/kinvolk/nebraska/backend/cmd/nebraska/auth"
 	"github.com/kinvolk/nebraska/backend/pkg/api"
+	"github.com/kinvolk/nebraska/backend/pkg/declarative"
 	"github.com/kinvolk/nebraska/backend/pkg/omaha"
 	ginsessions "github.com/kinvolk/nebraska/backend/pkg/sessions/gin"
+	"github.com/kinvolk/nebraska/backend/pkg/storage"
 	"github.com/kinvolk/nebraska/backend/pkg/syncer"
 	"github.com/kinvolk/nebraska/backend/pkg/version"
 )
@@ -28,6 +32,15 @@ import (
 const (
 	GithubAccessManagementURL = "https://github.com/settings/apps/authorizations"
 	UpdateMaxRequestSize      = 64 * 1024
+
+	// teamHeader is the header API clients can use to pick the team their
+	// requests are made on behalf of.
+	teamHeader = "X-Nebraska-Team"
+
+	// packagesGCMinAge is how long hosted payloads are kept before being
+	// considered for garbage collection, so that payloads just stored by the
+	// syncer aren't removed before their package is created.
+	packagesGCMinAge = time.Hour
 )
 
 // ClientConfig represents Nebraska's configuration of interest for the client.
@@ -44,22 +57,49 @@ type ClientConfig struct {
 type controller struct {
 	api          *api.API
 	omahaHandler *omaha.Handler
+	cupSigner    *omaha.CUPSigner
 	syncer       *syncer.Syncer
+	packageStore storage.PackageStore
+	packagesGC   *storage.GarbageCollector
 	clientConfig *ClientConfig
 	auth         auth.Authenticator
+
+	requireTeamMembership bool
 }
 
 type controllerConfig struct {
 	api                 *api.API
 	enableSyncer        bool
 	hostFlatcarPackages bool
-	flatcarPackagesPath string
+	packageStore        storage.PackageStore
+	cupSigner           *omaha.CUPSigner
+	packagesGCInterval  time.Duration
 	nebraskaURL         string
 	noopAuthConfig      *auth.NoopAuthConfig
+	localAuthConfig     *auth.LocalAuthConfig
 	githubAuthConfig    *auth.GithubAuthConfig
 	oidcAuthConfig      *auth.OIDCAuthConfig
 	flatcarUpdatesURL   string
+	syncSources         []*syncer.Source
+	syncDownloadWorkers int
+	syncDownloadRetries int
 	checkFrequency      time.Duration
+
+	requireTeamMembership bool
+}
+
+// getUsername returns the name of the user sending the request, or an empty
+// string if authentication doesn't identify users.
+func getUsername(c *gin.Context) string {
+	if username := auth.Username(c); username != "" {
+		return username
+	}
+	session := ginsessions.GetSession(c)
+	if session == nil {
+		return ""
+	}
+	username, _ := session.Get("username").(string)
+	return username
 }
 
 func loggerWithUsername(l zerolog.Logger, c *gin.Context) zerolog.Logger {
@@ -78,20 +118,29 @@ func newController(conf *controllerConfig) (*controller, error) {
 	if err != nil {
 		return nil, err
 	}
+	hostedPackagesURL := conf.nebraskaURL + "/flatcar/"
 	c := &controller{
 		api:          conf.api,
 		omahaHandler: omaha.NewHandler(conf.api),
+		cupSigner:    conf.cupSigner,
+		packageStore: conf.packageStore,
 		auth:         authenticator,
+
+		requireTeamMembership: conf.requireTeamMembership,
 	}
 
 	if conf.enableSyncer {
 		syncerConf := &syncer.Config{
 			API:               conf.api,
 			HostPackages:      conf.hostFlatcarPackages,
-			PackagesPath:      conf.flatcarPackagesPath,
-			PackagesURL:       conf.nebraskaURL + "/flatcar/",
+			PackageStore:      conf.packageStore,
+			PackagesURL:       hostedPackagesURL,
 			FlatcarUpdatesURL: conf.flatcarUpdatesURL,
+			Sources:           conf.syncSources,
 			CheckFrequency:    conf.checkFrequency,
+
+			DownloadConcurrency: conf.syncDownloadWorkers,
+			DownloadRetries:     conf.syncDownloadRetries,
 		}
 		syncer, err := syncer.New(syncerConf)
 		if err != nil {
@@ -101,6 +150,11 @@ func newController(conf *controllerConfig) (*controller, error) {
 		go syncer.Start()
 	}
 
+	if conf.packageStore != nil && conf.packagesGCInterval > 0 {
+		c.packagesGC = storage.NewGarbageCollector(conf.packageStore, conf.api.GetPayloadFilenames, conf.packagesGCInterval, packagesGCMinAge)
+		go c.packagesGC.Start()
+	}
+
 	c.clientConfig = NewClientConfig(conf)
 
 	return c, nil
@@ -110,20 +164,30 @@ func (ctl *controller) close() {
 	if ctl.syncer != nil {
 		ctl.syncer.Stop()
 	}
+	if ctl.packagesGC != nil {
+		ctl.packagesGC.Stop()
+	}
 	ctl.api.Close()
 }
 
 func getAuthenticator(config *controllerConfig) (auth.Authenticator, error) {
-	if config.noopAuthConfig != nil {
-		return auth.NewNoopAuthenticator(config.noopAuthConfig), nil
-	}
-	if config.githubAuthConfig != nil {
-		return auth.NewGithubAuthenticator(config.githubAuthConfig), nil
+	var authenticator auth.Authenticator
+	switch {
+	case config.noopAuthConfig != nil:
+		authenticator = auth.NewNoopAuthenticator(config.noopAuthConfig)
+	case config.localAuthConfig != nil:
+		authenticator = auth.NewLocalAuthenticator(config.localAuthConfig)
+	case config.githubAuthConfig != nil:
+		authenticator = auth.NewGithubAuthenticator(config.githubAuthConfig)
+	case config.oidcAuthConfig != nil:
+		authenticator = auth.NewOIDCAuthenticator(config.oidcAuthConfig)
+	default:
+		return nil, fmt.Errorf("authentication method not configured")
 	}
-	if config.oidcAuthConfig != nil {
-		return auth.NewOIDCAuthenticator(config.oidcAuthConfig), nil
+	if config.api != nil {
+		authenticator = auth.NewTokenAuthenticator(config.api, authenticator)
 	}
-	return nil, fmt.Errorf("authentication method not configured")
+	return authenticator, nil
 }
 
 func httpError(c *gin.Context, status int) {
@@ -168,22 +232,660 @@ func NewClientConfig(conf *controllerConfig) *ClientConfig {
 		config.Logo = string(svg)
 		return config
 	}
-	return config
-}
+	return config
+}
+
+// ----------------------------------------------------------------------------
+// Authentication
+//
+
+// authenticate is a middleware handler in charge of authenticating requests.
+// It also sets the team the request is made on behalf of, chosen among the
+// teams the user belongs to (see selectTeam).
+func (ctl *controller) authenticate(c *gin.Context) {
+	defaultTeamID, replied := ctl.auth.Authenticate(c)
+	if replied {
+		return
+	}
+
+	teams, err := ctl.getUserTeams(c, defaultTeamID)
+	if err != nil {
+		logger.Error().Err(err).Msg("authenticate - getting user teams")
+		httpError(c, http.StatusInternalServerError)
+		return
+	}
+	if len(teams) == 0 {
+		logger.Debug().Str("username", getUsername(c)).Msg("authenticate - user doesn't belong to any team")
+		httpError(c, http.StatusForbidden)
+		return
+	}
+	team, ok := selectTeam(c, teams, defaultTeamID)
+	if !ok {
+		httpError(c, http.StatusForbidden)
+		return
+	}
+
+	logger.Debug().Str("setting team id in context keys", team.ID).Msg("authenticate")
+	c.Set("team_id", team.ID)
+	c.Set("teams", teams)
+	c.Next()
+}
+
+// getUserTeams returns the teams the user sending the request belongs to,
+// either explicitly or through the groups provided by the authenticator.
+// Users not belonging to any team get the authenticator's default team,
+// unless team membership is required. Requests authenticated with an API
+// token only have access to the token's team.
+func (ctl *controller) getUserTeams(c *gin.Context, defaultTeamID string) ([]*api.Team, error) {
+	if _, ok := auth.Scopes(c); !ok {
+		teams, err := ctl.api.GetUserTeams(getUsername(c), auth.Groups(c))
+		if err != nil || len(teams) > 0 || ctl.requireTeamMembership {
+			return teams, err
+		}
+	}
+	team, err := ctl.api.GetTeamByID(defaultTeamID)
+	if err != nil {
+		return nil, err
+	}
+	return []*api.Team{team}, nil
+}
+
+// selectTeam picks the team the request is made on behalf of: the one in the
+// X-Nebraska-Team header, if any, or the one picked by the user and stored in
+// the session. Otherwise the default team is used if the user belongs to it,
+// or the first of the user's teams.
+func selectTeam(c *gin.Context, teams []*api.Team, defaultTeamID string) (*api.Team, bool) {
+	find := func(teamID string) *api.Team {
+		for _, team := range teams {
+			if team.ID == teamID {
+				return team
+			}
+		}
+		return nil
+	}
+
+	if teamID := c.GetHeader(teamHeader); teamID != "" {
+		team := find(teamID)
+		return team, team != nil
+	}
+	if session := ginsessions.GetSession(c); session != nil {
+		if teamID, ok := session.Get("team_id").(string); ok {
+			if team := find(teamID); team != nil {
+				return team, true
+			}
+		}
+	}
+	if team := find(defaultTeamID); team != nil {
+		return team, true
+	}
+	return teams[0], true
+}
+
+// checkTeamOwnership is a middleware handler making sure that the resources
+// referenced by the route parameters belong to the team the request is made
+// on behalf of. Resources of other teams are reported as not found.
+func (ctl *controller) checkTeamOwnership(c *gin.Context) {
+	resources := &api.TeamResources{
+		AppID:      c.Param("app_id"),
+		GroupID:    c.Param("group_id"),
+		ChannelID:  c.Param("channel_id"),
+		PackageID:  c.Param("package_id"),
+		InstanceID: c.Param("instance_id"),
+	}
+	switch err := ctl.api.CheckTeamOwnership(c.GetString("team_id"), resources); err {
+	case nil:
+		c.Next()
+	case api.ErrNotInTeam:
+		httpError(c, http.StatusNotFound)
+	default:
+		logger.Error().Err(err).Msgf("checkTeamOwnership - checking resources %+v", resources)
+		httpError(c, http.StatusBadRequest)
+	}
+}
+
+// checkTeamMembership is a middleware handler making sure that the user
+// belongs to the team referenced by the team_id route parameter.
+func (ctl *controller) checkTeamMembership(c *gin.Context) {
+	if !isUserTeam(c, c.Param("team_id")) {
+		httpError(c, http.StatusNotFound)
+		return
+	}
+	c.Next()
+}
+
+func isUserTeam(c *gin.Context, teamID string) bool {
+	teams, _ := c.Get("teams")
+	userTeams, _ := teams.([]*api.Team)
+	for _, team := range userTeams {
+		if team.ID == teamID {
+			return true
+		}
+	}
+	return false
+}
+
+// ----------------------------------------------------------------------------
+// API: teams
+//
+
+func (ctl *controller) getTeams(c *gin.Context) {
+	teams, _ := c.Get("teams")
+	result := struct {
+		CurrentTeamID string      `json:"current_team_id"`
+		Teams         interface{} `json:"teams"`
+	}{c.GetString("team_id"), teams}
+	if err := json.NewEncoder(c.Writer).Encode(result); err != nil {
+		logger.Error().Err(err).Msg("getTeams - encoding teams")
+	}
+}
+
+func (ctl *controller) setCurrentTeam(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	params := struct {
+		TeamID string `json:"team_id"`
+	}{}
+	if err := json.NewDecoder(c.Request.Body).Decode(&params); err != nil {
+		logger.Error().Err(err).Msg("setCurrentTeam - decoding payload")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	if !isUserTeam(c, params.TeamID) {
+		httpError(c, http.StatusNotFound)
+		return
+	}
+
+	// Without sessions (noop authentication) the team has to be picked in
+	// every request using the X-Nebraska-Team header.
+	session := ginsessions.GetSession(c)
+	if session == nil {
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	session.Set("team_id", params.TeamID)
+	if err := ginsessions.SaveSession(c, session); err != nil {
+		logger.Error().Err(err).Msg("setCurrentTeam - saving session")
+		httpError(c, http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusNoContent)
+
+	logger.Info().Msgf("setCurrentTeam - successfully set current team to %q", params.TeamID)
+}
+
+func (ctl *controller) addTeam(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	team := &api.Team{}
+	if err := json.NewDecoder(c.Request.Body).Decode(team); err != nil {
+		logger.Error().Err(err).Msg("addTeam - decoding payload")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	team.ID = ""
+
+	team, err := ctl.api.AddTeam(team)
+	if err != nil {
+		logger.Error().Err(err).Msgf("addTeam - adding team %+v", team)
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	// The creator becomes a member of the new team, so it's not orphaned.
+	if username := getUsername(c); username != "" {
+		if err := ctl.api.AddTeamMember(team.ID, username); err != nil {
+			logger.Error().Err(err).Str("teamID", team.ID).Msg("addTeam - adding creator as member")
+			httpError(c, http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := json.NewEncoder(c.Writer).Encode(team); err != nil {
+		logger.Error().Err(err).Str("teamID", team.ID).Msg("addTeam - encoding team")
+	}
+
+	logger.Info().Msgf("addTeam - successfully added team %+v", team)
+}
+
+func (ctl *controller) getTeamMembers(c *gin.Context) {
+	teamID := c.Params.ByName("team_id")
+
+	members, err := ctl.api.GetTeamMembers(teamID)
+	if err != nil {
+		logger.Error().Err(err).Str("teamID", teamID).Msg("getTeamMembers - getting members")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	if members == nil {
+		members = []string{}
+	}
+	if err := json.NewEncoder(c.Writer).Encode(members); err != nil {
+		logger.Error().Err(err).Str("teamID", teamID).Msg("getTeamMembers - encoding members")
+	}
+}
+
+func (ctl *controller) addTeamMember(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	teamID := c.Params.ByName("team_id")
+	username := c.Params.ByName("username")
+
+	if err := ctl.api.AddTeamMember(teamID, username); err != nil {
+		logger.Error().Err(err).Str("teamID", teamID).Msgf("addTeamMember - adding member %q", username)
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	c.Status(http.StatusNoContent)
+
+	logger.Info().Msgf("addTeamMember - successfully added member %q to team %q", username, teamID)
+}
+
+func (ctl *controller) removeTeamMember(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	teamID := c.Params.ByName("team_id")
+	username := c.Params.ByName("username")
+
+	switch err := ctl.api.RemoveTeamMember(teamID, username); err {
+	case nil:
+		c.Status(http.StatusNoContent)
+	case api.ErrNoRowsAffected:
+		httpError(c, http.StatusNotFound)
+		return
+	default:
+		logger.Error().Err(err).Str("teamID", teamID).Msgf("removeTeamMember - removing member %q", username)
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+
+	logger.Info().Msgf("removeTeamMember - successfully removed member %q from team %q", username, teamID)
+}
+
+func (ctl *controller) getTeamOIDCGroups(c *gin.Context) {
+	teamID := c.Params.ByName("team_id")
+
+	groups, err := ctl.api.GetTeamOIDCGroups(teamID)
+	if err != nil {
+		logger.Error().Err(err).Str("teamID", teamID).Msg("getTeamOIDCGroups - getting oidc groups")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	if groups == nil {
+		groups = []string{}
+	}
+	if err := json.NewEncoder(c.Writer).Encode(groups); err != nil {
+		logger.Error().Err(err).Str("teamID", teamID).Msg("getTeamOIDCGroups - encoding oidc groups")
+	}
+}
+
+func (ctl *controller) addTeamOIDCGroup(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	teamID := c.Params.ByName("team_id")
+	group := c.Params.ByName("group")
+
+	if err := ctl.api.AddTeamOIDCGroup(teamID, group); err != nil {
+		logger.Error().Err(err).Str("teamID", teamID).Msgf("addTeamOIDCGroup - adding oidc group %q", group)
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	c.Status(http.StatusNoContent)
+
+	logger.Info().Msgf("addTeamOIDCGroup - successfully mapped oidc group %q to team %q", group, teamID)
+}
+
+func (ctl *controller) removeTeamOIDCGroup(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	teamID := c.Params.ByName("team_id")
+	group := c.Params.ByName("group")
+
+	switch err := ctl.api.RemoveTeamOIDCGroup(teamID, group); err {
+	case nil:
+		c.Status(http.StatusNoContent)
+	case api.ErrNoRowsAffected:
+		httpError(c, http.StatusNotFound)
+		return
+	default:
+		logger.Error().Err(err).Str("teamID", teamID).Msgf("removeTeamOIDCGroup - removing oidc group %q", group)
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+
+	logger.Info().Msgf("removeTeamOIDCGroup - successfully unmapped oidc group %q from team %q", group, teamID)
+}
+
+// ----------------------------------------------------------------------------
+// API: tokens
+//
+
+func (ctl *controller) addAPIToken(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	// Tokens can't create other tokens, which would outlive them.
+	if _, ok := auth.Scopes(c); ok {
+		httpError(c, http.StatusForbidden)
+		return
+	}
+
+	token := &api.APIToken{}
+	if err := json.NewDecoder(c.Request.Body).Decode(token); err != nil {
+		logger.Error().Err(err).Msg("addAPIToken - decoding payload")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	token.TeamID = c.GetString("team_id")
+	token.CreatedBy = getUsername(c)
+
+	permissions, err := ctl.userPermissions(c, token.TeamID)
+	if err != nil {
+		logger.Error().Err(err).Msg("addAPIToken - getting user permissions")
+		httpError(c, http.StatusInternalServerError)
+		return
+	}
+	switch token.Kind {
+	case api.APITokenKindPersonal:
+		// Personal tokens can only be created for oneself.
+		token.Owner = token.CreatedBy
+		if token.Owner == "" {
+			httpError(c, http.StatusBadRequest)
+			return
+		}
+	case api.APITokenKindServiceAccount:
+		if !permissions.Allows(api.PermissionTokensManage, "") {
+			httpError(c, http.StatusForbidden)
+			return
+		}
+	}
+	// Tokens can't be granted permissions their creator doesn't have.
+	for _, scope := range token.Scopes {
+		if !permissions.Includes(scope) {
+			logger.Debug().Str("scope", scope).Msg("addAPIToken - scope not granted to creator")
+			httpError(c, http.StatusForbidden)
+			return
+		}
+	}
+
+	secret, err := ctl.api.AddAPIToken(token)
+	if err != nil {
+		logger.Error().Err(err).Msgf("addAPIToken - adding token %+v", token)
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	result := struct {
+		*api.APIToken
+		Token string `json:"token"`
+	}{token, secret}
+	if err := json.NewEncoder(c.Writer).Encode(result); err != nil {
+		logger.Error().Err(err).Str("tokenID", token.ID).Msg("addAPIToken - encoding token")
+	}
+
+	logger.Info().Msgf("addAPIToken - successfully added %s token %q (%s) for %q with scopes %v", token.Kind, token.Name, token.ID, token.Owner, token.Scopes)
+}
+
+func (ctl *controller) revokeAPIToken(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	teamID := c.GetString("team_id")
+	tokenID := c.Params.ByName("token_id")
+
+	token, err := ctl.api.GetAPIToken(teamID, tokenID)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		httpError(c, http.StatusNotFound)
+		return
+	default:
+		logger.Error().Err(err).Str("tokenID", tokenID).Msg("revokeAPIToken - getting token")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	if !ctl.isOwnAPIToken(c, token) {
+		permissions, err := ctl.userPermissions(c, teamID)
+		if err != nil {
+			logger.Error().Err(err).Msg("revokeAPIToken - getting user permissions")
+			httpError(c, http.StatusInternalServerError)
+			return
+		}
+		if !permissions.Allows(api.PermissionTokensManage, "") {
+			httpError(c, http.StatusForbidden)
+			return
+		}
+	}
+
+	switch err := ctl.api.RevokeAPIToken(teamID, tokenID); err {
+	case nil:
+		c.Status(http.StatusNoContent)
+	case api.ErrNoRowsAffected:
+		httpError(c, http.StatusNotFound)
+		return
+	default:
+		logger.Error().Err(err).Str("tokenID", tokenID).Msg("revokeAPIToken")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+
+	logger.Info().Msgf("revokeAPIToken - successfully revoked token %q (%s)", token.Name, tokenID)
+}
+
+func (ctl *controller) getAPITokens(c *gin.Context) {
+	teamID := c.GetString("team_id")
+
+	permissions, err := ctl.userPermissions(c, teamID)
+	if err != nil {
+		logger.Error().Err(err).Msg("getAPITokens - getting user permissions")
+		httpError(c, http.StatusInternalServerError)
+		return
+	}
+	// Users not allowed to see all the team's tokens get their own ones.
+	var tokens []*api.APIToken
+	if permissions.Allows(api.PermissionTokensRead, "") {
+		tokens, err = ctl.api.GetAPITokens(teamID, "")
+	} else if username := getUsername(c); username != "" {
+		tokens, err = ctl.api.GetAPITokens(teamID, username)
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("getAPITokens - getting tokens")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	if tokens == nil {
+		tokens = []*api.APIToken{}
+	}
+	if err := json.NewEncoder(c.Writer).Encode(tokens); err != nil {
+		logger.Error().Err(err).Msg("getAPITokens - encoding tokens")
+	}
+}
+
+func (ctl *controller) isOwnAPIToken(c *gin.Context, token *api.APIToken) bool {
+	return token.Kind == api.APITokenKindPersonal && token.Owner == getUsername(c)
+}
+
+// ----------------------------------------------------------------------------
+// API: roles
+//
+
+func (ctl *controller) getPermissions(c *gin.Context) {
+	if err := json.NewEncoder(c.Writer).Encode(api.Permissions); err != nil {
+		logger.Error().Err(err).Msg("getPermissions - encoding permissions")
+	}
+}
+
+func (ctl *controller) addRole(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	role := &api.Role{}
+	if err := json.NewDecoder(c.Request.Body).Decode(role); err != nil {
+		logger.Error().Err(err).Msg("addRole - decoding payload")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	role.TeamID = c.GetString("team_id")
+
+	_, err := ctl.api.AddRole(role)
+	if err != nil {
+		logger.Error().Err(err).Msgf("addRole - adding role %+v", role)
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+
+	roleID := role.ID
+	role, err = ctl.api.GetRole(role.TeamID, roleID)
+	if err != nil {
+		logger.Error().Err(err).Str("roleID", roleID).Msg("addRole - getting added role")
+		httpError(c, http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewEncoder(c.Writer).Encode(role); err != nil {
+		logger.Error().Err(err).Str("roleID", role.ID).Msg("addRole - encoding role")
+	}
+
+	logger.Info().Msgf("addRole - successfully added role %+v", role)
+}
+
+func (ctl *controller) updateRole(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	role := &api.Role{}
+	if err := json.NewDecoder(c.Request.Body).Decode(role); err != nil {
+		logger.Error().Err(err).Msg("updateRole - decoding payload")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	roleID := c.Params.ByName("role_id")
+	role.ID = roleID
+	role.TeamID = c.GetString("team_id")
+
+	switch err := ctl.api.UpdateRole(role); err {
+	case nil:
+	case api.ErrNoRowsAffected:
+		httpError(c, http.StatusNotFound)
+		return
+	default:
+		logger.Error().Err(err).Msgf("updateRole - updating role %+v", role)
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+
+	role, err := ctl.api.GetRole(role.TeamID, roleID)
+	if err != nil {
+		logger.Error().Err(err).Str("roleID", roleID).Msg("updateRole - getting role updated")
+		httpError(c, http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewEncoder(c.Writer).Encode(role); err != nil {
+		logger.Error().Err(err).Str("roleID", role.ID).Msg("updateRole - encoding role")
+	}
+
+	logger.Info().Msgf("updateRole - successfully updated role %+v", role)
+}
+
+func (ctl *controller) deleteRole(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	roleID := c.Params.ByName("role_id")
+
+	switch err := ctl.api.DeleteRole(c.GetString("team_id"), roleID); err {
+	case nil:
+		c.Status(http.StatusNoContent)
+	case api.ErrNoRowsAffected:
+		httpError(c, http.StatusNotFound)
+		return
+	default:
+		logger.Error().Err(err).Str("roleID", roleID).Msg("deleteRole")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+
+	logger.Info().Msgf("deleteRole - successfully deleted role %q", roleID)
+}
+
+func (ctl *controller) getRole(c *gin.Context) {
+	roleID := c.Params.ByName("role_id")
+
+	role, err := ctl.api.GetRole(c.GetString("team_id"), roleID)
+	switch err {
+	case nil:
+		if err := json.NewEncoder(c.Writer).Encode(role); err != nil {
+			logger.Error().Err(err).Str("roleID", roleID).Msg("getRole - encoding role")
+		}
+	case sql.ErrNoRows:
+		httpError(c, http.StatusNotFound)
+	default:
+		logger.Error().Err(err).Str("roleID", roleID).Msg("getRole - getting role")
+		httpError(c, http.StatusBadRequest)
+	}
+}
+
+func (ctl *controller) getRoles(c *gin.Context) {
+	roles, err := ctl.api.GetRoles(c.GetString("team_id"))
+	if err != nil {
+		logger.Error().Err(err).Msg("getRoles - getting roles")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	if roles == nil {
+		roles = []*api.Role{}
+	}
+	if err := json.NewEncoder(c.Writer).Encode(roles); err != nil {
+		logger.Error().Err(err).Msg("getRoles - encoding roles")
+	}
+}
+
+func (ctl *controller) addRoleBinding(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	binding := &api.RoleBinding{}
+	if err := json.NewDecoder(c.Request.Body).Decode(binding); err != nil {
+		logger.Error().Err(err).Msg("addRoleBinding - decoding payload")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+
+	_, err := ctl.api.AddRoleBinding(c.GetString("team_id"), binding)
+	if err != nil {
+		logger.Error().Err(err).Msgf("addRoleBinding - adding role binding %+v", binding)
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	if err := json.NewEncoder(c.Writer).Encode(binding); err != nil {
+		logger.Error().Err(err).Str("bindingID", binding.ID).Msg("addRoleBinding - encoding role binding")
+	}
+
+	logger.Info().Msgf("addRoleBinding - successfully added role binding %+v", binding)
+}
+
+func (ctl *controller) deleteRoleBinding(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	bindingID := c.Params.ByName("binding_id")
+
+	switch err := ctl.api.DeleteRoleBinding(c.GetString("team_id"), bindingID); err {
+	case nil:
+		c.Status(http.StatusNoContent)
+	case api.ErrNoRowsAffected:
+		httpError(c, http.StatusNotFound)
+		return
+	default:
+		logger.Error().Err(err).Str("bindingID", bindingID).Msg("deleteRoleBinding")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
 
-// ----------------------------------------------------------------------------
-// Authentication
-//
+	logger.Info().Msgf("deleteRoleBinding - successfully deleted role binding %q", bindingID)
+}
 
-// authenticate is a middleware handler in charge of authenticating requests.
-func (ctl *controller) authenticate(c *gin.Context) {
-	teamID, replied := ctl.auth.Authenticate(c)
-	if replied {
+func (ctl *controller) getRoleBindings(c *gin.Context) {
+	bindings, err := ctl.api.GetRoleBindings(c.GetString("team_id"))
+	if err != nil {
+		logger.Error().Err(err).Msg("getRoleBindings - getting role bindings")
+		httpError(c, http.StatusBadRequest)
 		return
 	}
-	logger.Debug().Str("setting team id in context keys", teamID).Msg("authenticate")
-	c.Set("team_id", teamID)
-	c.Next()
+	if bindings == nil {
+		bindings = []*api.RoleBinding{}
+	}
+	if err := json.NewEncoder(c.Writer).Encode(bindings); err != nil {
+		logger.Error().Err(err).Msg("getRoleBindings - encoding role bindings")
+	}
 }
 
 // ----------------------------------------------------------------------------
@@ -191,6 +893,35 @@ func (ctl *controller) authenticate(c *gin.Context) {
 //
 
 func (ctl *controller) updateUserPassword(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	var payload struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&payload); err != nil {
+		logger.Error().Err(err).Msg("updateUserPassword - decoding payload")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+
+	username := getUsername(c)
+	if _, err := ctl.api.AuthenticateUser(username, payload.CurrentPassword); err != nil {
+		if err != api.ErrInvalidCredentials {
+			logger.Error().Err(err).Msg("updateUserPassword - checking current password")
+			httpError(c, http.StatusInternalServerError)
+		} else {
+			httpError(c, http.StatusForbidden)
+		}
+		return
+	}
+
+	if err := ctl.api.UpdateUserPassword(username, payload.NewPassword); err != nil {
+		logger.Error().Err(err).Msg("updateUserPassword - updating password")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	c.Status(http.StatusNoContent)
 }
 
 // ----------------------------------------------------------------------------
@@ -210,6 +941,14 @@ func (ctl *controller) addApp(c *gin.Context) {
 	}
 	app.TeamID = c.GetString("team_id")
 
+	if sourceAppID != "" {
+		if err := ctl.api.CheckTeamOwnership(app.TeamID, &api.TeamResources{AppID: sourceAppID}); err != nil {
+			logger.Error().Err(err).Str("sourceAppID", sourceAppID).Msg("addApp - checking app to clone")
+			httpError(c, http.StatusBadRequest)
+			return
+		}
+	}
+
 	_, err := ctl.api.AddAppCloning(app, sourceAppID)
 	if err != nil {
 		logger.Error().Err(err).Str("sourceAppID", sourceAppID).Msgf("addApp - cloning app %v", app)
@@ -821,6 +1560,93 @@ func (ctl *controller) getPackages(c *gin.Context) {
 	}
 }
 
+// ----------------------------------------------------------------------------
+// API: package mirrors CRUD
+//
+
+func (ctl *controller) addPackageMirror(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	mirror := &api.PackageMirror{}
+	if err := json.NewDecoder(c.Request.Body).Decode(mirror); err != nil {
+		logger.Error().Err(err).Msg("addPackageMirror - decoding payload")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	mirror.PackageID = c.Params.ByName("package_id")
+
+	if _, err := ctl.api.AddPackageMirror(mirror); err != nil {
+		logger.Error().Err(err).Msgf("addPackageMirror - adding package mirror %+v", mirror)
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	if err := json.NewEncoder(c.Writer).Encode(mirror); err != nil {
+		logger.Error().Err(err).Str("mirrorID", mirror.ID).Msg("addPackageMirror - encoding package mirror")
+	}
+
+	logger.Info().Msgf("addPackageMirror - successfully added package mirror %+v", mirror)
+}
+
+func (ctl *controller) updatePackageMirror(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	mirror := &api.PackageMirror{}
+	if err := json.NewDecoder(c.Request.Body).Decode(mirror); err != nil {
+		logger.Error().Err(err).Msg("updatePackageMirror - decoding payload")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	mirror.ID = c.Params.ByName("mirror_id")
+	mirror.PackageID = c.Params.ByName("package_id")
+
+	err := ctl.api.UpdatePackageMirror(mirror)
+	switch err {
+	case nil:
+		if err := json.NewEncoder(c.Writer).Encode(mirror); err != nil {
+			logger.Error().Err(err).Str("mirrorID", mirror.ID).Msg("updatePackageMirror - encoding package mirror")
+		}
+		logger.Info().Msgf("updatePackageMirror - successfully updated package mirror %+v", mirror)
+	case sql.ErrNoRows:
+		httpError(c, http.StatusNotFound)
+	default:
+		logger.Error().Err(err).Msgf("updatePackageMirror - updating package mirror %+v", mirror)
+		httpError(c, http.StatusBadRequest)
+	}
+}
+
+func (ctl *controller) deletePackageMirror(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	packageID := c.Params.ByName("package_id")
+	mirrorID := c.Params.ByName("mirror_id")
+
+	err := ctl.api.DeletePackageMirror(packageID, mirrorID)
+	switch err {
+	case nil:
+		c.Status(http.StatusNoContent)
+		logger.Info().Str("packageID", packageID).Msgf("deletePackageMirror - successfully deleted package mirror %s", mirrorID)
+	case api.ErrNoRowsAffected:
+		httpError(c, http.StatusNotFound)
+	default:
+		logger.Error().Err(err).Str("packageID", packageID).Str("mirrorID", mirrorID).Msg("deletePackageMirror")
+		httpError(c, http.StatusBadRequest)
+	}
+}
+
+func (ctl *controller) getPackageMirrors(c *gin.Context) {
+	packageID := c.Params.ByName("package_id")
+
+	mirrors, err := ctl.api.GetPackageMirrors(packageID)
+	if err != nil {
+		logger.Error().Err(err).Str("packageID", packageID).Msg("getPackageMirrors - getting package mirrors")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	if err := json.NewEncoder(c.Writer).Encode(mirrors); err != nil {
+		logger.Error().Err(err).Str("packageID", packageID).Msg("getPackageMirrors - encoding package mirrors")
+	}
+}
+
 // ----------------------------------------------------------------------------
 // API: instances
 //
@@ -936,6 +1762,72 @@ func (ctl *controller) updateInstance(c *gin.Context) {
 	logger.Info().Msgf("updateInstance - successfully updated instance %q alias to %q", instanceID, instance.Alias)
 }
 
+func (ctl *controller) getInstanceOverride(c *gin.Context) {
+	appID := c.Params.ByName("app_id")
+	instanceID := c.Params.ByName("instance_id")
+
+	override, err := ctl.api.GetInstanceOverride(instanceID, appID)
+	switch err {
+	case nil:
+		if err := json.NewEncoder(c.Writer).Encode(override); err != nil {
+			logger.Error().Err(err).Str("appID", appID).Str("instanceID", instanceID).Msg("getInstanceOverride - encoding instance override")
+		}
+	case sql.ErrNoRows:
+		httpError(c, http.StatusNotFound)
+	default:
+		logger.Error().Err(err).Str("appID", appID).Str("instanceID", instanceID).Msg("getInstanceOverride - getting instance override")
+		httpError(c, http.StatusBadRequest)
+	}
+}
+
+func (ctl *controller) setInstanceOverride(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	override := &api.InstanceOverride{}
+	if err := json.NewDecoder(c.Request.Body).Decode(override); err != nil {
+		logger.Error().Err(err).Msg("setInstanceOverride - decoding payload")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	override.ApplicationID = c.Params.ByName("app_id")
+	override.InstanceID = c.Params.ByName("instance_id")
+
+	result, err := ctl.api.SetInstanceOverride(override)
+	if err != nil {
+		logger.Error().Err(err).Msgf("setInstanceOverride - setting instance override %+v", override)
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+
+	if err := json.NewEncoder(c.Writer).Encode(result); err != nil {
+		logger.Error().Err(err).Str("instanceID", result.InstanceID).Msg("setInstanceOverride - encoding instance override")
+	}
+
+	logger.Info().Msgf("setInstanceOverride - successfully set instance override %+v", result)
+}
+
+func (ctl *controller) deleteInstanceOverride(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	appID := c.Params.ByName("app_id")
+	instanceID := c.Params.ByName("instance_id")
+
+	err := ctl.api.DeleteInstanceOverride(instanceID, appID)
+	switch err {
+	case nil:
+		c.Status(http.StatusNoContent)
+	case api.ErrNoRowsAffected:
+		httpError(c, http.StatusNotFound)
+		return
+	default:
+		logger.Error().Err(err).Str("appID", appID).Str("instanceID", instanceID).Msg("deleteInstanceOverride")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+
+	logger.Info().Msgf("deleteInstanceOverride - successfully deleted override of instance %q", instanceID)
+}
+
 // ----------------------------------------------------------------------------
 // API: activity
 //
@@ -970,14 +1862,202 @@ func (ctl *controller) getActivity(c *gin.Context) {
 	}
 }
 
+// ----------------------------------------------------------------------------
+// API: audit log
+//
+
+func (ctl *controller) getAuditEntries(c *gin.Context) {
+	teamID := c.GetString("team_id")
+
+	p := api.AuditQueryParams{
+		Actor:      c.Query("actor"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		AppID:      c.Query("app"),
+		RequestID:  c.Query("request_id"),
+	}
+	p.Start, _ = time.Parse(time.RFC3339, c.Query("start"))
+	p.End, _ = time.Parse(time.RFC3339, c.Query("end"))
+	p.Page, _ = strconv.ParseUint(c.Query("page"), 10, 64)
+	p.PerPage, _ = strconv.ParseUint(c.Query("perpage"), 10, 64)
+
+	result, err := ctl.api.GetAuditEntries(teamID, p)
+	if err != nil {
+		logger.Error().Err(err).Str("teamID", teamID).Msgf("getAuditEntries params %v", p)
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	if err := json.NewEncoder(c.Writer).Encode(result); err != nil {
+		logger.Error().Err(err).Msgf("getAuditEntries - encoding audit entries params %v", p)
+	}
+}
+
+// ----------------------------------------------------------------------------
+// API: syncer
+//
+
+func (ctl *controller) getSyncerStatus(c *gin.Context) {
+	teamID := c.GetString("team_id")
+
+	states, err := ctl.api.GetSyncerStates(teamID)
+	if err != nil {
+		logger.Error().Err(err).Str("teamID", teamID).Msg("getSyncerStatus - getting syncer states")
+		httpError(c, http.StatusInternalServerError)
+		return
+	}
+	status := struct {
+		Enabled  bool               `json:"enabled"`
+		Syncing  bool               `json:"syncing"`
+		Channels []*api.SyncerState `json:"channels"`
+	}{
+		Enabled:  ctl.syncer != nil,
+		Syncing:  ctl.syncer != nil && ctl.syncer.Syncing(),
+		Channels: states,
+	}
+	if err := json.NewEncoder(c.Writer).Encode(status); err != nil {
+		logger.Error().Err(err).Msg("getSyncerStatus - encoding syncer status")
+	}
+}
+
+func (ctl *controller) syncNow(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	if ctl.syncer == nil {
+		httpError(c, http.StatusConflict)
+		return
+	}
+	if ctl.syncer.SyncNow() {
+		logger.Info().Msg("syncNow - sync requested")
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// ----------------------------------------------------------------------------
+// API: declarative configuration
+//
+
+// configReadPermissions are the permissions needed on an application to
+// export its configuration.
+var configReadPermissions = []string{
+	api.PermissionAppsRead,
+	api.PermissionPackagesRead,
+	api.PermissionChannelsRead,
+	api.PermissionGroupsRead,
+}
+
+// errConfigChangeForbidden is returned when authorizing a change to apply a
+// configuration the user isn't allowed to make.
+var errConfigChangeForbidden = errors.New("configuration change not allowed")
+
+func (ctl *controller) exportConfig(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+	teamID := c.GetString("team_id")
+
+	permissions, err := ctl.userPermissions(c, teamID)
+	if err != nil {
+		logger.Error().Err(err).Msg("exportConfig - getting user permissions")
+		httpError(c, http.StatusInternalServerError)
+		return
+	}
+	config, err := declarative.Export(ctl.api, teamID, c.QueryArray("app_id")...)
+	if err != nil {
+		logger.Error().Err(err).Msg("exportConfig - exporting configuration")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	readable := config.Applications[:0]
+	for _, app := range config.Applications {
+		allowed := true
+		for _, permission := range configReadPermissions {
+			allowed = allowed && permissions.Allows(permission, app.ID)
+		}
+		if allowed {
+			readable = append(readable, app)
+		}
+	}
+	config.Applications = readable
+
+	if c.Query("format") == "json" {
+		if err := json.NewEncoder(c.Writer).Encode(config); err != nil {
+			logger.Error().Err(err).Msg("exportConfig - encoding configuration")
+		}
+		return
+	}
+	c.Header("Content-Type", "application/x-yaml")
+	if err := declarative.Write(c.Writer, config); err != nil {
+		logger.Error().Err(err).Msg("exportConfig - encoding configuration")
+	}
+}
+
+func (ctl *controller) applyConfig(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+	teamID := c.GetString("team_id")
+	dryRun := c.Query("dry_run") == "true"
+
+	config, err := declarative.Read(c.Request.Body)
+	if err != nil {
+		logger.Error().Err(err).Msg("applyConfig - decoding configuration")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+
+	permissions, err := ctl.userPermissions(c, teamID)
+	if err != nil {
+		logger.Error().Err(err).Msg("applyConfig - getting user permissions")
+		httpError(c, http.StatusInternalServerError)
+		return
+	}
+	// No change is made unless the user is allowed to make all of them.
+	authorize := func(change *declarative.Change) error {
+		if !permissions.Allows(change.Permission(), change.ApplicationID) {
+			logger.Debug().Str("change", change.String()).Msg("applyConfig - permission denied")
+			return errConfigChangeForbidden
+		}
+		return nil
+	}
+	changes, err := declarative.Apply(ctl.api, teamID, config, dryRun, authorize)
+	switch {
+	case errors.Is(err, errConfigChangeForbidden):
+		httpError(c, http.StatusForbidden)
+		return
+	case err != nil:
+		logger.Error().Err(err).Msg("applyConfig - applying configuration")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	if changes == nil {
+		changes = []*declarative.Change{}
+	}
+	result := struct {
+		DryRun  bool                  `json:"dry_run"`
+		Changes []*declarative.Change `json:"changes"`
+	}{dryRun, changes}
+	if err := json.NewEncoder(c.Writer).Encode(result); err != nil {
+		logger.Error().Err(err).Msg("applyConfig - encoding changes")
+	}
+}
+
 // ----------------------------------------------------------------------------
 // OMAHA server
 //
 
 func (ctl *controller) processOmahaRequest(c *gin.Context) {
-	c.Writer.Header().Set("Content-Type", "text/xml")
+	// Requests are processed as XML unless they were sent using the JSON
+	// flavour of the protocol, in which case the response is JSON too.
+	handle := ctl.omahaHandler.Handle
+	if c.ContentType() == gin.MIMEJSON {
+		handle = ctl.omahaHandler.HandleJSON
+		c.Writer.Header().Set("Content-Type", gin.MIMEJSON)
+	} else {
+		c.Writer.Header().Set("Content-Type", "text/xml")
+	}
 	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, UpdateMaxRequestSize)
-	if err := ctl.omahaHandler.Handle(c.Request.Body, c.Writer, getRequestIP(c.Request)); err != nil {
+	if cup2key := c.Query(omaha.CUPKeyParam); cup2key != "" && ctl.cupSigner != nil {
+		ctl.processSignedOmahaRequest(c, handle, cup2key)
+		return
+	}
+	if err := handle(c.Request.Body, c.Writer, getRequestIP(c.Request)); err != nil {
 		logger.Error().Err(err).Msg("process omaha request")
 		if uerr := errors.Unwrap(err); uerr != nil && uerr.Error() == "http: request body too large" {
 			httpError(c, http.StatusBadRequest)
@@ -985,6 +2065,65 @@ func (ctl *controller) processOmahaRequest(c *gin.Context) {
 	}
 }
 
+// processSignedOmahaRequest processes an Omaha request asking for its response
+// to be signed using the Client Update Protocol, returning the signature in
+// the omaha.CUPServerProofHeader header.
+func (ctl *controller) processSignedOmahaRequest(c *gin.Context, handle func(io.Reader, io.Writer, string) error, cup2key string) {
+	request, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		logger.Error().Err(err).Msg("processSignedOmahaRequest - reading request")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	// Requests whose response can't be signed are rejected before being
+	// processed, so they don't register any event or instance.
+	cup2hreq := c.Query(omaha.CUPRequestHashParam)
+	if err := ctl.cupSigner.Validate(cup2key, cup2hreq, request); err != nil {
+		logger.Warn().Err(err).Str("cup2key", cup2key).Msg("processSignedOmahaRequest - validating request")
+		httpError(c, http.StatusBadRequest)
+		return
+	}
+	var response bytes.Buffer
+	if err := handle(bytes.NewReader(request), &response, getRequestIP(c.Request)); err != nil {
+		logger.Error().Err(err).Msg("process omaha request")
+		if errors.Is(err, omaha.ErrMalformedResponse) {
+			httpError(c, http.StatusInternalServerError)
+		} else {
+			httpError(c, http.StatusBadRequest)
+		}
+		return
+	}
+	proof, err := ctl.cupSigner.Sign(cup2key, cup2hreq, request, response.Bytes())
+	if err != nil {
+		logger.Error().Err(err).Str("cup2key", cup2key).Msg("processSignedOmahaRequest - signing response")
+		httpError(c, http.StatusInternalServerError)
+		return
+	}
+	c.Writer.Header().Set(omaha.CUPServerProofHeader, proof)
+	// Proxies must not alter signed responses.
+	c.Writer.Header().Set("Cache-Control", "no-transform")
+	if _, err := c.Writer.Write(response.Bytes()); err != nil {
+		logger.Error().Err(err).Msg("processSignedOmahaRequest - writing response")
+	}
+}
+
+// ----------------------------------------------------------------------------
+// Hosted packages payloads
+//
+
+// redirectToPackagePayload redirects clients to the url the package payload
+// requested can be downloaded from in the package store (e.g. a presigned S3
+// url).
+func (ctl *controller) redirectToPackagePayload(c *gin.Context) {
+	payloadURL, err := ctl.packageStore.URL(c.Param("filename"))
+	if err != nil {
+		logger.Error().Err(err).Str("filename", c.Param("filename")).Msg("redirectToPackagePayload - getting payload url")
+		httpError(c, http.StatusNotFound)
+		return
+	}
+	c.Redirect(http.StatusFound, payloadURL)
+}
+
 // ----------------------------------------------------------------------------
 // Helpers
 //
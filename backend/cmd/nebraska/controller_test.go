@@ -2,9 +2,15 @@ package main
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -13,6 +19,7 @@ import (
 
 	"github.com/kinvolk/nebraska/backend/cmd/nebraska/auth"
 	"github.com/kinvolk/nebraska/backend/pkg/api"
+	"github.com/kinvolk/nebraska/backend/pkg/omaha"
 )
 
 func TestGetRequestIP(t *testing.T) {
@@ -85,6 +92,34 @@ func TestClientConfig(t *testing.T) {
 	assert.NotEmpty(t, ctl.clientConfig.NebraskaVersion)
 }
 
+func TestRoutePermissions(t *testing.T) {
+	conf := &controllerConfig{
+		noopAuthConfig: &auth.NoopAuthConfig{},
+	}
+	ctl, err := newController(conf)
+	require.NoError(t, err)
+
+	apiRoutes := map[string]bool{}
+	for _, route := range setupRoutes(ctl, false).Routes() {
+		if strings.HasPrefix(route.Path, "/api/") {
+			apiRoutes[route.Method+" "+route.Path] = true
+		}
+	}
+	for route := range apiRoutes {
+		assert.Contains(t, routePermissions, route, "API routes must have a permission defined")
+	}
+	for route := range routePermissions {
+		assert.Contains(t, apiRoutes, route, "Permissions must be defined for existing routes only")
+	}
+}
+
+func TestAccessLevelPermissions(t *testing.T) {
+	assert.True(t, accessLevelPermissions(auth.AccessLevelAdmin).Allows(api.PermissionGroupsDelete, ""))
+	assert.True(t, accessLevelPermissions(auth.AccessLevelViewer).Allows(api.PermissionGroupsRead, "app"))
+	assert.False(t, accessLevelPermissions(auth.AccessLevelViewer).Allows(api.PermissionGroupsDelete, "app"))
+	assert.False(t, accessLevelPermissions("").Allows(api.PermissionGroupsRead, ""))
+}
+
 func TestOmahaRequestSizeLimitation(t *testing.T) {
 	type testCase struct {
 		bodyLength int
@@ -139,3 +174,90 @@ func TestOmahaRequestSizeLimitation(t *testing.T) {
 		assert.Equal(t, tc.status, w.Code)
 	}
 }
+
+func TestSignedOmahaRequest(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := omaha.NewCUPSigner(map[int]*ecdsa.PrivateKey{1: key})
+	require.NoError(t, err)
+	ctl := &controller{cupSigner: signer}
+	gin.SetMode(gin.TestMode)
+
+	var (
+		handled   bool
+		handleErr error
+	)
+	handle := func(r io.Reader, w io.Writer, ip string) error {
+		handled = true
+		if handleErr != nil {
+			return handleErr
+		}
+		_, err := w.Write([]byte(`<response protocol="3.0"></response>`))
+		return err
+	}
+	process := func(query string) *httptest.ResponseRecorder {
+		handled = false
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/v1/update?"+query, strings.NewReader(`<request protocol="3.0"></request>`))
+		ctl.processSignedOmahaRequest(c, handle, c.Query(omaha.CUPKeyParam))
+		return w
+	}
+
+	w := process("cup2key=1:c3VwZXJzZWNyZXRub25jZQ")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, handled)
+	assert.NotEmpty(t, w.Header().Get(omaha.CUPServerProofHeader))
+
+	// Requests whose response can't be signed aren't processed.
+	for _, query := range []string{"cup2key=2:c3VwZXJzZWNyZXRub25jZQ", "cup2key=1:short", "cup2key=1:c3VwZXJzZWNyZXRub25jZQ&cup2hreq=00"} {
+		w = process(query)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		assert.False(t, handled, query)
+		assert.Empty(t, w.Header().Get(omaha.CUPServerProofHeader), query)
+	}
+
+	// Processing errors aren't replied to with an empty response.
+	handleErr = omaha.ErrMalformedResponse
+	w = process("cup2key=1:c3VwZXJzZWNyZXRub25jZQ")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	handleErr = errors.New("omaha: request is malformed: EOF")
+	w = process("cup2key=1:c3VwZXJzZWNyZXRub25jZQ")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, w.Header().Get(omaha.CUPServerProofHeader))
+}
+
+func TestAuditTarget(t *testing.T) {
+	testCases := []struct {
+		method     string
+		route      string
+		path       string
+		targetType string
+		targetID   string
+	}{
+		{"POST", "/api/apps", "/api/apps", "apps", ""},
+		{"PUT", "/api/apps/:app_id", "/api/apps/app1", "apps", "app1"},
+		{"POST", "/api/apps/:app_id/channels", "/api/apps/app1/channels", "channels", ""},
+		{"DELETE", "/api/apps/:app_id/channels/:channel_id", "/api/apps/app1/channels/channel1", "channels", "channel1"},
+		{"PUT", "/api/apps/:app_id/instances/:instance_id/override", "/api/apps/app1/instances/instance1/override", "override", "instance1"},
+		{"PUT", "/api/current_team", "/api/current_team", "current_team", ""},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tc := range testCases {
+		var targetType, targetID string
+		engine := gin.New()
+		engine.Handle(tc.method, tc.route, func(c *gin.Context) {
+			targetType, targetID = auditTarget(c)
+		})
+		engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tc.method, tc.path, nil))
+		assert.Equal(t, tc.targetType, targetType, tc.route)
+		assert.Equal(t, tc.targetID, targetID, tc.route)
+	}
+}
+
+func TestAuditData(t *testing.T) {
+	assert.Equal(t, api.AuditData{"id": "token1", "name": "ci"}, auditData([]byte(`{"id": "token1", "name": "ci", "token": "nbr_secret"}`)))
+	assert.Nil(t, auditData([]byte(`["not", "an", "object"]`)))
+	assert.Nil(t, auditData(nil))
+}
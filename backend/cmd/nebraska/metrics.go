@@ -6,6 +6,9 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+	"github.com/kinvolk/nebraska/backend/pkg/syncer"
 )
 
 const (
@@ -48,7 +51,11 @@ func registerNebraskaMetrics() error {
 	if err != nil {
 		return err
 	}
-	return nil
+	err = api.RegisterCheckinMetrics()
+	if err != nil {
+		return err
+	}
+	return syncer.RegisterMetrics()
 }
 
 // getMetricsRefreshInterval returns the metrics update Interval key is set in the environment as time.Duration,
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/Depado/ginprom"
@@ -24,31 +28,52 @@ import (
 
 	"github.com/kinvolk/nebraska/backend/cmd/nebraska/auth"
 	"github.com/kinvolk/nebraska/backend/pkg/api"
+	"github.com/kinvolk/nebraska/backend/pkg/notify"
+	"github.com/kinvolk/nebraska/backend/pkg/omaha"
 	"github.com/kinvolk/nebraska/backend/pkg/random"
+	"github.com/kinvolk/nebraska/backend/pkg/storage"
+	"github.com/kinvolk/nebraska/backend/pkg/syncer"
 	"github.com/kinvolk/nebraska/backend/pkg/util"
 )
 
 const (
-	ghClientIDEnvName          = "NEBRASKA_GITHUB_OAUTH_CLIENT_ID"
-	ghClientSecretEnvName      = "NEBRASKA_GITHUB_OAUTH_CLIENT_SECRET"
-	ghSessionAuthKeyEnvName    = "NEBRASKA_GITHUB_SESSION_SECRET"
-	ghSessionCryptKeyEnvName   = "NEBRASKA_GITHUB_SESSION_CRYPT_KEY"
-	ghWebhookSecretEnvName     = "NEBRASKA_GITHUB_WEBHOOK_SECRET"
-	ghEnterpriseURLEnvName     = "NEBRASKA_GITHUB_ENTERPRISE_URL"
-	oidcClientIDEnvName        = "NEBRASKA_OIDC_CLIENT_ID"
-	oidcClientSecretEnvName    = "NEBRASKA_OIDC_CLIENT_SECRET"
-	oidcSessionAuthKeyEnvName  = "NEBRASKA_OIDC_SESSION_SECRET"
-	oidcSessionCryptKeyEnvName = "NEBRASKA_OIDC_SESSION_CRYPT_KEY"
+	ghClientIDEnvName           = "NEBRASKA_GITHUB_OAUTH_CLIENT_ID"
+	ghClientSecretEnvName       = "NEBRASKA_GITHUB_OAUTH_CLIENT_SECRET"
+	ghSessionAuthKeyEnvName     = "NEBRASKA_GITHUB_SESSION_SECRET"
+	ghSessionCryptKeyEnvName    = "NEBRASKA_GITHUB_SESSION_CRYPT_KEY"
+	ghWebhookSecretEnvName      = "NEBRASKA_GITHUB_WEBHOOK_SECRET"
+	ghEnterpriseURLEnvName      = "NEBRASKA_GITHUB_ENTERPRISE_URL"
+	oidcClientIDEnvName         = "NEBRASKA_OIDC_CLIENT_ID"
+	oidcClientSecretEnvName     = "NEBRASKA_OIDC_CLIENT_SECRET"
+	oidcSessionAuthKeyEnvName   = "NEBRASKA_OIDC_SESSION_SECRET"
+	oidcSessionCryptKeyEnvName  = "NEBRASKA_OIDC_SESSION_CRYPT_KEY"
+	localSessionAuthKeyEnvName  = "NEBRASKA_LOCAL_SESSION_SECRET"
+	localSessionCryptKeyEnvName = "NEBRASKA_LOCAL_SESSION_CRYPT_KEY"
+	s3AccessKeyIDEnvName        = "NEBRASKA_S3_ACCESS_KEY_ID"
+	s3SecretAccessKeyEnvName    = "NEBRASKA_S3_SECRET_ACCESS_KEY"
+
+	// shutdownTimeout is how long the requests in flight are waited for
+	// when Nebraska is asked to stop.
+	shutdownTimeout = 30 * time.Second
 )
 
 var (
 	enableSyncer          = flag.Bool("enable-syncer", false, "Enable Flatcar packages syncer")
 	hostFlatcarPackages   = flag.Bool("host-flatcar-packages", false, "Host Flatcar packages in Nebraska")
-	flatcarPackagesPath   = flag.String("flatcar-packages-path", "", "Path where Flatcar packages files should be stored")
+	flatcarPackagesPath   = flag.String("flatcar-packages-path", "", "Path where Flatcar packages files should be stored (fs packages storage)")
+	packagesStorage       = flag.String("packages-storage", "fs", "Storage used for the hosted Flatcar packages payloads, available storages: fs, s3")
+	packagesGCInterval    = flag.String("packages-gc-interval", "0", "Interval to remove the hosted packages payloads no longer referenced by any package (e.g. 1h), 0 disables it; only enable it if the packages storage is used by Nebraska alone")
+	s3Endpoint            = flag.String("s3-endpoint", "https://s3.amazonaws.com", "Base URL of the S3 compatible service used to store packages payloads (path style addressing is used)")
+	s3Bucket              = flag.String("s3-bucket", "", "S3 bucket used to store packages payloads")
+	s3Prefix              = flag.String("s3-prefix", "", "Prefix of the S3 keys used to store packages payloads")
+	s3Region              = flag.String("s3-region", "us-east-1", "Region of the S3 bucket used to store packages payloads")
+	s3AccessKeyID         = flag.String("s3-access-key-id", "", fmt.Sprintf("S3 access key ID; can be taken from %s env var too", s3AccessKeyIDEnvName))
+	s3SecretAccessKey     = flag.String("s3-secret-access-key", "", fmt.Sprintf("S3 secret access key; can be taken from %s env var too", s3SecretAccessKeyEnvName))
+	s3URLExpiry           = flag.String("s3-url-expiry", "1h", "Validity of the presigned URLs used to download packages payloads from S3")
 	nebraskaURL           = flag.String("nebraska-url", "http://localhost:8000", "nebraska URL (http://host:port - required when hosting Flatcar packages in nebraska)")
 	httpLog               = flag.Bool("http-log", false, "Enable http requests logging")
 	httpStaticDir         = flag.String("http-static-dir", "../frontend/build", "Path to frontend static files")
-	authMode              = flag.String("auth-mode", "github", "authentication mode, available modes: noop, github, oidc")
+	authMode              = flag.String("auth-mode", "github", "authentication mode, available modes: noop, local, github, oidc")
 	ghClientID            = flag.String("gh-client-id", "", fmt.Sprintf("GitHub client ID used for authentication; can be taken from %s env var too", ghClientIDEnvName))
 	ghClientSecret        = flag.String("gh-client-secret", "", fmt.Sprintf("GitHub client secret used for authentication; can be taken from %s env var too", ghClientSecretEnvName))
 	ghSessionAuthKey      = flag.String("gh-session-secret", "", fmt.Sprintf("Session secret used for authenticating sessions in cookies used for storing GitHub info , will be generated if none is passed; can be taken from %s env var too", ghSessionAuthKeyEnvName))
@@ -65,19 +90,41 @@ var (
 	oidcViewerRoles       = flag.String("oidc-viewer-roles", "", "comma-separated list of accepted roles with viewer access")
 	oidcRolesPath         = flag.String("oidc-roles-path", "roles", "json path in which the roles array is present in the id token")
 	oidcScopes            = flag.String("oidc-scopes", "openid", "comma-separated list of scopes to be used in OIDC")
+	oidcGroupsPath        = flag.String("oidc-groups-path", "groups", "json path in which the groups array is present in the id token; groups can be mapped to teams")
+	requireTeamMembership = flag.Bool("require-team-membership", false, "Deny access to users not belonging to any team instead of giving them access to the default team")
 	oidcSessionAuthKey    = flag.String("oidc-session-secret", "", fmt.Sprintf("Session secret used for authenticating sessions in cookies used for storing OIDC info , will be generated if none is passed; can be taken from %s env var too", oidcSessionAuthKeyEnvName))
 	oidcSessionCryptKey   = flag.String("oidc-session-crypt-key", "", fmt.Sprintf("Session key used for encrypting sessions in cookies used for storing OIDC info, will be generated if none is passed; can be taken from %s env var too", oidcSessionCryptKeyEnvName))
+	localSessionAuthKey   = flag.String("local-session-secret", "", fmt.Sprintf("Session secret used for authenticating sessions in cookies of users logged in with a local account, will be generated if none is passed; can be taken from %s env var too", localSessionAuthKeyEnvName))
+	localSessionCryptKey  = flag.String("local-session-crypt-key", "", fmt.Sprintf("Session key used for encrypting sessions in cookies of users logged in with a local account, will be generated if none is passed; can be taken from %s env var too", localSessionCryptKeyEnvName))
+	localAccessLevel      = flag.String("local-access-level", auth.AccessLevelViewer, "access level given to all local accounts, further permissions being granted through roles; available levels: none, viewer, admin")
+	localAdminUsers       = flag.String("local-admin-users", "", "comma-separated list of local accounts with admin access")
 	flatcarUpdatesURL     = flag.String("sync-update-url", "https://public.update.flatcar-linux.net/v1/update/", "Flatcar update URL to sync from")
-	checkFrequencyVal     = flag.String("sync-interval", "1h", "Sync check interval (the minimum depends on the number of channels to sync, e.g., 8m for 8 channels incl. different architectures)")
+	syncSourcesConfig     = flag.String("sync-sources-config", "", "Path to a YAML file configuring the upstream Omaha servers and tracks to sync from, instead of the official Flatcar channels")
+	checkFrequencyVal     = flag.String("sync-interval", "1h", "Sync check interval")
+	syncDownloadWorkers   = flag.Int("sync-download-concurrency", 2, "Maximum number of package payloads downloaded at once by the syncer when hosting Flatcar packages")
+	syncDownloadRetries   = flag.Int("sync-download-retries", 3, "Number of times the syncer retries a failed package payload download, resuming it when possible")
 	appLogoPath           = flag.String("client-logo", "", "Client app logo, should be a path to svg file")
 	appTitle              = flag.String("client-title", "", "Client app title")
 	appHeaderStyle        = flag.String("client-header-style", "light", "Client app header style, should be either dark or light")
 	apiEndpointSuffix     = flag.String("api-endpoint-suffix", "", "Additional suffix for the API endpoint to serve Omaha clients on; use a secret to only serve your clients, e.g., mysecret results in /v1/update/mysecret")
 	debug                 = flag.Bool("debug", false, "sets log level to debug")
+	notificationsConfig   = flag.String("notifications-config", "", "Path to a YAML file configuring where activity notifications are sent (webhook, slack, matrix or smtp)")
+	updateCache           = flag.Bool("update-cache", true, "Cache the groups, channels and packages used to serve updates; the cache is invalidated through the database when they change, so it can be used with several Nebraska instances")
+	updateCacheMaxAge     = flag.String("update-cache-max-age", "10m", "Maximum time the entries of the update cache are kept, even if not invalidated (0 keeps them until invalidated)")
+	checkinFlushInterval  = flag.String("checkin-flush-interval", "5s", "Interval at which the instances check-ins not changing their state are written to the database in batches (0 writes them synchronously)")
+	checkinBufferSize     = flag.Int("checkin-buffer-size", 10000, "Maximum number of instances check-ins buffered before being written to the database")
+	cupKeysPath           = flag.String("cup-keys-path", "", "Path to a directory with the ECDSA P-256 keys used to sign Omaha responses (Client Update Protocol), named after their version (e.g. 1.pem); responses are signed for the clients requesting it")
 	logger                = util.NewLogger("nebraska")
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := runConfigCommand(os.Args[2:]); err != nil {
+			logger.Error().Err(err).Send()
+			os.Exit(1)
+		}
+		return
+	}
 	if err := mainWithError(); err != nil {
 		logger.Error().Err(err).Send()
 		os.Exit(1)
@@ -97,15 +144,45 @@ func mainWithError() error {
 		return err
 	}
 
-	api, err := api.New()
+	var apiOptions []func(*api.API) error
+	if *notificationsConfig != "" {
+		config, err := notify.LoadConfig(*notificationsConfig)
+		if err != nil {
+			return fmt.Errorf("loading notifications config: %w", err)
+		}
+		dispatcher, err := notify.NewDispatcherFromConfig(config)
+		if err != nil {
+			return fmt.Errorf("setting up notifications: %w", err)
+		}
+		apiOptions = append(apiOptions, api.OptionNotifier(dispatcher))
+	}
+
+	if *updateCache {
+		maxAge, err := time.ParseDuration(*updateCacheMaxAge)
+		if err != nil {
+			return fmt.Errorf("invalid update cache max age: %w", err)
+		}
+		apiOptions = append(apiOptions, api.OptionUpdateCache(maxAge))
+	}
+
+	flushInterval, err := time.ParseDuration(*checkinFlushInterval)
+	if err != nil {
+		return fmt.Errorf("invalid check-in flush interval: %w", err)
+	}
+	if flushInterval > 0 && *checkinBufferSize > 0 {
+		apiOptions = append(apiOptions, api.OptionCheckinBuffer(*checkinBufferSize, flushInterval))
+	}
+
+	api, err := api.New(apiOptions...)
 	if err != nil {
 		return err
 	}
 
 	var (
-		noopAuthConfig *auth.NoopAuthConfig
-		ghAuthConfig   *auth.GithubAuthConfig
-		oidcAuthConfig *auth.OIDCAuthConfig
+		noopAuthConfig  *auth.NoopAuthConfig
+		localAuthConfig *auth.LocalAuthConfig
+		ghAuthConfig    *auth.GithubAuthConfig
+		oidcAuthConfig  *auth.OIDCAuthConfig
 	)
 
 	switch *authMode {
@@ -117,6 +194,22 @@ func mainWithError() error {
 		noopAuthConfig = &auth.NoopAuthConfig{
 			DefaultTeamID: defaultTeam.ID,
 		}
+	case "local":
+		accessLevel := *localAccessLevel
+		switch accessLevel {
+		case "none":
+			accessLevel = ""
+		case auth.AccessLevelViewer, auth.AccessLevelAdmin:
+		default:
+			return fmt.Errorf("invalid local access level %q", accessLevel)
+		}
+		localAuthConfig = &auth.LocalAuthConfig{
+			SessionAuthKey:  obtainSessionLocalAuthKey(*localSessionAuthKey),
+			SessionCryptKey: obtainSessionLocalCryptKey(*localSessionCryptKey),
+			Users:           api,
+			AccessLevel:     accessLevel,
+			AdminUsers:      strings.Split(*localAdminUsers, ","),
+		}
 	case "github":
 		logger.Warn().Msg("github auth-mode support will be deprecated, oidc auth-mode is recommended")
 		defaultTeam, err := api.GetTeam()
@@ -183,6 +276,7 @@ func mainWithError() error {
 			SessionAuthKey:    obtainSessionOIDCAuthKey(*oidcSessionAuthKey),
 			SessionCryptKey:   obtainSessionOIDCCryptKey(*oidcSessionCryptKey),
 			RolesPath:         *oidcRolesPath,
+			GroupsPath:        *oidcGroupsPath,
 		}
 	default:
 		return fmt.Errorf("unknown auth mode %q", *authMode)
@@ -192,17 +286,51 @@ func mainWithError() error {
 	if err != nil {
 		return err
 	}
+	var syncSources []*syncer.Source
+	if *syncSourcesConfig != "" {
+		config, err := syncer.LoadSourcesConfig(*syncSourcesConfig)
+		if err != nil {
+			return fmt.Errorf("loading sync sources config: %w", err)
+		}
+		syncSources = config.Sources
+	}
+	gcInterval, err := time.ParseDuration(*packagesGCInterval)
+	if err != nil {
+		return err
+	}
+	var packageStore storage.PackageStore
+	if *hostFlatcarPackages {
+		packageStore, err = newPackageStore()
+		if err != nil {
+			return err
+		}
+	}
+	var cupSigner *omaha.CUPSigner
+	if *cupKeysPath != "" {
+		cupSigner, err = omaha.LoadCUPSigner(*cupKeysPath)
+		if err != nil {
+			return fmt.Errorf("loading cup keys: %w", err)
+		}
+	}
 	conf := &controllerConfig{
 		api:                 api,
 		enableSyncer:        *enableSyncer,
 		hostFlatcarPackages: *hostFlatcarPackages,
-		flatcarPackagesPath: *flatcarPackagesPath,
+		packageStore:        packageStore,
+		cupSigner:           cupSigner,
+		packagesGCInterval:  gcInterval,
 		nebraskaURL:         *nebraskaURL,
 		noopAuthConfig:      noopAuthConfig,
+		localAuthConfig:     localAuthConfig,
 		githubAuthConfig:    ghAuthConfig,
 		oidcAuthConfig:      oidcAuthConfig,
 		flatcarUpdatesURL:   *flatcarUpdatesURL,
+		syncSources:         syncSources,
+		syncDownloadWorkers: *syncDownloadWorkers,
+		syncDownloadRetries: *syncDownloadRetries,
 		checkFrequency:      checkFrequency,
+
+		requireTeamMembership: *requireTeamMembership,
 	}
 	ctl, err := newController(conf)
 	if err != nil {
@@ -218,11 +346,37 @@ func mainWithError() error {
 		return err
 	}
 
-	var params []string
-	if os.Getenv("PORT") == "" {
-		params = append(params, ":8000")
+	return runServer(engine)
+}
+
+// runServer serves the engine until Nebraska is asked to stop, giving the
+// requests in flight some time to complete, so the deferred cleanups (like
+// writing the check-ins buffered) run.
+func runServer(engine *gin.Engine) error {
+	addr := ":8000"
+	if port := os.Getenv("PORT"); port != "" {
+		addr = ":" + port
+	}
+	server := &http.Server{Addr: addr, Handler: engine}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-serverErr:
+		return err
+	case sig := <-signals:
+		logger.Info().Str("signal", sig.String()).Msg("shutting down")
 	}
-	return engine.Run(params...)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(ctx)
 }
 
 func obtainSessionAuthKey(potentialSecret string) []byte {
@@ -253,6 +407,20 @@ func obtainSessionOIDCCryptKey(potentialKey string) []byte {
 	return random.Data(32)
 }
 
+func obtainSessionLocalAuthKey(potentialKey string) []byte {
+	if key := getPotentialOrEnv(potentialKey, localSessionAuthKeyEnvName); key != "" {
+		return []byte(key)
+	}
+	return random.Data(64)
+}
+
+func obtainSessionLocalCryptKey(potentialKey string) []byte {
+	if key := getPotentialOrEnv(potentialKey, localSessionCryptKeyEnvName); key != "" {
+		return []byte(key)
+	}
+	return random.Data(32)
+}
+
 func obtainOIDCClientID(potentialID string) (string, error) {
 	if id := getPotentialOrEnv(potentialID, oidcClientIDEnvName); id != "" {
 		return id, nil
@@ -295,6 +463,29 @@ func obtainEnterpriseURL(potentialURL string) (string, error) {
 	return "", errors.New("no enterprise URL")
 }
 
+func newPackageStore() (storage.PackageStore, error) {
+	packagesURL := *nebraskaURL + "/flatcar/"
+	switch *packagesStorage {
+	case "fs":
+		return storage.NewFSStore(*flatcarPackagesPath, packagesURL), nil
+	case "s3":
+		urlExpiry, err := time.ParseDuration(*s3URLExpiry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid s3-url-expiry: %w", err)
+		}
+		return storage.NewS3Store(&storage.S3Config{
+			Endpoint:        *s3Endpoint,
+			Bucket:          *s3Bucket,
+			Prefix:          *s3Prefix,
+			Region:          *s3Region,
+			AccessKeyID:     getPotentialOrEnv(*s3AccessKeyID, s3AccessKeyIDEnvName),
+			SecretAccessKey: getPotentialOrEnv(*s3SecretAccessKey, s3SecretAccessKeyEnvName),
+			URLExpiry:       urlExpiry,
+		})
+	}
+	return nil, fmt.Errorf("unknown packages storage %q", *packagesStorage)
+}
+
 func getPotentialOrEnv(potentialValue, envName string) string {
 	if potentialValue != "" {
 		return potentialValue
@@ -304,14 +495,16 @@ func getPotentialOrEnv(potentialValue, envName string) string {
 
 func checkArgs() error {
 	if *hostFlatcarPackages {
-		if *flatcarPackagesPath == "" {
-			return errors.New("Invalid Flatcar packages path. Please ensure you provide a valid path using -flatcar-packages-path")
+		if *packagesStorage == "fs" {
+			if *flatcarPackagesPath == "" {
+				return errors.New("Invalid Flatcar packages path. Please ensure you provide a valid path using -flatcar-packages-path")
+			}
+			tmpFile, err := ioutil.TempFile(*flatcarPackagesPath, "")
+			if err != nil {
+				return errors.New("Invalid Flatcar packages path: " + err.Error())
+			}
+			defer os.Remove(tmpFile.Name())
 		}
-		tmpFile, err := ioutil.TempFile(*flatcarPackagesPath, "")
-		if err != nil {
-			return errors.New("Invalid Flatcar packages path: " + err.Error())
-		}
-		defer os.Remove(tmpFile.Name())
 
 		if _, err := url.ParseRequestURI(*nebraskaURL); err != nil {
 			return errors.New("invalid Nebraska URL, please ensure the value provided using -nebraska-url is a valid url")
@@ -357,9 +550,40 @@ func setupRoutes(ctl *controller, httpLog bool) *gin.Engine {
 	// API router setup
 	apiRouter := wrappedEngine.Group("/api", "api")
 	apiRouter.Use(ctl.authenticate)
+	apiRouter.Use(ctl.recordAuditEntry)
+	apiRouter.Use(ctl.checkTeamOwnership)
+	apiRouter.Use(ctl.authorize)
+	apiRouter.Use(ctl.captureAuditState)
 
 	// API routes
 
+	// Teams
+	apiRouter.GET("/teams", ctl.getTeams)
+	apiRouter.POST("/teams", ctl.addTeam)
+	apiRouter.PUT("/current_team", ctl.setCurrentTeam)
+	apiRouter.GET("/teams/:team_id/members", ctl.checkTeamMembership, ctl.getTeamMembers)
+	apiRouter.PUT("/teams/:team_id/members/:username", ctl.checkTeamMembership, ctl.addTeamMember)
+	apiRouter.DELETE("/teams/:team_id/members/:username", ctl.checkTeamMembership, ctl.removeTeamMember)
+	apiRouter.GET("/teams/:team_id/oidc_groups", ctl.checkTeamMembership, ctl.getTeamOIDCGroups)
+	apiRouter.PUT("/teams/:team_id/oidc_groups/:group", ctl.checkTeamMembership, ctl.addTeamOIDCGroup)
+	apiRouter.DELETE("/teams/:team_id/oidc_groups/:group", ctl.checkTeamMembership, ctl.removeTeamOIDCGroup)
+
+	// Roles
+	apiRouter.GET("/permissions", ctl.getPermissions)
+	apiRouter.POST("/roles", ctl.addRole)
+	apiRouter.PUT("/roles/:role_id", ctl.updateRole)
+	apiRouter.DELETE("/roles/:role_id", ctl.deleteRole)
+	apiRouter.GET("/roles/:role_id", ctl.getRole)
+	apiRouter.GET("/roles", ctl.getRoles)
+	apiRouter.POST("/role_bindings", ctl.addRoleBinding)
+	apiRouter.DELETE("/role_bindings/:binding_id", ctl.deleteRoleBinding)
+	apiRouter.GET("/role_bindings", ctl.getRoleBindings)
+
+	// API tokens
+	apiRouter.POST("/tokens", ctl.addAPIToken)
+	apiRouter.DELETE("/tokens/:token_id", ctl.revokeAPIToken)
+	apiRouter.GET("/tokens", ctl.getAPITokens)
+
 	// Users
 	apiRouter.PUT("/password", ctl.updateUserPassword)
 
@@ -394,6 +618,14 @@ func setupRoutes(ctl *controller, httpLog bool) *gin.Engine {
 	apiRouter.DELETE("/apps/:app_id/packages/:package_id", ctl.deletePackage)
 	apiRouter.GET("/apps/:app_id/packages/:package_id", ctl.getPackage)
 	apiRouter.GET("/apps/:app_id/packages", ctl.getPackages)
+	apiRouter.POST("/apps/:app_id/packages/:package_id/mirrors", ctl.addPackageMirror)
+	apiRouter.PUT("/apps/:app_id/packages/:package_id/mirrors/:mirror_id", ctl.updatePackageMirror)
+	apiRouter.DELETE("/apps/:app_id/packages/:package_id/mirrors/:mirror_id", ctl.deletePackageMirror)
+	apiRouter.GET("/apps/:app_id/packages/:package_id/mirrors", ctl.getPackageMirrors)
+
+	// Declarative configuration
+	apiRouter.GET("/config/export", ctl.exportConfig)
+	apiRouter.POST("/config/apply", ctl.applyConfig)
 
 	// Instances
 	apiRouter.GET("/apps/:app_id/groups/:group_id/instances/:instance_id/status_history", ctl.getInstanceStatusHistory)
@@ -401,10 +633,20 @@ func setupRoutes(ctl *controller, httpLog bool) *gin.Engine {
 	apiRouter.GET("/apps/:app_id/groups/:group_id/instancescount", ctl.getInstancesCount)
 	apiRouter.GET("/apps/:app_id/groups/:group_id/instances/:instance_id", ctl.getInstance)
 	apiRouter.PUT("/instances/:instance_id", ctl.updateInstance)
+	apiRouter.GET("/apps/:app_id/instances/:instance_id/override", ctl.getInstanceOverride)
+	apiRouter.PUT("/apps/:app_id/instances/:instance_id/override", ctl.setInstanceOverride)
+	apiRouter.DELETE("/apps/:app_id/instances/:instance_id/override", ctl.deleteInstanceOverride)
 
 	// Activity
 	apiRouter.GET("/activity", ctl.getActivity)
 
+	// Audit log
+	apiRouter.GET("/audit", ctl.getAuditEntries)
+
+	// Syncer
+	apiRouter.GET("/syncer/status", ctl.getSyncerStatus)
+	apiRouter.POST("/syncer/sync", ctl.syncNow)
+
 	// Omaha server router setup
 	omahaRouter := wrappedEngine.Group("/", "omaha")
 	omahaRouter.POST("/omaha", ctl.processOmahaRequest)
@@ -420,7 +662,11 @@ func setupRoutes(ctl *controller, httpLog bool) *gin.Engine {
 	// Host Flatcar packages payloads
 	if *hostFlatcarPackages {
 		flatcarPkgsRouter := wrappedEngine.Group("/flatcar", "flatcar")
-		flatcarPkgsRouter.Static("/", *flatcarPackagesPath)
+		if *packagesStorage == "fs" {
+			flatcarPkgsRouter.Static("/", *flatcarPackagesPath)
+		} else {
+			flatcarPkgsRouter.GET("/:filename", ctl.redirectToPackagePayload)
+		}
 	}
 
 	// Serve frontend static content
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kinvolk/nebraska/backend/cmd/nebraska/auth"
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+)
+
+// routePermissions maps the API routes, identified by their method and path,
+// to the permission required to use them. An empty permission means that any
+// authenticated user can use the route. Routes not listed here are denied.
+var routePermissions = map[string]string{
+	"PUT /api/password": "",
+
+	"GET /api/teams":                                "",
+	"POST /api/teams":                               api.PermissionTeamsManage,
+	"PUT /api/current_team":                         "",
+	"GET /api/teams/:team_id/members":               api.PermissionTeamsRead,
+	"PUT /api/teams/:team_id/members/:username":     api.PermissionTeamsManage,
+	"DELETE /api/teams/:team_id/members/:username":  api.PermissionTeamsManage,
+	"GET /api/teams/:team_id/oidc_groups":           api.PermissionTeamsRead,
+	"PUT /api/teams/:team_id/oidc_groups/:group":    api.PermissionTeamsManage,
+	"DELETE /api/teams/:team_id/oidc_groups/:group": api.PermissionTeamsManage,
+	"GET /api/permissions":                          "",
+	"GET /api/roles":                                api.PermissionRolesRead,
+	"POST /api/roles":                               api.PermissionRolesManage,
+	"GET /api/roles/:role_id":                       api.PermissionRolesRead,
+	"PUT /api/roles/:role_id":                       api.PermissionRolesManage,
+	"DELETE /api/roles/:role_id":                    api.PermissionRolesManage,
+	"GET /api/role_bindings":                        api.PermissionRolesRead,
+	"POST /api/role_bindings":                       api.PermissionRolesManage,
+	"DELETE /api/role_bindings/:binding_id":         api.PermissionRolesManage,
+
+	"POST /api/apps":           api.PermissionAppsCreate,
+	"PUT /api/apps/:app_id":    api.PermissionAppsUpdate,
+	"DELETE /api/apps/:app_id": api.PermissionAppsDelete,
+	"GET /api/apps/:app_id":    api.PermissionAppsRead,
+	"GET /api/apps":            api.PermissionAppsRead,
+
+	"POST /api/apps/:app_id/groups":                            api.PermissionGroupsCreate,
+	"PUT /api/apps/:app_id/groups/:group_id":                   api.PermissionGroupsUpdate,
+	"DELETE /api/apps/:app_id/groups/:group_id":                api.PermissionGroupsDelete,
+	"GET /api/apps/:app_id/groups/:group_id":                   api.PermissionGroupsRead,
+	"GET /api/apps/:app_id/groups":                             api.PermissionGroupsRead,
+	"GET /api/apps/:app_id/groups/:group_id/version_timeline":  api.PermissionGroupsRead,
+	"GET /api/apps/:app_id/groups/:group_id/status_timeline":   api.PermissionGroupsRead,
+	"GET /api/apps/:app_id/groups/:group_id/instances_stats":   api.PermissionGroupsRead,
+	"GET /api/apps/:app_id/groups/:group_id/version_breakdown": api.PermissionGroupsRead,
+
+	"POST /api/apps/:app_id/channels":               api.PermissionChannelsCreate,
+	"PUT /api/apps/:app_id/channels/:channel_id":    api.PermissionChannelsUpdate,
+	"DELETE /api/apps/:app_id/channels/:channel_id": api.PermissionChannelsDelete,
+	"GET /api/apps/:app_id/channels/:channel_id":    api.PermissionChannelsRead,
+	"GET /api/apps/:app_id/channels":                api.PermissionChannelsRead,
+
+	"POST /api/apps/:app_id/packages":               api.PermissionPackagesCreate,
+	"PUT /api/apps/:app_id/packages/:package_id":    api.PermissionPackagesUpdate,
+	"DELETE /api/apps/:app_id/packages/:package_id": api.PermissionPackagesDelete,
+	"GET /api/apps/:app_id/packages/:package_id":    api.PermissionPackagesRead,
+	"GET /api/apps/:app_id/packages":                api.PermissionPackagesRead,
+
+	"POST /api/apps/:app_id/packages/:package_id/mirrors":              api.PermissionPackagesUpdate,
+	"PUT /api/apps/:app_id/packages/:package_id/mirrors/:mirror_id":    api.PermissionPackagesUpdate,
+	"DELETE /api/apps/:app_id/packages/:package_id/mirrors/:mirror_id": api.PermissionPackagesUpdate,
+	"GET /api/apps/:app_id/packages/:package_id/mirrors":               api.PermissionPackagesRead,
+
+	"GET /api/apps/:app_id/groups/:group_id/instances/:instance_id/status_history": api.PermissionInstancesRead,
+	"GET /api/apps/:app_id/groups/:group_id/instances":                             api.PermissionInstancesRead,
+	"GET /api/apps/:app_id/groups/:group_id/instancescount":                        api.PermissionInstancesRead,
+	"GET /api/apps/:app_id/groups/:group_id/instances/:instance_id":                api.PermissionInstancesRead,
+	"PUT /api/instances/:instance_id":                                              api.PermissionInstancesWrite,
+	"GET /api/apps/:app_id/instances/:instance_id/override":                        api.PermissionInstancesRead,
+	"PUT /api/apps/:app_id/instances/:instance_id/override":                        api.PermissionInstancesWrite,
+	"DELETE /api/apps/:app_id/instances/:instance_id/override":                     api.PermissionInstancesWrite,
+
+	// Checked for each application exported or changed.
+	"GET /api/config/export": "",
+	"POST /api/config/apply": "",
+
+	"GET /api/activity": api.PermissionActivityRead,
+	"GET /api/audit":    api.PermissionAuditRead,
+
+	"GET /api/syncer/status": api.PermissionSyncerRead,
+	"POST /api/syncer/sync":  api.PermissionSyncerSync,
+
+	"POST /api/tokens":             "",
+	"DELETE /api/tokens/:token_id": "",
+	"GET /api/tokens":              "",
+}
+
+// authorize is a middleware handler making sure that the user sending the
+// request has the permission required by the route, either because of the
+// access level given by the authenticator or because of the roles granted to
+// them in the team. Permissions granted on a single application only apply to
+// the routes of that application.
+func (ctl *controller) authorize(c *gin.Context) {
+	logger := loggerWithUsername(logger, c)
+
+	route := c.Request.Method + " " + c.FullPath()
+	permission, ok := routePermissions[route]
+	if !ok {
+		logger.Error().Str("route", route).Msg("authorize - no permission defined for route")
+		httpError(c, http.StatusForbidden)
+		return
+	}
+	if permission == "" {
+		c.Next()
+		return
+	}
+
+	// Team management routes are authorized in the team they refer to.
+	teamID := c.GetString("team_id")
+	if id := c.Param("team_id"); id != "" {
+		teamID = id
+	}
+	appID := c.Param("app_id")
+	permissions, err := ctl.userPermissions(c, teamID)
+	if err != nil {
+		logger.Error().Err(err).Str("teamID", teamID).Msg("authorize - getting user permissions")
+		httpError(c, http.StatusInternalServerError)
+		return
+	}
+	if !permissions.Allows(permission, appID) {
+		logger.Debug().Str("route", route).Str("permission", permission).Msg("authorize - permission denied")
+		httpError(c, http.StatusForbidden)
+		return
+	}
+	c.Next()
+}
+
+// userPermissions returns the permissions of the user sending the request in
+// the given team. Requests authenticated with an API token only get the
+// token's scopes.
+func (ctl *controller) userPermissions(c *gin.Context, teamID string) (*api.PermissionSet, error) {
+	if scopes, ok := auth.Scopes(c); ok {
+		return api.NewPermissionSet(scopes...), nil
+	}
+	level := auth.AccessLevel(c)
+	if level == auth.AccessLevelAdmin {
+		return accessLevelPermissions(level), nil
+	}
+	return ctl.api.GetUserPermissions(teamID, getUsername(c), auth.Groups(c), accessLevelPermissions(level))
+}
+
+// accessLevelPermissions returns the permissions users get because of the
+// access level given to them by the authenticator.
+func accessLevelPermissions(level string) *api.PermissionSet {
+	switch level {
+	case auth.AccessLevelAdmin:
+		return api.NewPermissionSet(api.PermissionAll)
+	case auth.AccessLevelViewer:
+		return api.NewPermissionSet(api.ReadPermissions()...)
+	default:
+		return api.NewPermissionSet()
+	}
+}
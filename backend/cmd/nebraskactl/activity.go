@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+)
+
+var activityCommands = map[string]*command{
+	"list": {
+		usage:       "[-app <app>] [-group <group>] [-severity <severity>] [-since <duration>]",
+		description: "List the activity entries of the team, newest first.",
+		run:         listActivity,
+	},
+}
+
+func listActivity(cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	appRef := flags.String("app", "", "Only list the entries of this application, by id or name")
+	groupRef := flags.String("group", "", "Only list the entries of this group, by id or name (requires -app)")
+	severity := flags.String("severity", "", "Only list the entries with this severity: success, info, warning or error")
+	since := flags.Duration("since", 72*time.Hour, "Only list the entries created in this period")
+	if err := cli.parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("start", time.Now().Add(-*since).UTC().Format(time.RFC3339))
+	if *severity != "" {
+		s, err := api.ActivitySeverityFromName(*severity)
+		if err != nil {
+			return err
+		}
+		query.Set("severity", strconv.Itoa(s))
+	}
+	if *appRef != "" {
+		app, err := cli.findApp(*appRef)
+		if err != nil {
+			return err
+		}
+		query.Set("app", app.ID)
+		if *groupRef != "" {
+			group, err := cli.findGroup(app, *groupRef)
+			if err != nil {
+				return err
+			}
+			query.Set("group", group.ID)
+		}
+	} else if *groupRef != "" {
+		return errGroupWithoutApp
+	}
+
+	entries := []*api.Activity{}
+	err := cli.client.getAll("/activity", query, func(get func(out interface{}) error) (int, error) {
+		var page []*api.Activity
+		if err := get(&page); err != nil {
+			return 0, err
+		}
+		entries = append(entries, page...)
+		return len(page), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	t := &table{headers: []string{"TIME", "SEVERITY", "CLASS", "APPLICATION", "GROUP", "CHANNEL", "VERSION", "INSTANCE"}}
+	for _, entry := range entries {
+		t.add(formatTime(entry.CreatedTs), entry.SeverityName(), entry.ClassName(), entry.ApplicationName, formatNullString(entry.GroupName), formatNullString(entry.ChannelName), entry.Version, formatNullString(entry.InstanceID))
+	}
+	return cli.printer.print(entries, t)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strconv"
+)
+
+var appsCommands = map[string]*command{
+	"list": {
+		usage:       "",
+		description: "List the applications of the team.",
+		run:         listApps,
+	},
+	"get": {
+		usage:       "<app>",
+		description: "Show an application, referred to by id or name.",
+		run:         getApp,
+	},
+}
+
+func listApps(cli *cli, args []string) error {
+	if err := cli.parseFlags(cli.newFlagSet(), args, 0); err != nil {
+		return err
+	}
+	apps, err := cli.getApps()
+	if err != nil {
+		return err
+	}
+	t := &table{headers: []string{"ID", "NAME", "GROUPS", "CHANNELS", "INSTANCES"}}
+	for _, app := range apps {
+		t.add(app.ID, app.Name, strconv.Itoa(len(app.Groups)), strconv.Itoa(len(app.Channels)), strconv.Itoa(app.Instances.Count))
+	}
+	return cli.printer.print(apps, t)
+}
+
+func getApp(cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	if err := cli.parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	app, err := cli.findApp(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	t := &table{headers: []string{"ID", "NAME", "DESCRIPTION", "CREATED", "INSTANCES"}}
+	t.add(app.ID, app.Name, app.Description, formatTime(app.CreatedTs), strconv.Itoa(app.Instances.Count))
+	return cli.printer.print(app, t)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+)
+
+var channelsCommands = map[string]*command{
+	"list": {
+		usage:       "-app <app>",
+		description: "List the channels of an application.",
+		run:         listChannels,
+	},
+	"get": {
+		usage:       "-app <app> [-arch <arch>] <channel>",
+		description: "Show a channel, referred to by id or name.",
+		run:         getChannel,
+	},
+}
+
+func channelsTable(channels ...*api.Channel) *table {
+	t := &table{headers: []string{"ID", "NAME", "ARCH", "PACKAGE", "VERSION CONSTRAINT"}}
+	for _, channel := range channels {
+		version := "-"
+		if channel.Package != nil {
+			version = channel.Package.Version
+		}
+		t.add(channel.ID, channel.Name, channel.Arch.String(), version, formatNullString(channel.VersionConstraint))
+	}
+	return t
+}
+
+func listChannels(cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	appRef := flags.String("app", "", "Application id or name")
+	if err := cli.parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	app, err := cli.findApp(*appRef)
+	if err != nil {
+		return err
+	}
+	channels, err := cli.getChannels(app.ID)
+	if err != nil {
+		return err
+	}
+	return cli.printer.print(channels, channelsTable(channels...))
+}
+
+func getChannel(cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	appRef := flags.String("app", "", "Application id or name")
+	arch := flags.String("arch", "", "Architecture of the channel, required if the name is used by several")
+	if err := cli.parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	app, err := cli.findApp(*appRef)
+	if err != nil {
+		return err
+	}
+	channel, err := cli.findChannel(app, flags.Arg(0), *arch)
+	if err != nil {
+		return err
+	}
+	return cli.printer.print(channel, channelsTable(channel))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pageSize is the number of items requested per page when listing all the
+// items of a resource.
+const pageSize = 100
+
+// client sends requests to Nebraska's REST API, authenticated with an API
+// token.
+type client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// apiError is returned when the API replies with an error status.
+type apiError struct {
+	method     string
+	path       string
+	statusCode int
+	message    string
+}
+
+func (e *apiError) Error() string {
+	msg := fmt.Sprintf("%s %s: %d %s", e.method, e.path, e.statusCode, http.StatusText(e.statusCode))
+	if e.message != "" && e.message != http.StatusText(e.statusCode) {
+		msg += ": " + e.message
+	}
+	return msg
+}
+
+func newClient(server, token string) *client {
+	return &client{
+		baseURL:    strings.TrimSuffix(server, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// do sends a request to the API path provided, with the JSON encoding of in
+// as body if not nil, and decodes the JSON reply into out if not nil.
+func (c *client) do(method, path string, query url.Values, in, out interface{}) error {
+	u := c.baseURL + "/api" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &apiError{
+			method:     method,
+			path:       path,
+			statusCode: resp.StatusCode,
+			message:    strings.TrimSpace(string(message)),
+		}
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *client) get(path string, query url.Values, out interface{}) error {
+	return c.do(http.MethodGet, path, query, nil, out)
+}
+
+func (c *client) put(path string, in, out interface{}) error {
+	return c.do(http.MethodPut, path, nil, in, out)
+}
+
+// getAll gets all the pages of the list at the path provided. The page
+// function is called with each page number and must return how many items
+// the page had.
+func (c *client) getAll(path string, query url.Values, page func(get func(out interface{}) error) (int, error)) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("perpage", strconv.Itoa(pageSize))
+	for p := 1; ; p++ {
+		query.Set("page", strconv.Itoa(p))
+		n, err := page(func(out interface{}) error {
+			return c.get(path, query, out)
+		})
+		if err != nil {
+			return err
+		}
+		if n < pageSize {
+			return nil
+		}
+	}
+}
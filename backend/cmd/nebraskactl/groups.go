@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+)
+
+var groupsCommands = map[string]*command{
+	"list": {
+		usage:       "-app <app>",
+		description: "List the groups of an application.",
+		run:         listGroups,
+	},
+	"get": {
+		usage:       "-app <app> <group>",
+		description: "Show a group, referred to by id or name.",
+		run:         getGroup,
+	},
+	"pause": {
+		usage:       "-app <app> <group>",
+		description: "Disable the updates of the instances in a group.",
+		run:         pauseGroup,
+	},
+	"resume": {
+		usage:       "-app <app> <group>",
+		description: "Enable again the updates of the instances in a group.",
+		run:         resumeGroup,
+	},
+}
+
+func groupsTable(groups ...*api.Group) *table {
+	t := &table{headers: []string{"ID", "NAME", "CHANNEL", "UPDATES", "SAFE MODE", "MAX UPDATES", "ROLLOUT"}}
+	for _, group := range groups {
+		channel := "-"
+		if group.Channel != nil {
+			channel = group.Channel.Name + " (" + group.Channel.Arch.String() + ")"
+		}
+		rollout := "-"
+		if group.RolloutInProgress {
+			rollout = "in progress"
+		}
+		maxUpdates := strconv.Itoa(group.PolicyMaxUpdatesPerPeriod) + " / " + group.PolicyPeriodInterval
+		t.add(group.ID, group.Name, channel, formatBool(group.PolicyUpdatesEnabled), formatBool(group.PolicySafeMode), maxUpdates, rollout)
+	}
+	return t
+}
+
+func listGroups(cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	appRef := flags.String("app", "", "Application id or name")
+	if err := cli.parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	app, err := cli.findApp(*appRef)
+	if err != nil {
+		return err
+	}
+	groups, err := cli.getGroups(app.ID)
+	if err != nil {
+		return err
+	}
+	return cli.printer.print(groups, groupsTable(groups...))
+}
+
+func getGroup(cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	appRef := flags.String("app", "", "Application id or name")
+	if err := cli.parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	app, err := cli.findApp(*appRef)
+	if err != nil {
+		return err
+	}
+	group, err := cli.findGroup(app, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return cli.printer.print(group, groupsTable(group))
+}
+
+func pauseGroup(cli *cli, args []string) error {
+	return setGroupUpdatesEnabled(cli, args, false)
+}
+
+func resumeGroup(cli *cli, args []string) error {
+	return setGroupUpdatesEnabled(cli, args, true)
+}
+
+func setGroupUpdatesEnabled(cli *cli, args []string, enabled bool) error {
+	flags := cli.newFlagSet()
+	appRef := flags.String("app", "", "Application id or name")
+	if err := cli.parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	app, err := cli.findApp(*appRef)
+	if err != nil {
+		return err
+	}
+	group, err := cli.findGroup(app, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if group.PolicyUpdatesEnabled != enabled {
+		group.PolicyUpdatesEnabled = enabled
+		updated := &api.Group{}
+		if err := cli.client.put("/apps/"+app.ID+"/groups/"+group.ID, group, updated); err != nil {
+			return err
+		}
+		group = updated
+	}
+	if enabled {
+		cli.printer.message("Updates enabled in group %q", group.Name)
+	} else {
+		cli.printer.message("Updates paused in group %q", group.Name)
+	}
+	if cli.printer.format == outputJSON {
+		return cli.printer.print(group, nil)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+)
+
+var instancesCommands = map[string]*command{
+	"list": {
+		usage:       "-app <app> [-group <group>] [-status <status>] [-version <version>] [-duration <duration>]",
+		description: "List the instances of an application, in all its groups unless one is given.",
+		run:         listInstances,
+	},
+	"get": {
+		usage:       "-app <app> -group <group> <instance id>",
+		description: "Show an instance along with its status history.",
+		run:         getInstance,
+	},
+}
+
+// instanceStatusNames contains the names used for the instance statuses in
+// the command line.
+var instanceStatusNames = map[int]string{
+	api.InstanceStatusUndefined:     "undefined",
+	api.InstanceStatusUpdateGranted: "update-granted",
+	api.InstanceStatusError:         "error",
+	api.InstanceStatusComplete:      "complete",
+	api.InstanceStatusInstalled:     "installed",
+	api.InstanceStatusDownloaded:    "downloaded",
+	api.InstanceStatusDownloading:   "downloading",
+	api.InstanceStatusOnHold:        "on-hold",
+}
+
+func instanceStatusName(status null.Int) string {
+	if name, ok := instanceStatusNames[int(status.Int64)]; ok && status.Valid {
+		return name
+	}
+	return "-"
+}
+
+func instanceStatusFromName(name string) (int, error) {
+	for status, statusName := range instanceStatusNames {
+		if statusName == name {
+			return status, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid instance status %q", name)
+}
+
+func instancesTable(instances ...*api.Instance) *table {
+	t := &table{headers: []string{"ID", "ALIAS", "IP", "VERSION", "STATUS", "GROUP", "LAST CHECK"}}
+	for _, instance := range instances {
+		alias := instance.Alias
+		if alias == "" {
+			alias = "-"
+		}
+		app := instance.Application
+		t.add(instance.ID, alias, instance.IP, app.Version, instanceStatusName(app.Status), formatNullString(app.GroupID), formatTime(app.LastCheckForUpdates))
+	}
+	return t
+}
+
+func listInstances(cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	appRef := flags.String("app", "", "Application id or name")
+	groupRef := flags.String("group", "", "Group id or name, all the groups of the application if empty")
+	status := flags.String("status", "", "Only list the instances with this status, e.g. error or on-hold")
+	version := flags.String("version", "", "Only list the instances running this version")
+	duration := flags.String("duration", "1d", "Only list the instances that checked for updates in this period (1h, 1d, 7d or 30d)")
+	if err := cli.parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	query := url.Values{}
+	query.Set("duration", *duration)
+	if *status != "" {
+		s, err := instanceStatusFromName(*status)
+		if err != nil {
+			return err
+		}
+		query.Set("status", strconv.Itoa(s))
+	}
+	if *version != "" {
+		query.Set("version", *version)
+	}
+
+	app, err := cli.findApp(*appRef)
+	if err != nil {
+		return err
+	}
+	var groups []*api.Group
+	if *groupRef != "" {
+		group, err := cli.findGroup(app, *groupRef)
+		if err != nil {
+			return err
+		}
+		groups = []*api.Group{group}
+	} else if groups, err = cli.getGroups(app.ID); err != nil {
+		return err
+	}
+
+	instances := []*api.Instance{}
+	for _, group := range groups {
+		err := cli.client.getAll("/apps/"+app.ID+"/groups/"+group.ID+"/instances", query, func(get func(out interface{}) error) (int, error) {
+			var page api.InstancesWithTotal
+			if err := get(&page); err != nil {
+				return 0, err
+			}
+			instances = append(instances, page.Instances...)
+			return len(page.Instances), nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	t := instancesTable(instances...)
+	groupNames := make(map[string]string, len(groups))
+	for _, group := range groups {
+		groupNames[group.ID] = group.Name
+	}
+	for i, instance := range instances {
+		if name, ok := groupNames[instance.Application.GroupID.String]; ok {
+			t.rows[i][5] = name
+		}
+	}
+	return cli.printer.print(instances, t)
+}
+
+func getInstance(cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	appRef := flags.String("app", "", "Application id or name")
+	groupRef := flags.String("group", "", "Group id or name")
+	if err := cli.parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	app, err := cli.findApp(*appRef)
+	if err != nil {
+		return err
+	}
+	group, err := cli.findGroup(app, *groupRef)
+	if err != nil {
+		return err
+	}
+	path := "/apps/" + app.ID + "/groups/" + group.ID + "/instances/" + url.PathEscape(flags.Arg(0))
+	instance := &api.Instance{}
+	if err := cli.client.get(path, nil, instance); err != nil {
+		return err
+	}
+	var history []*api.InstanceStatusHistoryEntry
+	if err := cli.client.get(path+"/status_history", nil, &history); err != nil {
+		return err
+	}
+
+	if cli.printer.format == outputJSON {
+		return cli.printer.print(struct {
+			*api.Instance
+			StatusHistory []*api.InstanceStatusHistoryEntry `json:"status_history"`
+		}{instance, history}, nil)
+	}
+	if err := cli.printer.print(nil, instancesTable(instance)); err != nil {
+		return err
+	}
+	cli.printer.message("")
+	t := &table{headers: []string{"TIME", "STATUS", "VERSION", "ERROR CODE"}}
+	for _, entry := range history {
+		t.add(formatTime(entry.CreatedTs), instanceStatusName(null.IntFrom(int64(entry.Status))), entry.Version, formatNullString(entry.ErrorCode))
+	}
+	return cli.printer.print(nil, t)
+}
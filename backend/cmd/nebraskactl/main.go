@@ -0,0 +1,173 @@
+// nebraskactl is a command line client for Nebraska's REST API. It
+// authenticates with an API token and prints the resources as tables or as
+// JSON, so it can be used both interactively and from scripts.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	serverEnvName = "NEBRASKA_URL"
+	tokenEnvName  = "NEBRASKA_TOKEN"
+
+	defaultServer = "http://localhost:8000"
+)
+
+// errUsage is returned when the command line is not valid, after the usage
+// has been printed.
+var errUsage = errors.New("invalid usage")
+
+// errGroupWithoutApp is returned when a group is passed without the
+// application it belongs to.
+var errGroupWithoutApp = errors.New("the application of the group must be passed with -app")
+
+// command is an action on a resource, e.g. "groups pause".
+type command struct {
+	usage       string
+	description string
+	run         func(cli *cli, args []string) error
+}
+
+// cli holds what the commands need to talk to Nebraska and print results.
+type cli struct {
+	client  *client
+	printer *printer
+	stderr  io.Writer
+	// name and cmd are the command being run, e.g. "groups pause".
+	name string
+	cmd  *command
+}
+
+var resources = map[string]map[string]*command{
+	"apps":      appsCommands,
+	"groups":    groupsCommands,
+	"channels":  channelsCommands,
+	"packages":  packagesCommands,
+	"instances": instancesCommands,
+	"activity":  activityCommands,
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if err != errUsage {
+			fmt.Fprintf(os.Stderr, "nebraskactl: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("nebraskactl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	server := flags.String("server", envOrDefault(serverEnvName, defaultServer), "URL of the Nebraska server; can be taken from "+serverEnvName+" env var too")
+	token := flags.String("token", os.Getenv(tokenEnvName), "API token used to authenticate; can be taken from "+tokenEnvName+" env var too")
+	output := flags.String("o", outputTable, "Output format, "+outputTable+" or "+outputJSON)
+	flags.Usage = func() { printUsage(stderr, flags) }
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return errUsage
+	}
+	if *output != outputTable && *output != outputJSON {
+		return fmt.Errorf("invalid output format %q", *output)
+	}
+
+	args = flags.Args()
+	if len(args) < 2 {
+		printUsage(stderr, flags)
+		return errUsage
+	}
+	commands, ok := resources[args[0]]
+	if !ok {
+		printUsage(stderr, flags)
+		return errUsage
+	}
+	cmd, ok := commands[args[1]]
+	if !ok {
+		fmt.Fprintf(stderr, "Unknown action %q for %s, available actions:\n", args[1], args[0])
+		printCommands(stderr, args[0], commands)
+		return errUsage
+	}
+	if *token == "" {
+		return fmt.Errorf("an API token must be passed with -token or the %s env var", tokenEnvName)
+	}
+
+	c := &cli{
+		client:  newClient(*server, *token),
+		printer: &printer{format: *output, w: stdout},
+		stderr:  stderr,
+		name:    args[0] + " " + args[1],
+		cmd:     cmd,
+	}
+	return cmd.run(c, args[2:])
+}
+
+// newFlagSet returns the flag set parsing the arguments of the command run.
+func (cli *cli) newFlagSet() *flag.FlagSet {
+	flags := flag.NewFlagSet(cli.name, flag.ContinueOnError)
+	flags.SetOutput(cli.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(cli.stderr, "Usage: nebraskactl %s %s\n\n%s\n", cli.name, cli.cmd.usage, cli.cmd.description)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags parses the arguments of a command, which must have as many
+// positional arguments as expected.
+func (cli *cli) parseFlags(flags *flag.FlagSet, args []string, positional int) error {
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != positional {
+		flags.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func printUsage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: nebraskactl [flags] <resource> <action> [action flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags:")
+	flags.PrintDefaults()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Actions:")
+	for _, resource := range sortedKeys(resources) {
+		printCommands(w, resource, resources[resource])
+	}
+}
+
+func printCommands(w io.Writer, resource string, commands map[string]*command) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s %s %s\n      %s\n", resource, name, commands[name].usage, commands[name].description)
+	}
+}
+
+func sortedKeys(m map[string]map[string]*command) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func envOrDefault(name, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
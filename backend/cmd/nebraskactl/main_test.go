@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+)
+
+const testToken = "nbr_test"
+
+// fakeServer serves the API requests made by the commands from canned
+// replies, and records the updates sent.
+type fakeServer struct {
+	t       *testing.T
+	replies map[string]interface{}
+	updates map[string]map[string]interface{}
+	queries map[string]string
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, *httptest.Server) {
+	fs := &fakeServer{
+		t: t,
+		replies: map[string]interface{}{
+			"/api/apps": []*api.Application{
+				{ID: "app1", Name: "Flatcar"},
+			},
+			"/api/apps/app1/groups": []*api.Group{
+				{ID: "group1", Name: "stable", ApplicationID: "app1", PolicyUpdatesEnabled: true},
+				{ID: "group2", Name: "beta", ApplicationID: "app1", PolicyUpdatesEnabled: true},
+			},
+			"/api/apps/app1/channels": []*api.Channel{
+				{ID: "channel1", Name: "stable", ApplicationID: "app1", Arch: api.ArchAMD64, PackageID: null.StringFrom("pkg1")},
+				{ID: "channel2", Name: "stable", ApplicationID: "app1", Arch: api.ArchAArch64},
+			},
+			"/api/apps/app1/packages": []*api.Package{
+				{ID: "pkg1", Version: "1.0.0", Arch: api.ArchAMD64},
+				{ID: "pkg2", Version: "2.0.0", Arch: api.ArchAMD64},
+			},
+			"/api/apps/app1/groups/group1/instances": api.InstancesWithTotal{
+				TotalInstances: 1,
+				Instances: []*api.Instance{
+					{ID: "instance1", IP: "10.0.0.1", Application: api.InstanceApplication{GroupID: null.StringFrom("group1"), Status: null.IntFrom(int64(api.InstanceStatusError))}},
+				},
+			},
+			"/api/apps/app1/groups/group2/instances": api.InstancesWithTotal{},
+		},
+		updates: map[string]map[string]interface{}{},
+		queries: map[string]string{},
+	}
+	return fs, httptest.NewServer(fs)
+}
+
+func (fs *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	fs.queries[r.URL.Path] = r.URL.RawQuery
+	if r.Method == http.MethodPut {
+		update := map[string]interface{}{}
+		require.NoError(fs.t, json.NewDecoder(r.Body).Decode(&update))
+		fs.updates[r.URL.Path] = update
+		require.NoError(fs.t, json.NewEncoder(w).Encode(update))
+		return
+	}
+	reply, ok := fs.replies[r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	require.NoError(fs.t, json.NewEncoder(w).Encode(reply))
+}
+
+func runForTest(t *testing.T, server *httptest.Server, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-server", server.URL, "-token", testToken}, args...)
+	err := run(args, &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestPromotePackage(t *testing.T) {
+	fs, server := newFakeServer(t)
+	defer server.Close()
+
+	_, err := runForTest(t, server, "packages", "promote", "-app", "Flatcar", "-channel", "stable", "2.0.0")
+	require.NoError(t, err)
+	require.Contains(t, fs.updates, "/api/apps/app1/channels/channel1")
+	assert.Equal(t, "pkg2", fs.updates["/api/apps/app1/channels/channel1"]["package_id"])
+	assert.NotContains(t, fs.updates, "/api/apps/app1/channels/channel2")
+
+	_, err = runForTest(t, server, "packages", "promote", "-app", "Flatcar", "-channel", "alpha", "2.0.0")
+	assert.Error(t, err)
+	_, err = runForTest(t, server, "packages", "promote", "-app", "Flatcar", "2.0.0")
+	assert.Error(t, err)
+}
+
+func TestPauseGroup(t *testing.T) {
+	fs, server := newFakeServer(t)
+	defer server.Close()
+
+	out, err := runForTest(t, server, "groups", "pause", "-app", "app1", "stable")
+	require.NoError(t, err)
+	require.Contains(t, fs.updates, "/api/apps/app1/groups/group1")
+	assert.Equal(t, false, fs.updates["/api/apps/app1/groups/group1"]["policy_updates_enabled"])
+	assert.Equal(t, "Updates paused in group \"stable\"\n", out)
+
+	_, err = runForTest(t, server, "groups", "pause", "-app", "app1", "unknown")
+	assert.Error(t, err)
+}
+
+func TestListInstancesInError(t *testing.T) {
+	fs, server := newFakeServer(t)
+	defer server.Close()
+
+	out, err := runForTest(t, server, "-o", "json", "instances", "list", "-app", "Flatcar", "-status", "error")
+	require.NoError(t, err)
+	assert.Contains(t, fs.queries["/api/apps/app1/groups/group1/instances"], "status=3")
+	assert.Contains(t, fs.queries["/api/apps/app1/groups/group2/instances"], "status=3")
+
+	var instances []*api.Instance
+	require.NoError(t, json.Unmarshal([]byte(out), &instances))
+	require.Len(t, instances, 1)
+	assert.Equal(t, "instance1", instances[0].ID)
+
+	out, err = runForTest(t, server, "instances", "list", "-app", "Flatcar", "-status", "error")
+	require.NoError(t, err)
+	assert.Contains(t, out, "instance1")
+	assert.Contains(t, out, "stable")
+
+	_, err = runForTest(t, server, "instances", "list", "-app", "Flatcar", "-status", "broken")
+	assert.Error(t, err)
+}
+
+func TestRunErrors(t *testing.T) {
+	_, server := newFakeServer(t)
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	assert.Error(t, run([]string{"-server", server.URL, "apps", "list"}, &stdout, &stderr))
+	assert.Equal(t, errUsage, run([]string{"-token", testToken, "apps"}, &stdout, &stderr))
+	assert.Equal(t, errUsage, run([]string{"-token", testToken, "apps", "delete"}, &stdout, &stderr))
+
+	_, err := runForTest(t, server, "-token", "nbr_wrong", "apps", "list")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "401")
+}
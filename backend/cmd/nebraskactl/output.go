@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// printer prints the results of the commands, either as a table or as the
+// JSON returned by the API.
+type printer struct {
+	format string
+	w      io.Writer
+}
+
+// table is printed with a column per header and a row per item.
+type table struct {
+	headers []string
+	rows    [][]string
+}
+
+func (t *table) add(columns ...string) {
+	t.rows = append(t.rows, columns)
+}
+
+// print prints v as JSON, or the table provided otherwise.
+func (p *printer) print(v interface{}, t *table) error {
+	if p.format == outputJSON {
+		encoder := json.NewEncoder(p.w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.headers, "\t"))
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// message prints a confirmation of an action, only in table output so the
+// JSON output can always be parsed.
+func (p *printer) message(format string, args ...interface{}) {
+	if p.format == outputTable {
+		fmt.Fprintf(p.w, format+"\n", args...)
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func formatNullString(s null.String) string {
+	if !s.Valid || s.String == "" {
+		return "-"
+	}
+	return s.String
+}
+
+func formatBool(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
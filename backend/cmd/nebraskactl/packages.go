@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+)
+
+var packagesCommands = map[string]*command{
+	"list": {
+		usage:       "-app <app>",
+		description: "List the packages of an application.",
+		run:         listPackages,
+	},
+	"get": {
+		usage:       "-app <app> [-arch <arch>] <package>",
+		description: "Show a package, referred to by id or version.",
+		run:         getPackage,
+	},
+	"promote": {
+		usage:       "-app <app> -channel <channel> [-arch <arch>] <package>",
+		description: "Point a channel to a package, referred to by id or version.",
+		run:         promotePackage,
+	},
+}
+
+func packagesTable(pkgs ...*api.Package) *table {
+	t := &table{headers: []string{"ID", "VERSION", "ARCH", "URL", "FILENAME", "CREATED"}}
+	for _, pkg := range pkgs {
+		t.add(pkg.ID, pkg.Version, pkg.Arch.String(), pkg.URL, formatNullString(pkg.Filename), formatTime(pkg.CreatedTs))
+	}
+	return t
+}
+
+func listPackages(cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	appRef := flags.String("app", "", "Application id or name")
+	if err := cli.parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	app, err := cli.findApp(*appRef)
+	if err != nil {
+		return err
+	}
+	pkgs, err := cli.getPackages(app.ID)
+	if err != nil {
+		return err
+	}
+	return cli.printer.print(pkgs, packagesTable(pkgs...))
+}
+
+func getPackage(cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	appRef := flags.String("app", "", "Application id or name")
+	arch := flags.String("arch", "", "Architecture of the package, required if the version is used by several")
+	if err := cli.parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	app, err := cli.findApp(*appRef)
+	if err != nil {
+		return err
+	}
+	pkg, err := cli.findPackage(app, flags.Arg(0), *arch)
+	if err != nil {
+		return err
+	}
+	return cli.printer.print(pkg, packagesTable(pkg))
+}
+
+func promotePackage(cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	appRef := flags.String("app", "", "Application id or name")
+	channelRef := flags.String("channel", "", "Id or name of the channel the package is promoted to")
+	arch := flags.String("arch", "", "Architecture of the package and channel, required if their names are used by several")
+	if err := cli.parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	if *channelRef == "" {
+		return fmt.Errorf("the channel must be passed with -channel")
+	}
+	app, err := cli.findApp(*appRef)
+	if err != nil {
+		return err
+	}
+	pkg, err := cli.findPackage(app, flags.Arg(0), *arch)
+	if err != nil {
+		return err
+	}
+	channel, err := cli.findChannel(app, *channelRef, pkg.Arch.String())
+	if err != nil {
+		return err
+	}
+
+	if channel.PackageID.String != pkg.ID {
+		channel.PackageID = null.StringFrom(pkg.ID)
+		updated := &api.Channel{}
+		if err := cli.client.put("/apps/"+app.ID+"/channels/"+channel.ID, channel, updated); err != nil {
+			return err
+		}
+		channel = updated
+	}
+	cli.printer.message("Channel %q (%s) now points to package %s", channel.Name, channel.Arch, pkg.Version)
+	if cli.printer.format == outputJSON {
+		return cli.printer.print(channel, nil)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+)
+
+// The resources can be referred to by id or by name in the command line.
+// Channels and packages are only unique per architecture, so an arch must
+// be provided when the name is ambiguous.
+
+func (cli *cli) getApps() ([]*api.Application, error) {
+	var apps []*api.Application
+	err := cli.client.getAll("/apps", nil, func(get func(out interface{}) error) (int, error) {
+		var page []*api.Application
+		if err := get(&page); err != nil {
+			return 0, err
+		}
+		apps = append(apps, page...)
+		return len(page), nil
+	})
+	return apps, err
+}
+
+func (cli *cli) findApp(ref string) (*api.Application, error) {
+	if ref == "" {
+		return nil, fmt.Errorf("the application must be passed with -app")
+	}
+	apps, err := cli.getApps()
+	if err != nil {
+		return nil, err
+	}
+	for _, app := range apps {
+		if app.ID == ref {
+			return app, nil
+		}
+	}
+	for _, app := range apps {
+		if app.Name == ref {
+			return app, nil
+		}
+	}
+	return nil, fmt.Errorf("application %q not found", ref)
+}
+
+func (cli *cli) getGroups(appID string) ([]*api.Group, error) {
+	var groups []*api.Group
+	err := cli.client.getAll("/apps/"+appID+"/groups", nil, func(get func(out interface{}) error) (int, error) {
+		var page []*api.Group
+		if err := get(&page); err != nil {
+			return 0, err
+		}
+		groups = append(groups, page...)
+		return len(page), nil
+	})
+	return groups, err
+}
+
+func (cli *cli) findGroup(app *api.Application, ref string) (*api.Group, error) {
+	groups, err := cli.getGroups(app.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if group.ID == ref {
+			return group, nil
+		}
+	}
+	for _, group := range groups {
+		if group.Name == ref {
+			return group, nil
+		}
+	}
+	return nil, fmt.Errorf("group %q not found in application %q", ref, app.Name)
+}
+
+func (cli *cli) getChannels(appID string) ([]*api.Channel, error) {
+	var channels []*api.Channel
+	err := cli.client.getAll("/apps/"+appID+"/channels", nil, func(get func(out interface{}) error) (int, error) {
+		var page []*api.Channel
+		if err := get(&page); err != nil {
+			return 0, err
+		}
+		channels = append(channels, page...)
+		return len(page), nil
+	})
+	return channels, err
+}
+
+func (cli *cli) findChannel(app *api.Application, ref, arch string) (*api.Channel, error) {
+	channels, err := cli.getChannels(app.ID)
+	if err != nil {
+		return nil, err
+	}
+	var matches []*api.Channel
+	for _, channel := range channels {
+		if channel.ID == ref {
+			return channel, nil
+		}
+		if channel.Name == ref && (arch == "" || channel.Arch.String() == arch) {
+			matches = append(matches, channel)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("channel %q not found in application %q", ref, app.Name)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("there are channels named %q for several architectures, use -arch to pick one", ref)
+	}
+}
+
+func (cli *cli) getPackages(appID string) ([]*api.Package, error) {
+	var pkgs []*api.Package
+	err := cli.client.getAll("/apps/"+appID+"/packages", nil, func(get func(out interface{}) error) (int, error) {
+		var page []*api.Package
+		if err := get(&page); err != nil {
+			return 0, err
+		}
+		pkgs = append(pkgs, page...)
+		return len(page), nil
+	})
+	return pkgs, err
+}
+
+// findPackage finds a package by id, or by version.
+func (cli *cli) findPackage(app *api.Application, ref, arch string) (*api.Package, error) {
+	pkgs, err := cli.getPackages(app.ID)
+	if err != nil {
+		return nil, err
+	}
+	var matches []*api.Package
+	for _, pkg := range pkgs {
+		if pkg.ID == ref {
+			return pkg, nil
+		}
+		if pkg.Version == ref && (arch == "" || pkg.Arch.String() == arch) {
+			matches = append(matches, pkg)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("package %q not found in application %q", ref, app.Name)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("there are packages with version %q for several architectures, use -arch to pick one", ref)
+	}
+}
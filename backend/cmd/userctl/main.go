@@ -1,7 +1,9 @@
 package main
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"os"
@@ -9,6 +11,10 @@ import (
 	"github.com/kinvolk/nebraska/backend/pkg/api"
 )
 
+const (
+	passwordEnvName = "NEBRASKA_USER_PASSWORD"
+)
+
 func main() {
 	a, err := api.New()
 	if err != nil {
@@ -19,8 +25,16 @@ func main() {
 	addTeamF := flag.String("add-team", "", "Add team")
 	addUserToTeamF := flag.String("add-user-to-team", "", "Add user to team (must use -add-team to specify the team, the team must exist)")
 	changeTeamNameToF := flag.String("change-team-name-to", "", "Change team name to the passed value (must use -add-team to specify the team to change)")
+	setPasswordOfF := flag.String("set-password-of", "", "Set the password of the user (must use -password or the "+passwordEnvName+" env var to specify the password)")
+	passwordF := flag.String("password", "", "Password of the user added with -add-user-to-team or changed with -set-password-of, a random one is generated for new users if not passed; can be taken from "+passwordEnvName+" env var too")
+	upgradeLegacySecretsF := flag.Bool("upgrade-legacy-secrets", false, "Hash with argon2id the legacy md5 secrets of the users who haven't logged in since passwords are hashed")
 	flag.Parse()
 
+	password := *passwordF
+	if password == "" {
+		password = os.Getenv(passwordEnvName)
+	}
+
 	if *listTeamsF {
 		teams := getTeams(a)
 		say("teams:")
@@ -41,8 +55,33 @@ func main() {
 		if *addTeamF == "" {
 			fail(`use the "-add-team" flag to specify the team where the user should be added`)
 		}
-		addUserToTeam(a, *addUserToTeamF, *addTeamF)
+		generated := password == ""
+		if generated {
+			password = generatePassword()
+		}
+		addUserToTeam(a, *addUserToTeamF, *addTeamF, password)
 		say("user %q added to team %q", *addUserToTeamF, *addTeamF)
+		if generated {
+			say("password: %s", password)
+		}
+		return
+	}
+	if *setPasswordOfF != "" {
+		if password == "" {
+			fail(`use the "-password" flag or the %s env var to specify the new password`, passwordEnvName)
+		}
+		if err := a.UpdateUserPassword(*setPasswordOfF, password); err != nil {
+			fail("failed to set the password of user %q: %v", *setPasswordOfF, err)
+		}
+		say("password of user %q changed", *setPasswordOfF)
+		return
+	}
+	if *upgradeLegacySecretsF {
+		upgraded, err := a.UpgradeLegacyUserSecrets()
+		if err != nil {
+			fail("failed to upgrade legacy secrets: %v", err)
+		}
+		say("%d legacy secrets upgraded", upgraded)
 		return
 	}
 	if *changeTeamNameToF != "" {
@@ -71,7 +110,7 @@ func getUsersInTeam(a *api.API, teamName string) []*api.User {
 	return users
 }
 
-func addUserToTeam(a *api.API, userToAdd, teamName string) *api.User {
+func addUserToTeam(a *api.API, userToAdd, teamName, password string) *api.User {
 	_, err := a.GetUser(userToAdd)
 	if err != sql.ErrNoRows {
 		if err == nil {
@@ -80,7 +119,10 @@ func addUserToTeam(a *api.API, userToAdd, teamName string) *api.User {
 		fail("failed to check if user %q exists", userToAdd)
 	}
 	teamID := getTeamIDFor(a, teamName)
-	secret, err := a.GenerateUserSecret(userToAdd, userToAdd)
+	if len(password) < api.MinPasswordLength {
+		fail("the password must be at least %d characters long", api.MinPasswordLength)
+	}
+	secret, err := api.HashPassword(password)
 	if err != nil {
 		fail("failed to generate secret for user %q: %v", userToAdd, err)
 	}
@@ -97,6 +139,14 @@ func addUserToTeam(a *api.API, userToAdd, teamName string) *api.User {
 	return user
 }
 
+func generatePassword() string {
+	data := make([]byte, 18)
+	if _, err := rand.Read(data); err != nil {
+		fail("failed to generate password: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
 func addTeam(a *api.API, teamName string) *api.Team {
 	ensureNoTeam(a, teamName)
 	team := &api.Team{
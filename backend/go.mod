@@ -19,6 +19,7 @@ require (
 	github.com/kevinburke/go-bindata v3.22.0+incompatible
 	github.com/kinvolk/go-omaha v0.0.1
 	github.com/lib/pq v1.10.1
+	github.com/minio/minio-go/v7 v7.0.10
 	github.com/prometheus/client_golang v1.10.0
 	github.com/rs/zerolog v1.21.0
 	github.com/rubenv/sql-migrate v0.0.0-20210408115534-a32ed26c37ea
@@ -29,6 +30,8 @@ require (
 	github.com/swaggo/swag v1.7.0
 	github.com/tidwall/gjson v1.8.0
 	github.com/ziutek/mymysql v1.5.4 // indirect
+	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2
 	golang.org/x/oauth2 v0.0.0-20210427180440-81ed05c6b58c
 	gopkg.in/guregu/null.v4 v4.0.0
+	gopkg.in/yaml.v2 v2.4.0
 )
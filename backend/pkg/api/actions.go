@@ -24,6 +24,8 @@ type FlatcarAction struct {
 
 // AddFlatcarAction registers the provided Omaha Flatcar action.
 func (api *API) AddFlatcarAction(action *FlatcarAction) (*FlatcarAction, error) {
+	defer api.invalidateUpdateCache()
+
 	query, _, err := goqu.Insert("flatcar_action").
 		Cols("event", "chromeos_version", "sha256", "needs_admin", "is_delta", "disable_payload_backoff", "metadata_signature_rsa", "metadata_size", "deadline", "package_id").
 		Vals(goqu.Vals{
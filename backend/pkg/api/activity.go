@@ -1,15 +1,13 @@
 package api
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"net/http"
-	"os"
 	"time"
 
 	"github.com/doug-martin/goqu/v9"
 	"gopkg.in/guregu/null.v4"
+
+	"github.com/kinvolk/nebraska/backend/pkg/notify"
 )
 
 const (
@@ -19,6 +17,8 @@ const (
 	activityRolloutFailed
 	activityInstanceUpdateFailed
 	activityChannelPackageUpdated
+	activityRolloutPaused
+	activityChannelRolledBack
 )
 
 const (
@@ -28,6 +28,28 @@ const (
 	activityError
 )
 
+// activityClassNames contains the names used to identify activity classes in
+// notifications.
+var activityClassNames = map[int]string{
+	activityPackageNotFound:       "package_not_found",
+	activityRolloutStarted:        "rollout_started",
+	activityRolloutFinished:       "rollout_finished",
+	activityRolloutFailed:         "rollout_failed",
+	activityInstanceUpdateFailed:  "instance_update_failed",
+	activityChannelPackageUpdated: "channel_package_updated",
+	activityRolloutPaused:         "rollout_paused",
+	activityChannelRolledBack:     "channel_rolled_back",
+}
+
+// activitySeverityNames contains the names used to identify activity
+// severities in notifications.
+var activitySeverityNames = map[int]string{
+	activitySuccess: "success",
+	activityInfo:    "info",
+	activityWarning: "warning",
+	activityError:   "error",
+}
+
 // activityContext represents the context of a given activity entry.
 type activityContext struct {
 	appID      string
@@ -50,6 +72,28 @@ type Activity struct {
 	InstanceID      null.String `db:"instance_id" json:"instance_id"`
 }
 
+// ClassName returns the name identifying the class of the activity entry.
+func (a *Activity) ClassName() string {
+	return activityClassNames[a.Class]
+}
+
+// SeverityName returns the name identifying the severity of the activity
+// entry.
+func (a *Activity) SeverityName() string {
+	return activitySeverityNames[a.Severity]
+}
+
+// ActivitySeverityFromName returns the severity identified by the name
+// provided (success, info, warning or error).
+func ActivitySeverityFromName(name string) (int, error) {
+	for severity, severityName := range activitySeverityNames {
+		if severityName == name {
+			return severity, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid activity severity %q", name)
+}
+
 // ActivityQueryParams represents a helper structure used to pass a set of
 // parameters when querying activity entries.
 type ActivityQueryParams struct {
@@ -218,7 +262,9 @@ func (api *API) newGroupActivityEntry(class int, severity int, version, appID, g
 		appID:   appID,
 		groupID: groupID,
 	}
-	go api.postHipchat(class, severity, version, ctx)
+	api.afterCommit(func(api *API) {
+		api.notify(class, severity, version, ctx)
+	})
 
 	return nil
 }
@@ -243,7 +289,9 @@ func (api *API) newChannelActivityEntry(class int, severity int, version, appID,
 		appID:     appID,
 		channelID: channelID,
 	}
-	go api.postHipchat(class, severity, version, ctx)
+	api.afterCommit(func(api *API) {
+		api.notify(class, severity, version, ctx)
+	})
 
 	return nil
 }
@@ -269,72 +317,69 @@ func (api *API) newInstanceActivityEntry(class int, severity int, version, appID
 		groupID:    groupID,
 		instanceID: instanceID,
 	}
-	go api.postHipchat(class, severity, version, ctx)
+	api.afterCommit(func(api *API) {
+		api.notify(class, severity, version, ctx)
+	})
 
 	return nil
 }
 
-// EXPERIMENTAL! This is an experiment playing a bit with Hipchat
-//
-// postHipchat builds and posts a message representing the activity entry
-// provided to Hipchat. This is just an experiment.
-func (api *API) postHipchat(class, severity int, version string, ctx *activityContext) {
-	room := os.Getenv("CR_HIPCHAT_ROOM")
-	token := os.Getenv("CR_HIPCHAT_TOKEN")
-	if room == "" || token == "" {
+// notify sends a notification representing the activity entry provided using
+// the API notifier, if any.
+func (api *API) notify(class, severity int, version string, ctx *activityContext) {
+	if api.notifier == nil {
 		return
 	}
 
-	var msg bytes.Buffer
-	var color string
-
-	app, _ := api.GetApp(ctx.appID)
-	fmt.Fprintf(&msg, "<b>%s</b> ", app.Name)
+	n := &notify.Notification{
+		Class:      activityClassNames[class],
+		Severity:   activitySeverityNames[severity],
+		Version:    version,
+		AppID:      ctx.appID,
+		GroupID:    ctx.groupID,
+		ChannelID:  ctx.channelID,
+		InstanceID: ctx.instanceID,
+		CreatedTs:  nowUTC(),
+	}
 
+	if app, err := api.GetApp(ctx.appID); err == nil {
+		n.AppName = app.Name
+	}
 	if ctx.groupID != "" {
-		group, _ := api.GetGroup(ctx.groupID)
-		fmt.Fprintf(&msg, "> <b>%s</b>", group.Name)
+		if group, err := api.GetGroup(ctx.groupID); err == nil {
+			n.GroupName = group.Name
+		}
+	}
+	if ctx.channelID != "" {
+		if channel, err := api.GetChannel(ctx.channelID); err == nil {
+			n.ChannelName = channel.Name
+		}
 	}
-	fmt.Fprint(&msg, "<br/>")
 
 	switch class {
 	case activityPackageNotFound:
-		fmt.Fprint(&msg, "An update request could not be processed because the group's channel is not linked to any package")
-		color = "red"
+		n.Message = "An update request could not be processed because the group's channel is not linked to any package"
 	case activityRolloutStarted:
-		fmt.Fprintf(&msg, "Version <i>%s</i> roll out started", version)
-		color = "purple"
+		n.Message = fmt.Sprintf("Version %s roll out started", version)
 	case activityRolloutFinished:
-		fmt.Fprintf(&msg, "Version <i>%s</i> successfully rolled out", version)
-		color = "green"
+		n.Message = fmt.Sprintf("Version %s successfully rolled out", version)
 	case activityRolloutFailed:
-		fmt.Fprintf(&msg, "There was an error rolling out version <i>%s</i> as the first update attempt failed. Group's updates have been disabled", version)
-		color = "red"
+		n.Message = fmt.Sprintf("There was an error rolling out version %s as the first update attempt failed. Group's updates have been disabled", version)
 	case activityInstanceUpdateFailed:
-		instance, _ := api.GetInstance(ctx.instanceID, ctx.appID)
-		fmt.Fprintf(&msg, "Instance <i>%s</i> reported an error while processing update to version <i>%s</i>", instance.IP, version)
-		color = "yellow"
+		instanceIP := ctx.instanceID
+		if instance, err := api.GetInstance(ctx.instanceID, ctx.appID); err == nil {
+			instanceIP = instance.IP
+		}
+		n.Message = fmt.Sprintf("Instance %s reported an error while processing update to version %s", instanceIP, version)
 	case activityChannelPackageUpdated:
-		channel, _ := api.GetChannel(ctx.channelID)
-		fmt.Fprintf(&msg, "Channel <i>%s</i> is now pointing to version <i>%s</i>", channel.Name, version)
-		color = "purple"
+		n.Message = fmt.Sprintf("Channel %s is now pointing to version %s", n.ChannelName, version)
+	case activityRolloutPaused:
+		n.Message = fmt.Sprintf("Version %s roll out paused as its failure rate exceeded the group's maximum. Group's updates have been disabled", version)
+	case activityChannelRolledBack:
+		n.Message = fmt.Sprintf("Channel %s was rolled back to version %s after a failed roll out", n.ChannelName, version)
 	}
 
-	body := map[string]interface{}{
-		"message_format": "html",
-		"message":        msg.String(),
-		"color":          color,
-		"notify":         true,
-	}
-	bodyJSON, err := json.Marshal(body)
-	if err != nil {
-		return
-	}
-
-	url := "https://api.hipchat.com/v2/room/%s/notification?auth_token=%s"
-	resp, err := http.Post(fmt.Sprintf(url, room, token), "application/json", bytes.NewReader(bodyJSON))
-	if err != nil {
-		return
+	if err := api.notifier.Notify(n); err != nil {
+		logger.Error().Err(err).Str("class", n.Class).Msg("notify - could not send activity notification")
 	}
-	resp.Body.Close()
 }
@@ -6,7 +6,10 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/guregu/null.v4"
+
+	"github.com/kinvolk/nebraska/backend/pkg/notify"
 )
 
 func TestGetActivity(t *testing.T) {
@@ -65,3 +68,40 @@ func TestGetActivity(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Nil(t, activityEntries, "Team with this id doesn't exist")
 }
+
+type notifierFunc func(n *notify.Notification) error
+
+func (f notifierFunc) Notify(n *notify.Notification) error {
+	return f(n)
+}
+
+func TestActivityNotifications(t *testing.T) {
+	notifications := make(chan *notify.Notification, 1)
+	a, err := NewForTest(OptionInitDB, OptionNotifier(notifierFunc(func(n *notify.Notification) error {
+		notifications <- n
+		return nil
+	})))
+	require.NoError(t, err)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tGroup, _ := a.AddGroup(&Group{Name: "group1", ApplicationID: tApp.ID, PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes"})
+
+	err = a.newGroupActivityEntry(activityRolloutFailed, activityError, "12.1.0", tApp.ID, tGroup.ID)
+	require.NoError(t, err)
+
+	select {
+	case n := <-notifications:
+		assert.Equal(t, "rollout_failed", n.Class)
+		assert.Equal(t, "error", n.Severity)
+		assert.Equal(t, "12.1.0", n.Version)
+		assert.Equal(t, tApp.ID, n.AppID)
+		assert.Equal(t, "test_app", n.AppName)
+		assert.Equal(t, tGroup.ID, n.GroupID)
+		assert.Equal(t, "group1", n.GroupName)
+		assert.Contains(t, n.Message, "12.1.0")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for notification")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/jmoiron/sqlx"
 	migrate "github.com/rubenv/sql-migrate"
 
+	"github.com/kinvolk/nebraska/backend/pkg/notify"
 	"github.com/kinvolk/nebraska/backend/pkg/util"
 
 	// Postgresql driver
@@ -57,13 +58,28 @@ var (
 
 // API represents an api instance used to interact with Nebraska entities.
 type API struct {
-	db       *sqlx.DB
+	db       database
+	conn     *sqlx.DB
 	dbDriver string
 	dbURL    string
 
+	// committed holds the functions to run once the transaction the API
+	// is running in is committed (see RunInTransaction).
+	committed *[]func(*API)
+
 	// disableUpdatesOnFailedRollout defines wether to disable updates
 	// after a first rollout attempt failed (ResultFailed)
 	disableUpdatesOnFailedRollout bool
+
+	// notifier is used to send notifications about new activity entries.
+	notifier notify.Notifier
+
+	// cache caches the data used to serve updates, when enabled.
+	cache *updateCache
+
+	// checkins buffers the instances check-ins not changing their state,
+	// when enabled.
+	checkins *checkinBuffer
 }
 
 // New creates a new API instance, creating the underlying db connection and
@@ -79,11 +95,12 @@ func New(options ...func(*API) error) (*API, error) {
 	}
 
 	var err error
-	api.db, err = sqlx.Open(api.dbDriver, api.dbURL)
+	api.conn, err = sqlx.Open(api.dbDriver, api.dbURL)
 	if err != nil {
 		return nil, err
 	}
-	if err := api.db.Ping(); err != nil {
+	api.db = dbPool{api.conn}
+	if err := api.conn.Ping(); err != nil {
 		return nil, err
 	}
 
@@ -107,9 +124,9 @@ func New(options ...func(*API) error) (*API, error) {
 		connMaxLifetime = dBConnMaxLifetime
 	}
 
-	api.db.SetMaxOpenConns(maxOpenConns)
-	api.db.SetMaxIdleConns(maxIdleConns)
-	api.db.SetConnMaxLifetime(time.Duration(connMaxLifetime) * time.Second)
+	api.conn.SetMaxOpenConns(maxOpenConns)
+	api.conn.SetMaxIdleConns(maxIdleConns)
+	api.conn.SetConnMaxLifetime(time.Duration(connMaxLifetime) * time.Second)
 
 	for _, option := range options {
 		err := option(api)
@@ -124,7 +141,7 @@ func New(options ...func(*API) error) (*API, error) {
 		AssetDir: AssetDir,
 		Dir:      "db/migrations",
 	}
-	if _, err := migrate.Exec(api.db.DB, "postgres", migrations, migrate.Up); err != nil {
+	if _, err := migrate.Exec(api.conn.DB, "postgres", migrations, migrate.Up); err != nil {
 		return nil, err
 	}
 	api.updateCachedGroups()
@@ -157,9 +174,26 @@ func OptionDisableUpdatesOnFailedRollout(api *API) error {
 	return nil
 }
 
-// Close releases the connections to the database.
+// OptionNotifier will modify API to send notifications about new activity
+// entries using the notifier provided.
+func OptionNotifier(notifier notify.Notifier) func(*API) error {
+	return func(api *API) error {
+		api.notifier = notifier
+
+		return nil
+	}
+}
+
+// Close releases the connections to the database, once the check-ins buffered
+// have been written.
 func (api *API) Close() {
-	_ = api.db.DB.Close()
+	if api.checkins != nil {
+		api.checkins.close()
+	}
+	if api.cache != nil {
+		api.cache.close()
+	}
+	_ = api.conn.Close()
 }
 
 // NewForTest creates a new API instance with given options and fills
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"gopkg.in/guregu/null.v4"
+)
+
+// API token kinds.
+const (
+	// APITokenKindPersonal tokens act on behalf of the user who owns them.
+	APITokenKindPersonal = "personal"
+	// APITokenKindServiceAccount tokens act on behalf of a service account,
+	// like a CI pipeline, not tied to any user.
+	APITokenKindServiceAccount = "service_account"
+
+	// APITokenPrefix is the prefix of all API tokens, so they can be told
+	// apart from other bearer tokens.
+	APITokenPrefix = "nbr_"
+
+	apiTokenRandomBytes = 32
+	apiTokenPrefixLen   = len(APITokenPrefix) + 8
+
+	// apiTokenLastUsedResolution is how often the last use of a token is
+	// recorded, so authenticating requests doesn't write to the database
+	// every time.
+	apiTokenLastUsedResolution = time.Minute
+)
+
+var (
+	// ErrInvalidAPIToken indicates that the API token provided is not valid,
+	// e.g. because it has no scopes or its kind is unknown.
+	ErrInvalidAPIToken = errors.New("nebraska: invalid api token")
+
+	// ErrAPITokenRejected indicates that the API token used to authenticate
+	// doesn't exist, has expired or has been revoked.
+	ErrAPITokenRejected = errors.New("nebraska: api token rejected")
+)
+
+// APIToken represents a long-lived token used to authenticate API requests
+// made on behalf of a team. The token itself is only known when it's
+// created, only its hash is stored.
+type APIToken struct {
+	ID         string      `db:"id" json:"id"`
+	TeamID     string      `db:"team_id" json:"-"`
+	Name       string      `db:"name" json:"name"`
+	Kind       string      `db:"kind" json:"kind"`
+	Owner      string      `db:"owner" json:"owner"`
+	Scopes     StringArray `db:"scopes" json:"scopes"`
+	Prefix     string      `db:"token_prefix" json:"prefix"`
+	CreatedBy  string      `db:"created_by" json:"created_by"`
+	CreatedTs  time.Time   `db:"created_ts" json:"created_ts"`
+	ExpiresTs  null.Time   `db:"expires_ts" json:"expires_ts"`
+	LastUsedTs null.Time   `db:"last_used_ts" json:"last_used_ts"`
+	RevokedTs  null.Time   `db:"revoked_ts" json:"revoked_ts"`
+}
+
+// Active checks if the token can still be used to authenticate requests.
+func (t *APIToken) Active() bool {
+	if t.RevokedTs.Valid {
+		return false
+	}
+	return !t.ExpiresTs.Valid || t.ExpiresTs.Time.After(time.Now())
+}
+
+// Username returns the name requests authenticated with the token are made
+// on behalf of.
+func (t *APIToken) Username() string {
+	if t.Kind == APITokenKindServiceAccount {
+		return "service-account/" + t.Owner
+	}
+	return t.Owner
+}
+
+func hashAPIToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// AddAPIToken registers the API token provided, returning the secret token
+// to be used in the Authorization header of the requests. Its scopes are the
+// permissions granted to requests authenticated with it.
+func (api *API) AddAPIToken(token *APIToken) (string, error) {
+	if token.Kind != APITokenKindPersonal && token.Kind != APITokenKindServiceAccount {
+		return "", ErrInvalidAPIToken
+	}
+	if len(token.Scopes) == 0 || (token.ExpiresTs.Valid && token.ExpiresTs.Time.Before(time.Now())) {
+		return "", ErrInvalidAPIToken
+	}
+	if err := validatePermissions(token.Scopes); err != nil {
+		return "", err
+	}
+
+	data := make([]byte, apiTokenRandomBytes)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	secret := APITokenPrefix + base64.RawURLEncoding.EncodeToString(data)
+	token.Prefix = secret[:apiTokenPrefixLen]
+
+	query, _, err := goqu.Insert("api_token").
+		Cols("team_id", "name", "kind", "owner", "scopes", "token_prefix", "token_hash", "created_by", "expires_ts").
+		Vals(goqu.Vals{
+			token.TeamID,
+			token.Name,
+			token.Kind,
+			token.Owner,
+			pq.Array([]string(token.Scopes)),
+			token.Prefix,
+			hashAPIToken(secret),
+			token.CreatedBy,
+			token.ExpiresTs,
+		}).
+		Returning("id", "created_ts").
+		ToSQL()
+	if err != nil {
+		return "", err
+	}
+	if err := api.db.QueryRowx(query).Scan(&token.ID, &token.CreatedTs); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// GetAPIToken returns the API token of the team identified by the id
+// provided.
+func (api *API) GetAPIToken(teamID, tokenID string) (*APIToken, error) {
+	query, _, err := api.apiTokensQuery().
+		Where(goqu.C("id").Eq(tokenID), goqu.C("team_id").Eq(teamID)).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	var token APIToken
+	if err := api.db.QueryRowx(query).StructScan(&token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetAPITokens returns the API tokens of the team provided. When an owner is
+// provided, only the personal tokens of that user are returned.
+func (api *API) GetAPITokens(teamID, owner string) ([]*APIToken, error) {
+	query := api.apiTokensQuery().
+		Where(goqu.C("team_id").Eq(teamID)).
+		Order(goqu.C("created_ts").Desc())
+	if owner != "" {
+		query = query.Where(goqu.C("kind").Eq(APITokenKindPersonal), goqu.C("owner").Eq(owner))
+	}
+	q, _, err := query.ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := api.db.Queryx(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tokens []*APIToken
+	for rows.Next() {
+		token := &APIToken{}
+		if err := rows.StructScan(token); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RevokeAPIToken revokes the API token of the team identified by the id
+// provided. Revoked tokens are kept, but can't be used anymore.
+func (api *API) RevokeAPIToken(teamID, tokenID string) error {
+	query, _, err := goqu.Update("api_token").
+		Set(goqu.Record{"revoked_ts": nowUTC()}).
+		Where(goqu.C("id").Eq(tokenID), goqu.C("team_id").Eq(teamID), goqu.C("revoked_ts").IsNull()).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	return api.execAffectingRows(query)
+}
+
+// revokeUserAPITokens revokes the personal tokens the user identified by the
+// username provided owns in the given team, as the permissions they were
+// granted with may not be the user's anymore.
+func revokeUserAPITokens(tx sqlx.Execer, teamID, username string) error {
+	query, _, err := goqu.Update("api_token").
+		Set(goqu.Record{"revoked_ts": nowUTC()}).
+		Where(
+			goqu.C("team_id").Eq(teamID),
+			goqu.C("kind").Eq(APITokenKindPersonal),
+			goqu.C("owner").Eq(username),
+			goqu.C("revoked_ts").IsNull(),
+		).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(query)
+	return err
+}
+
+// AuthenticateAPIToken returns the active API token matching the secret
+// provided, recording its use. Uses are recorded at most once a minute per
+// token.
+func (api *API) AuthenticateAPIToken(secret string) (*APIToken, error) {
+	if !strings.HasPrefix(secret, APITokenPrefix) {
+		return nil, ErrAPITokenRejected
+	}
+	query, _, err := api.apiTokensQuery().
+		Where(goqu.C("token_hash").Eq(hashAPIToken(secret))).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	var token APIToken
+	switch err := api.db.QueryRowx(query).StructScan(&token); err {
+	case nil:
+	case sql.ErrNoRows:
+		return nil, ErrAPITokenRejected
+	default:
+		return nil, err
+	}
+	if !token.Active() {
+		return nil, ErrAPITokenRejected
+	}
+	if token.LastUsedTs.Valid && time.Since(token.LastUsedTs.Time) < apiTokenLastUsedResolution {
+		return &token, nil
+	}
+
+	query, _, err = goqu.Update("api_token").
+		Set(goqu.Record{"last_used_ts": nowUTC()}).
+		Where(goqu.C("id").Eq(token.ID)).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := api.db.Exec(query); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// apiTokensQuery returns a SelectDataset prepared to return all API tokens,
+// leaving out their hashes.
+func (api *API) apiTokensQuery() *goqu.SelectDataset {
+	return goqu.From("api_token").
+		Select("id", "team_id", "name", "kind", "owner", "scopes", "token_prefix", "created_by", "created_ts", "expires_ts", "last_used_ts", "revoked_ts")
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestAPITokens(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam1, _ := a.AddTeam(&Team{Name: "team1"})
+	tTeam2, _ := a.AddTeam(&Team{Name: "team2"})
+
+	_, err := a.AddAPIToken(&APIToken{TeamID: tTeam1.ID, Name: "ci", Kind: "robot", Owner: "ci", Scopes: []string{PermissionAll}})
+	assert.Equal(t, ErrInvalidAPIToken, err)
+	_, err = a.AddAPIToken(&APIToken{TeamID: tTeam1.ID, Name: "ci", Kind: APITokenKindServiceAccount, Owner: "ci"})
+	assert.Equal(t, ErrInvalidAPIToken, err)
+	_, err = a.AddAPIToken(&APIToken{TeamID: tTeam1.ID, Name: "ci", Kind: APITokenKindServiceAccount, Owner: "ci", Scopes: []string{"packages:fly"}})
+	assert.Equal(t, ErrInvalidPermission, err)
+	_, err = a.AddAPIToken(&APIToken{TeamID: tTeam1.ID, Name: "ci", Kind: APITokenKindServiceAccount, Owner: "ci", Scopes: []string{PermissionAll}, ExpiresTs: null.TimeFrom(time.Now().Add(-time.Hour))})
+	assert.Equal(t, ErrInvalidAPIToken, err)
+
+	ciToken := &APIToken{TeamID: tTeam1.ID, Name: "ci", Kind: APITokenKindServiceAccount, Owner: "release-pipeline", Scopes: []string{"packages:*", PermissionChannelsUpdate}, CreatedBy: "alice"}
+	ciSecret, err := a.AddAPIToken(ciToken)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(ciSecret, APITokenPrefix))
+	assert.True(t, strings.HasPrefix(ciSecret, ciToken.Prefix))
+	assert.NotEmpty(t, ciToken.ID)
+
+	personalToken := &APIToken{TeamID: tTeam1.ID, Name: "laptop", Kind: APITokenKindPersonal, Owner: "alice", Scopes: []string{PermissionAppsRead}, ExpiresTs: null.TimeFrom(time.Now().Add(time.Hour))}
+	personalSecret, err := a.AddAPIToken(personalToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, ciSecret, personalSecret)
+
+	token, err := a.AuthenticateAPIToken(ciSecret)
+	assert.NoError(t, err)
+	assert.Equal(t, ciToken.ID, token.ID)
+	assert.Equal(t, tTeam1.ID, token.TeamID)
+	assert.Equal(t, StringArray{"packages:*", PermissionChannelsUpdate}, token.Scopes)
+	assert.Equal(t, "service-account/release-pipeline", token.Username())
+
+	token, err = a.AuthenticateAPIToken(personalSecret)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", token.Username())
+
+	_, err = a.AuthenticateAPIToken(APITokenPrefix + "unknown")
+	assert.Equal(t, ErrAPITokenRejected, err)
+	_, err = a.AuthenticateAPIToken("Bearer " + ciSecret)
+	assert.Equal(t, ErrAPITokenRejected, err)
+
+	tokens, err := a.GetAPITokens(tTeam1.ID, "")
+	assert.NoError(t, err)
+	assert.Len(t, tokens, 2)
+	assert.True(t, tokens[0].LastUsedTs.Valid)
+	tokens, err = a.GetAPITokens(tTeam1.ID, "alice")
+	assert.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, personalToken.ID, tokens[0].ID)
+	tokens, err = a.GetAPITokens(tTeam2.ID, "")
+	assert.NoError(t, err)
+	assert.Empty(t, tokens)
+
+	_, err = a.GetAPIToken(tTeam2.ID, ciToken.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	assert.Equal(t, ErrNoRowsAffected, a.RevokeAPIToken(tTeam2.ID, ciToken.ID))
+	assert.NoError(t, a.RevokeAPIToken(tTeam1.ID, ciToken.ID))
+	assert.Equal(t, ErrNoRowsAffected, a.RevokeAPIToken(tTeam1.ID, ciToken.ID))
+	_, err = a.AuthenticateAPIToken(ciSecret)
+	assert.Equal(t, ErrAPITokenRejected, err)
+
+	token, err = a.GetAPIToken(tTeam1.ID, ciToken.ID)
+	assert.NoError(t, err)
+	assert.False(t, token.Active())
+}
+
+func TestAPITokensLastUsed(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "team1"})
+	token := &APIToken{TeamID: tTeam.ID, Name: "ci", Kind: APITokenKindServiceAccount, Owner: "ci", Scopes: []string{PermissionAppsRead}}
+	secret, err := a.AddAPIToken(token)
+	require.NoError(t, err)
+
+	_, err = a.AuthenticateAPIToken(secret)
+	require.NoError(t, err)
+	token, err = a.GetAPIToken(tTeam.ID, token.ID)
+	require.NoError(t, err)
+	require.True(t, token.LastUsedTs.Valid)
+	lastUsed := token.LastUsedTs.Time
+
+	// Uses within a minute of the last recorded one are not recorded.
+	_, err = a.AuthenticateAPIToken(secret)
+	require.NoError(t, err)
+	token, err = a.GetAPIToken(tTeam.ID, token.ID)
+	require.NoError(t, err)
+	assert.True(t, lastUsed.Equal(token.LastUsedTs.Time))
+}
+
+func TestAPITokensRevokedWithPermissions(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "team1"})
+	tRole, _ := a.AddRole(&Role{TeamID: tTeam.ID, Name: "release manager", Permissions: []string{"channels:*"}})
+	tRole2, _ := a.AddRole(&Role{TeamID: tTeam.ID, Name: "packager", Permissions: []string{"packages:*"}})
+	require.NoError(t, a.AddTeamMember(tTeam.ID, "alice"))
+	binding, err := a.AddRoleBinding(tTeam.ID, &RoleBinding{RoleID: tRole.ID, SubjectType: SubjectTypeUser, Subject: "alice"})
+	require.NoError(t, err)
+	_, err = a.AddRoleBinding(tTeam.ID, &RoleBinding{RoleID: tRole2.ID, SubjectType: SubjectTypeUser, Subject: "bob"})
+	require.NoError(t, err)
+
+	addToken := func(kind, owner string) string {
+		secret, err := a.AddAPIToken(&APIToken{TeamID: tTeam.ID, Name: owner, Kind: kind, Owner: owner, Scopes: []string{PermissionChannelsRead}})
+		require.NoError(t, err)
+		return secret
+	}
+	authenticates := func(secret string) bool {
+		_, err := a.AuthenticateAPIToken(secret)
+		return err == nil
+	}
+
+	// Removing a role binding of a user revokes their personal tokens.
+	aliceSecret := addToken(APITokenKindPersonal, "alice")
+	ciSecret := addToken(APITokenKindServiceAccount, "alice")
+	require.NoError(t, a.DeleteRoleBinding(tTeam.ID, binding.ID))
+	assert.False(t, authenticates(aliceSecret))
+	assert.True(t, authenticates(ciSecret))
+
+	// And so does removing them from the team.
+	aliceSecret = addToken(APITokenKindPersonal, "alice")
+	require.NoError(t, a.RemoveTeamMember(tTeam.ID, "alice"))
+	assert.False(t, authenticates(aliceSecret))
+	assert.True(t, authenticates(ciSecret))
+
+	// Or deleting a role bound to them.
+	bobSecret := addToken(APITokenKindPersonal, "bob")
+	require.NoError(t, a.DeleteRole(tTeam.ID, tRole2.ID))
+	assert.False(t, authenticates(bobSecret))
+	assert.True(t, authenticates(ciSecret))
+}
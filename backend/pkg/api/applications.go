@@ -27,11 +27,15 @@ type Application struct {
 	} `db:"instances" json:"instances,omitempty"`
 }
 
-// AddApp registers the provided application.
+// AddApp registers the provided application. An id is generated for it
+// unless the application provided has one already.
 func (api *API) AddApp(app *Application) (*Application, error) {
+	record := goqu.Record{"name": app.Name, "description": app.Description, "team_id": app.TeamID}
+	if app.ID != "" {
+		record["id"] = app.ID
+	}
 	query, _, err := goqu.Insert("application").
-		Cols("name", "description", "team_id").
-		Vals(goqu.Vals{app.Name, app.Description, app.TeamID}).
+		Rows(record).
 		Returning(goqu.T("application").All()).
 		ToSQL()
 	if err != nil {
@@ -125,6 +129,8 @@ func (api *API) UpdateApp(app *Application) error {
 
 // DeleteApp removes the application identified by the id provided.
 func (api *API) DeleteApp(appID string) error {
+	defer api.invalidateUpdateCache()
+
 	query, _, err := goqu.Delete("application").Where(goqu.C("id").Eq(appID)).ToSQL()
 	if err != nil {
 		return err
@@ -194,10 +200,15 @@ func (api *API) GetApps(teamID string, page, perPage uint64) ([]*Application, er
 	defer rows.Close()
 	for rows.Next() {
 		app := Application{}
-		err := rows.StructScan(&app)
-		if err != nil {
+		if err := rows.StructScan(&app); err != nil {
 			return nil, err
 		}
+		apps = append(apps, &app)
+	}
+	if err := closeRows(rows); err != nil {
+		return nil, err
+	}
+	for _, app := range apps {
 		groups, err := api.getGroups(app.ID)
 		if err == nil || err == sql.ErrNoRows {
 			app.Groups = groups
@@ -214,10 +225,6 @@ func (api *API) GetApps(teamID string, page, perPage uint64) ([]*Application, er
 		if err != nil {
 			return nil, err
 		}
-		apps = append(apps, &app)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
 	}
 	return apps, nil
 }
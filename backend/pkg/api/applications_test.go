@@ -35,6 +35,11 @@ func TestAddApp(t *testing.T) {
 
 	_, err = a.AddApp(&Application{Name: "app2", TeamID: "invalidTeamID"})
 	assert.Error(t, err, "Team id must be a valid uuid.")
+
+	appID := uuid.New().String()
+	newApp, err = a.AddApp(&Application{ID: appID, Name: "app3", TeamID: tTeam.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, appID, newApp.ID)
 }
 
 func TestAddAppCloning(t *testing.T) {
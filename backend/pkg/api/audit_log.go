@@ -0,0 +1,200 @@
+package api
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"gopkg.in/guregu/null.v4"
+)
+
+// AuditEntry represents a change made to Nebraska's resources through the
+// API, along with who made it and the state of the resource changed before
+// and after it.
+type AuditEntry struct {
+	ID            int64       `db:"id" json:"id"`
+	TeamID        string      `db:"team_id" json:"-"`
+	CreatedTs     time.Time   `db:"created_ts" json:"created_ts"`
+	Actor         string      `db:"actor" json:"actor"`
+	Action        string      `db:"action" json:"action"`
+	Method        string      `db:"method" json:"method"`
+	Route         string      `db:"route" json:"route"`
+	TargetType    string      `db:"target_type" json:"target_type"`
+	TargetID      string      `db:"target_id" json:"target_id"`
+	ApplicationID null.String `db:"application_id" json:"application_id"`
+	Status        int         `db:"status" json:"status"`
+	RequestID     string      `db:"request_id" json:"request_id"`
+	Before        AuditData   `db:"before" json:"before"`
+	After         AuditData   `db:"after" json:"after"`
+	Changes       AuditData   `db:"changes" json:"changes"`
+}
+
+// AuditEntriesWithTotal represents a page of audit entries along with the
+// total number of entries matching the query.
+type AuditEntriesWithTotal struct {
+	TotalEntries uint64        `json:"total"`
+	Entries      []*AuditEntry `json:"entries"`
+}
+
+// AuditQueryParams represents the criteria used to filter the audit entries.
+type AuditQueryParams struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	AppID      string
+	RequestID  string
+	Start      time.Time
+	End        time.Time
+	Page       uint64
+	PerPage    uint64
+}
+
+// AuditData represents the JSON representation of a resource, stored as
+// JSON.
+type AuditData map[string]interface{}
+
+// Scan implements the sql.Scanner interface.
+func (d *AuditData) Scan(src interface{}) error {
+	return scanJSON(src, d)
+}
+
+// Value implements the driver.Valuer interface.
+func (d AuditData) Value() (driver.Value, error) {
+	if d == nil {
+		return nil, nil
+	}
+	return valueJSON(d)
+}
+
+// AuditChanges returns the fields that differ between the two states of a
+// resource provided, along with their values before and after the change.
+func AuditChanges(before, after AuditData) AuditData {
+	if before == nil || after == nil {
+		return nil
+	}
+	changes := AuditData{}
+	addChange := func(field string) {
+		if _, ok := changes[field]; ok || reflect.DeepEqual(before[field], after[field]) {
+			return
+		}
+		changes[field] = map[string]interface{}{"before": before[field], "after": after[field]}
+	}
+	for field := range before {
+		addChange(field)
+	}
+	for field := range after {
+		addChange(field)
+	}
+	return changes
+}
+
+// AddAuditEntry records the audit entry provided. Changes are computed from
+// the states before and after the change when both are available.
+func (api *API) AddAuditEntry(entry *AuditEntry) error {
+	if entry.Changes == nil {
+		entry.Changes = AuditChanges(entry.Before, entry.After)
+	}
+	query, _, err := goqu.Insert("audit_log").
+		Cols("team_id", "actor", "action", "method", "route", "target_type", "target_id", "application_id", "status", "request_id", "before", "after", "changes").
+		Vals(goqu.Vals{
+			entry.TeamID,
+			entry.Actor,
+			entry.Action,
+			entry.Method,
+			entry.Route,
+			entry.TargetType,
+			entry.TargetID,
+			entry.ApplicationID,
+			entry.Status,
+			entry.RequestID,
+			entry.Before,
+			entry.After,
+			entry.Changes,
+		}).
+		Returning("id", "created_ts").
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	return api.db.QueryRowx(query).Scan(&entry.ID, &entry.CreatedTs)
+}
+
+// GetAuditEntries returns the audit entries of the team provided that match
+// the criteria in the query parameters, newest first.
+func (api *API) GetAuditEntries(teamID string, p AuditQueryParams) (AuditEntriesWithTotal, error) {
+	query := api.auditQuery(teamID, p)
+
+	countQuery, _, err := query.Select(goqu.COUNT("*")).ToSQL()
+	if err != nil {
+		return AuditEntriesWithTotal{}, err
+	}
+	var total uint64
+	if err := api.db.QueryRow(countQuery).Scan(&total); err != nil {
+		return AuditEntriesWithTotal{}, err
+	}
+
+	p.Page, p.PerPage = validatePaginationParams(p.Page, p.PerPage)
+	limit, offset := sqlPaginate(p.Page, p.PerPage)
+	entriesQuery, _, err := query.
+		Order(goqu.C("created_ts").Desc(), goqu.C("id").Desc()).
+		Limit(limit).
+		Offset(offset).
+		ToSQL()
+	if err != nil {
+		return AuditEntriesWithTotal{}, err
+	}
+	rows, err := api.db.Queryx(entriesQuery)
+	if err != nil {
+		return AuditEntriesWithTotal{}, err
+	}
+	defer rows.Close()
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		entry := &AuditEntry{}
+		if err := rows.StructScan(entry); err != nil {
+			return AuditEntriesWithTotal{}, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return AuditEntriesWithTotal{}, err
+	}
+	return AuditEntriesWithTotal{
+		TotalEntries: total,
+		Entries:      entries,
+	}, nil
+}
+
+// auditQuery returns a SelectDataset prepared to return the audit entries of
+// the team provided matching the criteria in AuditQueryParams.
+func (api *API) auditQuery(teamID string, p AuditQueryParams) *goqu.SelectDataset {
+	query := goqu.From("audit_log").Where(goqu.C("team_id").Eq(teamID))
+
+	if p.Actor != "" {
+		query = query.Where(goqu.C("actor").Eq(p.Actor))
+	}
+	if p.Action != "" {
+		query = query.Where(goqu.C("action").Eq(p.Action))
+	}
+	if p.TargetType != "" {
+		query = query.Where(goqu.C("target_type").Eq(p.TargetType))
+	}
+	if p.TargetID != "" {
+		query = query.Where(goqu.C("target_id").Eq(p.TargetID))
+	}
+	if p.AppID != "" {
+		query = query.Where(goqu.C("application_id").Eq(p.AppID))
+	}
+	if p.RequestID != "" {
+		query = query.Where(goqu.C("request_id").Eq(p.RequestID))
+	}
+	if !p.Start.IsZero() {
+		query = query.Where(goqu.C("created_ts").Gte(p.Start.UTC()))
+	}
+	if !p.End.IsZero() {
+		query = query.Where(goqu.C("created_ts").Lt(p.End.UTC()))
+	}
+	return query
+}
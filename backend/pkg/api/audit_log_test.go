@@ -0,0 +1,79 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestAuditLog(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam1, _ := a.AddTeam(&Team{Name: "team1"})
+	tTeam2, _ := a.AddTeam(&Team{Name: "team2"})
+	tApp, _ := a.AddApp(&Application{Name: "app1", TeamID: tTeam1.ID})
+
+	entry := &AuditEntry{
+		TeamID:        tTeam1.ID,
+		Actor:         "alice",
+		Action:        "channels.update",
+		Method:        "PUT",
+		Route:         "/api/apps/:app_id/channels/:channel_id",
+		TargetType:    "channels",
+		TargetID:      "channel1",
+		ApplicationID: null.StringFrom(tApp.ID),
+		Status:        200,
+		RequestID:     "request1",
+		Before:        AuditData{"name": "stable", "color": "blue"},
+		After:         AuditData{"name": "stable", "color": "red"},
+	}
+	require.NoError(t, a.AddAuditEntry(entry))
+	assert.NotZero(t, entry.ID)
+	assert.Equal(t, AuditData{"color": map[string]interface{}{"before": "blue", "after": "red"}}, entry.Changes)
+
+	require.NoError(t, a.AddAuditEntry(&AuditEntry{TeamID: tTeam1.ID, Actor: "bob", Action: "groups.delete", Method: "DELETE", Route: "/api/apps/:app_id/groups/:group_id", TargetType: "groups", TargetID: "group1", Status: 204}))
+	require.NoError(t, a.AddAuditEntry(&AuditEntry{TeamID: tTeam1.ID, Actor: "alice", Action: "apps.create", Method: "POST", Route: "/api/apps", TargetType: "apps", Status: 400}))
+	require.NoError(t, a.AddAuditEntry(&AuditEntry{TeamID: tTeam2.ID, Actor: "alice", Action: "apps.create", Method: "POST", Route: "/api/apps", TargetType: "apps", Status: 200}))
+
+	result, err := a.GetAuditEntries(tTeam1.ID, AuditQueryParams{})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), result.TotalEntries)
+	require.Len(t, result.Entries, 3)
+	assert.Equal(t, "apps.create", result.Entries[0].Action)
+	assert.Nil(t, result.Entries[0].Before)
+	assert.Equal(t, entry.After, result.Entries[2].After)
+	assert.Equal(t, entry.Changes, result.Entries[2].Changes)
+
+	result, err = a.GetAuditEntries(tTeam1.ID, AuditQueryParams{Actor: "alice", Page: 1, PerPage: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), result.TotalEntries)
+	assert.Len(t, result.Entries, 1)
+
+	result, err = a.GetAuditEntries(tTeam1.ID, AuditQueryParams{TargetType: "channels", TargetID: "channel1", AppID: tApp.ID, RequestID: "request1"})
+	assert.NoError(t, err)
+	require.Len(t, result.Entries, 1)
+	assert.Equal(t, entry.ID, result.Entries[0].ID)
+
+	result, err = a.GetAuditEntries(tTeam1.ID, AuditQueryParams{Action: "groups.delete", Start: time.Now().Add(-time.Hour), End: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), result.TotalEntries)
+
+	result, err = a.GetAuditEntries(tTeam1.ID, AuditQueryParams{End: time.Now().Add(-time.Hour)})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Entries)
+}
+
+func TestAuditChanges(t *testing.T) {
+	assert.Nil(t, AuditChanges(nil, AuditData{"name": "a"}))
+	assert.Nil(t, AuditChanges(AuditData{"name": "a"}, nil))
+	assert.Empty(t, AuditChanges(AuditData{"name": "a"}, AuditData{"name": "a"}))
+	assert.Equal(t, AuditData{
+		"name":  map[string]interface{}{"before": "a", "after": "b"},
+		"color": map[string]interface{}{"before": nil, "after": "red"},
+		"arch":  map[string]interface{}{"before": float64(1), "after": nil},
+	}, AuditChanges(AuditData{"name": "a", "arch": float64(1)}, AuditData{"name": "b", "color": "red"}))
+}
@@ -1,6 +1,6 @@
 // Code generated by go-bindata. DO NOT EDIT.
 // sources:
-// db/drop_all_tables.sql (781B)
+// db/drop_all_tables.sql (1.253kB)
 // db/sample_data.sql (16.109kB)
 // db/migrations/0001_initial.sql (7.125kB)
 // db/migrations/0002_event_data.sql (729B)
@@ -15,6 +15,21 @@
 // db/migrations/0011_add_composite_indexes.sql (760B)
 // db/migrations/0012_drop_unused_indexes.sql (696B)
 // db/migrations/0013_add_stats_indexes.sql (426B)
+// db/migrations/0014_add_group_rollout_steps.sql (965B)
+// db/migrations/0015_add_failure_rate_policy.sql (697B)
+// db/migrations/0016_add_group_update_windows.sql (309B)
+// db/migrations/0017_add_package_deltas.sql (612B)
+// db/migrations/0018_add_instance_overrides.sql (546B)
+// db/migrations/0019_add_channel_version_constraints.sql (465B)
+// db/migrations/0020_add_package_min_from_version.sql (178B)
+// db/migrations/0021_add_team_members.sql (718B)
+// db/migrations/0022_add_roles.sql (1.268kB)
+// db/migrations/0023_add_api_tokens.sql (724B)
+// db/migrations/0024_add_audit_log.sql (744B)
+// db/migrations/0025_widen_user_secret.sql (449B)
+// db/migrations/0026_add_syncer_state.sql (475B)
+// db/migrations/0027_add_cache_invalidation.sql (3.599kB)
+// db/migrations/0028_add_package_mirrors.sql (1.05kB)
 
 package api
 
@@ -83,7 +98,7 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
-var _dbDrop_all_tablesSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x92\x3d\x6e\xc3\x30\x0c\x85\xf7\x9c\x42\x5b\x27\x9f\x20\x5b\xd1\xb1\x77\x10\x9e\x69\xc6\x21\xa2\x50\x82\x48\xa7\xf5\xed\x8b\xfc\xb4\x43\xd0\x80\x9e\xf5\xf1\x23\xc5\xc7\xa9\xd7\x96\x1c\x63\xe1\x24\x87\xc4\xdf\x62\x6e\xc9\x19\xe7\x44\x30\xc2\xc4\xfb\xdd\xbf\xc8\x62\xdc\x2d\x60\xd0\x5a\x11\x82\x4b\xd5\x80\x6c\xa0\x13\x66\x0e\xa8\x43\x81\x13\x7a\x06\x6d\x50\xd2\x11\xaa\x5c\x02\x6a\xee\x75\x69\xd1\x3f\x44\xcd\xa1\x14\x8d\xf7\x8b\x65\x73\xf8\xb2\x55\x9a\xb7\x6f\xe9\xa9\x41\x3e\x8a\x79\xed\x6b\x50\xc5\x17\x56\xcf\xbe\xb6\x68\xfe\x1b\x18\x45\x4a\x2e\x17\xf1\xa8\xe7\x23\xcf\xfc\x08\x21\x8f\x05\x74\x2a\x62\x91\x7e\x82\x63\x84\x71\x3e\xcb\xdc\x6f\x2b\xb1\xfd\x6e\x18\xd2\x27\xcf\xa0\xf5\x8e\xdb\x95\xff\xe2\xb7\xce\xe9\xea\x68\xa2\xf3\xdf\x83\x26\x24\xad\x3a\xdc\xcb\x79\x4a\x1f\xef\x2f\xae\xa3\x76\xae\xf6\x7c\x49\x3f\x01\x00\x00\xff\xff\xe6\x1e\x65\x85\x0d\x03\x00\x00")
+var _dbDrop_all_tablesSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x94\x41\x8e\xf3\x30\x08\x85\xf7\x3d\x85\x77\xff\xaa\x27\xe8\xee\xd7\x2c\xe7\x0e\x16\xc1\x34\x45\x75\x8c\x05\xa4\x33\xb9\xfd\x28\xe9\xcc\xa6\xaa\x84\xd7\xf9\x78\xc0\xe3\xc5\x45\xa5\x27\x87\xa9\x52\xe2\x6b\xa2\x6f\x36\xb7\xe4\x04\x4b\x42\x30\x84\x42\x97\xd3\x5b\x64\x35\x52\x0b\x18\xe8\xbd\x32\x82\xb3\xb4\x80\xec\x80\x77\x98\x29\xa0\xae\x15\x1c\x41\x33\xe0\x80\x24\xde\xa0\x35\xaa\x01\x35\xab\xac\x3d\xda\x83\x9b\x39\x34\xa4\x41\x2c\x9b\x83\xaf\xa3\xa2\x79\xdc\xa5\x97\x06\xf9\xc6\xe6\xa2\x5b\x50\x45\x0f\x6a\x9e\x7d\xeb\xd1\xfc\x07\x18\x30\xbb\xf5\x0f\xf6\x6d\xec\x9e\xf9\xf7\x08\x79\xaa\x80\xf7\xca\xe6\x83\x75\x85\xaa\xc3\x20\xbb\xb0\xaa\xe8\xa8\x75\xf2\x20\x55\x2e\x91\x17\xfb\x1f\x90\x17\x5a\x26\x8a\x94\x0f\x52\xb8\x60\x3e\xb2\x14\xd0\x2a\x35\x6a\xbd\x23\xb9\x93\x2e\x6c\x16\x67\xe2\xa0\x27\x6e\x85\xdb\x1c\xa0\xd0\x39\xbb\xdc\x29\x92\x84\xb5\xb0\xe7\x2a\x91\x9e\x6d\x0d\x49\x8f\x30\x46\x3b\x15\x70\x98\xc0\x28\x2f\x3c\xeb\x11\x75\xbb\x9c\xce\xe7\xf4\x49\x33\xe0\xf6\x9c\xd4\xf6\x51\xbf\xe8\x9f\x52\xda\xc7\xef\xfb\x42\x7f\x1f\x5a\x82\xd4\xa4\x9d\x9f\xe5\x54\xd2\xc7\xff\xf7\x8d\x50\x94\xc4\x5e\x5f\x88\x9f\x01\x00\x5a\x40\xdb\xb0\xe5\x04\x00\x00")
 
 func dbDrop_all_tablesSqlBytes() ([]byte, error) {
 	return bindataRead(
@@ -98,8 +113,8 @@ func dbDrop_all_tablesSql() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "db/drop_all_tables.sql", size: 781, mode: os.FileMode(0644), modTime: time.Unix(1, 0)}
-	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0xde, 0xcf, 0xbe, 0xfb, 0xd5, 0xe3, 0xea, 0xab, 0xec, 0x78, 0x43, 0x41, 0x2, 0x31, 0xfc, 0x52, 0x9a, 0x8b, 0x30, 0x84, 0xc8, 0xab, 0x83, 0x9c, 0x5b, 0x64, 0xf8, 0xbe, 0xbc, 0xfd, 0x0, 0x97}}
+	info := bindataFileInfo{name: "db/drop_all_tables.sql", size: 1253, mode: os.FileMode(0644), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0x1c, 0x6e, 0xc2, 0xa9, 0x29, 0xe5, 0x7d, 0x7e, 0x70, 0x22, 0xc3, 0xc4, 0x93, 0xbb, 0x1c, 0xfa, 0xdb, 0x5d, 0x2c, 0x4f, 0xc4, 0xb3, 0x57, 0xcc, 0x75, 0xf4, 0xd0, 0xfb, 0xf6, 0xc1, 0x40, 0xb8}}
 	return a, nil
 }
 
@@ -383,6 +398,306 @@ func dbMigrations0013_add_stats_indexesSql() (*asset, error) {
 	return a, nil
 }
 
+var _dbMigrations0014_add_group_rollout_stepsSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xac\x92\xc1\x4e\xc3\x30\x10\x44\xef\xf9\x8a\xbd\xb5\x15\xaa\x14\x90\xca\x25\x94\x13\xbf\xc0\xd9\x5a\xe2\x25\x8e\xd8\x78\xad\xf5\x3a\x08\xbe\x1e\x71\x28\x0d\x50\xd1\x26\xe2\xee\x79\xe3\x9d\x99\xed\x16\xae\x86\xbe\x53\x34\x82\xc7\x54\x55\xc8\x46\x0a\x86\x4f\x4c\xd0\xa9\x94\x94\x01\xbd\x87\x56\xb8\x0c\x11\x92\x70\xdf\xbe\x39\x15\x66\x29\xe6\xb2\x51\xca\x30\xa2\xb6\x01\x75\x7d\xb3\xbb\xdd\x40\x14\x83\x58\x98\xc1\xd3\x33\x16\x36\x58\xad\x9a\xf9\x50\xd7\x47\x23\x1d\x91\x8f\xf0\xfa\xdf\xd8\x81\x90\x2d\x38\x0b\x4a\x39\x08\x7b\xf8\x34\xeb\x48\x7f\xf3\x6b\x68\x03\xb5\x2f\xb0\xbe\x08\x73\xbf\x87\x1a\x30\xfa\xcb\x4c\xef\xf6\x70\x5d\xd7\x9b\x73\x07\x4c\x21\x7f\x7c\x74\x0e\xc6\x8d\xa4\xb9\x97\x38\x29\x6e\xb7\x28\xdc\x6f\xd0\x6c\xa8\x46\xde\x59\x06\xeb\x07\xca\x86\x43\xb2\xf7\xa6\xaa\xa6\x0b\x7b\x90\xd7\x78\x72\x63\x5e\x25\x1d\xb0\x27\xe2\xcb\xcd\x02\xd1\xd7\x88\x16\x89\x7f\x16\x76\x16\x32\x55\xcf\x7a\x7c\xe8\x63\x9e\xe8\x98\x77\x53\x7d\x0c\x00\x4c\xdf\x18\xa5\xc5\x03\x00\x00")
+
+func dbMigrations0014_add_group_rollout_stepsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations0014_add_group_rollout_stepsSql,
+		"db/migrations/0014_add_group_rollout_steps.sql",
+	)
+}
+
+func dbMigrations0014_add_group_rollout_stepsSql() (*asset, error) {
+	bytes, err := dbMigrations0014_add_group_rollout_stepsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/0014_add_group_rollout_steps.sql", size: 965, mode: os.FileMode(0644), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0xfc, 0xd8, 0x7f, 0xd, 0x21, 0x92, 0x3c, 0x37, 0x96, 0xd5, 0x2b, 0xdd, 0xba, 0x19, 0x47, 0x94, 0xd2, 0x2, 0x69, 0x32, 0xdb, 0xb5, 0x2f, 0xa7, 0x63, 0x82, 0x80, 0xfd, 0x95, 0xc9, 0xfc, 0x67}}
+	return a, nil
+}
+
+var _dbMigrations0015_add_failure_rate_policySql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x91\x4d\x6a\xc3\x40\x0c\x46\xf7\x3e\xc5\xb7\x4b\x42\x09\xb8\xdd\xba\xe9\xaa\x57\xe8\x7a\x50\x66\x64\x67\x88\x22\x19\x79\x26\x69\x6f\x5f\xe8\x0f\xe4\x17\xbc\x1e\xde\x1b\xe9\x69\xbd\xc6\xd3\x21\x0f\x4e\x85\xf1\x31\x36\x0d\x49\x61\x47\xa1\xad\x30\x06\xb7\x3a\x4e\xa0\x94\x10\x4d\xea\x41\x31\x9a\xe4\xf8\x15\x0e\xf4\x19\x7a\xca\x52\x9d\xc3\x0f\x99\xb5\xf0\xc0\x0e\xb5\x02\xad\x22\x48\xdc\x53\x95\x82\x16\x71\xc7\x71\x8f\xe5\x23\xf2\x6d\x83\x16\xa4\xe9\xa1\xfa\x75\x83\xe7\xb6\x5d\x75\xf3\x26\x3b\x47\xc3\x29\x6b\xb2\x13\x8e\xe4\x71\x47\xbe\x7c\x69\x57\xb7\x03\x2e\x16\x33\xcd\x6e\x22\x5b\x8a\xfb\x60\xfa\xff\x0b\xb6\x66\xc2\xa4\xb7\xd6\x9e\x64\xe2\xee\xb2\x66\xdc\x91\x2a\xcb\x85\xda\xf9\x98\xad\x4e\x61\xa4\xb8\xa7\x81\x43\x4e\xa8\x35\x27\x38\xf7\xec\xac\x91\x27\xfc\x3d\x61\x99\xd3\x0a\xa6\x48\x2c\x5c\x18\x13\xff\x96\xee\x9a\xe6\xfc\x84\xef\x76\xd2\xbb\x47\x4c\x6e\xe3\xd5\x46\xd7\xa9\xbb\x99\xdc\x9d\xc6\x73\xd1\x3b\x11\x1f\x54\xba\x80\x6f\x33\x75\xcd\xf7\x00\x18\x87\x04\x30\xb9\x02\x00\x00")
+
+func dbMigrations0015_add_failure_rate_policySqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations0015_add_failure_rate_policySql,
+		"db/migrations/0015_add_failure_rate_policy.sql",
+	)
+}
+
+func dbMigrations0015_add_failure_rate_policySql() (*asset, error) {
+	bytes, err := dbMigrations0015_add_failure_rate_policySqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/0015_add_failure_rate_policy.sql", size: 697, mode: os.FileMode(0644), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0xfe, 0xe8, 0xc5, 0x4b, 0xf5, 0x1b, 0x19, 0x6f, 0xb7, 0x2e, 0x2, 0x22, 0x27, 0x5c, 0x79, 0x0, 0x48, 0xbe, 0x76, 0xa8, 0x62, 0xfc, 0x6f, 0x9c, 0x26, 0xc6, 0x19, 0xce, 0x68, 0x6b, 0x53, 0x5c}}
+	return a, nil
+}
+
+var _dbMigrations0016_add_group_update_windowsSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\xce\x41\xaa\xc2\x40\x0c\x87\xf1\xfd\x9c\xe2\xbf\xeb\xe2\xd1\x13\x74\xfb\xae\xe0\x4a\xa4\xa4\xcd\x58\x46\xd3\x49\x98\x26\x14\x6f\xef\x56\x44\xb4\x07\xf8\x3e\x7e\x7d\x8f\xbf\xb5\x2c\x8d\x3c\xe3\x64\x29\x91\x78\x6e\x70\x9a\x24\x63\x69\x1a\xb6\x81\x98\x31\xab\xc4\x5a\x61\x2a\x65\x7e\x8c\x61\x4c\x9e\xc7\xbd\x54\xd6\x7d\xc3\x6d\xd3\x3a\xa1\xaa\xa3\x86\x08\x38\x5f\x29\xc4\xd1\x9d\x2f\xdd\x70\x6c\x38\x09\xcd\x77\x0d\x1f\x2d\xb7\xa2\xfc\x63\x99\x5e\xd1\xff\xba\xd7\x8f\x6c\x6e\x6a\x5f\xdd\xc3\xc1\xea\x1d\x37\xa4\xe7\x00\xe0\xa1\x5d\x59\x35\x01\x00\x00")
+
+func dbMigrations0016_add_group_update_windowsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations0016_add_group_update_windowsSql,
+		"db/migrations/0016_add_group_update_windows.sql",
+	)
+}
+
+func dbMigrations0016_add_group_update_windowsSql() (*asset, error) {
+	bytes, err := dbMigrations0016_add_group_update_windowsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/0016_add_group_update_windows.sql", size: 309, mode: os.FileMode(0644), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0xe9, 0xd6, 0x84, 0x31, 0x73, 0x1b, 0xa3, 0x41, 0x16, 0x38, 0x0, 0xb6, 0xf2, 0x34, 0x80, 0xa8, 0x5d, 0xfd, 0xc8, 0xe6, 0xfb, 0x96, 0x11, 0xf2, 0x9f, 0x7a, 0x63, 0x32, 0x8d, 0x76, 0x26, 0x3e}}
+	return a, nil
+}
+
+var _dbMigrations0017_add_package_deltasSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x6c\x52\xb1\x6e\xeb\x30\x0c\x9c\xa3\xaf\xe0\x66\x1b\x2f\x01\xf2\x8c\xd8\x4b\x8a\x4e\xfd\x85\xce\x02\x2b\xd1\xb6\x10\x59\x76\x29\x29\x6d\xf2\xf5\x85\x52\x44\x76\xda\x6e\xc2\xf1\xee\x48\x91\xb7\xdb\xc1\xbf\xd1\xf4\x8c\x81\xe0\x75\x16\x42\x31\xa5\x67\xc0\x37\x4b\x60\x3a\x70\x53\x00\xfa\x34\x3e\x78\x98\x51\x9d\xb0\x27\xa9\xc9\x06\x84\x52\x6c\x8c\x86\x18\x8d\x86\x99\xcd\x88\x7c\x81\x13\x5d\x40\x53\x87\xd1\x86\x5b\x41\xf6\xe4\x28\x39\xcb\xf3\xa1\xac\xb6\x62\x73\x77\xb8\x0b\x93\xb9\x8b\xd6\x02\x53\x47\x4c\x4e\x51\xee\x02\xa5\xd1\x15\x4c\x0e\x34\x59\x0a\x04\x0a\xbd\x42\x4d\x5b\xb1\xe9\x78\x1a\xe5\x99\xd8\x9b\xc9\xc1\x19\x59\x0d\xc8\x65\xdd\x34\xd5\x62\xa7\x06\x52\x27\x28\x1f\x98\x4f\xcf\x50\x14\x69\x88\xc8\x76\x25\x6b\x7f\xcb\x12\x21\xb3\x3b\x63\xc9\xe1\x48\x59\xf2\x7f\xbf\x4f\x2e\xde\x5c\x17\xac\xbe\x41\x03\xfa\x21\x43\xed\x21\x41\x7e\xc0\xba\x69\x7f\x80\x23\x05\xd4\x18\x50\x7a\xd3\x3b\x0c\x91\x49\xb2\xc7\x4c\xaa\x9b\xb6\xca\x6b\x2c\x8a\x47\xc1\xaa\x69\x1a\xe4\x91\xf7\x7d\x3b\x2d\x83\x87\x60\x46\xf2\x01\xc7\x39\x5c\x33\x47\x45\x66\x72\x41\xe6\x5a\xfe\x79\xda\x8a\x33\xef\x91\xa0\x5c\x4e\xb4\x85\xf5\xfe\x2a\x51\x1d\x85\x58\xa7\xe5\x65\xfa\x70\x42\x68\x9e\xe6\x25\x2d\x7f\x25\xe5\x28\xbe\x06\x00\x49\xc3\x42\xf0\x64\x02\x00\x00")
+
+func dbMigrations0017_add_package_deltasSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations0017_add_package_deltasSql,
+		"db/migrations/0017_add_package_deltas.sql",
+	)
+}
+
+func dbMigrations0017_add_package_deltasSql() (*asset, error) {
+	bytes, err := dbMigrations0017_add_package_deltasSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/0017_add_package_deltas.sql", size: 612, mode: os.FileMode(0644), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0xac, 0x88, 0x72, 0x76, 0xc8, 0x4f, 0x3b, 0x70, 0xdb, 0x27, 0x2c, 0xe0, 0xdb, 0x14, 0x62, 0x36, 0x8d, 0xfa, 0x26, 0xda, 0x90, 0x1b, 0xc2, 0xc6, 0x63, 0xdc, 0x20, 0x2a, 0x81, 0x22, 0x14, 0xf4}}
+	return a, nil
+}
+
+var _dbMigrations0018_add_instance_overridesSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x74\x91\xc1\x4e\xc3\x30\x0c\x86\xcf\xcd\x53\xf8\xb6\x56\x74\x12\x42\xea\x69\x88\x13\xaf\xc0\xb9\xf2\x12\x77\xb3\x96\x26\x91\xe3\x14\xc6\xd3\xa3\x0e\xd1\x75\x13\xbb\x55\xb5\xf3\xf9\xb3\xff\xed\x16\x9e\x46\x3e\x08\x2a\xc1\x47\x32\xc6\x0a\xcd\x9f\x8a\x7b\x4f\xc0\x03\x84\xa8\x40\x5f\x9c\x35\x03\x87\xac\x18\x2c\xf5\x71\x22\x11\x76\x04\xb5\xa9\x96\x9f\xec\x60\x42\xb1\x47\x94\xba\x7b\x6e\x2e\xef\x42\xf1\x1e\x84\x06\x12\x0a\x96\xae\x00\xa8\xd9\x35\x10\x03\x38\xf2\xa4\x04\x16\xb3\x45\x47\xad\xa9\x30\x25\xcf\x16\x95\x63\xe8\xd9\x41\x29\xec\xfe\x25\xad\xfa\x1e\xc3\x02\x4d\x24\x7d\x49\x6e\x5e\x68\x1f\xa3\x27\x9c\x47\x0e\x58\xbc\xc2\x80\x3e\xd3\xc2\x6e\x4d\x95\x38\x04\x72\xfd\x44\x92\x67\xea\xdf\x2e\x2f\x5d\xd7\x80\x3d\x92\x3d\x41\x7d\xd7\xf2\xfa\x06\x9b\x4d\xd3\x9a\xea\x20\xb1\xa4\xc5\x77\xa5\x79\x29\xe4\x7b\xc3\x4c\xcb\xd0\xdf\x6b\xbb\x5e\x33\x28\x8f\x94\x15\xc7\xa4\xdf\x8b\xa4\x2d\x22\x14\xb4\x5f\x6a\x37\xc2\xc2\x23\xca\x19\x4e\x74\x86\x7a\x15\x43\x0b\xb7\x57\x6c\x4c\xb3\x33\x66\x9d\xf3\x7b\xfc\x0c\xc6\x38\x89\xe9\x9a\xf3\xa3\x8c\x77\xe6\x67\x00\x50\x53\x26\x1e\x22\x02\x00\x00")
+
+func dbMigrations0018_add_instance_overridesSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations0018_add_instance_overridesSql,
+		"db/migrations/0018_add_instance_overrides.sql",
+	)
+}
+
+func dbMigrations0018_add_instance_overridesSql() (*asset, error) {
+	bytes, err := dbMigrations0018_add_instance_overridesSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/0018_add_instance_overrides.sql", size: 546, mode: os.FileMode(0644), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0x43, 0x4, 0x34, 0x19, 0xc7, 0xf1, 0xe0, 0xb7, 0xc0, 0xfc, 0x9e, 0x67, 0x34, 0x90, 0x97, 0xae, 0xd6, 0x24, 0xcb, 0xed, 0xfc, 0x4b, 0x71, 0xba, 0x66, 0x0, 0x57, 0xe7, 0xe3, 0x3f, 0xd3, 0xab}}
+	return a, nil
+}
+
+var _dbMigrations0019_add_channel_version_constraintsSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x90\x3d\x6a\xc4\x30\x14\x84\x7b\x9d\x62\xba\xb5\x09\xdb\x04\xb6\x72\x48\x95\x2b\xa4\x36\x2f\xd2\x64\x2d\x56\x7e\x32\x4f\xb2\x73\xfd\x34\x0e\x18\x22\xf0\xd6\xf3\xc7\x7c\xd7\x2b\x5e\xe6\x78\x37\xa9\xc4\xe7\xe2\x9c\xa4\x4a\x43\x95\xaf\x44\xf8\x49\x54\x99\x20\x21\xc0\xe7\xb4\xce\x8a\x8d\x56\x62\xd6\xd1\x67\x2d\xd5\x24\x6a\xc5\x26\xe6\x27\xb1\xee\xf5\x76\xeb\xe1\x27\xfa\x07\xba\x86\xed\xed\x1d\x97\x4b\x3f\x9c\x0d\xcc\x51\xc7\x3d\xdd\x6c\x3e\xea\x4f\x56\x1a\x4b\x4e\x1b\xc3\xb8\x88\x7f\xc8\x9d\x63\x0c\x58\xd7\x18\x60\xfc\xa6\x51\x3d\x0b\x76\x09\x5d\x0c\x3d\xb2\x22\x30\xb1\x12\x85\x15\xba\xa6\x34\x38\x77\x04\xf5\x91\x7f\xb4\x8d\x2a\x58\x5e\xfe\x76\xff\x43\x18\x4e\x33\x87\x7b\xe7\xe6\xc6\xb1\xc1\xfd\x0e\x00\x57\x8d\x58\x76\xd1\x01\x00\x00")
+
+func dbMigrations0019_add_channel_version_constraintsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations0019_add_channel_version_constraintsSql,
+		"db/migrations/0019_add_channel_version_constraints.sql",
+	)
+}
+
+func dbMigrations0019_add_channel_version_constraintsSql() (*asset, error) {
+	bytes, err := dbMigrations0019_add_channel_version_constraintsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/0019_add_channel_version_constraints.sql", size: 465, mode: os.FileMode(0644), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0x9a, 0xf1, 0xa7, 0x10, 0x62, 0x60, 0x7d, 0xd8, 0x69, 0xe0, 0x99, 0xa7, 0xc1, 0x97, 0x6c, 0x8d, 0xf3, 0x57, 0xd3, 0x5a, 0xfa, 0x27, 0xfe, 0x7f, 0xc5, 0x24, 0xb, 0x5c, 0x8c, 0x98, 0x81, 0xb2}}
+	return a, nil
+}
+
+var _dbMigrations0020_add_package_min_from_versionSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x74\xcd\xb1\x0e\x82\x30\x10\x06\xe0\xfd\x9e\xe2\xdf\x80\x18\x16\x13\x26\x8c\x93\xaf\xe0\x4c\xce\xe3\x84\x86\xb6\xd7\x9c\x15\x5f\xdf\xd5\x44\xdd\xbf\xe4\xeb\x7b\x1c\x52\x58\x9c\xab\xe2\x5a\x88\x38\x56\x75\x54\xbe\x45\x45\x61\xd9\x78\x51\xf0\x3c\x43\x2c\x3e\x53\x46\x0a\x79\xba\xbb\xa5\x69\x57\x7f\x04\xcb\xd8\xd9\x65\x65\x6f\x8f\xc3\xd0\x41\x56\x95\x0d\xed\x17\x3a\x9d\xd1\x34\xdd\x48\xf4\xb9\x5d\xec\x95\x7f\x7f\xb3\x5b\xf9\x17\x8e\xf4\x1e\x00\x85\xbe\x69\x80\xb2\x00\x00\x00")
+
+func dbMigrations0020_add_package_min_from_versionSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations0020_add_package_min_from_versionSql,
+		"db/migrations/0020_add_package_min_from_version.sql",
+	)
+}
+
+func dbMigrations0020_add_package_min_from_versionSql() (*asset, error) {
+	bytes, err := dbMigrations0020_add_package_min_from_versionSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/0020_add_package_min_from_version.sql", size: 178, mode: os.FileMode(0644), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0xa4, 0xdc, 0x3c, 0xb2, 0x74, 0x6e, 0x68, 0x5e, 0xa7, 0x43, 0x5a, 0x4c, 0x2a, 0xdd, 0xac, 0xa5, 0x89, 0x17, 0x7e, 0x8e, 0x1, 0x7a, 0xcd, 0x72, 0xd0, 0xbd, 0x38, 0x1, 0x56, 0xe9, 0xa5, 0x97}}
+	return a, nil
+}
+
+var _dbMigrations0021_add_team_membersSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xb4\x92\xb1\x4e\xc3\x30\x10\x86\xe7\xdc\x53\xdc\xd6\x44\xa4\x0b\x12\x2c\x41\x4c\xbc\x02\x73\x74\xb5\xff\xb6\x56\x63\x3b\xba\xd8\xd0\xf2\xf4\xa8\x29\x24\x41\x42\xed\x02\x5b\x22\x7f\xfe\xef\xbf\x4f\x5e\xaf\xf9\xce\xbb\x9d\x4a\x02\xbf\xf6\x44\x46\x71\xfe\x4c\xb2\xe9\xc0\x6e\xcb\x21\x26\xc6\xd1\x0d\x69\xe0\x04\xf1\xad\x87\xdf\x40\xb9\xa4\x62\xfc\x75\x96\x73\x76\x76\xc4\x42\xee\x3a\x56\x6c\xa1\x08\x06\x17\x9e\x4b\x67\x2b\x8e\x81\x2d\x3a\x24\xb0\x91\xc1\x88\x45\x4d\x45\x1e\xa0\x41\x3c\xf8\x4d\xd4\xec\x45\xcb\xfb\x87\xc7\x6a\xce\x31\x7b\x98\x03\x97\x13\xf5\xf4\xcc\xab\x55\x55\x53\x71\x29\x68\xdb\x73\x21\xe7\x31\x24\xf1\x7d\xfa\x60\x8b\xad\xe4\x2e\xb1\xc9\xaa\x08\xa9\x9d\xce\xa6\xc8\x9a\x8a\x5e\x9d\x17\x3d\xf1\x01\x27\x2e\xbf\xfa\xd7\xfc\x3d\xa3\xa2\xaa\x99\x04\xb8\x60\x71\x3c\x17\xff\xb1\xf5\x84\x36\xb7\x4d\x45\x67\x4d\xbb\xd3\x98\xfb\x3f\xb0\x35\xe6\xb4\xb7\x7d\x2d\xb8\x7f\x34\x36\x4f\xb9\xe2\x6c\xb9\xff\xe2\x42\x43\xb4\x7c\x73\x2f\xf1\x3d\x10\x59\x8d\xfd\x6c\xf2\x77\x8b\xcd\x15\xca\xc3\x6f\xa0\x0d\x7d\x0e\x00\x99\x92\xf8\x8f\xce\x02\x00\x00")
+
+func dbMigrations0021_add_team_membersSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations0021_add_team_membersSql,
+		"db/migrations/0021_add_team_members.sql",
+	)
+}
+
+func dbMigrations0021_add_team_membersSql() (*asset, error) {
+	bytes, err := dbMigrations0021_add_team_membersSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/0021_add_team_members.sql", size: 718, mode: os.FileMode(0644), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0xa4, 0x76, 0xe4, 0xc3, 0xf4, 0x30, 0x1e, 0x38, 0xbb, 0x2b, 0x8b, 0x18, 0x14, 0x91, 0x6b, 0xca, 0xf5, 0x5a, 0x9f, 0x6a, 0xf0, 0x8f, 0x1d, 0xf4, 0x38, 0x49, 0x12, 0xaa, 0xcd, 0x6c, 0x9a, 0xb5}}
+	return a, nil
+}
+
+var _dbMigrations0022_add_rolesSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xa4\x54\xc1\xae\xd3\x30\x10\x3c\xc7\x5f\xb1\x37\xdb\xc2\x95\x1e\x88\xc7\xa5\x88\x13\xbf\xc0\x39\x72\xed\x6d\xdf\xf2\x12\xc7\xd8\xeb\x47\xcb\xd7\x23\x97\x34\x49\xa5\x36\xa0\xd2\x4a\x51\xa2\x9d\x8c\x67\x66\x47\xd9\x6c\xe0\x5d\x4f\x87\x64\x19\xe1\x5b\x14\xc2\x25\xac\xb7\x6c\x77\x1d\x02\xed\x21\x0c\x0c\x78\xa4\xcc\x19\xd2\xd0\x21\x28\xd1\x90\x87\x52\xc8\x43\x4c\xd4\xdb\x74\x82\x57\x3c\x81\xc7\xbd\x2d\x1d\x9f\x07\xed\x01\x03\x56\xc2\xf6\xed\xa3\xd2\x46\x34\x8c\xb6\x6f\x2f\x6f\x55\xc2\x50\xba\x0e\x12\xee\x31\x61\x70\x98\xa1\x02\x40\x91\xd7\x30\x04\xf0\xd8\x21\x23\x38\x9b\x9d\xf5\x68\x44\x13\x6c\x8f\xf0\x66\x93\x7b\xb1\x49\x3d\x3f\xe9\x99\xc2\xbd\xa0\x7b\x05\x75\x06\x7c\xfe\x02\x52\xd6\xd3\x3c\x66\x97\x28\x32\x0d\x01\x18\x8f\x3c\xc3\x2f\x22\xa5\x34\xa2\xf9\x63\xd4\xb7\x9c\x81\xa9\xc7\xcc\xb6\x8f\xfc\x6b\xc2\xb8\x92\x12\x06\x6e\xa7\xd9\x44\x63\x44\x53\x02\xfd\x28\x08\x6a\x34\x66\xa0\x2a\xd0\x42\x6f\xff\x9a\x5f\x1b\x31\xf5\x94\x73\x15\xa7\x44\x53\x23\x5d\x4d\xa6\x02\xee\x27\xb3\x20\x5b\xcb\x67\x01\x9b\x52\x5a\x2e\x4f\x8d\x32\x0c\xcc\xc8\x7f\x73\xb3\xa3\xe0\x29\x1c\x1e\x6a\xc5\x7f\x7a\xcf\x65\xf7\x1d\x1d\xb7\x7c\x8a\x73\x3b\xde\xdf\x70\x7f\x05\xa4\x00\x4a\x96\x8c\x49\x1a\x90\x87\x34\x94\x28\xb5\x9e\xd9\x26\xa2\x0f\xcf\x9f\xee\x32\xcd\x21\xda\x18\x3b\x72\xb6\x56\x6d\x72\xb2\x30\xb0\x18\xdf\xf7\xf1\x70\x0f\x97\x0b\x1a\x0b\x49\xc1\xe3\xb1\xa6\x75\xbd\x9c\x69\xbd\xa3\x81\x73\x66\xd3\x93\x01\x37\xd8\x0e\xb3\x43\x75\xed\xc7\x80\x7c\x1a\x7f\x9b\x1b\x97\xcb\x5f\x6a\xbd\xbd\xe8\xb8\x23\xe0\xe6\xb9\x55\xfe\xf2\xeb\xf3\x75\xf8\x19\x84\xf0\x69\x88\x73\xdf\x6e\x74\x6d\xbb\x02\x99\xeb\xbb\x82\xda\x8a\xdf\x03\x00\xfd\xa2\x54\xd0\xf4\x04\x00\x00")
+
+func dbMigrations0022_add_rolesSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations0022_add_rolesSql,
+		"db/migrations/0022_add_roles.sql",
+	)
+}
+
+func dbMigrations0022_add_rolesSql() (*asset, error) {
+	bytes, err := dbMigrations0022_add_rolesSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/0022_add_roles.sql", size: 1268, mode: os.FileMode(0644), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0x3, 0x19, 0x8b, 0xca, 0x24, 0x5, 0x7b, 0xde, 0xf1, 0x87, 0x8, 0xc6, 0x3d, 0x0, 0xf8, 0x82, 0x16, 0x5d, 0x5, 0x2a, 0x16, 0xc0, 0x63, 0x53, 0x5b, 0xb5, 0x5b, 0x30, 0xd1, 0x10, 0x7a, 0xc6}}
+	return a, nil
+}
+
+var _dbMigrations0023_add_api_tokensSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x74\x92\xc1\x6e\xdb\x30\x0c\x86\xcf\xd6\x53\xf0\x66\x1b\x73\x81\x74\x68\x73\xe9\xb0\xd3\x5e\x61\xa7\x61\x10\x54\xe9\x4f\x23\xd8\xa6\x34\x4a\x4a\x93\x3d\xfd\xa0\x74\x55\x82\x66\xbb\x09\xe0\xc7\x8f\x02\xf9\xdf\xdd\xd1\xa7\xd5\xbf\x88\xc9\xa0\xef\x51\x29\x2b\xa8\xcf\x6c\x9e\x17\x90\xdf\x11\x87\x4c\x38\xfa\x94\x13\x99\xe8\x75\x0e\x33\x98\x06\xd5\x79\x47\xa5\x78\x47\x51\xfc\x6a\xe4\x44\x33\x4e\xe4\xb0\x33\x65\xc9\xe7\x82\x7e\x01\xa3\x5a\xf5\xe1\x61\x18\x27\xd5\x65\x98\x55\xbf\x77\x55\x2b\x97\x65\x21\xc1\x0e\x02\xb6\x48\x54\x01\x1a\xbc\x1b\x29\x30\x39\x2c\xc8\x20\x6b\x92\x35\x0e\x93\xea\xd8\xac\xa0\x83\x11\xbb\x37\x32\xdc\x6f\x36\xe3\xc5\x61\xf7\xb0\x33\x0d\x67\xe2\xcb\x57\xea\xfb\x3a\x6e\xf6\xec\x1a\xff\xf9\x1f\xf8\x19\xf0\x4c\x43\x1f\x21\x29\xb0\x59\xfa\x89\xfa\x04\x39\x78\x0b\x6d\xac\x0d\x85\x73\x3f\x56\x57\x78\x65\xc8\x45\xf6\xb8\xbd\xb5\xbd\x21\x6d\x7a\xb2\x21\x22\xb5\x96\xc7\xcd\xf8\xe3\x67\xeb\xa9\xcb\xa8\x6b\xd4\x51\xb0\xf3\xc7\x46\xdd\x6f\xc7\x5b\x66\x6f\xd2\xbe\x11\xdb\x87\xab\xc9\x85\xfd\xaf\x52\x57\xf3\x76\x32\xa7\x9f\x4f\xff\xf9\xe3\xfb\x5d\xfa\xfe\x8a\xce\x89\xb2\x5f\x91\xb2\x59\x63\xfe\xdd\x6e\x67\x8b\x08\x38\xeb\x56\x6b\x9a\x49\x75\x38\x46\x2f\x48\x1f\x7a\x27\xd5\x2d\x26\x65\x5d\xd2\x8d\x76\x52\x9d\xe0\x10\xe6\x9b\x82\x1a\x9f\x5a\xd6\x3c\x3b\x1c\xeb\xd1\xaf\x02\xf6\x37\x2d\x95\xba\x4e\xe8\xb7\xf0\xca\x4a\x39\x09\xf1\x92\xd0\x8f\xe9\x7c\x52\x7f\x06\x00\x05\x3c\xeb\x44\xd4\x02\x00\x00")
+
+func dbMigrations0023_add_api_tokensSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations0023_add_api_tokensSql,
+		"db/migrations/0023_add_api_tokens.sql",
+	)
+}
+
+func dbMigrations0023_add_api_tokensSql() (*asset, error) {
+	bytes, err := dbMigrations0023_add_api_tokensSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/0023_add_api_tokens.sql", size: 724, mode: os.FileMode(0644), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0x57, 0x90, 0x25, 0x98, 0x2e, 0xb7, 0x9c, 0x2a, 0x30, 0xa1, 0x1b, 0xd1, 0x30, 0x25, 0xaa, 0x7d, 0x9b, 0x5d, 0xfb, 0x65, 0xec, 0x8e, 0xe, 0xdd, 0x49, 0x7f, 0x51, 0xfe, 0x79, 0x69, 0x21, 0x8a}}
+	return a, nil
+}
+
+var _dbMigrations0024_add_audit_logSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x74\x92\xc1\x72\xdb\x30\x0c\x44\xcf\xe2\x57\xe0\x16\x7b\x2a\xcf\xb8\x9d\x26\x97\x5c\xfb\x0b\x3d\x6b\x20\x72\x25\xa3\x91\x48\x15\x04\xdb\xb8\x5f\xdf\x91\xed\x48\x72\x26\xb9\x89\xda\x25\xb0\x00\xdf\xe1\x40\x5f\x46\xe9\x95\x0d\xf4\x73\x72\xce\x2b\xe6\x4f\xe3\x76\x00\x49\x47\x31\x19\xe1\x55\xb2\x65\xe2\x12\xc4\x9a\x21\xf5\xb4\x73\x95\x04\x6a\xa5\xcf\x50\xe1\x81\x26\x95\x91\xf5\x4c\x2f\x38\xd7\xae\x32\xf0\xd8\x48\xa0\x52\x24\x5c\xee\xc7\x32\x0c\xa4\xe8\xa0\x88\x1e\x99\x66\x03\xed\x24\xec\x29\x45\x0a\x18\x60\x20\xcf\xd9\x73\x40\xed\xaa\x6b\x82\xd0\x58\x26\x93\x11\xd9\x78\x9c\xec\x1f\x05\x74\x5c\x06\x23\x5f\x54\x11\xad\x59\xb4\xa5\x45\xed\x2a\xf6\x96\x94\xfe\xb0\xfa\x13\xeb\xee\xdb\xe3\xd3\x7e\x0d\xf0\x56\xe0\xe1\xe1\x6a\x94\x14\x17\xe7\xd7\xe3\x71\x75\xd6\xae\x1a\x61\xa7\x14\x36\xf2\x9d\xaa\xa9\x18\x3e\xee\x32\x8f\xcf\xda\xc3\x1a\x3b\x4f\xab\xe7\xf1\xf8\x59\x90\x9b\x5b\xc2\xc7\xf5\xee\xcd\x87\xc3\x45\x60\xea\x92\x42\xfa\x78\x59\x38\xe5\x44\x88\xa6\x82\x4c\xdc\xa6\x62\xb7\x95\x06\xe2\x69\x1a\xc4\xb3\x49\x8a\x99\x58\x41\x2f\x98\xcc\x55\x9b\xdf\x6f\xcf\x54\xbb\x2a\x1b\x5b\xc9\x24\xd1\xd0\x43\x97\x00\xf3\xb8\xf8\x5d\x90\xef\x32\x3e\x7d\xff\x2c\x62\x8b\x39\x1b\xfd\xca\x29\xb6\xf3\x9e\x3b\x83\x2e\x27\x7f\xe2\xd8\x23\x5f\xcf\x6e\xff\xbc\xe0\x26\x31\xe0\x75\xa6\x61\xc3\xd8\x0d\xa3\x9a\x36\x40\x04\x64\x3f\x5f\xdb\x52\xfb\x23\xfd\x8d\xce\x05\x4d\xd3\x4a\xed\x7b\x62\x9f\xdd\xff\x01\x00\x67\x03\x64\x04\xe8\x02\x00\x00")
+
+func dbMigrations0024_add_audit_logSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations0024_add_audit_logSql,
+		"db/migrations/0024_add_audit_log.sql",
+	)
+}
+
+func dbMigrations0024_add_audit_logSql() (*asset, error) {
+	bytes, err := dbMigrations0024_add_audit_logSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/0024_add_audit_log.sql", size: 744, mode: os.FileMode(0644), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0xf0, 0x91, 0x77, 0x5b, 0x20, 0x6c, 0x48, 0x76, 0xb7, 0x55, 0x39, 0x85, 0x16, 0xb5, 0x87, 0x29, 0xc0, 0x6, 0x8a, 0xab, 0x54, 0x7, 0xa9, 0xe1, 0x5e, 0x3b, 0x84, 0x51, 0x40, 0x74, 0xd, 0xcb}}
+	return a, nil
+}
+
+var _dbMigrations0025_widen_user_secretSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\xd0\x31\x6f\xc2\x30\x10\x05\xe0\xdd\xbf\xe2\x6d\x80\x4a\x10\xaa\x94\x09\xb5\x4b\x3b\x30\xb2\xf4\x07\x1c\xf1\xc5\xb6\x94\xd8\xe9\xdd\xa5\x11\xff\xbe\x32\x01\xa9\x73\xd7\xa7\xa7\xf3\xf7\xdc\x34\x78\x19\x53\x10\x32\xc6\xd7\xe4\x5c\xd3\xe0\x42\xaa\x4b\x11\x8f\x48\x1a\x59\x41\xc2\x50\x2b\xc2\x1e\x29\xe3\x72\xfe\x80\x9a\xa4\x1c\xd0\x17\x19\xc9\xf6\x58\x62\xea\x22\x92\x62\x28\x39\xb0\xc0\x22\x65\x58\xe4\x7a\x6c\xe0\x40\xdd\x0d\xa3\x6f\xe1\x53\x60\x35\x3d\x38\x1a\xac\xb6\xe8\x3a\x30\x66\x65\x51\xac\x49\x57\x86\x79\xcc\x50\xee\x84\x0d\x76\x9b\x18\x3f\x24\x5d\x24\xd9\xbe\xb6\xed\xee\xe4\xdc\x5f\xed\x67\x59\xf2\x3d\x39\xaf\x4c\x5f\xf2\xc6\xd0\x27\xab\x4a\x8b\xfc\x7c\x7a\xbd\xba\xaf\xa0\xdb\x7d\xcb\x50\xd4\x50\x32\x7c\x59\x72\x10\xf2\x0c\xca\xfe\xe9\x9d\x1e\xe3\x15\xa5\xaf\xd9\x13\xd8\xf7\xdc\x19\x7b\x8c\xb3\x1a\xae\x0c\x65\x03\x05\x4a\xf9\xe0\xe6\xc9\x57\xcf\x5a\xac\xf9\x63\xc0\x1b\x36\xc2\xca\xd6\x08\x7f\xcf\x49\xd8\x6f\xb0\x44\xae\x00\xce\xc1\xe2\x76\xad\xed\xf0\x8e\xf6\x78\xfa\xcf\xa7\xb4\xc7\xdd\xc9\xfd\x0e\x00\xf1\xed\xf2\x47\xc1\x01\x00\x00")
+
+func dbMigrations0025_widen_user_secretSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations0025_widen_user_secretSql,
+		"db/migrations/0025_widen_user_secret.sql",
+	)
+}
+
+func dbMigrations0025_widen_user_secretSql() (*asset, error) {
+	bytes, err := dbMigrations0025_widen_user_secretSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/0025_widen_user_secret.sql", size: 449, mode: os.FileMode(0644), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0x54, 0x9e, 0x83, 0x61, 0xaa, 0x37, 0x4f, 0xe0, 0x47, 0xb8, 0x36, 0x77, 0x26, 0xf9, 0x1, 0x61, 0x1a, 0x68, 0xe6, 0xd5, 0x2b, 0x6b, 0xfa, 0x11, 0xe5, 0x2, 0xc3, 0x6e, 0x32, 0x4, 0xbb, 0xb4}}
+	return a, nil
+}
+
+var _dbMigrations0026_add_syncer_stateSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x7c\x91\xc1\x6a\x02\x41\x10\x44\xcf\x3b\x5f\xd1\x37\x95\x28\x84\x10\xbd\x78\xcd\x2f\xe4\xbc\x74\x7a\xcb\xec\xe0\xec\xcc\xd2\xdd\x63\x34\x5f\x1f\x36\xc4\x68\x40\x73\x6b\xa8\x47\x55\xc3\x5b\xad\xe8\x61\x88\xef\xca\x0e\x7a\x1d\x43\x10\xc5\x74\x3a\xbf\x25\x50\xdc\x51\x2e\x4e\x38\x46\x73\x23\x3b\x65\x81\xb6\xe6\x13\x30\x0f\x8d\xf4\x9c\x33\x52\x1b\x3b\xaa\x35\x76\x34\x6a\x1c\x58\x4f\xb4\xc7\x89\x14\x3b\x28\xb2\xc0\xe8\x07\xa3\x79\xec\x16\x54\x32\x75\x48\x70\x90\xb0\x09\x77\x58\x86\xc6\x4a\x55\x01\x1d\x58\xa5\x67\x9d\x3f\xad\x37\x8b\xef\xd9\x5c\x53\x5a\x86\xc6\x95\x65\x7f\x37\x1d\x58\xfa\x98\x31\x3d\x71\x46\x36\xcf\x7f\x88\x3a\x9a\x2b\x78\x68\x0f\x50\x8b\x25\x5f\x55\xad\x2f\x20\x75\xd8\x71\x4d\x4e\xb3\xd9\x32\x34\x89\xcd\x5b\xe9\x21\xfb\xd6\x8d\x3c\x0e\x30\xe7\x61\xf4\xcf\x73\x66\x55\x04\x66\x77\x52\x85\x4d\x55\xbf\x43\x8f\xff\xee\x40\xb5\x28\x39\x8e\x7e\x8b\x0a\x8b\x6d\x08\xd7\x96\x5e\xca\x47\x0e\xa1\xd3\x32\x5e\x2c\xdd\x30\xb4\x0d\x5f\x03\x00\xae\xa4\x2e\x1f\xdb\x01\x00\x00")
+
+func dbMigrations0026_add_syncer_stateSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations0026_add_syncer_stateSql,
+		"db/migrations/0026_add_syncer_state.sql",
+	)
+}
+
+func dbMigrations0026_add_syncer_stateSql() (*asset, error) {
+	bytes, err := dbMigrations0026_add_syncer_stateSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/0026_add_syncer_state.sql", size: 475, mode: os.FileMode(0644), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0xfb, 0x27, 0xa2, 0x65, 0xea, 0x44, 0x26, 0x8c, 0x26, 0xcb, 0xe3, 0x5, 0xcb, 0xd8, 0xcb, 0x62, 0xdf, 0x14, 0x9b, 0xe0, 0x67, 0xca, 0x8c, 0x72, 0x43, 0x92, 0x2e, 0xa, 0x86, 0xb2, 0x6c, 0x42}}
+	return a, nil
+}
+
+var _dbMigrations0027_add_cache_invalidationSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xb4\x97\x51\x8f\xda\x38\x10\xc7\x9f\xc9\xa7\x98\x87\x95\x68\x75\xb0\x5f\x00\xf5\xe1\x4e\xed\x6b\xaf\xba\x6b\x75\x8f\xd1\x60\x4f\x8c\xb5\x66\x9c\x1b\x4f\xa0\x7c\xfb\x93\x93\xc0\x2e\x85\x00\x4d\x73\xd2\x3e\x64\x89\xfd\xf7\xcf\x3f\x8f\x6d\x58\x2e\xe1\xb7\xad\x77\x82\x4a\xf0\xad\x2e\x8a\xe5\x12\x3e\x47\xf5\xd5\x01\x74\x43\xf0\x99\xd6\x82\xe9\x05\xc1\x73\x52\x64\x43\x09\x0c\x9a\x8d\x67\xd7\xbe\xb6\xa8\x08\x4d\x22\x0b\x1a\x21\x91\xec\x08\x9a\xda\xa2\x52\x82\xfd\x86\x38\x87\x79\x05\xb3\x41\x76\x94\x16\x90\x62\xee\x75\x00\x83\x0c\x56\x62\x0d\x5e\x9f\xe1\xab\x78\xe7\x48\x12\xa0\x10\x48\xdc\x2f\x03\xed\x28\xe4\xb6\x9c\xff\xd4\x57\xde\xa0\xfa\xd8\xa5\x25\x48\xc4\x0a\x55\x14\x48\x8a\x4a\x5b\x62\x4d\xb9\x19\x6c\xa3\xf5\xd5\x21\x93\x21\x1f\x72\xd0\x02\x90\xed\x89\x27\x10\xee\x8e\xd8\x12\xf7\x29\xa7\x61\xea\x78\xf6\x24\xd4\x0e\xef\x1d\x47\x21\xfb\x0c\x5f\x62\x52\x27\xd4\x8e\x66\x13\x20\x24\xcf\x2e\xd0\x19\x0f\xd4\x24\xa0\xb8\x0e\xd4\x66\xb1\x05\x15\xe4\x84\x26\xc3\x2e\x60\x13\xf7\xb4\x23\x81\x6d\x8f\xd3\x4d\xb0\xa5\xf4\x64\x9f\x8b\xe2\xad\xf9\xbf\x8f\x73\xf9\x83\x9c\xe7\xa2\x30\x42\xf9\xe3\x28\x20\x54\x07\x34\x04\x55\xc3\x6d\x70\x87\x70\x28\xf3\x32\x50\xe9\x79\x87\xc1\xdb\x96\xe7\xdd\x7b\x10\xd2\x46\x38\x81\x76\x4e\x01\x13\x3c\x3d\x15\xeb\x36\x73\xe6\x2b\x50\x57\x76\x76\x3f\xc0\xfc\xaf\x3f\xff\x99\xb7\x86\xd4\x95\xb1\x86\x0f\x30\xff\xf6\xe5\xe3\xef\x5f\x3f\xcd\xb3\x13\x2e\x66\xb9\x7d\x0c\x36\x2b\xcf\x7a\xad\x4f\xea\xd9\x28\x54\x12\xb7\xc0\xb4\x3f\x36\x9b\x75\x83\x02\x37\x21\xac\x8a\xd9\x8c\xd8\x82\xaf\x56\xc5\xeb\x43\x4d\x52\x45\xd9\x42\xed\xca\x0e\xfe\xdd\x9c\xfb\xba\xba\x32\x8d\xf9\x22\x63\xb6\x5e\x4b\xc6\x2d\xbd\x5f\x15\xe7\x43\x10\xdb\x55\xf1\xf4\x04\x01\xd9\x35\xe8\x08\xea\x50\xbb\xf4\x6f\x58\x0d\x28\xfd\xc4\xf6\x24\xf4\x28\xc6\x49\x6c\xea\x74\x65\x74\xc0\x4a\x49\x72\xb9\x93\x28\x44\xe9\xeb\x27\x3f\x59\x0a\x94\xd7\x84\xfb\xde\xc5\x2c\x57\x21\xa1\xd9\xe4\x6a\x03\xfa\x4e\xa6\x51\x82\x5a\xa2\x21\xdb\x08\xdd\x5a\xa9\xd5\xc3\x40\xa5\x4a\xc3\x26\x37\xed\xc8\x4e\xff\x5e\xe3\x38\x6d\x89\x5f\xa4\xc9\x3b\x96\x29\x8c\xf5\xd3\x77\x9f\x54\xd0\x30\xd2\x2d\x43\x97\x24\x53\x29\xaa\xd1\xbc\xa0\xa3\xb1\x8a\xfa\xee\x93\x2a\x1a\x46\xba\xa5\xe8\x92\x64\x2a\x45\x55\x40\x35\x28\x65\x77\x22\x8e\x35\x75\x9e\x32\xa9\xb0\xbb\x80\xb7\xbc\x0d\x72\x4d\x5e\x61\x7d\xe5\xaf\x03\x9a\x97\xe0\x93\x8e\x35\x39\x18\x38\xa9\xd4\x9f\xc1\x7e\xa0\x2e\x6f\xd2\x4e\xad\xda\x52\x50\xfc\x55\xbd\x6d\xc8\xff\xa2\x74\x08\xef\x11\x8d\x3f\x52\x8d\x56\x77\x76\xc9\x7e\x8c\x7b\x2e\x8a\xf6\xbb\xdc\x11\xd6\x57\x40\xdf\x7d\xd2\x34\x7c\xa7\xbd\xde\xa1\xab\x9f\xee\x5b\x5e\x5e\x80\x83\x21\xc7\xd2\xb9\x4e\xd0\xbf\x1d\xd1\xfb\x8c\xe1\x5e\xcc\x71\x01\xae\x43\xf4\x6f\x47\xf4\x3e\x83\xb8\x17\x73\xf7\xa4\xbb\x3c\xd1\xc6\x67\x9d\x91\x3d\x18\x7a\x9a\xe7\x8f\xbb\x7d\x80\x75\xb0\xfd\x24\x23\x5c\x73\x3b\x62\xa8\xc1\xe3\xe4\x4d\x6a\xdb\x66\x74\xd2\x55\xd0\xb7\x91\xa7\x9f\x0d\xaf\x99\x37\x77\xf7\x7f\x03\x00\x66\x05\x9e\x08\x0f\x0e\x00\x00")
+
+func dbMigrations0027_add_cache_invalidationSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations0027_add_cache_invalidationSql,
+		"db/migrations/0027_add_cache_invalidation.sql",
+	)
+}
+
+func dbMigrations0027_add_cache_invalidationSql() (*asset, error) {
+	bytes, err := dbMigrations0027_add_cache_invalidationSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/0027_add_cache_invalidation.sql", size: 3599, mode: os.FileMode(0644), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0x3e, 0x4d, 0xba, 0x54, 0xc6, 0xca, 0xbc, 0x97, 0x7f, 0xca, 0xcf, 0xd9, 0x17, 0xc4, 0xfc, 0xc0, 0x9d, 0xdd, 0xd1, 0xfb, 0xdc, 0xb8, 0x42, 0xc3, 0x12, 0x25, 0x1b, 0xe3, 0xf6, 0x3c, 0x4e, 0xaf}}
+	return a, nil
+}
+
+var _dbMigrations0028_add_package_mirrorsSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\x93\xb1\x6e\x1b\x3d\x10\x84\x6b\xf1\x29\xa6\xf3\x09\xbf\x64\xfc\x08\x92\x34\x0e\x52\xa5\x4d\x97\xd4\x87\x35\xb9\x27\x2d\xcc\x23\x0f\xcb\xa5\x2d\xe5\xe9\x03\x9e\x73\x27\x39\x71\x02\xb8\x24\x38\x3b\xf3\xed\x10\xdc\xef\xf1\xdf\x28\x07\x25\x63\x7c\x9f\x9c\xdb\xef\xf1\x55\x54\xb3\x16\x90\x32\xee\xa9\x30\xaa\xc6\x02\x3b\x32\x26\x3a\xc7\x4c\xa1\x20\x0f\x20\x4c\xe4\x1f\xe8\xc0\xf0\x94\x40\xb1\x64\xdc\x33\x42\x7e\x4a\x4d\xc2\x01\x83\xe6\xf1\xb6\xf9\x7d\x3b\x32\xf2\x64\x92\x13\x45\xf8\x28\x9c\xac\xf7\x12\x74\x87\x83\xe6\x3a\xf5\x12\x40\x29\x80\xd4\x1f\xe1\x73\xac\x63\x2a\x50\x2e\xa6\xe2\x6d\x8e\x7d\x9e\x29\xa0\xe6\x36\xce\x74\x90\x06\x31\xb0\x72\x80\xe5\x5b\xe7\x95\xdb\x06\x46\xf7\x91\x21\x03\x52\x36\xf0\x49\x8a\x95\x05\xb3\xff\x35\xd8\xb9\x8d\x04\xd4\x2a\x01\x93\xca\x48\x7a\xc6\x03\x9f\x11\x78\xa0\x1a\x6d\xbe\xe8\x0f\x9c\xb8\x35\xd2\x3f\xbe\xef\xb6\x3b\xb7\x59\x2c\x96\xc1\xe6\x9e\x6a\x8c\x50\x6e\x08\xc9\xf3\x1a\x83\x4e\xc2\x16\x39\x21\x70\x64\x6b\xe5\x14\x4f\x81\x77\x6e\x53\x35\xe2\xb1\x2d\x49\xda\xbd\xfb\xf0\x71\x7b\x71\xf1\x47\xf6\x0f\xe8\x9a\xe0\xd3\x67\xdc\xdc\xcc\x91\xb9\x48\xab\x0c\x92\x8c\x0f\xac\x17\xf5\x42\xfa\xff\xce\x6d\xae\xda\xc4\x5c\xa9\xdb\xac\x9d\xb6\x4d\xae\x01\xe7\x8b\xf2\x77\xbe\x86\xb6\xa4\x35\xeb\xb9\xd1\xd0\x5b\x81\xc9\xc8\xc5\x68\x9c\xec\xc7\x9a\xee\xab\x6a\x7b\xc8\xf5\x6e\x05\x74\xdb\x3b\xb7\xbc\x87\xa4\xc0\xa7\xdf\x5e\xa0\x5f\x8e\x12\x7a\x09\xa7\xd6\xd5\x4b\x01\xba\x8b\xe2\xca\xcb\x54\x0e\xad\x88\x97\xe2\xde\x93\x3f\x72\x2f\xe9\x91\xa2\x04\x9a\x2b\xa3\xc1\x58\x21\xa9\xb0\x1a\xb2\xa2\x4e\xa1\xc1\x64\x5d\x96\xfe\x23\xd2\x6d\x86\xac\x60\xf2\x47\x68\x7e\x02\x9f\xd8\x57\x63\x4c\x9a\x3d\x87\xaa\xdc\x96\x93\xe1\xfc\x4a\x58\xb7\xbd\x7b\x33\x60\x6f\x5a\x93\x6f\x23\xcf\xa4\xeb\xf1\x5f\x5c\xc5\xc8\x78\xe4\x64\x6f\xa5\x73\xd7\x5f\xfc\x4b\x7e\x4a\xce\x05\xcd\xd3\xe5\xaf\xbc\xfa\x4f\xee\xdc\xcf\x01\x00\x89\x5b\x6e\x5c\x1a\x04\x00\x00")
+
+func dbMigrations0028_add_package_mirrorsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations0028_add_package_mirrorsSql,
+		"db/migrations/0028_add_package_mirrors.sql",
+	)
+}
+
+func dbMigrations0028_add_package_mirrorsSql() (*asset, error) {
+	bytes, err := dbMigrations0028_add_package_mirrorsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/0028_add_package_mirrors.sql", size: 1050, mode: os.FileMode(0644), modTime: time.Unix(1, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0xd5, 0x63, 0xad, 0xe2, 0x19, 0x3f, 0x5c, 0x43, 0xd6, 0xff, 0x41, 0xbe, 0xf2, 0x64, 0x8b, 0x10, 0x6d, 0x25, 0x26, 0xd7, 0x73, 0xb3, 0x69, 0x9b, 0x87, 0xbb, 0x72, 0x37, 0x52, 0x4c, 0x24, 0x5a}}
+	return a, nil
+}
+
 // Asset loads and returns the asset for the given name.
 // It returns an error if the asset could not be found or
 // could not be loaded.
@@ -474,21 +789,36 @@ func AssetNames() []string {
 
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
-	"db/drop_all_tables.sql":                       dbDrop_all_tablesSql,
-	"db/sample_data.sql":                           dbSample_dataSql,
-	"db/migrations/0001_initial.sql":               dbMigrations0001_initialSql,
-	"db/migrations/0002_event_data.sql":            dbMigrations0002_event_dataSql,
-	"db/migrations/0003_longer_team_names.sql":     dbMigrations0003_longer_team_namesSql,
-	"db/migrations/0004_rename_coreos_action.sql":  dbMigrations0004_rename_coreos_actionSql,
-	"db/migrations/0005_default_team_id.sql":       dbMigrations0005_default_team_idSql,
-	"db/migrations/0006_initial_application.sql":   dbMigrations0006_initial_applicationSql,
-	"db/migrations/0007_add_package_arch.sql":      dbMigrations0007_add_package_archSql,
-	"db/migrations/0008-arm-channels-groups.sql":   dbMigrations0008ArmChannelsGroupsSql,
-	"db/migrations/0009_group_track_names.sql":     dbMigrations0009_group_track_namesSql,
-	"db/migrations/0010_add_instance_alias.sql":    dbMigrations0010_add_instance_aliasSql,
-	"db/migrations/0011_add_composite_indexes.sql": dbMigrations0011_add_composite_indexesSql,
-	"db/migrations/0012_drop_unused_indexes.sql":   dbMigrations0012_drop_unused_indexesSql,
-	"db/migrations/0013_add_stats_indexes.sql":     dbMigrations0013_add_stats_indexesSql,
+	"db/drop_all_tables.sql":                                 dbDrop_all_tablesSql,
+	"db/sample_data.sql":                                     dbSample_dataSql,
+	"db/migrations/0001_initial.sql":                         dbMigrations0001_initialSql,
+	"db/migrations/0002_event_data.sql":                      dbMigrations0002_event_dataSql,
+	"db/migrations/0003_longer_team_names.sql":               dbMigrations0003_longer_team_namesSql,
+	"db/migrations/0004_rename_coreos_action.sql":            dbMigrations0004_rename_coreos_actionSql,
+	"db/migrations/0005_default_team_id.sql":                 dbMigrations0005_default_team_idSql,
+	"db/migrations/0006_initial_application.sql":             dbMigrations0006_initial_applicationSql,
+	"db/migrations/0007_add_package_arch.sql":                dbMigrations0007_add_package_archSql,
+	"db/migrations/0008-arm-channels-groups.sql":             dbMigrations0008ArmChannelsGroupsSql,
+	"db/migrations/0009_group_track_names.sql":               dbMigrations0009_group_track_namesSql,
+	"db/migrations/0010_add_instance_alias.sql":              dbMigrations0010_add_instance_aliasSql,
+	"db/migrations/0011_add_composite_indexes.sql":           dbMigrations0011_add_composite_indexesSql,
+	"db/migrations/0012_drop_unused_indexes.sql":             dbMigrations0012_drop_unused_indexesSql,
+	"db/migrations/0013_add_stats_indexes.sql":               dbMigrations0013_add_stats_indexesSql,
+	"db/migrations/0014_add_group_rollout_steps.sql":         dbMigrations0014_add_group_rollout_stepsSql,
+	"db/migrations/0015_add_failure_rate_policy.sql":         dbMigrations0015_add_failure_rate_policySql,
+	"db/migrations/0016_add_group_update_windows.sql":        dbMigrations0016_add_group_update_windowsSql,
+	"db/migrations/0017_add_package_deltas.sql":              dbMigrations0017_add_package_deltasSql,
+	"db/migrations/0018_add_instance_overrides.sql":          dbMigrations0018_add_instance_overridesSql,
+	"db/migrations/0019_add_channel_version_constraints.sql": dbMigrations0019_add_channel_version_constraintsSql,
+	"db/migrations/0020_add_package_min_from_version.sql":    dbMigrations0020_add_package_min_from_versionSql,
+	"db/migrations/0021_add_team_members.sql":                dbMigrations0021_add_team_membersSql,
+	"db/migrations/0022_add_roles.sql":                       dbMigrations0022_add_rolesSql,
+	"db/migrations/0023_add_api_tokens.sql":                  dbMigrations0023_add_api_tokensSql,
+	"db/migrations/0024_add_audit_log.sql":                   dbMigrations0024_add_audit_logSql,
+	"db/migrations/0025_widen_user_secret.sql":               dbMigrations0025_widen_user_secretSql,
+	"db/migrations/0026_add_syncer_state.sql":                dbMigrations0026_add_syncer_stateSql,
+	"db/migrations/0027_add_cache_invalidation.sql":          dbMigrations0027_add_cache_invalidationSql,
+	"db/migrations/0028_add_package_mirrors.sql":             dbMigrations0028_add_package_mirrorsSql,
 }
 
 // AssetDir returns the file names below a certain
@@ -535,19 +865,34 @@ var _bintree = &bintree{nil, map[string]*bintree{
 	"db": &bintree{nil, map[string]*bintree{
 		"drop_all_tables.sql": &bintree{dbDrop_all_tablesSql, map[string]*bintree{}},
 		"migrations": &bintree{nil, map[string]*bintree{
-			"0001_initial.sql":               &bintree{dbMigrations0001_initialSql, map[string]*bintree{}},
-			"0002_event_data.sql":            &bintree{dbMigrations0002_event_dataSql, map[string]*bintree{}},
-			"0003_longer_team_names.sql":     &bintree{dbMigrations0003_longer_team_namesSql, map[string]*bintree{}},
-			"0004_rename_coreos_action.sql":  &bintree{dbMigrations0004_rename_coreos_actionSql, map[string]*bintree{}},
-			"0005_default_team_id.sql":       &bintree{dbMigrations0005_default_team_idSql, map[string]*bintree{}},
-			"0006_initial_application.sql":   &bintree{dbMigrations0006_initial_applicationSql, map[string]*bintree{}},
-			"0007_add_package_arch.sql":      &bintree{dbMigrations0007_add_package_archSql, map[string]*bintree{}},
-			"0008-arm-channels-groups.sql":   &bintree{dbMigrations0008ArmChannelsGroupsSql, map[string]*bintree{}},
-			"0009_group_track_names.sql":     &bintree{dbMigrations0009_group_track_namesSql, map[string]*bintree{}},
-			"0010_add_instance_alias.sql":    &bintree{dbMigrations0010_add_instance_aliasSql, map[string]*bintree{}},
-			"0011_add_composite_indexes.sql": &bintree{dbMigrations0011_add_composite_indexesSql, map[string]*bintree{}},
-			"0012_drop_unused_indexes.sql":   &bintree{dbMigrations0012_drop_unused_indexesSql, map[string]*bintree{}},
-			"0013_add_stats_indexes.sql":     &bintree{dbMigrations0013_add_stats_indexesSql, map[string]*bintree{}},
+			"0001_initial.sql":                         &bintree{dbMigrations0001_initialSql, map[string]*bintree{}},
+			"0002_event_data.sql":                      &bintree{dbMigrations0002_event_dataSql, map[string]*bintree{}},
+			"0003_longer_team_names.sql":               &bintree{dbMigrations0003_longer_team_namesSql, map[string]*bintree{}},
+			"0004_rename_coreos_action.sql":            &bintree{dbMigrations0004_rename_coreos_actionSql, map[string]*bintree{}},
+			"0005_default_team_id.sql":                 &bintree{dbMigrations0005_default_team_idSql, map[string]*bintree{}},
+			"0006_initial_application.sql":             &bintree{dbMigrations0006_initial_applicationSql, map[string]*bintree{}},
+			"0007_add_package_arch.sql":                &bintree{dbMigrations0007_add_package_archSql, map[string]*bintree{}},
+			"0008-arm-channels-groups.sql":             &bintree{dbMigrations0008ArmChannelsGroupsSql, map[string]*bintree{}},
+			"0009_group_track_names.sql":               &bintree{dbMigrations0009_group_track_namesSql, map[string]*bintree{}},
+			"0010_add_instance_alias.sql":              &bintree{dbMigrations0010_add_instance_aliasSql, map[string]*bintree{}},
+			"0011_add_composite_indexes.sql":           &bintree{dbMigrations0011_add_composite_indexesSql, map[string]*bintree{}},
+			"0012_drop_unused_indexes.sql":             &bintree{dbMigrations0012_drop_unused_indexesSql, map[string]*bintree{}},
+			"0013_add_stats_indexes.sql":               &bintree{dbMigrations0013_add_stats_indexesSql, map[string]*bintree{}},
+			"0014_add_group_rollout_steps.sql":         &bintree{dbMigrations0014_add_group_rollout_stepsSql, map[string]*bintree{}},
+			"0015_add_failure_rate_policy.sql":         &bintree{dbMigrations0015_add_failure_rate_policySql, map[string]*bintree{}},
+			"0016_add_group_update_windows.sql":        &bintree{dbMigrations0016_add_group_update_windowsSql, map[string]*bintree{}},
+			"0017_add_package_deltas.sql":              &bintree{dbMigrations0017_add_package_deltasSql, map[string]*bintree{}},
+			"0018_add_instance_overrides.sql":          &bintree{dbMigrations0018_add_instance_overridesSql, map[string]*bintree{}},
+			"0019_add_channel_version_constraints.sql": &bintree{dbMigrations0019_add_channel_version_constraintsSql, map[string]*bintree{}},
+			"0020_add_package_min_from_version.sql":    &bintree{dbMigrations0020_add_package_min_from_versionSql, map[string]*bintree{}},
+			"0021_add_team_members.sql":                &bintree{dbMigrations0021_add_team_membersSql, map[string]*bintree{}},
+			"0022_add_roles.sql":                       &bintree{dbMigrations0022_add_rolesSql, map[string]*bintree{}},
+			"0023_add_api_tokens.sql":                  &bintree{dbMigrations0023_add_api_tokensSql, map[string]*bintree{}},
+			"0024_add_audit_log.sql":                   &bintree{dbMigrations0024_add_audit_logSql, map[string]*bintree{}},
+			"0025_widen_user_secret.sql":               &bintree{dbMigrations0025_widen_user_secretSql, map[string]*bintree{}},
+			"0026_add_syncer_state.sql":                &bintree{dbMigrations0026_add_syncer_stateSql, map[string]*bintree{}},
+			"0027_add_cache_invalidation.sql":          &bintree{dbMigrations0027_add_cache_invalidationSql, map[string]*bintree{}},
+			"0028_add_package_mirrors.sql":             &bintree{dbMigrations0028_add_package_mirrorsSql, map[string]*bintree{}},
 		}},
 		"sample_data.sql": &bintree{dbSample_dataSql, map[string]*bintree{}},
 	}},
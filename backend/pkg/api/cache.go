@@ -0,0 +1,198 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// cacheInvalidationChannel is the channel the database notifies changes
+	// to the data cached on, see the 0027_add_cache_invalidation migration.
+	cacheInvalidationChannel = "nebraska_cache_invalidation"
+
+	// cacheListenerPingInterval is how often the connection listening for
+	// the cache invalidation notifications is checked when idle.
+	cacheListenerPingInterval = 90 * time.Second
+)
+
+// updateCache is a read-through cache of the groups (along with their channel
+// and package) and packages used to serve updates, saving some queries to the
+// update checks. As this data rarely changes, the whole cache is dropped when
+// any of it changes, either in this Nebraska instance or in another one using
+// the same database (notified through Postgres LISTEN/NOTIFY).
+//
+// Cached entries must not be modified, as they are shared by all the update
+// checks.
+type updateCache struct {
+	maxAge   time.Duration
+	listener *pq.Listener
+
+	mu sync.RWMutex
+	// generation is increased every time the cache is invalidated, so
+	// entries read from the database before an invalidation are not
+	// cached after it.
+	generation uint64
+	groups     map[string]cacheEntry
+	packages   map[packageCacheKey]cacheEntry
+}
+
+type cacheEntry struct {
+	value    interface{}
+	storedAt time.Time
+}
+
+type packageCacheKey struct {
+	appID   string
+	version string
+	arch    Arch
+}
+
+// OptionUpdateCache enables the cache of the groups, channels and packages used
+// to serve updates. Entries are kept until the data changes, or for maxAge at
+// most when it's not zero.
+func OptionUpdateCache(maxAge time.Duration) func(*API) error {
+	return func(api *API) error {
+		cache := &updateCache{maxAge: maxAge}
+		cache.reset()
+		cache.listener = pq.NewListener(api.dbURL, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				logger.Error().Err(err).Msg("updateCache - listening for cache invalidations")
+			}
+		})
+		if err := cache.listener.Listen(cacheInvalidationChannel); err != nil {
+			_ = cache.listener.Close()
+			return err
+		}
+		go cache.listen(api)
+		api.cache = cache
+		return nil
+	}
+}
+
+// listen drops the cache every time the data cached changes, until the
+// listener is closed.
+func (c *updateCache) listen(api *API) {
+	ticker := time.NewTicker(cacheListenerPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case n, ok := <-c.listener.Notify:
+			if !ok {
+				return
+			}
+			// A nil notification is sent after reconnecting, changes
+			// may have been missed in the meantime.
+			if n != nil {
+				logger.Debug().Str("table", n.Extra).Msg("updateCache - invalidating cache")
+			}
+			c.invalidate()
+			api.updateCachedGroups()
+		case <-ticker.C:
+			go func() {
+				_ = c.listener.Ping()
+			}()
+		}
+	}
+}
+
+func (c *updateCache) reset() {
+	c.groups = make(map[string]cacheEntry)
+	c.packages = make(map[packageCacheKey]cacheEntry)
+}
+
+// invalidate drops all the cached entries.
+func (c *updateCache) invalidate() {
+	c.mu.Lock()
+	c.generation++
+	c.reset()
+	c.mu.Unlock()
+}
+
+func (c *updateCache) close() {
+	_ = c.listener.Close()
+}
+
+// getGroup returns the group provided, from the cache when possible.
+func (c *updateCache) getGroup(api *API, groupID string) (*Group, error) {
+	c.mu.RLock()
+	entry, ok := c.groups[groupID]
+	generation := c.generation
+	c.mu.RUnlock()
+	if ok && c.fresh(entry) {
+		return entry.value.(*Group), nil
+	}
+
+	group, err := api.GetGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.generation == generation {
+		c.groups[groupID] = cacheEntry{value: group, storedAt: time.Now()}
+	}
+	c.mu.Unlock()
+	return group, nil
+}
+
+// getPackageByVersionAndArch returns the package of the application with the
+// version and architecture provided, from the cache when possible.
+func (c *updateCache) getPackageByVersionAndArch(api *API, appID, version string, arch Arch) (*Package, error) {
+	key := packageCacheKey{appID: appID, version: version, arch: arch}
+	c.mu.RLock()
+	entry, ok := c.packages[key]
+	generation := c.generation
+	c.mu.RUnlock()
+	if ok && c.fresh(entry) {
+		return entry.value.(*Package), nil
+	}
+
+	pkg, err := api.GetPackageByVersionAndArch(appID, version, arch)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.generation == generation {
+		c.packages[key] = cacheEntry{value: pkg, storedAt: time.Now()}
+	}
+	c.mu.Unlock()
+	return pkg, nil
+}
+
+func (c *updateCache) fresh(entry cacheEntry) bool {
+	return c.maxAge == 0 || time.Since(entry.storedAt) <= c.maxAge
+}
+
+// getGroupForUpdate works like GetGroup, but uses the update cache if enabled.
+func (api *API) getGroupForUpdate(groupID string) (*Group, error) {
+	if api.cache == nil {
+		return api.GetGroup(groupID)
+	}
+	return api.cache.getGroup(api, groupID)
+}
+
+// getPackageForUpdate works like GetPackageByVersionAndArch, but uses the
+// update cache if enabled.
+func (api *API) getPackageForUpdate(appID, version string, arch Arch) (*Package, error) {
+	if api.cache == nil {
+		return api.GetPackageByVersionAndArch(appID, version, arch)
+	}
+	return api.cache.getPackageByVersionAndArch(api, appID, version, arch)
+}
+
+// invalidateUpdateCache drops the update cache, if enabled. It must be called
+// whenever the groups, channels or packages are modified, so this Nebraska
+// instance doesn't serve stale data until notified by the database.
+func (api *API) invalidateUpdateCache() {
+	if api.cache != nil {
+		api.cache.invalidate()
+		// In a transaction, the data cached until it's committed doesn't
+		// include its changes, so the cache is dropped again then.
+		if api.committed != nil {
+			api.afterCommit(func(api *API) {
+				api.cache.invalidate()
+			})
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestUpdateCache(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tPkg, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.1.0", ApplicationID: tApp.ID})
+	tPkg2, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.2.0", ApplicationID: tApp.ID})
+	tChannel, _ := a.AddChannel(&Channel{Name: "test_channel", Color: "blue", ApplicationID: tApp.ID, PackageID: null.StringFrom(tPkg.ID)})
+	tGroup, _ := a.AddGroup(&Group{Name: "group", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: false, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 100, PolicyUpdateTimeout: "60 minutes"})
+
+	// cached plays the role of another Nebraska instance, caching the
+	// data changed through a.
+	cached, err := New(OptionUpdateCache(0))
+	require.NoError(t, err)
+	defer cached.Close()
+
+	group, err := cached.getGroupForUpdate(tGroup.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "12.1.0", group.Channel.Package.Version)
+	group2, err := cached.getGroupForUpdate(tGroup.ID)
+	require.NoError(t, err)
+	assert.True(t, group == group2, "Group should be cached.")
+	pkg, err := cached.getPackageForUpdate(tApp.ID, "12.2.0", ArchAll)
+	require.NoError(t, err)
+	assert.Equal(t, tPkg2.ID, pkg.ID)
+
+	tChannel.PackageID = null.StringFrom(tPkg2.ID)
+	require.NoError(t, a.UpdateChannel(tChannel))
+	assert.Eventually(t, func() bool {
+		group, err := cached.getGroupForUpdate(tGroup.ID)
+		return err == nil && group.Channel.Package.Version == "12.2.0"
+	}, 5*time.Second, 10*time.Millisecond, "Cache should be invalidated by changes in other instances.")
+
+	pkg, err = cached.GetUpdatePackage(uuid.New().String(), "", "10.0.0.1", "12.0.0", tApp.ID, tGroup.ID)
+	require.NoError(t, err)
+	assert.Equal(t, tPkg2.ID, pkg.ID)
+
+	// Local changes invalidate the cache right away.
+	tChannel.PackageID = null.StringFrom(tPkg.ID)
+	require.NoError(t, cached.UpdateChannel(tChannel))
+	group, err = cached.getGroupForUpdate(tGroup.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "12.1.0", group.Channel.Package.Version)
+}
+
+func TestUpdateCacheChannelRollback(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tPkg, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.1.0", ApplicationID: tApp.ID})
+	tPkg2, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.2.0", ApplicationID: tApp.ID})
+	tChannel, _ := a.AddChannel(&Channel{Name: "test_channel", Color: "blue", ApplicationID: tApp.ID, PackageID: null.StringFrom(tPkg.ID)})
+	tGroup, _ := a.AddGroup(&Group{Name: "group", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: false, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 100, PolicyUpdateTimeout: "60 minutes"})
+	tChannel.PackageID = null.StringFrom(tPkg2.ID)
+	require.NoError(t, a.UpdateChannel(tChannel))
+
+	cached, err := New(OptionUpdateCache(0))
+	require.NoError(t, err)
+	defer cached.Close()
+
+	group, err := cached.getGroupForUpdate(tGroup.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "12.2.0", group.Channel.Package.Version)
+
+	// Rolling back a channel invalidates the cache right away.
+	channel, err := cached.GetChannel(tChannel.ID)
+	require.NoError(t, err)
+	pkg, err := cached.rollbackChannel(channel)
+	require.NoError(t, err)
+	assert.Equal(t, tPkg.ID, pkg.ID)
+	group, err = cached.getGroupForUpdate(tGroup.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "12.1.0", group.Channel.Package.Version)
+}
+
+func TestUpdateCacheNoopUpdates(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tGroup, _ := a.AddGroup(&Group{Name: "group", ApplicationID: tApp.ID, PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes"})
+
+	cached, err := New(OptionUpdateCache(0))
+	require.NoError(t, err)
+	defer cached.Close()
+
+	group, err := cached.getGroupForUpdate(tGroup.ID)
+	require.NoError(t, err)
+
+	// Updates not modifying the group, locally or in other instances,
+	// don't invalidate the cache.
+	require.NoError(t, cached.setGroupRolloutInProgress(tGroup.ID, false))
+	require.NoError(t, a.setGroupRolloutInProgress(tGroup.ID, false))
+	advanced, err := cached.advanceGroupRolloutStep(tGroup.ID, 3, "")
+	require.NoError(t, err)
+	assert.False(t, advanced)
+	time.Sleep(100 * time.Millisecond)
+	group2, err := cached.getGroupForUpdate(tGroup.ID)
+	require.NoError(t, err)
+	assert.True(t, group == group2, "Group should still be cached.")
+
+	require.NoError(t, cached.setGroupRolloutInProgress(tGroup.ID, true))
+	group2, err = cached.getGroupForUpdate(tGroup.ID)
+	require.NoError(t, err)
+	assert.False(t, group == group2, "Group should have been invalidated.")
+	assert.True(t, group2.RolloutInProgress)
+}
+
+func TestUpdateCacheMaxAge(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tGroup, _ := a.AddGroup(&Group{Name: "group", ApplicationID: tApp.ID, PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes"})
+
+	cached, err := New(OptionUpdateCache(time.Millisecond))
+	require.NoError(t, err)
+	defer cached.Close()
+
+	group, err := cached.getGroupForUpdate(tGroup.ID)
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	group2, err := cached.getGroupForUpdate(tGroup.ID)
+	require.NoError(t, err)
+	assert.False(t, group == group2, "Group should have expired.")
+}
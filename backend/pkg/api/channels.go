@@ -21,34 +21,52 @@ var (
 
 // Channel represents a Nebraska application's channel.
 type Channel struct {
-	ID            string      `db:"id" json:"id"`
-	Name          string      `db:"name" json:"name"`
-	Color         string      `db:"color" json:"color"`
-	CreatedTs     time.Time   `db:"created_ts" json:"created_ts"`
-	ApplicationID string      `db:"application_id" json:"application_id"`
-	PackageID     null.String `db:"package_id" json:"package_id"`
-	Package       *Package    `db:"package" json:"package"`
-	Arch          Arch        `db:"arch" json:"arch"`
+	ID                string      `db:"id" json:"id"`
+	Name              string      `db:"name" json:"name"`
+	Color             string      `db:"color" json:"color"`
+	CreatedTs         time.Time   `db:"created_ts" json:"created_ts"`
+	ApplicationID     string      `db:"application_id" json:"application_id"`
+	PackageID         null.String `db:"package_id" json:"package_id"`
+	Package           *Package    `db:"package" json:"package"`
+	Arch              Arch        `db:"arch" json:"arch"`
+	PreviousPackageID null.String `db:"previous_package_id" json:"previous_package_id"`
+	// VersionConstraint makes the channel point to the newest package of its
+	// application and architecture matching the constraint, instead of to a
+	// specific package.
+	VersionConstraint null.String `db:"version_constraint" json:"version_constraint"`
+	// ResolvedPackageID is the package a channel using a version constraint
+	// points to, updated whenever the packages of its application change.
+	ResolvedPackageID null.String `db:"resolved_package_id" json:"-"`
+	// MinVersion is the version instances running an older one are updated
+	// to before getting the channel's package.
+	MinVersion null.String `db:"min_version" json:"min_version"`
 }
 
 // AddChannel registers the provided channel.
 func (api *API) AddChannel(channel *Channel) (*Channel, error) {
+	defer api.invalidateUpdateCache()
+
 	if !channel.Arch.IsValid() {
 		return nil, ErrInvalidArch
 	}
+	if err := validateChannelVersions(channel); err != nil {
+		return nil, err
+	}
 	if channel.PackageID.String != "" {
 		if _, err := api.validatePackage(channel.PackageID.String, channel.ID, channel.ApplicationID, channel.Arch); err != nil {
 			return nil, err
 		}
 	}
 	query, _, err := goqu.Insert("channel").
-		Cols("name", "color", "application_id", "package_id", "arch").
+		Cols("name", "color", "application_id", "package_id", "arch", "version_constraint", "min_version").
 		Vals(goqu.Vals{
 			channel.Name,
 			channel.Color,
 			channel.ApplicationID,
 			channel.PackageID,
-			channel.Arch}).
+			channel.Arch,
+			channel.VersionConstraint,
+			channel.MinVersion}).
 		Returning(goqu.T("channel").All()).
 		ToSQL()
 	if err != nil {
@@ -58,29 +76,46 @@ func (api *API) AddChannel(channel *Channel) (*Channel, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := api.resolveChannelPackage(channel); err != nil {
+		return nil, err
+	}
 	return channel, nil
 }
 
 // UpdateChannel updates an existing channel using the content of the channel
 // provided.
 func (api *API) UpdateChannel(channel *Channel) error {
+	defer api.invalidateUpdateCache()
+
 	channelBeforeUpdate, err := api.GetChannel(channel.ID)
 	if err != nil {
 		return err
 	}
 
+	if err := validateChannelVersions(channel); err != nil {
+		return err
+	}
+
 	var pkg *Package
 	if channel.PackageID.String != "" {
 		if pkg, err = api.validatePackage(channel.PackageID.String, channel.ID, channelBeforeUpdate.ApplicationID, channelBeforeUpdate.Arch); err != nil {
 			return err
 		}
 	}
+	record := goqu.Record{
+		"name":               channel.Name,
+		"color":              channel.Color,
+		"package_id":         channel.PackageID,
+		"version_constraint": channel.VersionConstraint,
+		"min_version":        channel.MinVersion,
+	}
+	// Keep track of the package the channel pointed to before, so that a
+	// failed rollout can point the channel back to it.
+	if channelBeforeUpdate.PackageID.String != channel.PackageID.String && channelBeforeUpdate.PackageID.String != "" {
+		record["previous_package_id"] = channelBeforeUpdate.PackageID
+	}
 	query, _, err := goqu.Update("channel").
-		Set(goqu.Record{
-			"name":       channel.Name,
-			"color":      channel.Color,
-			"package_id": channel.PackageID,
-		}).
+		Set(record).
 		Where(goqu.C("id").Eq(channel.ID)).
 		ToSQL()
 	if err != nil {
@@ -98,6 +133,13 @@ func (api *API) UpdateChannel(channel *Channel) error {
 		return ErrNoRowsAffected
 	}
 
+	channel.ApplicationID = channelBeforeUpdate.ApplicationID
+	channel.Arch = channelBeforeUpdate.Arch
+	channel.ResolvedPackageID = channelBeforeUpdate.ResolvedPackageID
+	if err := api.resolveChannelPackage(channel); err != nil {
+		return err
+	}
+
 	if channelBeforeUpdate.PackageID.String != channel.PackageID.String && pkg != nil {
 		if err := api.newChannelActivityEntry(activityChannelPackageUpdated, activityInfo, pkg.Version, pkg.ApplicationID, channel.ID); err != nil {
 			logger.Error().Err(err).Msg("UpdateChannel - could not add channel activity")
@@ -107,8 +149,82 @@ func (api *API) UpdateChannel(channel *Channel) error {
 	return nil
 }
 
+// rollbackChannel points the channel provided back to the package it pointed
+// to before its current one. Channels using a version constraint get their
+// current package blacklisted instead, so they point to the newest package
+// matching the constraint older than it. It returns the package the channel
+// now points to, or nil if the channel has no previous package to roll back
+// to.
+func (api *API) rollbackChannel(channel *Channel) (*Package, error) {
+	defer api.invalidateUpdateCache()
+
+	if channel.VersionConstraint.String != "" {
+		return api.rollbackConstraintChannel(channel)
+	}
+	if channel.PreviousPackageID.String == "" {
+		return nil, nil
+	}
+	pkg, err := api.getPackage(channel.PreviousPackageID)
+	if err != nil {
+		return nil, err
+	}
+
+	query, _, err := goqu.Update("channel").
+		Set(goqu.Record{
+			"package_id":          channel.PreviousPackageID,
+			"previous_package_id": nil,
+		}).
+		Where(goqu.C("id").Eq(channel.ID), goqu.C("package_id").Eq(channel.PackageID.String)).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	result, err := api.db.Exec(query)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, ErrNoRowsAffected
+	}
+
+	return pkg, nil
+}
+
+func (api *API) rollbackConstraintChannel(channel *Channel) (*Package, error) {
+	if !channel.ResolvedPackageID.Valid {
+		return nil, nil
+	}
+	newest, err := api.newestChannelPackage(channel, channel.ResolvedPackageID.String)
+	if err != nil || newest == nil {
+		return nil, err
+	}
+
+	query, _, err := goqu.Insert("package_channel_blacklist").
+		Cols("package_id", "channel_id").
+		Vals(goqu.Vals{channel.ResolvedPackageID, channel.ID}).
+		OnConflict(goqu.DoNothing()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := api.db.Exec(query); err != nil {
+		return nil, err
+	}
+	if err := api.resolveChannelPackage(channel); err != nil {
+		return nil, err
+	}
+
+	return api.getPackage(channel.ResolvedPackageID)
+}
+
 // DeleteChannel removes the channel identified by the id provided.
 func (api *API) DeleteChannel(channelID string) error {
+	defer api.invalidateUpdateCache()
+
 	query, _, err := goqu.Delete("channel").
 		Where(goqu.C("id").Eq(channelID)).
 		ToSQL()
@@ -144,7 +260,7 @@ func (api *API) GetChannel(channelID string) (*Channel, error) {
 	if err != nil {
 		return nil, err
 	}
-	packageEntity, err := api.getPackage(channel.PackageID)
+	packageEntity, err := api.getChannelPackage(&channel)
 	switch err {
 	case nil:
 		channel.Package = packageEntity
@@ -171,28 +287,19 @@ func (api *API) getSpecificChannels(channelID ...string) ([]*Channel, error) {
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var err error
 		var channel Channel
-		var packageEntity *Package
-		err = rows.StructScan(&channel)
-		if err != nil {
-			return nil, err
-		}
-		packageEntity, err = api.getPackage(channel.PackageID)
-		switch err {
-		case nil:
-			channel.Package = packageEntity
-		case sql.ErrNoRows:
-			channel.Package = nil
-		default:
+		if err := rows.StructScan(&channel); err != nil {
 			return nil, err
 		}
 		channels = append(channels, &channel)
 	}
-	if err := rows.Err(); err != nil {
+	if err := closeRows(rows); err != nil {
+		return nil, err
+	}
+	if err := api.setChannelsPackages(channels); err != nil {
 		return nil, err
 	}
-	return channels, err
+	return channels, nil
 }
 
 // GetChannels returns all channels associated to the application provided.
@@ -232,22 +339,150 @@ func (api *API) getChannelsFromQuery(query string) ([]*Channel, error) {
 		if err := rows.StructScan(&channel); err != nil {
 			return nil, err
 		}
+		channels = append(channels, &channel)
+	}
+	if err := closeRows(rows); err != nil {
+		return nil, err
+	}
+	if err := api.setChannelsPackages(channels); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
 
-		packageEntity, err := api.getPackage(channel.PackageID)
+// setChannelsPackages loads the packages the channels provided point to.
+func (api *API) setChannelsPackages(channels []*Channel) error {
+	for _, channel := range channels {
+		packageEntity, err := api.getChannelPackage(channel)
 		switch err {
 		case nil:
 			channel.Package = packageEntity
 		case sql.ErrNoRows:
 			channel.Package = nil
 		default:
-			return nil, err
+			return err
 		}
-		channels = append(channels, &channel)
 	}
-	if err := rows.Err(); err != nil {
+	return nil
+}
+
+// getChannelPackage returns the package the channel provided points to. For
+// channels using a version constraint, that's the package it was resolved to
+// (see resolveChannelPackage).
+func (api *API) getChannelPackage(channel *Channel) (*Package, error) {
+	if channel.VersionConstraint.String == "" {
+		return api.getPackage(channel.PackageID)
+	}
+	return api.getPackage(channel.ResolvedPackageID)
+}
+
+// resolveChannelPackage points the channel provided, if it uses a version
+// constraint, to the newest package of the channel's application and
+// architecture matching the constraint that hasn't blacklisted the channel.
+// It must be called whenever those packages change.
+func (api *API) resolveChannelPackage(channel *Channel) error {
+	var resolved null.String
+	if channel.VersionConstraint.String != "" {
+		newest, err := api.newestChannelPackage(channel, "")
+		if err != nil {
+			return err
+		}
+		if newest != nil {
+			resolved = null.StringFrom(newest.ID)
+		}
+	}
+	if resolved == channel.ResolvedPackageID {
+		return nil
+	}
+
+	query, _, err := goqu.Update("channel").
+		Set(goqu.Record{"resolved_package_id": resolved}).
+		Where(goqu.C("id").Eq(channel.ID)).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	if _, err := api.db.Exec(query); err != nil {
+		return err
+	}
+	channel.ResolvedPackageID = resolved
+	return nil
+}
+
+// resolveChannelPackages resolves the package of all the channels of the
+// application provided using a version constraint, see
+// resolveChannelPackage.
+func (api *API) resolveChannelPackages(appID string) error {
+	query, _, err := goqu.From("channel").
+		Where(goqu.C("application_id").Eq(appID), goqu.C("version_constraint").IsNotNull()).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	var channels []*Channel
+	if err := api.db.Select(&channels, query); err != nil {
+		return err
+	}
+	for _, channel := range channels {
+		if err := api.resolveChannelPackage(channel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newestChannelPackage returns the newest package matching the version
+// constraint of the channel provided, older than the version of the package
+// identified by olderThanID when provided, or nil if there is none.
+func (api *API) newestChannelPackage(channel *Channel, olderThanID string) (*packageVersion, error) {
+	versionRange, err := parseVersionConstraint(channel.VersionConstraint.String)
+	if err != nil {
 		return nil, err
 	}
-	return channels, nil
+	versions, err := api.getPackageVersions(channel.ApplicationID, channel.Arch, channel.ID)
+	if err != nil {
+		return nil, err
+	}
+	var olderThan *packageVersion
+	for _, v := range versions {
+		if v.ID == olderThanID {
+			olderThan = v
+		}
+	}
+	if olderThanID != "" && olderThan == nil {
+		return nil, nil
+	}
+
+	var newest *packageVersion
+	for _, v := range versions {
+		if !versionRange(v.Version) || (olderThan != nil && !v.Version.LT(olderThan.Version)) {
+			continue
+		}
+		if newest == nil || v.Version.GT(newest.Version) {
+			newest = v
+		}
+	}
+	return newest, nil
+}
+
+// validateChannelVersions checks the version constraint and minimum version of
+// the channel provided, normalizing them so that empty values are stored as
+// NULL. Channels using a version constraint can't point to a specific package.
+func validateChannelVersions(channel *Channel) error {
+	if channel.VersionConstraint.String != "" {
+		if channel.PackageID.String != "" {
+			return ErrInvalidVersionConstraint
+		}
+		if _, err := parseVersionConstraint(channel.VersionConstraint.String); err != nil {
+			return err
+		}
+	}
+	if channel.MinVersion.String != "" && !isValidSemver(channel.MinVersion.String) {
+		return ErrInvalidSemver
+	}
+	channel.VersionConstraint = null.NewString(channel.VersionConstraint.String, channel.VersionConstraint.String != "")
+	channel.MinVersion = null.NewString(channel.MinVersion.String, channel.MinVersion.String != "")
+	return nil
 }
 
 // validatePackage checks if a package belongs to the application provided and
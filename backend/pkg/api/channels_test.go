@@ -156,3 +156,66 @@ func TestGetChannels(t *testing.T) {
 	_, err = a.GetChannels(uuid.New().String(), 0, 0)
 	assert.NoError(t, err, "no error for a non existing appID")
 }
+
+func TestChannelVersionConstraint(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tPkg1, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "3100.0.0", ApplicationID: tApp.ID, Arch: ArchAMD64})
+	tPkg2, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "3100.1.0", ApplicationID: tApp.ID, Arch: ArchAMD64})
+	tPkg3, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "3101.0.0", ApplicationID: tApp.ID, Arch: ArchAMD64})
+	_, _ = a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "3100.2.0", ApplicationID: tApp.ID, Arch: ArchAArch64})
+
+	_, err := a.AddChannel(&Channel{Name: "channel1", Color: "blue", ApplicationID: tApp.ID, Arch: ArchAMD64, VersionConstraint: null.StringFrom("latest")})
+	assert.Equal(t, ErrInvalidVersionConstraint, err, "Invalid version constraint.")
+
+	_, err = a.AddChannel(&Channel{Name: "channel1", Color: "blue", ApplicationID: tApp.ID, Arch: ArchAMD64, VersionConstraint: null.StringFrom("~3100"), PackageID: null.StringFrom(tPkg1.ID)})
+	assert.Equal(t, ErrInvalidVersionConstraint, err, "Channel can't use a version constraint and point to a package.")
+
+	_, err = a.AddChannel(&Channel{Name: "channel1", Color: "blue", ApplicationID: tApp.ID, Arch: ArchAMD64, MinVersion: null.StringFrom("3100")})
+	assert.Equal(t, ErrInvalidSemver, err, "Invalid min version.")
+
+	tChannel, err := a.AddChannel(&Channel{Name: "channel1", Color: "blue", ApplicationID: tApp.ID, Arch: ArchAMD64, VersionConstraint: null.StringFrom("~3100"), MinVersion: null.StringFrom(tPkg1.Version)})
+	assert.NoError(t, err)
+
+	channel, err := a.GetChannel(tChannel.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "~3100", channel.VersionConstraint.String)
+	assert.Equal(t, tPkg1.Version, channel.MinVersion.String)
+	if assert.NotNil(t, channel.Package) {
+		assert.Equal(t, tPkg2.ID, channel.Package.ID, "Newest package matching the constraint and the channel arch.")
+	}
+
+	_, err = a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "3100.3.0", ApplicationID: tApp.ID, Arch: ArchAMD64, ChannelsBlacklist: []string{tChannel.ID}})
+	assert.NoError(t, err)
+	channel, err = a.GetChannel(tChannel.ID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, channel.Package) {
+		assert.Equal(t, tPkg2.ID, channel.Package.ID, "Packages blacklisting the channel are skipped.")
+	}
+
+	assert.NoError(t, a.DeletePackage(tPkg2.ID))
+	channel, err = a.GetChannel(tChannel.ID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, channel.Package) {
+		assert.Equal(t, tPkg1.ID, channel.Package.ID, "Deleted packages are replaced by the newest remaining one.")
+	}
+
+	channel.VersionConstraint = null.StringFrom("3101.x")
+	err = a.UpdateChannel(channel)
+	assert.NoError(t, err)
+	channel, err = a.GetChannel(tChannel.ID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, channel.Package) {
+		assert.Equal(t, tPkg3.ID, channel.Package.ID)
+	}
+
+	channel.VersionConstraint = null.StringFrom("~3102")
+	err = a.UpdateChannel(channel)
+	assert.NoError(t, err)
+	channel, err = a.GetChannel(tChannel.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, channel.Package, "No package matching the constraint.")
+}
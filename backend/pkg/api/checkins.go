@@ -0,0 +1,261 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// checkinBatchSize is the maximum number of rows updated by each of the
+	// statements flushing the check-ins buffered.
+	checkinBatchSize = 500
+)
+
+var (
+	checkinFlushDurationMetric = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "nebraska",
+			Subsystem: "checkins",
+			Name:      "flush_duration_seconds",
+			Help:      "Time taken to flush the instances check-ins buffered to the database",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+		},
+	)
+
+	checkinFlushedMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "nebraska",
+			Subsystem: "checkins",
+			Name:      "flushed_total",
+			Help:      "Instances check-ins flushed to the database, by result (success or failure)",
+		},
+		[]string{"result"},
+	)
+
+	checkinPendingMetric = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "nebraska",
+			Subsystem: "checkins",
+			Name:      "pending",
+			Help:      "Instances check-ins buffered waiting to be flushed to the database",
+		},
+	)
+
+	checkinOverflowMetric = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "nebraska",
+			Subsystem: "checkins",
+			Name:      "overflow_total",
+			Help:      "Instances check-ins written synchronously because the buffer was full",
+		},
+	)
+)
+
+// RegisterCheckinMetrics registers the metrics of the check-ins buffer with
+// the DefaultRegisterer.
+func RegisterCheckinMetrics() error {
+	for _, c := range []prometheus.Collector{checkinFlushDurationMetric, checkinFlushedMetric, checkinPendingMetric, checkinOverflowMetric} {
+		if err := prometheus.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type instanceAppKey struct {
+	instanceID string
+	appID      string
+}
+
+// checkinBuffer is a write-behind buffer of the instances check-ins that don't
+// change their state, which only refresh the time they last checked for
+// updates and maybe their IP. Check-ins are coalesced per instance and flushed
+// periodically in batches. The check-ins changing the state of an instance,
+// like its version or its group, are still written synchronously.
+type checkinBuffer struct {
+	api      *API
+	maxSize  int
+	interval time.Duration
+
+	mu          sync.Mutex
+	lastChecks  map[instanceAppKey]time.Time
+	ips         map[string]string
+	flushSignal chan struct{}
+	stopCh      chan struct{}
+	stopOnce    sync.Once
+	done        chan struct{}
+}
+
+// OptionCheckinBuffer enables buffering the instances check-ins that don't
+// change their state, flushing them to the database every interval or as soon
+// as maxSize instances are buffered. Check-ins are written synchronously when
+// the buffer is full.
+func OptionCheckinBuffer(maxSize int, interval time.Duration) func(*API) error {
+	return func(api *API) error {
+		b := &checkinBuffer{
+			api:         api,
+			maxSize:     maxSize,
+			interval:    interval,
+			lastChecks:  make(map[instanceAppKey]time.Time),
+			ips:         make(map[string]string),
+			flushSignal: make(chan struct{}, 1),
+			stopCh:      make(chan struct{}),
+			done:        make(chan struct{}),
+		}
+		go b.run()
+		api.checkins = b
+		return nil
+	}
+}
+
+// add buffers the check-in of an instance provided, along with its new IP if
+// it changed. It returns false if the buffer is full, in which case the
+// check-in must be written synchronously.
+func (b *checkinBuffer) add(instanceID, appID, ip string, checkTs time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := instanceAppKey{instanceID: instanceID, appID: appID}
+	_, buffered := b.lastChecks[key]
+	if !buffered && len(b.lastChecks) >= b.maxSize {
+		checkinOverflowMetric.Inc()
+		b.signalFlush()
+		return false
+	}
+	b.lastChecks[key] = checkTs
+	if ip != "" {
+		b.ips[instanceID] = ip
+	}
+	checkinPendingMetric.Set(float64(len(b.lastChecks)))
+	if len(b.lastChecks) >= b.maxSize {
+		b.signalFlush()
+	}
+	return true
+}
+
+func (b *checkinBuffer) signalFlush() {
+	select {
+	case b.flushSignal <- struct{}{}:
+	default:
+	}
+}
+
+func (b *checkinBuffer) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.flushSignal:
+		case <-b.stopCh:
+			b.flush()
+			return
+		}
+		b.flush()
+	}
+}
+
+// close stops flushing the buffer periodically, flushing the check-ins
+// buffered so far. It can be called several times.
+func (b *checkinBuffer) close() {
+	b.stopOnce.Do(func() { close(b.stopCh) })
+	<-b.done
+}
+
+// flush writes the check-ins buffered to the database. The check-ins are
+// buffered again if they can't be written, to be retried in the next flush.
+func (b *checkinBuffer) flush() {
+	b.mu.Lock()
+	lastChecks, ips := b.lastChecks, b.ips
+	b.lastChecks = make(map[instanceAppKey]time.Time)
+	b.ips = make(map[string]string)
+	checkinPendingMetric.Set(0)
+	b.mu.Unlock()
+
+	if len(lastChecks) == 0 {
+		return
+	}
+	start := time.Now()
+	err := b.api.flushCheckins(lastChecks, ips)
+	checkinFlushDurationMetric.Observe(time.Since(start).Seconds())
+	if err != nil {
+		logger.Error().Err(err).Int("checkins", len(lastChecks)).Msg("flush - writing buffered check-ins")
+		checkinFlushedMetric.WithLabelValues("failure").Add(float64(len(lastChecks)))
+		b.requeue(lastChecks, ips)
+		return
+	}
+	checkinFlushedMetric.WithLabelValues("success").Add(float64(len(lastChecks)))
+}
+
+// requeue buffers again the check-ins provided, which could not be written.
+// The check-ins buffered in the meantime are newer, so they are kept.
+func (b *checkinBuffer) requeue(lastChecks map[instanceAppKey]time.Time, ips map[string]string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for key, ts := range lastChecks {
+		if current, ok := b.lastChecks[key]; !ok || ts.After(current) {
+			b.lastChecks[key] = ts
+		}
+	}
+	for instanceID, ip := range ips {
+		if _, ok := b.ips[instanceID]; !ok {
+			b.ips[instanceID] = ip
+		}
+	}
+	checkinPendingMetric.Set(float64(len(b.lastChecks)))
+}
+
+// flushCheckins updates the last check for updates time and the IP of the
+// instances provided, in batched statements.
+func (api *API) flushCheckins(lastChecks map[instanceAppKey]time.Time, ips map[string]string) error {
+	var values []string
+	var args []interface{}
+	exec := func(query string) error {
+		if len(values) == 0 {
+			return nil
+		}
+		_, err := api.db.Exec(fmt.Sprintf(query, strings.Join(values, ", ")), args...)
+		values, args = values[:0], args[:0]
+		return err
+	}
+
+	// Check-ins never move the last check time backwards, in case the
+	// instance was updated synchronously in the meantime.
+	const updateLastChecks = `UPDATE instance_application AS ia SET last_check_for_updates = v.ts
+		FROM (VALUES %s) AS v(instance_id, application_id, ts)
+		WHERE ia.instance_id = v.instance_id AND ia.application_id = v.application_id AND ia.last_check_for_updates < v.ts`
+	for key, ts := range lastChecks {
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d::varchar, $%d::uuid, $%d::timestamptz)", n+1, n+2, n+3))
+		args = append(args, key.instanceID, key.appID, ts)
+		if len(values) == checkinBatchSize {
+			if err := exec(updateLastChecks); err != nil {
+				return err
+			}
+		}
+	}
+	if err := exec(updateLastChecks); err != nil {
+		return err
+	}
+
+	const updateIPs = `UPDATE instance AS i SET ip = v.ip
+		FROM (VALUES %s) AS v(id, ip)
+		WHERE i.id = v.id`
+	for instanceID, ip := range ips {
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d::varchar, $%d::inet)", n+1, n+2))
+		args = append(args, instanceID, ip)
+		if len(values) == checkinBatchSize {
+			if err := exec(updateIPs); err != nil {
+				return err
+			}
+		}
+	}
+	return exec(updateIPs)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckinBuffer(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tGroup, _ := a.AddGroup(&Group{Name: "group", ApplicationID: tApp.ID, PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes"})
+
+	instanceID := uuid.New().String()
+	instanceID2 := uuid.New().String()
+	_, err := a.RegisterInstance(instanceID, "", "10.0.0.1", "1.0.0", tApp.ID, tGroup.ID)
+	require.NoError(t, err)
+	_, err = a.RegisterInstance(instanceID2, "", "10.0.0.2", "1.0.0", tApp.ID, tGroup.ID)
+	require.NoError(t, err)
+
+	// The interval is long enough for the buffer to be flushed only when
+	// full or closed.
+	buffered, err := New(OptionCheckinBuffer(10, time.Hour))
+	require.NoError(t, err)
+	defer buffered.Close()
+
+	lastCheck := nowUTC().Add(-time.Hour).Truncate(time.Second)
+	_, err = a.db.Exec("UPDATE instance_application SET last_check_for_updates = $1", lastCheck)
+	require.NoError(t, err)
+
+	// Check-ins not changing the state of the instance are buffered.
+	instance, err := buffered.RegisterInstance(instanceID, "", "10.0.0.3", "1.0.0", tApp.ID, tGroup.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.3", instance.IP)
+	instance, err = a.GetInstance(instanceID, tApp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", instance.IP)
+	assert.True(t, lastCheck.Equal(instance.Application.LastCheckForUpdates))
+
+	// Check-ins changing the state of the instance are written right away.
+	_, err = buffered.RegisterInstance(instanceID2, "", "10.0.0.2", "1.0.1", tApp.ID, tGroup.ID)
+	require.NoError(t, err)
+	instance, err = a.GetInstance(instanceID2, tApp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.1", instance.Application.Version)
+
+	buffered.Close()
+	instance, err = a.GetInstance(instanceID, tApp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.3", instance.IP)
+	assert.True(t, instance.Application.LastCheckForUpdates.After(lastCheck))
+}
+
+func TestCheckinBufferOverflow(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tGroup, _ := a.AddGroup(&Group{Name: "group", ApplicationID: tApp.ID, PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes"})
+
+	buffered, err := New(OptionCheckinBuffer(1, time.Hour))
+	require.NoError(t, err)
+	defer buffered.Close()
+
+	// Stop flushing the buffer before filling it, so it's still full when
+	// the instance checks in.
+	buffered.checkins.close()
+	assert.True(t, buffered.checkins.add(uuid.New().String(), tApp.ID, "", nowUTC()))
+	assert.False(t, buffered.checkins.add(uuid.New().String(), tApp.ID, "", nowUTC()))
+
+	instanceID := uuid.New().String()
+	_, err = a.RegisterInstance(instanceID, "", "10.0.0.1", "1.0.0", tApp.ID, tGroup.ID)
+	require.NoError(t, err)
+	_, err = buffered.RegisterInstance(instanceID, "", "10.0.0.2", "1.0.0", tApp.ID, tGroup.ID)
+	require.NoError(t, err)
+	instance, err := a.GetInstance(instanceID, tApp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2", instance.IP, "Check-ins should be written synchronously when the buffer is full.")
+}
+
+func TestCheckinBufferFlushFailure(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	buffered, err := New(OptionCheckinBuffer(10, time.Hour))
+	require.NoError(t, err)
+	defer buffered.Close()
+	b := buffered.checkins
+	b.close()
+
+	// Check-ins that can't be written are buffered again.
+	instanceID := uuid.New().String()
+	lastCheck := nowUTC().Truncate(time.Second)
+	require.True(t, b.add(instanceID, "not-a-uuid", "10.0.0.1", lastCheck))
+	b.flush()
+	key := instanceAppKey{instanceID: instanceID, appID: "not-a-uuid"}
+	assert.Equal(t, map[instanceAppKey]time.Time{key: lastCheck}, b.lastChecks)
+	assert.Equal(t, map[string]string{instanceID: "10.0.0.1"}, b.ips)
+
+	// The check-ins buffered in the meantime are newer.
+	b.lastChecks[key] = lastCheck.Add(time.Minute)
+	b.ips[instanceID] = "10.0.0.2"
+	b.requeue(map[instanceAppKey]time.Time{key: lastCheck}, map[string]string{instanceID: "10.0.0.1"})
+	assert.Equal(t, lastCheck.Add(time.Minute), b.lastChecks[key])
+	assert.Equal(t, "10.0.0.2", b.ips[instanceID])
+}
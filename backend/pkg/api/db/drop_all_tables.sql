@@ -13,6 +13,17 @@ drop table if exists event_type cascade;
 drop table if exists event cascade;
 drop table if exists activity cascade;
 drop table if exists package_channel_blacklist cascade;
+drop table if exists package_delta cascade;
+drop table if exists package_mirror cascade;
+drop table if exists instance_override cascade;
+drop table if exists team_member cascade;
+drop table if exists team_oidc_group cascade;
+drop table if exists role cascade;
+drop table if exists role_permission cascade;
+drop table if exists role_binding cascade;
+drop table if exists api_token cascade;
+drop table if exists audit_log cascade;
+drop table if exists syncer_state cascade;
 drop table if exists database_migrations;
 -- Legacy tables if we're dropping tables in a non-migrated DB
 drop table if exists coreos_action cascade;
\ No newline at end of file
@@ -0,0 +1,17 @@
+-- +migrate Up
+
+alter table groups add column policy_rollout_steps varchar(256) not null default '';
+alter table groups add column policy_rollout_step_interval varchar(20) not null default '';
+alter table groups add column policy_rollout_step_health_threshold integer not null default 0 check (policy_rollout_step_health_threshold >= 0 and policy_rollout_step_health_threshold <= 100);
+alter table groups add column rollout_step integer not null default 0;
+alter table groups add column rollout_step_version varchar(255) not null default '';
+alter table groups add column rollout_step_started_ts timestamptz;
+
+-- +migrate Down
+
+alter table groups drop column policy_rollout_steps;
+alter table groups drop column policy_rollout_step_interval;
+alter table groups drop column policy_rollout_step_health_threshold;
+alter table groups drop column rollout_step;
+alter table groups drop column rollout_step_version;
+alter table groups drop column rollout_step_started_ts;
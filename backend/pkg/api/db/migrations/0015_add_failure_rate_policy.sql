@@ -0,0 +1,15 @@
+-- +migrate Up
+
+alter table groups add column policy_max_failure_rate integer not null default 0 check (policy_max_failure_rate >= 0 and policy_max_failure_rate <= 100);
+alter table groups add column policy_failure_rate_window varchar(20) not null default '';
+alter table groups add column policy_rollback_on_failure boolean not null default false;
+
+alter table channel add column previous_package_id uuid references package (id) on delete set null;
+
+-- +migrate Down
+
+alter table groups drop column policy_max_failure_rate;
+alter table groups drop column policy_failure_rate_window;
+alter table groups drop column policy_rollback_on_failure;
+
+alter table channel drop column previous_package_id;
@@ -0,0 +1,9 @@
+-- +migrate Up
+
+alter table groups add column policy_update_windows jsonb not null default '[]';
+alter table groups add column policy_blackout_periods jsonb not null default '[]';
+
+-- +migrate Down
+
+alter table groups drop column policy_update_windows;
+alter table groups drop column policy_blackout_periods;
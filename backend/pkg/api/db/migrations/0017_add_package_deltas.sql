@@ -0,0 +1,20 @@
+-- +migrate Up
+
+create table if not exists package_delta (
+	id uuid primary key default uuid_generate_v4(),
+	package_id uuid not null references package (id) on delete cascade,
+	from_version varchar(255) not null check (from_version <> ''),
+	url varchar(256) not null check (url <> ''),
+	filename varchar(100),
+	size varchar(20),
+	hash varchar(64),
+	sha256 varchar(64),
+	metadata_signature_rsa varchar(256) default '',
+	metadata_size varchar(100) default '',
+	created_ts timestamptz default current_timestamp not null,
+	unique (package_id, from_version)
+);
+
+-- +migrate Down
+
+drop table if exists package_delta;
@@ -0,0 +1,15 @@
+-- +migrate Up
+
+create table if not exists instance_override (
+	instance_id varchar(50) not null references instance (id) on delete cascade,
+	application_id uuid not null references application (id) on delete cascade,
+	never_update boolean default false not null,
+	pinned_version varchar(255) check (pinned_version <> ''),
+	group_id uuid references groups (id) on delete set null,
+	created_ts timestamptz default current_timestamp not null,
+	primary key (instance_id, application_id)
+);
+
+-- +migrate Down
+
+drop table if exists instance_override;
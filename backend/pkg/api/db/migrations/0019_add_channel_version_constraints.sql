@@ -0,0 +1,11 @@
+-- +migrate Up
+
+alter table channel add column version_constraint varchar(255) check (version_constraint <> '');
+alter table channel add column min_version varchar(255) check (min_version <> '');
+alter table channel add column resolved_package_id uuid references package (id) on delete set null;
+
+-- +migrate Down
+
+alter table channel drop column version_constraint;
+alter table channel drop column min_version;
+alter table channel drop column resolved_package_id;
@@ -0,0 +1,7 @@
+-- +migrate Up
+
+alter table package add column min_from_version varchar(255) check (min_from_version <> '');
+
+-- +migrate Down
+
+alter table package drop column min_from_version;
@@ -0,0 +1,24 @@
+-- +migrate Up
+
+create table if not exists team_member (
+	team_id uuid not null references team (id) on delete cascade,
+	username varchar(256) not null check (username <> ''),
+	created_ts timestamptz default current_timestamp not null,
+	primary key (team_id, username)
+);
+
+create index on team_member (username);
+
+create table if not exists team_oidc_group (
+	team_id uuid not null references team (id) on delete cascade,
+	group_name varchar(256) not null check (group_name <> ''),
+	created_ts timestamptz default current_timestamp not null,
+	primary key (team_id, group_name)
+);
+
+create index on team_oidc_group (group_name);
+
+-- +migrate Down
+
+drop table if exists team_oidc_group;
+drop table if exists team_member;
@@ -0,0 +1,34 @@
+-- +migrate Up
+
+create table if not exists role (
+	id uuid primary key default uuid_generate_v4(),
+	team_id uuid not null references team (id) on delete cascade,
+	name varchar(50) not null check (name <> ''),
+	description text not null default '',
+	created_ts timestamptz default current_timestamp not null,
+	unique (team_id, name)
+);
+
+create table if not exists role_permission (
+	role_id uuid not null references role (id) on delete cascade,
+	permission varchar(50) not null check (permission <> ''),
+	primary key (role_id, permission)
+);
+
+create table if not exists role_binding (
+	id uuid primary key default uuid_generate_v4(),
+	role_id uuid not null references role (id) on delete cascade,
+	subject_type varchar(10) not null check (subject_type in ('user', 'group')),
+	subject varchar(256) not null check (subject <> ''),
+	application_id uuid references application (id) on delete cascade,
+	created_ts timestamptz default current_timestamp not null
+);
+
+create unique index on role_binding (role_id, subject_type, subject, coalesce(application_id, '00000000-0000-0000-0000-000000000000'));
+create index on role_binding (subject_type, subject);
+
+-- +migrate Down
+
+drop table if exists role_binding;
+drop table if exists role_permission;
+drop table if exists role;
@@ -0,0 +1,23 @@
+-- +migrate Up
+
+create table if not exists api_token (
+	id uuid primary key default uuid_generate_v4(),
+	team_id uuid not null references team (id) on delete cascade,
+	name varchar(100) not null check (name <> ''),
+	kind varchar(20) not null check (kind in ('personal', 'service_account')),
+	owner varchar(256) not null check (owner <> ''),
+	scopes varchar(50)[] not null,
+	token_prefix varchar(16) not null,
+	token_hash varchar(64) not null unique,
+	created_by varchar(256) not null default '',
+	created_ts timestamptz default current_timestamp not null,
+	expires_ts timestamptz,
+	last_used_ts timestamptz,
+	revoked_ts timestamptz
+);
+
+create index on api_token (team_id);
+
+-- +migrate Down
+
+drop table if exists api_token;
@@ -0,0 +1,26 @@
+-- +migrate Up
+
+create table if not exists audit_log (
+	id bigserial primary key,
+	team_id uuid not null references team (id) on delete cascade,
+	created_ts timestamptz default current_timestamp not null,
+	actor varchar(256) not null default '',
+	action varchar(100) not null,
+	method varchar(10) not null,
+	route varchar(256) not null,
+	target_type varchar(50) not null default '',
+	target_id varchar(256) not null default '',
+	-- not a foreign key, so entries about deleted applications are kept
+	application_id uuid,
+	status integer not null,
+	request_id varchar(64) not null default '',
+	before jsonb,
+	after jsonb,
+	changes jsonb
+);
+
+create index on audit_log (team_id, created_ts desc);
+
+-- +migrate Down
+
+drop table if exists audit_log;
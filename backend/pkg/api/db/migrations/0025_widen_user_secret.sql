@@ -0,0 +1,12 @@
+-- +migrate Up
+
+-- Password hashes are stored in PHC string format, which is longer than the
+-- legacy md5 digests.
+alter table users alter column secret type varchar(255);
+
+-- +migrate Down
+
+-- Hashes don't fit in the legacy column, they are lost on downgrade and the
+-- passwords of the users affected must be set again.
+update users set secret = 'reset-required' where length(secret) > 50;
+alter table users alter column secret type varchar(50);
@@ -0,0 +1,17 @@
+-- +migrate Up
+
+create table if not exists syncer_state (
+	channel_id uuid primary key references channel (id) on delete cascade,
+	source varchar(256) not null,
+	track varchar(256) not null,
+	machine_id varchar(64) not null,
+	upstream_version varchar(255) not null default '',
+	last_check_ts timestamptz,
+	last_success_ts timestamptz,
+	last_result varchar(20) not null default '',
+	last_error text not null default ''
+);
+
+-- +migrate Down
+
+drop table if exists syncer_state;
@@ -0,0 +1,64 @@
+-- +migrate Up
+
+-- Notify the Nebraska instances caching the data used to serve updates when
+-- it changes, so they can drop it. Triggers are row-level so no notification
+-- is sent for statements not modifying any row, and updates leaving the rows
+-- as they were are ignored. Postgres sends a single notification per table
+-- and transaction, however many rows are modified.
+
+-- +migrate StatementBegin
+
+create or replace function notify_cache_invalidation() returns trigger as $$
+begin
+	if tg_level = 'ROW' and tg_op = 'UPDATE' then
+		if old is not distinct from new then
+			return null;
+		end if;
+	end if;
+	perform pg_notify('nebraska_cache_invalidation', tg_table_name);
+	return null;
+end;
+$$ language plpgsql;
+
+-- +migrate StatementEnd
+
+create trigger groups_cache_invalidation after insert or update or delete on groups
+	for each row execute procedure notify_cache_invalidation();
+create trigger groups_cache_invalidation_truncate after truncate on groups
+	for each statement execute procedure notify_cache_invalidation();
+create trigger channel_cache_invalidation after insert or update or delete on channel
+	for each row execute procedure notify_cache_invalidation();
+create trigger channel_cache_invalidation_truncate after truncate on channel
+	for each statement execute procedure notify_cache_invalidation();
+create trigger package_cache_invalidation after insert or update or delete on package
+	for each row execute procedure notify_cache_invalidation();
+create trigger package_cache_invalidation_truncate after truncate on package
+	for each statement execute procedure notify_cache_invalidation();
+create trigger flatcar_action_cache_invalidation after insert or update or delete on flatcar_action
+	for each row execute procedure notify_cache_invalidation();
+create trigger flatcar_action_cache_invalidation_truncate after truncate on flatcar_action
+	for each statement execute procedure notify_cache_invalidation();
+create trigger package_channel_blacklist_cache_invalidation after insert or update or delete on package_channel_blacklist
+	for each row execute procedure notify_cache_invalidation();
+create trigger package_channel_blacklist_cache_invalidation_truncate after truncate on package_channel_blacklist
+	for each statement execute procedure notify_cache_invalidation();
+create trigger package_delta_cache_invalidation after insert or update or delete on package_delta
+	for each row execute procedure notify_cache_invalidation();
+create trigger package_delta_cache_invalidation_truncate after truncate on package_delta
+	for each statement execute procedure notify_cache_invalidation();
+
+-- +migrate Down
+
+drop trigger if exists groups_cache_invalidation on groups;
+drop trigger if exists groups_cache_invalidation_truncate on groups;
+drop trigger if exists channel_cache_invalidation on channel;
+drop trigger if exists channel_cache_invalidation_truncate on channel;
+drop trigger if exists package_cache_invalidation on package;
+drop trigger if exists package_cache_invalidation_truncate on package;
+drop trigger if exists flatcar_action_cache_invalidation on flatcar_action;
+drop trigger if exists flatcar_action_cache_invalidation_truncate on flatcar_action;
+drop trigger if exists package_channel_blacklist_cache_invalidation on package_channel_blacklist;
+drop trigger if exists package_channel_blacklist_cache_invalidation_truncate on package_channel_blacklist;
+drop trigger if exists package_delta_cache_invalidation on package_delta;
+drop trigger if exists package_delta_cache_invalidation_truncate on package_delta;
+drop function if exists notify_cache_invalidation();
@@ -0,0 +1,26 @@
+-- +migrate Up
+
+-- Mirrors are base urls the payloads of a package can also be downloaded from.
+-- The optional client_cidr, group_id and arch columns restrict the clients a
+-- mirror is offered to.
+create table if not exists package_mirror (
+	id uuid primary key default uuid_generate_v4(),
+	package_id uuid not null references package (id) on delete cascade,
+	url varchar(256) not null check (url <> ''),
+	position integer not null default 0,
+	client_cidr cidr,
+	group_id uuid references groups (id) on delete cascade,
+	arch integer,
+	created_ts timestamptz default current_timestamp not null
+);
+
+create index package_mirror_package_id_idx on package_mirror (package_id);
+
+create trigger package_mirror_cache_invalidation after insert or update or delete on package_mirror
+	for each row execute procedure notify_cache_invalidation();
+create trigger package_mirror_cache_invalidation_truncate after truncate on package_mirror
+	for each statement execute procedure notify_cache_invalidation();
+
+-- +migrate Down
+
+drop table if exists package_mirror;
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"errors"
+	"time"
+
+	"github.com/blang/semver/v4"
+	"github.com/doug-martin/goqu/v9"
+	"gopkg.in/guregu/null.v4"
+)
+
+var (
+	// ErrInvalidPackageDelta indicates that a package delta is not valid: its
+	// source version must be a valid semver older than the package version,
+	// it must have an url and source versions must not be repeated.
+	ErrInvalidPackageDelta = errors.New("nebraska: invalid package delta")
+)
+
+// PackageDelta represents a delta payload of a package, which can be used to
+// update instances running the version the delta was generated from instead
+// of the package's full payload.
+type PackageDelta struct {
+	ID                   string      `db:"id" json:"id"`
+	PackageID            string      `db:"package_id" json:"-"`
+	FromVersion          string      `db:"from_version" json:"from_version"`
+	URL                  string      `db:"url" json:"url"`
+	Filename             null.String `db:"filename" json:"filename"`
+	Size                 null.String `db:"size" json:"size"`
+	Hash                 null.String `db:"hash" json:"hash"`
+	Sha256               null.String `db:"sha256" json:"sha256"`
+	MetadataSignatureRsa string      `db:"metadata_signature_rsa" json:"metadata_signature_rsa"`
+	MetadataSize         string      `db:"metadata_size" json:"metadata_size"`
+	CreatedTs            time.Time   `db:"created_ts" json:"created_ts"`
+}
+
+// PackageDeltas represents the deltas of a package, loaded along with it as
+// JSON.
+type PackageDeltas []*PackageDelta
+
+// Scan implements the sql.Scanner interface.
+func (d *PackageDeltas) Scan(src interface{}) error {
+	var deltas []*struct {
+		PackageDelta
+		PackageID string `json:"package_id"`
+	}
+	if err := scanJSON(src, &deltas); err != nil {
+		return err
+	}
+	*d = nil
+	for _, delta := range deltas {
+		delta.PackageDelta.PackageID = delta.PackageID
+		*d = append(*d, &delta.PackageDelta)
+	}
+	return nil
+}
+
+// DeltaFrom returns the package delta that can be used to update instances
+// running the version provided, or nil if the package doesn't have one.
+func (pkg *Package) DeltaFrom(version string) *PackageDelta {
+	for _, delta := range pkg.Deltas {
+		if delta.FromVersion == version {
+			return delta
+		}
+	}
+	return nil
+}
+
+// AddPackageDelta registers the provided delta payload for the package it
+// references.
+func (api *API) AddPackageDelta(delta *PackageDelta) (*PackageDelta, error) {
+	defer api.invalidateUpdateCache()
+
+	pkg, err := api.GetPackage(delta.PackageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validatePackageDelta(pkg, delta); err != nil {
+		return nil, err
+	}
+	if pkg.DeltaFrom(delta.FromVersion) != nil {
+		return nil, ErrInvalidPackageDelta
+	}
+	if err := insertPackageDelta(api.db, delta); err != nil {
+		return nil, err
+	}
+	return delta, nil
+}
+
+// GetPackageDeltas returns the delta payloads of the package provided.
+func (api *API) GetPackageDeltas(packageID string) ([]*PackageDelta, error) {
+	return api.getPackageDeltas(packageID)
+}
+
+func (api *API) getPackageDeltas(packageID string) ([]*PackageDelta, error) {
+	query, _, err := goqu.From("package_delta").
+		Where(goqu.C("package_id").Eq(packageID)).
+		Order(goqu.C("created_ts").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	var deltas []*PackageDelta
+	rows, err := api.db.Queryx(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		delta := &PackageDelta{}
+		if err := rows.StructScan(delta); err != nil {
+			return nil, err
+		}
+		deltas = append(deltas, delta)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deltas, nil
+}
+
+// validatePackageDeltas checks that the deltas of the package provided are
+// valid and that there is at most one delta per source version.
+func validatePackageDeltas(pkg *Package) error {
+	fromVersions := make(map[string]struct{}, len(pkg.Deltas))
+	for _, delta := range pkg.Deltas {
+		if err := validatePackageDelta(pkg, delta); err != nil {
+			return err
+		}
+		if _, ok := fromVersions[delta.FromVersion]; ok {
+			return ErrInvalidPackageDelta
+		}
+		fromVersions[delta.FromVersion] = struct{}{}
+	}
+	return nil
+}
+
+func validatePackageDelta(pkg *Package, delta *PackageDelta) error {
+	if delta == nil || delta.URL == "" {
+		return ErrInvalidPackageDelta
+	}
+	fromSemver, err := semver.Make(delta.FromVersion)
+	if err != nil {
+		return ErrInvalidPackageDelta
+	}
+	pkgSemver, err := semver.Make(pkg.Version)
+	if err != nil {
+		return ErrInvalidSemver
+	}
+	if !fromSemver.LT(pkgSemver) {
+		return ErrInvalidPackageDelta
+	}
+	return nil
+}
+
+func packageDeltaInsert(delta *PackageDelta) *goqu.InsertDataset {
+	return goqu.Insert("package_delta").
+		Cols("package_id", "from_version", "url", "filename", "size", "hash", "sha256", "metadata_signature_rsa", "metadata_size").
+		Vals(goqu.Vals{
+			delta.PackageID,
+			delta.FromVersion,
+			delta.URL,
+			delta.Filename,
+			delta.Size,
+			delta.Hash,
+			delta.Sha256,
+			delta.MetadataSignatureRsa,
+			delta.MetadataSize,
+		})
+}
+
+func insertPackageDelta(q queryer, delta *PackageDelta) error {
+	query, _, err := packageDeltaInsert(delta).
+		Returning(goqu.T("package_delta").All()).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	return q.QueryRowx(query).StructScan(delta)
+}
+
+// updatePackageDeltas makes the package deltas stored match the ones in the
+// updated package entry provided, adding, updating or removing them as needed.
+//
+// This method is part of the transaction that updates a package.
+func (api *API) updatePackageDeltas(tx transaction, pkg *Package) error {
+	fromVersions := make([]string, 0, len(pkg.Deltas))
+	for _, delta := range pkg.Deltas {
+		fromVersions = append(fromVersions, delta.FromVersion)
+	}
+
+	deleteQuery := goqu.Delete("package_delta").Where(goqu.C("package_id").Eq(pkg.ID))
+	if len(fromVersions) > 0 {
+		deleteQuery = deleteQuery.Where(goqu.C("from_version").NotIn(fromVersions))
+	}
+	query, _, err := deleteQuery.ToSQL()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+
+	for _, delta := range pkg.Deltas {
+		delta.PackageID = pkg.ID
+		query, _, err := packageDeltaInsert(delta).
+			OnConflict(goqu.DoUpdate("package_id, from_version", goqu.Record{
+				"url":                    delta.URL,
+				"filename":               delta.Filename,
+				"size":                   delta.Size,
+				"hash":                   delta.Hash,
+				"sha256":                 delta.Sha256,
+				"metadata_signature_rsa": delta.MetadataSignatureRsa,
+				"metadata_size":          delta.MetadataSize,
+			})).
+			Returning(goqu.T("package_delta").All()).
+			ToSQL()
+		if err != nil {
+			return err
+		}
+		if err := tx.QueryRowx(query).StructScan(delta); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
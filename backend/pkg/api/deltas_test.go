@@ -0,0 +1,91 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestAddPackageDelta(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tPkg, _ := a.AddPackage(&Package{Type: PkgTypeFlatcar, URL: "http://sample.url/pkg", Version: "12.1.0", ApplicationID: tApp.ID})
+
+	delta, err := a.AddPackageDelta(&PackageDelta{PackageID: tPkg.ID, FromVersion: "12.0.0", URL: "http://sample.url/delta", Filename: null.StringFrom("delta-12.0.0.gz"), Sha256: null.StringFrom("fsdkjjfghsdakjfgaksdjfasd")})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, delta.ID)
+
+	pkg, err := a.GetPackage(tPkg.ID)
+	require.NoError(t, err)
+	require.Len(t, pkg.Deltas, 1)
+	assert.Equal(t, "12.0.0", pkg.Deltas[0].FromVersion)
+	assert.Equal(t, "delta-12.0.0.gz", pkg.Deltas[0].Filename.String)
+	assert.Equal(t, tPkg.ID, pkg.Deltas[0].PackageID)
+	assert.Equal(t, delta.ID, pkg.Deltas[0].ID)
+	assert.Equal(t, pkg.Deltas[0], pkg.DeltaFrom("12.0.0"))
+	assert.Nil(t, pkg.DeltaFrom("11.0.0"))
+
+	_, err = a.AddPackageDelta(&PackageDelta{PackageID: tPkg.ID, FromVersion: "12.0.0", URL: "http://sample.url/delta"})
+	assert.Equal(t, ErrInvalidPackageDelta, err, "source versions must not be repeated")
+
+	_, err = a.AddPackageDelta(&PackageDelta{PackageID: tPkg.ID, FromVersion: "12.1.0", URL: "http://sample.url/delta"})
+	assert.Equal(t, ErrInvalidPackageDelta, err, "source version must be older than the package version")
+
+	_, err = a.AddPackageDelta(&PackageDelta{PackageID: tPkg.ID, FromVersion: "invalid", URL: "http://sample.url/delta"})
+	assert.Equal(t, ErrInvalidPackageDelta, err)
+
+	_, err = a.AddPackageDelta(&PackageDelta{PackageID: tPkg.ID, FromVersion: "11.0.0"})
+	assert.Equal(t, ErrInvalidPackageDelta, err, "url is required")
+}
+
+func TestPackageDeltas_AddAndUpdatePackage(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+
+	_, err := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.1.0", ApplicationID: tApp.ID, Deltas: []*PackageDelta{
+		{FromVersion: "12.0.0", URL: "http://sample.url/delta"},
+		{FromVersion: "12.0.0", URL: "http://sample.url/delta"},
+	}})
+	assert.Equal(t, ErrInvalidPackageDelta, err)
+
+	tPkg, err := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.1.0", ApplicationID: tApp.ID, Deltas: []*PackageDelta{
+		{FromVersion: "12.0.0", URL: "http://sample.url/delta", Filename: null.StringFrom("delta-12.0.0")},
+		{FromVersion: "11.0.0", URL: "http://sample.url/delta", Filename: null.StringFrom("delta-11.0.0")},
+	}})
+	require.NoError(t, err)
+
+	pkg, err := a.GetPackage(tPkg.ID)
+	require.NoError(t, err)
+	assert.Len(t, pkg.Deltas, 2)
+
+	// Deltas are left untouched when not provided
+	pkg.Deltas = nil
+	require.NoError(t, a.UpdatePackage(pkg))
+	pkg, _ = a.GetPackage(tPkg.ID)
+	assert.Len(t, pkg.Deltas, 2)
+
+	// Deltas provided replace the existing ones
+	pkg.Deltas = []*PackageDelta{
+		{FromVersion: "12.0.0", URL: "http://sample.url/delta", Filename: null.StringFrom("delta-12.0.0-new")},
+		{FromVersion: "10.0.0", URL: "http://sample.url/delta", Filename: null.StringFrom("delta-10.0.0")},
+	}
+	require.NoError(t, a.UpdatePackage(pkg))
+	pkg, _ = a.GetPackage(tPkg.ID)
+	require.Len(t, pkg.Deltas, 2)
+	assert.Equal(t, "delta-12.0.0-new", pkg.DeltaFrom("12.0.0").Filename.String)
+	assert.NotNil(t, pkg.DeltaFrom("10.0.0"))
+	assert.Nil(t, pkg.DeltaFrom("11.0.0"))
+
+	pkg.Deltas = []*PackageDelta{}
+	require.NoError(t, a.UpdatePackage(pkg))
+	pkg, _ = a.GetPackage(tPkg.ID)
+	assert.Empty(t, pkg.Deltas)
+}
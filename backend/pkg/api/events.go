@@ -98,6 +98,9 @@ func (api *API) RegisterEvent(instanceID, appID, groupID string, etype, eresult
 	if instance.Application.ApplicationID != appID {
 		return ErrInvalidApplicationOrGroup
 	}
+	if override := instance.Application.Override; override != nil && override.GroupID.Valid {
+		groupID = override.GroupID.String
+	}
 	if !instance.Application.UpdateInProgress {
 		// Do not log the event when we don't know about an update going on.
 		// There is no need to reset the instance state here because update_in_progress
@@ -159,7 +162,7 @@ func (api *API) RegisterEvent(instanceID, appID, groupID string, etype, eresult
 // given event. Depending on the type of the event and its result, the status
 // of the instance may be updated, new activity entries could be created, etc.
 func (api *API) triggerEventConsequences(instanceID, appID, groupID, lastUpdateVersion string, etype, result int) error {
-	group, err := api.GetGroup(groupID)
+	group, err := api.getGroupForUpdate(groupID)
 	if err != nil {
 		return err
 	}
@@ -210,6 +213,9 @@ func (api *API) triggerEventConsequences(instanceID, appID, groupID, lastUpdateV
 			logger.Error().Err(err).Msg("triggerEventConsequences - could not add instance activity")
 		}
 
+		// The group may be shared with other update checks through the
+		// update cache, so it's not modified here.
+		updatesEnabled := group.PolicyUpdatesEnabled
 		if api.disableUpdatesOnFailedRollout {
 			updatesStats, err := api.getGroupUpdatesStats(group)
 			if err != nil {
@@ -225,6 +231,13 @@ func (api *API) triggerEventConsequences(instanceID, appID, groupID, lastUpdateV
 				if err := api.newGroupActivityEntry(activityRolloutFailed, activityError, lastUpdateVersion, appID, groupID); err != nil {
 					logger.Error().Err(err).Msg("triggerEventConsequences - could not add group activity")
 				}
+				updatesEnabled = false
+			}
+		}
+
+		if group.PolicyMaxFailureRate > 0 && updatesEnabled {
+			if err := api.enforceFailureRatePolicy(group, appID, lastUpdateVersion); err != nil {
+				logger.Error().Err(err).Msg("triggerEventConsequences - could not enforce failure rate policy")
 			}
 		}
 	}
@@ -232,6 +245,51 @@ func (api *API) triggerEventConsequences(instanceID, appID, groupID, lastUpdateV
 	return nil
 }
 
+// enforceFailureRatePolicy pauses the rollout of the given version in the
+// group provided when the share of failed updates exceeds the group's maximum
+// failure rate. If the group policy requests it, the group's channel is also
+// pointed back to the package it pointed to before.
+func (api *API) enforceFailureRatePolicy(group *Group, appID, version string) error {
+	stats, err := api.getGroupFailureRateStats(group, version)
+	if err != nil {
+		return err
+	}
+	if stats.UpdatesGranted == 0 || stats.UpdatesFailed*100 <= stats.UpdatesGranted*group.PolicyMaxFailureRate {
+		return nil
+	}
+
+	if err := api.disableUpdates(group.ID); err != nil {
+		return err
+	}
+	if err := api.setGroupRolloutInProgress(group.ID, false); err != nil {
+		logger.Error().Err(err).Msg("enforceFailureRatePolicy - could not set rollout progress")
+	}
+	if err := api.newGroupActivityEntry(activityRolloutPaused, activityError, version, appID, group.ID); err != nil {
+		logger.Error().Err(err).Msg("enforceFailureRatePolicy - could not add group activity")
+	}
+
+	if !group.PolicyRollbackOnFailure || group.Channel == nil || group.Channel.Package == nil || group.Channel.Package.Version != version {
+		return nil
+	}
+	// The channel is loaded again, as the group's one may come from the
+	// update cache and rolling it back updates it.
+	channel, err := api.GetChannel(group.Channel.ID)
+	if err != nil {
+		return err
+	}
+	pkg, err := api.rollbackChannel(channel)
+	if err != nil {
+		return err
+	}
+	if pkg != nil {
+		if err := api.newChannelActivityEntry(activityChannelRolledBack, activityWarning, pkg.Version, appID, channel.ID); err != nil {
+			logger.Error().Err(err).Msg("enforceFailureRatePolicy - could not add channel activity")
+		}
+	}
+
+	return nil
+}
+
 func (api *API) GetEvent(instanceID string, appID string, timestamp time.Time) (null.String, error) {
 	query, _, err := goqu.From("event").
 		Select("error_code").
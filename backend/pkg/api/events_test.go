@@ -108,3 +108,76 @@ func TestRegisterEvent_TriggerEventConsequences_FirstUpdateAttemptFailed(t *test
 	group, _ := a.GetGroup(tGroup.ID)
 	assert.Equal(t, false, group.PolicyUpdatesEnabled, "First update attempt failed.")
 }
+
+func TestRegisterEvent_TriggerEventConsequences_MaxFailureRateExceeded(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tPkg1, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.0.0", ApplicationID: tApp.ID})
+	tPkg2, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.1.0", ApplicationID: tApp.ID})
+	tChannel, _ := a.AddChannel(&Channel{Name: "test_channel", Color: "blue", ApplicationID: tApp.ID, PackageID: null.StringFrom(tPkg1.ID)})
+	tGroup, _ := a.AddGroup(&Group{Name: "group1", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: false, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 10, PolicyUpdateTimeout: "60 minutes", PolicyMaxFailureRate: 40, PolicyRollbackOnFailure: true})
+
+	tChannel.PackageID = null.StringFrom(tPkg2.ID)
+	err := a.UpdateChannel(tChannel)
+	assert.NoError(t, err)
+	channel, _ := a.GetChannel(tChannel.ID)
+	assert.Equal(t, null.StringFrom(tPkg1.ID), channel.PreviousPackageID)
+
+	var instanceIDs []string
+	for i := 0; i < 3; i++ {
+		instanceID := uuid.New().String()
+		_, err := a.GetUpdatePackage(instanceID, "", "10.0.0.1", "11.0.0", tApp.ID, tGroup.ID)
+		assert.NoError(t, err)
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+
+	err = a.RegisterEvent(instanceIDs[0], tApp.ID, tGroup.ID, EventUpdateComplete, ResultFailed, "", "")
+	assert.NoError(t, err)
+	group, _ := a.GetGroup(tGroup.ID)
+	assert.True(t, group.PolicyUpdatesEnabled, "Failure rate is below the group's maximum.")
+	assert.Equal(t, tPkg2.ID, group.Channel.PackageID.String)
+
+	err = a.RegisterEvent(instanceIDs[1], tApp.ID, tGroup.ID, EventUpdateComplete, ResultFailed, "", "")
+	assert.NoError(t, err)
+	group, _ = a.GetGroup(tGroup.ID)
+	assert.False(t, group.PolicyUpdatesEnabled, "Failure rate exceeded the group's maximum.")
+	assert.False(t, group.RolloutInProgress)
+	assert.Equal(t, tPkg1.ID, group.Channel.PackageID.String, "Channel should point back to the previous package.")
+	assert.False(t, group.Channel.PreviousPackageID.Valid)
+}
+
+func TestRegisterEvent_TriggerEventConsequences_RollbackVersionConstraint(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tPkg1, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.0.0", ApplicationID: tApp.ID})
+	tChannel, _ := a.AddChannel(&Channel{Name: "test_channel", Color: "blue", ApplicationID: tApp.ID, VersionConstraint: null.StringFrom("~12")})
+	tPkg2, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.1.0", ApplicationID: tApp.ID})
+	tGroup, _ := a.AddGroup(&Group{Name: "group1", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: false, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 10, PolicyUpdateTimeout: "60 minutes", PolicyMaxFailureRate: 40, PolicyRollbackOnFailure: true})
+
+	group, _ := a.GetGroup(tGroup.ID)
+	assert.Equal(t, tPkg2.ID, group.Channel.Package.ID)
+
+	var instanceIDs []string
+	for i := 0; i < 2; i++ {
+		instanceID := uuid.New().String()
+		_, err := a.GetUpdatePackage(instanceID, "", "10.0.0.1", "11.0.0", tApp.ID, tGroup.ID)
+		assert.NoError(t, err)
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+
+	err := a.RegisterEvent(instanceIDs[0], tApp.ID, tGroup.ID, EventUpdateComplete, ResultFailed, "", "")
+	assert.NoError(t, err)
+	group, _ = a.GetGroup(tGroup.ID)
+	assert.False(t, group.PolicyUpdatesEnabled, "Failure rate exceeded the group's maximum.")
+	if assert.NotNil(t, group.Channel.Package) {
+		assert.Equal(t, tPkg1.ID, group.Channel.Package.ID, "Channel should point to the newest package older than the failing one.")
+	}
+	pkg, _ := a.GetPackage(tPkg2.ID)
+	assert.Equal(t, StringArray{tChannel.ID}, pkg.ChannelsBlacklist, "Failing package should blacklist the channel.")
+}
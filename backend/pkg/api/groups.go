@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -46,9 +47,35 @@ var (
 	ErrInvalidChannel = errors.New("nebraska: invalid channel")
 
 	// ErrExpectingValidTimezone error indicates that a valid timezone wasn't
-	// provided when enabling the flag PolicyOfficeHours.
+	// provided when enabling the flag PolicyOfficeHours or setting update
+	// windows or blackout periods.
 	ErrExpectingValidTimezone = errors.New("nebraska: expecting valid timezone")
 
+	// ErrInvalidRolloutSteps error indicates that the rollout steps provided
+	// are not a list of increasing percentages between 1 and 100.
+	ErrInvalidRolloutSteps = errors.New("nebraska: invalid rollout steps")
+
+	// ErrInvalidRolloutStepInterval error indicates that the rollout step
+	// interval provided is not an interval like "30 minutes" or "1 day".
+	ErrInvalidRolloutStepInterval = errors.New("nebraska: invalid rollout step interval")
+
+	// ErrInvalidRolloutStepHealthThreshold error indicates that the rollout
+	// step health threshold provided is not a percentage.
+	ErrInvalidRolloutStepHealthThreshold = errors.New("nebraska: invalid rollout step health threshold")
+
+	// ErrInvalidMaxFailureRate error indicates that the maximum failure rate
+	// provided is not a percentage.
+	ErrInvalidMaxFailureRate = errors.New("nebraska: invalid max failure rate")
+
+	// ErrInvalidFailureRateWindow error indicates that the failure rate
+	// window provided is not an interval like "30 minutes" or "1 day".
+	ErrInvalidFailureRateWindow = errors.New("nebraska: invalid failure rate window")
+
+	// validIntervalRegexp matches the intervals accepted by the group
+	// policies, a number of minutes, hours or days like the ones offered by
+	// the groups edit dialog.
+	validIntervalRegexp = regexp.MustCompile(`^[1-9][0-9]{0,5} (minute|hour|day)s?$`)
+
 	// cachedGroups caches the mapping of group track names and
 	// architectures to groups. It must not be modified directly but
 	// replaced (atomically or via lock) by a new map to prevent data races.
@@ -83,22 +110,33 @@ type GroupDescriptor struct {
 
 // Group represents a Nebraska application's group.
 type Group struct {
-	ID                        string      `db:"id" json:"id"`
-	Name                      string      `db:"name" json:"name"`
-	Description               string      `db:"description" json:"description"`
-	CreatedTs                 time.Time   `db:"created_ts" json:"created_ts"`
-	RolloutInProgress         bool        `db:"rollout_in_progress" json:"rollout_in_progress"`
-	ApplicationID             string      `db:"application_id" json:"application_id"`
-	ChannelID                 null.String `db:"channel_id" json:"channel_id"`
-	PolicyUpdatesEnabled      bool        `db:"policy_updates_enabled" json:"policy_updates_enabled"`
-	PolicySafeMode            bool        `db:"policy_safe_mode" json:"policy_safe_mode"`
-	PolicyOfficeHours         bool        `db:"policy_office_hours" json:"policy_office_hours"`
-	PolicyTimezone            null.String `db:"policy_timezone" json:"policy_timezone"`
-	PolicyPeriodInterval      string      `db:"policy_period_interval" json:"policy_period_interval"`
-	PolicyMaxUpdatesPerPeriod int         `db:"policy_max_updates_per_period" json:"policy_max_updates_per_period"`
-	PolicyUpdateTimeout       string      `db:"policy_update_timeout" json:"policy_update_timeout"`
-	Channel                   *Channel    `db:"channel" json:"channel,omitempty"`
-	Track                     string      `db:"track" json:"track"`
+	ID                               string          `db:"id" json:"id"`
+	Name                             string          `db:"name" json:"name"`
+	Description                      string          `db:"description" json:"description"`
+	CreatedTs                        time.Time       `db:"created_ts" json:"created_ts"`
+	RolloutInProgress                bool            `db:"rollout_in_progress" json:"rollout_in_progress"`
+	ApplicationID                    string          `db:"application_id" json:"application_id"`
+	ChannelID                        null.String     `db:"channel_id" json:"channel_id"`
+	PolicyUpdatesEnabled             bool            `db:"policy_updates_enabled" json:"policy_updates_enabled"`
+	PolicySafeMode                   bool            `db:"policy_safe_mode" json:"policy_safe_mode"`
+	PolicyOfficeHours                bool            `db:"policy_office_hours" json:"policy_office_hours"`
+	PolicyTimezone                   null.String     `db:"policy_timezone" json:"policy_timezone"`
+	PolicyPeriodInterval             string          `db:"policy_period_interval" json:"policy_period_interval"`
+	PolicyMaxUpdatesPerPeriod        int             `db:"policy_max_updates_per_period" json:"policy_max_updates_per_period"`
+	PolicyUpdateTimeout              string          `db:"policy_update_timeout" json:"policy_update_timeout"`
+	Channel                          *Channel        `db:"channel" json:"channel,omitempty"`
+	Track                            string          `db:"track" json:"track"`
+	PolicyRolloutSteps               string          `db:"policy_rollout_steps" json:"policy_rollout_steps"`
+	PolicyRolloutStepInterval        string          `db:"policy_rollout_step_interval" json:"policy_rollout_step_interval"`
+	PolicyRolloutStepHealthThreshold int             `db:"policy_rollout_step_health_threshold" json:"policy_rollout_step_health_threshold"`
+	RolloutStep                      int             `db:"rollout_step" json:"rollout_step"`
+	RolloutStepVersion               string          `db:"rollout_step_version" json:"rollout_step_version"`
+	RolloutStepStartedTs             null.Time       `db:"rollout_step_started_ts" json:"rollout_step_started_ts"`
+	PolicyMaxFailureRate             int             `db:"policy_max_failure_rate" json:"policy_max_failure_rate"`
+	PolicyFailureRateWindow          string          `db:"policy_failure_rate_window" json:"policy_failure_rate_window"`
+	PolicyRollbackOnFailure          bool            `db:"policy_rollback_on_failure" json:"policy_rollback_on_failure"`
+	PolicyUpdateWindows              UpdateWindows   `db:"policy_update_windows" json:"policy_update_windows"`
+	PolicyBlackoutPeriods            BlackoutPeriods `db:"policy_blackout_periods" json:"policy_blackout_periods"`
 }
 
 // VersionBreakdownEntry represents the distribution of the versions currently
@@ -153,10 +191,20 @@ type UpdatesStats struct {
 
 // AddGroup registers the provided group.
 func (api *API) AddGroup(group *Group) (*Group, error) {
-	if group.PolicyOfficeHours && !isTimezoneValid(group.PolicyTimezone.String) {
+	defer api.invalidateUpdateCache()
+
+	if group.usesTimezone() && !isTimezoneValid(group.PolicyTimezone.String) {
 		return nil, ErrExpectingValidTimezone
 	}
 
+	if err := validateRolloutPolicy(group); err != nil {
+		return nil, err
+	}
+
+	if err := validateUpdateWindows(group); err != nil {
+		return nil, err
+	}
+
 	if group.ChannelID.String != "" {
 		if err := api.validateChannel(group.ChannelID.String, group.ApplicationID); err != nil {
 			return nil, err
@@ -171,7 +219,10 @@ func (api *API) AddGroup(group *Group) (*Group, error) {
 	}
 	query, _, err := goqu.Insert("groups").
 		Cols("id", "name", "description", "application_id", "channel_id", "policy_updates_enabled", "policy_safe_mode", "policy_office_hours",
-			"policy_timezone", "policy_period_interval", "policy_max_updates_per_period", "policy_update_timeout", "track").
+			"policy_timezone", "policy_period_interval", "policy_max_updates_per_period", "policy_update_timeout", "track",
+			"policy_rollout_steps", "policy_rollout_step_interval", "policy_rollout_step_health_threshold",
+			"policy_max_failure_rate", "policy_failure_rate_window", "policy_rollback_on_failure",
+			"policy_update_windows", "policy_blackout_periods").
 		Vals(goqu.Vals{
 			group.ID,
 			group.Name,
@@ -186,6 +237,14 @@ func (api *API) AddGroup(group *Group) (*Group, error) {
 			group.PolicyMaxUpdatesPerPeriod,
 			group.PolicyUpdateTimeout,
 			group.Track,
+			group.PolicyRolloutSteps,
+			group.PolicyRolloutStepInterval,
+			group.PolicyRolloutStepHealthThreshold,
+			group.PolicyMaxFailureRate,
+			group.PolicyFailureRateWindow,
+			group.PolicyRollbackOnFailure,
+			group.PolicyUpdateWindows,
+			group.PolicyBlackoutPeriods,
 		}).
 		Returning(goqu.T("groups").All()).
 		ToSQL()
@@ -203,10 +262,20 @@ func (api *API) AddGroup(group *Group) (*Group, error) {
 // UpdateGroup updates an existing group using the context of the group
 // provided.
 func (api *API) UpdateGroup(group *Group) error {
-	if group.PolicyOfficeHours && !isTimezoneValid(group.PolicyTimezone.String) {
+	defer api.invalidateUpdateCache()
+
+	if group.usesTimezone() && !isTimezoneValid(group.PolicyTimezone.String) {
 		return ErrExpectingValidTimezone
 	}
 
+	if err := validateRolloutPolicy(group); err != nil {
+		return err
+	}
+
+	if err := validateUpdateWindows(group); err != nil {
+		return err
+	}
+
 	groupBeforeUpdate, err := api.GetGroup(group.ID)
 	if err != nil {
 		return err
@@ -223,17 +292,25 @@ func (api *API) UpdateGroup(group *Group) error {
 	query, _, err := goqu.Update("groups").
 		Set(
 			goqu.Record{
-				"name":                          group.Name,
-				"description":                   group.Description,
-				"channel_id":                    group.ChannelID,
-				"policy_updates_enabled":        group.PolicyUpdatesEnabled,
-				"policy_safe_mode":              group.PolicySafeMode,
-				"policy_office_hours":           group.PolicyOfficeHours,
-				"policy_timezone":               group.PolicyTimezone,
-				"policy_period_interval":        group.PolicyPeriodInterval,
-				"policy_max_updates_per_period": group.PolicyMaxUpdatesPerPeriod,
-				"policy_update_timeout":         group.PolicyUpdateTimeout,
-				"track":                         group.Track,
+				"name":                                 group.Name,
+				"description":                          group.Description,
+				"channel_id":                           group.ChannelID,
+				"policy_updates_enabled":               group.PolicyUpdatesEnabled,
+				"policy_safe_mode":                     group.PolicySafeMode,
+				"policy_office_hours":                  group.PolicyOfficeHours,
+				"policy_timezone":                      group.PolicyTimezone,
+				"policy_period_interval":               group.PolicyPeriodInterval,
+				"policy_max_updates_per_period":        group.PolicyMaxUpdatesPerPeriod,
+				"policy_update_timeout":                group.PolicyUpdateTimeout,
+				"track":                                group.Track,
+				"policy_rollout_steps":                 group.PolicyRolloutSteps,
+				"policy_rollout_step_interval":         group.PolicyRolloutStepInterval,
+				"policy_rollout_step_health_threshold": group.PolicyRolloutStepHealthThreshold,
+				"policy_max_failure_rate":              group.PolicyMaxFailureRate,
+				"policy_failure_rate_window":           group.PolicyFailureRateWindow,
+				"policy_rollback_on_failure":           group.PolicyRollbackOnFailure,
+				"policy_update_windows":                group.PolicyUpdateWindows,
+				"policy_blackout_periods":              group.PolicyBlackoutPeriods,
 			},
 		).
 		Where(goqu.C("id").Eq(group.ID)).
@@ -259,6 +336,8 @@ func (api *API) UpdateGroup(group *Group) error {
 
 // DeleteGroup removes the group identified by the id provided.
 func (api *API) DeleteGroup(groupID string) error {
+	defer api.invalidateUpdateCache()
+
 	query, _, err := goqu.Delete("groups").Where(goqu.C("id").Eq(groupID)).ToSQL()
 	if err != nil {
 		return err
@@ -410,24 +489,26 @@ func (api *API) getGroupsFromQuery(query string) ([]*Group, error) {
 		if err := rows.StructScan(&group); err != nil {
 			return nil, err
 		}
-		if group.ChannelID.String == "" {
-			group.Channel = nil
-		} else {
-			channel, err := api.GetChannel(group.ChannelID.String)
-			switch err {
-			case nil:
-				group.Channel = channel
-			case sql.ErrNoRows:
-				group.Channel = nil
-			default:
-				return nil, err
-			}
-		}
 		groups = append(groups, &group)
 	}
-	if err := rows.Err(); err != nil {
+	if err := closeRows(rows); err != nil {
 		return nil, err
 	}
+	for _, group := range groups {
+		if group.ChannelID.String == "" {
+			group.Channel = nil
+			continue
+		}
+		channel, err := api.GetChannel(group.ChannelID.String)
+		switch err {
+		case nil:
+			group.Channel = channel
+		case sql.ErrNoRows:
+			group.Channel = nil
+		default:
+			return nil, err
+		}
+	}
 	return groups, nil
 }
 
@@ -443,6 +524,38 @@ func (api *API) validateChannel(channelID, appID string) error {
 	return nil
 }
 
+// usesTimezone checks if the group's update policy depends on its timezone.
+func (group *Group) usesTimezone() bool {
+	return group.PolicyOfficeHours || len(group.PolicyUpdateWindows) > 0 || len(group.PolicyBlackoutPeriods) > 0
+}
+
+// validateRolloutPolicy checks if the rollout steps and failure rate settings
+// of the group provided are valid.
+func validateRolloutPolicy(group *Group) error {
+	if _, err := parseRolloutSteps(group.PolicyRolloutSteps); err != nil {
+		return err
+	}
+	if group.PolicyRolloutStepInterval != "" && !isValidInterval(group.PolicyRolloutStepInterval) {
+		return ErrInvalidRolloutStepInterval
+	}
+	if group.PolicyRolloutStepHealthThreshold < 0 || group.PolicyRolloutStepHealthThreshold > 100 {
+		return ErrInvalidRolloutStepHealthThreshold
+	}
+	if group.PolicyMaxFailureRate < 0 || group.PolicyMaxFailureRate > 100 {
+		return ErrInvalidMaxFailureRate
+	}
+	if group.PolicyFailureRateWindow != "" && !isValidInterval(group.PolicyFailureRateWindow) {
+		return ErrInvalidFailureRateWindow
+	}
+	return nil
+}
+
+// isValidInterval checks if the interval provided can be used in the group
+// policies.
+func isValidInterval(interval string) bool {
+	return validIntervalRegexp.MatchString(interval)
+}
+
 // getGroupUpdatesStats returns a set of statistics about the distribution of
 // updates and their status in the group provided.
 func (api *API) getGroupUpdatesStats(group *Group) (*UpdatesStats, error) {
@@ -474,37 +587,159 @@ func (api *API) getGroupUpdatesStats(group *Group) (*UpdatesStats, error) {
 	return &updatesStats, nil
 }
 
+// rolloutStepStats represents the status of the updates granted to the
+// instances of a group since its current rollout step started.
+type rolloutStepStats struct {
+	UpdatesGranted   int `db:"updates_granted"`
+	UpdatesSucceeded int `db:"updates_succeeded"`
+}
+
+// getGroupRolloutStepStats returns how many updates to the version being
+// rolled out were granted in the group provided during its current rollout
+// step and how many of them succeeded.
+func (api *API) getGroupRolloutStepStats(group *Group) (*rolloutStepStats, error) {
+	var stats rolloutStepStats
+
+	query, _, err := goqu.From("instance_application").Select(
+		goqu.COALESCE(goqu.SUM(goqu.L("case when last_update_version = ? then 1 else 0 end", group.RolloutStepVersion)), 0).As("updates_granted"),
+		goqu.COALESCE(goqu.SUM(goqu.L("case when update_in_progress = 'false' and last_update_version = ? and last_update_version = version then 1 else 0 end", group.RolloutStepVersion)), 0).As("updates_succeeded"),
+	).Where(goqu.C("group_id").Eq(group.ID), goqu.C("last_update_granted_ts").Gte(group.RolloutStepStartedTs.Time),
+		goqu.L(ignoreFakeInstanceCondition("instance_id")),
+	).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	err = api.db.QueryRowx(query).StructScan(&stats)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// failureRateStats represents how many of the updates to the version being
+// rolled out in a group failed within the group's failure rate window.
+type failureRateStats struct {
+	UpdatesGranted int `db:"updates_granted"`
+	UpdatesFailed  int `db:"updates_failed"`
+}
+
+// getGroupFailureRateStats returns how many updates to the version provided
+// were granted in the group within its failure rate window and how many of
+// them failed. When no window is set, all updates to the version are counted.
+func (api *API) getGroupFailureRateStats(group *Group, version string) (*failureRateStats, error) {
+	var stats failureRateStats
+
+	ds := goqu.From("instance_application").Select(
+		goqu.COUNT("*").As("updates_granted"),
+		goqu.COALESCE(goqu.SUM(goqu.L("case when status = ? then 1 else 0 end", InstanceStatusError)), 0).As("updates_failed"),
+	).Where(goqu.C("group_id").Eq(group.ID), goqu.C("last_update_version").Eq(version),
+		goqu.L(ignoreFakeInstanceCondition("instance_id")),
+	)
+	if group.PolicyFailureRateWindow != "" {
+		ds = ds.Where(goqu.L("last_update_granted_ts > now() at time zone 'utc' - interval ?", group.PolicyFailureRateWindow))
+	}
+	query, _, err := ds.ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	err = api.db.QueryRowx(query).StructScan(&stats)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
 // disableUpdates updates the group provided setting the policy_updates_enabled
 // field to false. This usually happens when the first instance in a group
 // processing an update to a specific version fails if safe mode is enabled.
 func (api *API) disableUpdates(groupID string) error {
 	query, _, err := goqu.Update("groups").
 		Set(goqu.Record{"policy_updates_enabled": false}).
+		Where(goqu.C("id").Eq(groupID), goqu.C("policy_updates_enabled").IsTrue()).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	_, err = api.execGroupUpdate(query)
+
+	return err
+}
+
+// setGroupRolloutStep moves the rollout of the group provided to the given
+// step, recording the version being rolled out and when the step started.
+func (api *API) setGroupRolloutStep(groupID string, step int, version string) error {
+	query, _, err := goqu.Update("groups").
+		Set(goqu.Record{
+			"rollout_step":            step,
+			"rollout_step_version":    version,
+			"rollout_step_started_ts": nowUTC(),
+		}).
 		Where(goqu.C("id").Eq(groupID)).
 		ToSQL()
 	if err != nil {
 		return err
 	}
-	_, err = api.db.Exec(query)
+	_, err = api.execGroupUpdate(query)
 
 	return err
 }
 
+// advanceGroupRolloutStep moves the rollout of the group provided to the step
+// after the given one. The update only takes place if the group is still in
+// that step, and if an interval is provided, only once the step has lasted
+// at least that long. It returns whether the rollout was advanced.
+func (api *API) advanceGroupRolloutStep(groupID string, step int, interval string) (bool, error) {
+	ds := goqu.Update("groups").
+		Set(goqu.Record{
+			"rollout_step":            step + 1,
+			"rollout_step_started_ts": nowUTC(),
+		}).
+		Where(goqu.C("id").Eq(groupID), goqu.C("rollout_step").Eq(step))
+	if interval != "" {
+		ds = ds.Where(goqu.L("rollout_step_started_ts <= now() at time zone 'utc' - interval ?", interval))
+	}
+	query, _, err := ds.ToSQL()
+	if err != nil {
+		return false, err
+	}
+
+	return api.execGroupUpdate(query)
+}
+
 // setGroupRolloutInProgress updates the value of the rollout_in_progress flag
 // for a given group, indicating if a rollout is taking place now or not.
 func (api *API) setGroupRolloutInProgress(groupID string, inProgress bool) error {
 	query, _, err := goqu.Update("groups").
 		Set(goqu.Record{"rollout_in_progress": inProgress}).
-		Where(goqu.C("id").Eq(groupID)).
+		Where(goqu.C("id").Eq(groupID), goqu.C("rollout_in_progress").Neq(inProgress)).
 		ToSQL()
 	if err != nil {
 		return err
 	}
-	_, err = api.db.Exec(query)
+	_, err = api.execGroupUpdate(query)
 
 	return err
 }
 
+// execGroupUpdate runs the groups update query provided, returning whether
+// any group was modified. The update cache is only invalidated in that case,
+// as these updates take place while serving updates.
+func (api *API) execGroupUpdate(query string) (bool, error) {
+	result, err := api.db.Exec(query)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected > 0 {
+		api.invalidateUpdateCache()
+	}
+
+	return rowsAffected > 0, nil
+}
+
 // groupsQuery returns a SelectDataset prepared to return all groups. This
 // query is meant to be extended later in the methods using it to filter by a
 // specific group id, all groups of a given app, specify how to query the rows
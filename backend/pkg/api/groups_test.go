@@ -55,6 +55,38 @@ func TestAddGroup(t *testing.T) {
 
 	_, err = a.AddGroup(&Group{Name: "test_group", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel2.ID), PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes"})
 	assert.Equal(t, ErrInvalidChannel, err, "Channel id used doesn't belong to the application id that this group will be bound to and it should.")
+
+	_, err = a.AddGroup(&Group{Name: "test_group_steps", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes", PolicyRolloutSteps: "25,5"})
+	assert.Equal(t, ErrInvalidRolloutSteps, err)
+
+	_, err = a.AddGroup(&Group{Name: "test_group_threshold", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes", PolicyRolloutStepHealthThreshold: 101})
+	assert.Equal(t, ErrInvalidRolloutStepHealthThreshold, err)
+
+	for _, interval := range []string{"1h", "0 minutes", "15 minutes'; --", "1 fortnight"} {
+		_, err = a.AddGroup(&Group{Name: "test_group_step_interval", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes", PolicyRolloutSteps: "10,100", PolicyRolloutStepInterval: interval})
+		assert.Equal(t, ErrInvalidRolloutStepInterval, err, interval)
+	}
+	_, err = a.AddGroup(&Group{Name: "test_group_step_interval", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes", PolicyRolloutSteps: "10,100", PolicyRolloutStepInterval: "1 day"})
+	assert.NoError(t, err)
+
+	_, err = a.AddGroup(&Group{Name: "test_group_failure_window", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes", PolicyMaxFailureRate: 20, PolicyFailureRateWindow: "2 hours ago"})
+	assert.Equal(t, ErrInvalidFailureRateWindow, err)
+	_, err = a.AddGroup(&Group{Name: "test_group_failure_window", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes", PolicyMaxFailureRate: 20, PolicyFailureRateWindow: "2 hours"})
+	assert.NoError(t, err)
+
+	windows := UpdateWindows{{Name: "weekends", Weekdays: []string{"sat", "sun"}, Start: "08:00", End: "20:00"}}
+	_, err = a.AddGroup(&Group{Name: "test_group_windows", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes", PolicyUpdateWindows: windows})
+	assert.Equal(t, ErrExpectingValidTimezone, err)
+
+	groupWindows, err := a.AddGroup(&Group{Name: "test_group_windows", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes", PolicyTimezone: null.StringFrom("Europe/Berlin"), PolicyUpdateWindows: windows, PolicyBlackoutPeriods: BlackoutPeriods{{Name: "holidays", Start: "2020-12-24", End: "2020-12-26"}}})
+	assert.NoError(t, err)
+	groupX, err = a.GetGroup(groupWindows.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, windows, groupX.PolicyUpdateWindows)
+	assert.Equal(t, "holidays", groupX.PolicyBlackoutPeriods[0].Name)
+
+	_, err = a.AddGroup(&Group{Name: "test_group_invalid_window", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes", PolicyTimezone: null.StringFrom("Europe/Berlin"), PolicyUpdateWindows: UpdateWindows{{Name: "bad", Cron: "* * *", Duration: "1h"}}})
+	assert.Equal(t, ErrInvalidUpdateWindow, err)
 }
 
 func TestUpdateGroup(t *testing.T) {
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"errors"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"gopkg.in/guregu/null.v4"
+)
+
+var (
+	// ErrInvalidInstanceOverride indicates that an instance override is not
+	// valid: it must set at least one of its settings, an instance can't be
+	// pinned to a version and excluded from updates at the same time, and the
+	// pinned version must be a valid semver.
+	ErrInvalidInstanceOverride = errors.New("nebraska: invalid instance override")
+)
+
+// InstanceOverride represents the settings used to override, for a single
+// instance, the behaviour of the group it belongs to in the context of the
+// given application. An instance can be excluded from updates, pinned to a
+// given version of the application or moved to another group.
+type InstanceOverride struct {
+	InstanceID    string      `db:"instance_id" json:"instance_id"`
+	ApplicationID string      `db:"application_id" json:"application_id"`
+	NeverUpdate   bool        `db:"never_update" json:"never_update"`
+	PinnedVersion null.String `db:"pinned_version" json:"pinned_version"`
+	GroupID       null.String `db:"group_id" json:"group_id"`
+	CreatedTs     time.Time   `db:"created_ts" json:"created_ts"`
+}
+
+// SetInstanceOverride creates the instance override provided, or replaces the
+// existing one for the instance and application it references.
+func (api *API) SetInstanceOverride(override *InstanceOverride) (*InstanceOverride, error) {
+	if err := validateInstanceOverride(override); err != nil {
+		return nil, err
+	}
+	if override.GroupID.String != "" {
+		appID, groupID, err := api.validateApplicationAndGroup(override.ApplicationID, override.GroupID.String)
+		if err != nil {
+			return nil, err
+		}
+		override.ApplicationID, override.GroupID = appID, null.StringFrom(groupID)
+	}
+
+	query, _, err := goqu.Insert("instance_override").
+		Cols("instance_id", "application_id", "never_update", "pinned_version", "group_id").
+		Vals(goqu.Vals{
+			override.InstanceID,
+			override.ApplicationID,
+			override.NeverUpdate,
+			override.PinnedVersion,
+			override.GroupID,
+		}).
+		OnConflict(goqu.DoUpdate("ON CONSTRAINT instance_override_pkey", goqu.Record{
+			"never_update":   override.NeverUpdate,
+			"pinned_version": override.PinnedVersion,
+			"group_id":       override.GroupID,
+		})).
+		Returning(goqu.T("instance_override").All()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	if err := api.db.QueryRowx(query).StructScan(override); err != nil {
+		return nil, err
+	}
+	return override, nil
+}
+
+// GetInstanceOverride returns the override set for the instance in the
+// context of the application provided.
+func (api *API) GetInstanceOverride(instanceID, appID string) (*InstanceOverride, error) {
+	var override InstanceOverride
+	query, _, err := goqu.From("instance_override").
+		Where(goqu.C("instance_id").Eq(instanceID), goqu.C("application_id").Eq(appID)).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	if err := api.db.QueryRowx(query).StructScan(&override); err != nil {
+		return nil, err
+	}
+	return &override, nil
+}
+
+// DeleteInstanceOverride removes the override set for the instance in the
+// context of the application provided, so it follows again the settings of
+// the group it belongs to.
+func (api *API) DeleteInstanceOverride(instanceID, appID string) error {
+	query, _, err := goqu.Delete("instance_override").
+		Where(goqu.C("instance_id").Eq(instanceID), goqu.C("application_id").Eq(appID)).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	result, err := api.db.Exec(query)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNoRowsAffected
+	}
+	return nil
+}
+
+// instanceOverrideJSON is the override of an instance, if any, loaded as JSON
+// along with the instance.
+type instanceOverrideJSON struct {
+	Override *InstanceOverride
+}
+
+func (o *instanceOverrideJSON) Scan(src interface{}) error {
+	o.Override = nil
+	if src == nil {
+		return nil
+	}
+	var override InstanceOverride
+	if err := scanJSON(src, &override); err != nil {
+		return err
+	}
+	o.Override = &override
+	return nil
+}
+
+// setInstancesOverrides fills the override of the instances provided, which
+// are expected to be running the given application.
+func (api *API) setInstancesOverrides(appID string, instances []*Instance) error {
+	if len(instances) == 0 {
+		return nil
+	}
+	instanceIDs := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		instanceIDs = append(instanceIDs, instance.ID)
+	}
+	query, _, err := goqu.From("instance_override").
+		Where(goqu.C("application_id").Eq(appID), goqu.C("instance_id").In(instanceIDs)).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	rows, err := api.db.Queryx(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	overrides := make(map[string]*InstanceOverride)
+	for rows.Next() {
+		override := &InstanceOverride{}
+		if err := rows.StructScan(override); err != nil {
+			return err
+		}
+		overrides[override.InstanceID] = override
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, instance := range instances {
+		instance.Application.Override = overrides[instance.ID]
+	}
+	return nil
+}
+
+func validateInstanceOverride(override *InstanceOverride) error {
+	if override.InstanceID == "" || override.ApplicationID == "" {
+		return ErrInvalidInstanceOverride
+	}
+	hasPinnedVersion := override.PinnedVersion.String != ""
+	if !override.NeverUpdate && !hasPinnedVersion && override.GroupID.String == "" {
+		return ErrInvalidInstanceOverride
+	}
+	if override.NeverUpdate && hasPinnedVersion {
+		return ErrInvalidInstanceOverride
+	}
+	if hasPinnedVersion && !isValidSemver(override.PinnedVersion.String) {
+		return ErrInvalidInstanceOverride
+	}
+	// Empty strings are stored as NULL, so that the column checks hold.
+	override.PinnedVersion = null.NewString(override.PinnedVersion.String, hasPinnedVersion)
+	override.GroupID = null.NewString(override.GroupID.String, override.GroupID.String != "")
+	return nil
+}
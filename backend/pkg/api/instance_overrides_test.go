@@ -0,0 +1,82 @@
+package api
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestInstanceOverrides(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tApp2, _ := a.AddApp(&Application{Name: "test_app2", TeamID: tTeam.ID})
+	tGroup, _ := a.AddGroup(&Group{Name: "group1", ApplicationID: tApp.ID, PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes"})
+	tGroup2, _ := a.AddGroup(&Group{Name: "group2", ApplicationID: tApp2.ID, PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes"})
+	tInstance, _ := a.RegisterInstance(uuid.New().String(), "", "10.0.0.1", "1.0.0", tApp.ID, tGroup.ID)
+	tInstance2, _ := a.RegisterInstance(uuid.New().String(), "", "10.0.0.2", "1.0.0", tApp.ID, tGroup.ID)
+
+	_, err := a.SetInstanceOverride(&InstanceOverride{InstanceID: tInstance.ID, ApplicationID: tApp.ID})
+	assert.Equal(t, ErrInvalidInstanceOverride, err, "Override without settings.")
+
+	_, err = a.SetInstanceOverride(&InstanceOverride{InstanceID: tInstance.ID, ApplicationID: tApp.ID, NeverUpdate: true, PinnedVersion: null.StringFrom("1.0.0")})
+	assert.Equal(t, ErrInvalidInstanceOverride, err, "Instance can't be pinned and excluded from updates.")
+
+	_, err = a.SetInstanceOverride(&InstanceOverride{InstanceID: tInstance.ID, ApplicationID: tApp.ID, PinnedVersion: null.StringFrom("invalid")})
+	assert.Equal(t, ErrInvalidInstanceOverride, err, "Invalid pinned version.")
+
+	_, err = a.SetInstanceOverride(&InstanceOverride{InstanceID: tInstance.ID, ApplicationID: tApp.ID, GroupID: null.StringFrom(tGroup2.ID)})
+	assert.Equal(t, ErrInvalidApplicationOrGroup, err, "Group doesn't belong to the application.")
+
+	_, err = a.SetInstanceOverride(&InstanceOverride{InstanceID: "nonExistentInstance", ApplicationID: tApp.ID, NeverUpdate: true})
+	assert.Error(t, err, "Non existent instance.")
+
+	override, err := a.SetInstanceOverride(&InstanceOverride{InstanceID: tInstance.ID, ApplicationID: tApp.ID, NeverUpdate: true})
+	require.NoError(t, err)
+	assert.True(t, override.NeverUpdate)
+	assert.False(t, override.PinnedVersion.Valid)
+
+	override, err = a.SetInstanceOverride(&InstanceOverride{InstanceID: tInstance.ID, ApplicationID: tApp.ID, PinnedVersion: null.StringFrom("1.5.0")})
+	require.NoError(t, err)
+	assert.False(t, override.NeverUpdate)
+	assert.Equal(t, "1.5.0", override.PinnedVersion.String)
+
+	override, err = a.GetInstanceOverride(tInstance.ID, tApp.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.5.0", override.PinnedVersion.String)
+
+	_, err = a.GetInstanceOverride(tInstance2.ID, tApp.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	instance, err := a.GetInstance(tInstance.ID, tApp.ID)
+	require.NoError(t, err)
+	require.NotNil(t, instance.Application.Override)
+	assert.Equal(t, "1.5.0", instance.Application.Override.PinnedVersion.String)
+
+	result, err := a.GetInstances(InstancesQueryParams{ApplicationID: tApp.ID, GroupID: tGroup.ID, Page: 1, PerPage: 10}, testDuration)
+	require.NoError(t, err)
+	require.Len(t, result.Instances, 2)
+	for _, instance := range result.Instances {
+		if instance.ID == tInstance.ID {
+			assert.NotNil(t, instance.Application.Override)
+		} else {
+			assert.Nil(t, instance.Application.Override)
+		}
+	}
+
+	err = a.DeleteInstanceOverride(tInstance.ID, tApp.ID)
+	assert.NoError(t, err)
+
+	err = a.DeleteInstanceOverride(tInstance.ID, tApp.ID)
+	assert.Equal(t, ErrNoRowsAffected, err)
+
+	instance, err = a.GetInstance(tInstance.ID, tApp.ID)
+	require.NoError(t, err)
+	assert.Nil(t, instance.Application.Override)
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"database/sql"
 	"fmt"
+	"net"
 	"strconv"
 	"time"
 
@@ -68,16 +69,17 @@ type InstancesWithTotal struct {
 // a given instance: current version of the app, last time the instance checked
 // for updates for this app, etc.
 type InstanceApplication struct {
-	InstanceID          string      `db:"instance_id" json:"instance_id,omitempty"`
-	ApplicationID       string      `db:"application_id" json:"application_id"`
-	GroupID             null.String `db:"group_id" json:"group_id"`
-	Version             string      `db:"version" json:"version"`
-	CreatedTs           time.Time   `db:"created_ts" json:"created_ts"`
-	Status              null.Int    `db:"status" json:"status"`
-	LastCheckForUpdates time.Time   `db:"last_check_for_updates" json:"last_check_for_updates"`
-	LastUpdateGrantedTs null.Time   `db:"last_update_granted_ts" json:"last_update_granted_ts"`
-	LastUpdateVersion   null.String `db:"last_update_version" json:"last_update_version"`
-	UpdateInProgress    bool        `db:"update_in_progress" json:"update_in_progress"`
+	InstanceID          string            `db:"instance_id" json:"instance_id,omitempty"`
+	ApplicationID       string            `db:"application_id" json:"application_id"`
+	GroupID             null.String       `db:"group_id" json:"group_id"`
+	Version             string            `db:"version" json:"version"`
+	CreatedTs           time.Time         `db:"created_ts" json:"created_ts"`
+	Status              null.Int          `db:"status" json:"status"`
+	LastCheckForUpdates time.Time         `db:"last_check_for_updates" json:"last_check_for_updates"`
+	LastUpdateGrantedTs null.Time         `db:"last_update_granted_ts" json:"last_update_granted_ts"`
+	LastUpdateVersion   null.String       `db:"last_update_version" json:"last_update_version"`
+	UpdateInProgress    bool              `db:"update_in_progress" json:"update_in_progress"`
+	Override            *InstanceOverride `db:"-" json:"override,omitempty"`
 }
 
 // InstanceStatusHistoryEntry represents an entry in the instance status
@@ -183,6 +185,12 @@ func (api *API) RegisterInstance(instanceID, instanceAlias, instanceIP, instance
 
 	instance, err := api.GetInstance(instanceID, appID)
 	if err == nil {
+		// Instances moved to another group are registered in that group no
+		// matter which one they report.
+		if override := instance.Application.Override; override != nil && override.GroupID.Valid {
+			groupID = override.GroupID.String
+		}
+
 		// Give precedence to an existing alias over an omitted or empty alias field
 		if instanceAlias == "" {
 			instanceAlias = instance.Alias
@@ -201,6 +209,28 @@ func (api *API) RegisterInstance(instanceID, instanceAlias, instanceIP, instance
 		if !updateInstance && !updateInstanceApplication {
 			return instance, nil
 		}
+
+		// Check-ins only refreshing the last check time or the IP are
+		// buffered when enabled, changes to the version, group or alias
+		// of the instance are written right away.
+		stateChanged := instance.Alias != instanceAlias || instance.Application.Version != instanceVersion ||
+			instance.Application.GroupID.String != groupID
+		// Invalid IPs would make the whole batch fail, they are left to the
+		// synchronous path to report them.
+		if api.checkins != nil && !stateChanged && net.ParseIP(instanceIP) != nil {
+			ip := ""
+			if updateInstance {
+				ip = instanceIP
+			}
+			checkTs := nowUTC()
+			if api.checkins.add(instanceID, appID, ip, checkTs) {
+				instance.IP = instanceIP
+				if updateInstanceApplication {
+					instance.Application.LastCheckForUpdates = checkTs
+				}
+				return instance, nil
+			}
+		}
 	}
 
 	upsertInstance, _, err := goqu.Insert("instance").
@@ -237,7 +267,7 @@ func (api *API) RegisterInstance(instanceID, instanceAlias, instanceIP, instance
 	}
 
 	// If this is an instance we haven't seen yet, then we write into instance + instance_application
-	tx, err := api.db.Begin()
+	tx, err := api.db.Beginx()
 	if err != nil {
 		return nil, err
 	}
@@ -278,17 +308,24 @@ func (api *API) RegisterInstance(instanceID, instanceAlias, instanceIP, instance
 
 // GetInstance returns the instance identified by the id provided.
 func (api *API) GetInstance(instanceID, appID string) (*Instance, error) {
-	var instance Instance
+	// The instance override is loaded along with the instance, as this runs
+	// for every update check.
+	var result struct {
+		Instance
+		Override instanceOverrideJSON `db:"override"`
+	}
 	query, _, err := goqu.From("instance").
+		Select(goqu.Star(), goqu.L("(SELECT row_to_json(io) FROM instance_override io WHERE io.instance_id = instance.id AND io.application_id = ?)", appID).As("override")).
 		Where(goqu.C("id").Eq(instanceID)).
 		ToSQL()
 	if err != nil {
 		return nil, err
 	}
-	err = api.db.QueryRowx(query).StructScan(&instance)
+	err = api.db.QueryRowx(query).StructScan(&result)
 	if err != nil {
 		return nil, err
 	}
+	instance := result.Instance
 	/* passing "" to sortFilter while invoking getInstanceApp signifies we are not interested
 	in a sort
 	*/
@@ -301,6 +338,7 @@ func (api *API) GetInstance(instanceID, appID string) (*Instance, error) {
 	default:
 		return nil, err
 	}
+	instance.Application.Override = result.Override.Override
 
 	return &instance, nil
 }
@@ -432,6 +470,9 @@ func (api *API) GetInstances(p InstancesQueryParams, duration string) (Instances
 			instance.Application = *application
 			instances = append(instances, instance)
 		}
+		if err := api.setInstancesOverrides(p.ApplicationID, instances); err != nil {
+			return InstancesWithTotal{}, err
+		}
 		return InstancesWithTotal{
 			TotalInstances: totalCount,
 			Instances:      instances,
@@ -481,6 +522,9 @@ func (api *API) GetInstances(p InstancesQueryParams, duration string) (Instances
 	if err := rows.Err(); err != nil {
 		return InstancesWithTotal{}, err
 	}
+	if err := api.setInstancesOverrides(p.ApplicationID, instances); err != nil {
+		return InstancesWithTotal{}, err
+	}
 	result := InstancesWithTotal{
 		TotalInstances: totalCount,
 		Instances:      instances,
@@ -542,7 +586,7 @@ func (api *API) validateApplicationAndGroup(appID, groupID string) (string, stri
 		return "", "", err
 	}
 
-	group, err := api.GetGroup(groupID)
+	group, err := api.getGroupForUpdate(groupID)
 	if err != nil {
 		return "", "", err
 	}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"gopkg.in/guregu/null.v4"
+)
+
+var (
+	// ErrInvalidPackageMirror indicates that a package mirror is not valid:
+	// it must have an http(s) url, and its client CIDR, group and arch rules
+	// must be valid when set, the group belonging to the package's
+	// application.
+	ErrInvalidPackageMirror = errors.New("nebraska: invalid package mirror")
+)
+
+// PackageMirror represents a base url the payloads of a package can also be
+// downloaded from. Mirrors can be restricted to the clients in a network, in
+// a group or running an arch, so clients are sent to the mirrors closest to
+// them first, and fall back to the other mirrors and the package's url.
+type PackageMirror struct {
+	ID         string      `db:"id" json:"id"`
+	PackageID  string      `db:"package_id" json:"package_id"`
+	URL        string      `db:"url" json:"url"`
+	Position   int         `db:"position" json:"position"`
+	ClientCIDR null.String `db:"client_cidr" json:"client_cidr"`
+	GroupID    null.String `db:"group_id" json:"group_id"`
+	Arch       null.Int    `db:"arch" json:"arch"`
+	CreatedTs  time.Time   `db:"created_ts" json:"created_ts"`
+}
+
+// PackageMirrors represents the mirrors of a package, loaded along with it as
+// JSON.
+type PackageMirrors []*PackageMirror
+
+// Scan implements the sql.Scanner interface.
+func (m *PackageMirrors) Scan(src interface{}) error {
+	*m = nil
+	return scanJSON(src, m)
+}
+
+// matches returns how many of the rules of the mirror the client provided
+// matches, or -1 if the mirror is not offered to the client.
+func (mirror *PackageMirror) matches(ip net.IP, groupID string, arch Arch) int {
+	matched := 0
+	if mirror.ClientCIDR.Valid {
+		_, network, err := net.ParseCIDR(mirror.ClientCIDR.String)
+		if err != nil || ip == nil || !network.Contains(ip) {
+			return -1
+		}
+		matched++
+	}
+	if mirror.GroupID.Valid {
+		if mirror.GroupID.String != groupID {
+			return -1
+		}
+		matched++
+	}
+	if mirror.Arch.Valid && Arch(mirror.Arch.Int64) != ArchAll {
+		if Arch(mirror.Arch.Int64) != arch {
+			return -1
+		}
+		matched++
+	}
+	return matched
+}
+
+// MirrorURLs returns the base urls of the mirrors of the package offered to a
+// client with the IP provided, in the group and running the arch provided.
+// Mirrors matching more rules come first, the ones without rules last, and
+// mirrors matching the same number of rules are sorted by position.
+func (pkg *Package) MirrorURLs(ip, groupID string, arch Arch) []string {
+	type candidate struct {
+		mirror  *PackageMirror
+		matched int
+	}
+	clientIP := net.ParseIP(ip)
+	var candidates []candidate
+	for _, mirror := range pkg.Mirrors {
+		if matched := mirror.matches(clientIP, groupID, arch); matched >= 0 {
+			candidates = append(candidates, candidate{mirror: mirror, matched: matched})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].matched != candidates[j].matched {
+			return candidates[i].matched > candidates[j].matched
+		}
+		return candidates[i].mirror.Position < candidates[j].mirror.Position
+	})
+	urls := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		urls = append(urls, c.mirror.URL)
+	}
+	return urls
+}
+
+// AddPackageMirror registers the provided mirror for the package it
+// references.
+func (api *API) AddPackageMirror(mirror *PackageMirror) (*PackageMirror, error) {
+	defer api.invalidateUpdateCache()
+
+	if err := api.validatePackageMirror(mirror); err != nil {
+		return nil, err
+	}
+	query, _, err := goqu.Insert("package_mirror").
+		Cols("package_id", "url", "position", "client_cidr", "group_id", "arch").
+		Vals(goqu.Vals{
+			mirror.PackageID,
+			mirror.URL,
+			mirror.Position,
+			mirror.ClientCIDR,
+			mirror.GroupID,
+			mirror.Arch,
+		}).
+		Returning(goqu.T("package_mirror").All()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	if err := api.db.QueryRowx(query).StructScan(mirror); err != nil {
+		return nil, err
+	}
+	return mirror, nil
+}
+
+// UpdatePackageMirror updates an existing mirror of a package using the
+// content provided.
+func (api *API) UpdatePackageMirror(mirror *PackageMirror) error {
+	defer api.invalidateUpdateCache()
+
+	if err := api.validatePackageMirror(mirror); err != nil {
+		return err
+	}
+	query, _, err := goqu.Update("package_mirror").
+		Set(goqu.Record{
+			"url":         mirror.URL,
+			"position":    mirror.Position,
+			"client_cidr": mirror.ClientCIDR,
+			"group_id":    mirror.GroupID,
+			"arch":        mirror.Arch,
+		}).
+		Where(goqu.C("id").Eq(mirror.ID), goqu.C("package_id").Eq(mirror.PackageID)).
+		Returning(goqu.T("package_mirror").All()).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	return api.db.QueryRowx(query).StructScan(mirror)
+}
+
+// DeletePackageMirror removes the mirror identified by the id provided from
+// the package provided.
+func (api *API) DeletePackageMirror(packageID, mirrorID string) error {
+	defer api.invalidateUpdateCache()
+
+	query, _, err := goqu.Delete("package_mirror").
+		Where(goqu.C("id").Eq(mirrorID), goqu.C("package_id").Eq(packageID)).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	result, err := api.db.Exec(query)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoRowsAffected
+	}
+
+	return nil
+}
+
+// GetPackageMirrors returns the mirrors of the package provided, sorted by
+// position.
+func (api *API) GetPackageMirrors(packageID string) ([]*PackageMirror, error) {
+	query, _, err := goqu.From("package_mirror").
+		Where(goqu.C("package_id").Eq(packageID)).
+		Order(goqu.C("position").Asc(), goqu.C("created_ts").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	mirrors := []*PackageMirror{}
+	if err := api.db.Select(&mirrors, query); err != nil {
+		return nil, err
+	}
+	return mirrors, nil
+}
+
+func (api *API) validatePackageMirror(mirror *PackageMirror) error {
+	if mirror == nil {
+		return ErrInvalidPackageMirror
+	}
+	u, err := url.Parse(mirror.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidPackageMirror
+	}
+	if mirror.ClientCIDR.Valid {
+		_, network, err := net.ParseCIDR(mirror.ClientCIDR.String)
+		if err != nil {
+			return ErrInvalidPackageMirror
+		}
+		// Postgres rejects networks with bits set after the mask.
+		mirror.ClientCIDR = null.StringFrom(network.String())
+	}
+	if mirror.Arch.Valid && (mirror.Arch.Int64 < 0 || !Arch(mirror.Arch.Int64).IsValid()) {
+		return ErrInvalidPackageMirror
+	}
+	if mirror.GroupID.Valid {
+		pkg, err := api.GetPackage(mirror.PackageID)
+		if err != nil {
+			return err
+		}
+		group, err := api.GetGroup(mirror.GroupID.String)
+		if err != nil || group.ApplicationID != pkg.ApplicationID {
+			return ErrInvalidPackageMirror
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestPackageMirrors(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tApp2, _ := a.AddApp(&Application{Name: "test_app2", TeamID: tTeam.ID})
+	tPkg, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.1.0", ApplicationID: tApp.ID})
+	tGroup, _ := a.AddGroup(&Group{Name: "group", ApplicationID: tApp.ID, PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes"})
+	tGroup2, _ := a.AddGroup(&Group{Name: "group2", ApplicationID: tApp2.ID, PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes"})
+
+	public, err := a.AddPackageMirror(&PackageMirror{PackageID: tPkg.ID, URL: "https://public.mirror/pkg/", Position: 1})
+	require.NoError(t, err)
+	assert.NotEmpty(t, public.ID)
+	local, err := a.AddPackageMirror(&PackageMirror{PackageID: tPkg.ID, URL: "http://dc1.mirror/pkg/", Position: 2, ClientCIDR: null.StringFrom("10.1.2.3/16")})
+	require.NoError(t, err)
+	assert.Equal(t, "10.1.0.0/16", local.ClientCIDR.String)
+	_, err = a.AddPackageMirror(&PackageMirror{PackageID: tPkg.ID, URL: "http://dc1-arm.mirror/pkg/", Position: 3, ClientCIDR: null.StringFrom("10.1.0.0/16"), Arch: null.IntFrom(int64(ArchAArch64))})
+	require.NoError(t, err)
+	_, err = a.AddPackageMirror(&PackageMirror{PackageID: tPkg.ID, URL: "http://canary.mirror/pkg/", Position: 0, GroupID: null.StringFrom(tGroup.ID)})
+	require.NoError(t, err)
+
+	for _, mirror := range []*PackageMirror{
+		{PackageID: tPkg.ID},
+		{PackageID: tPkg.ID, URL: "ftp://sample.url/pkg/"},
+		{PackageID: tPkg.ID, URL: "http://sample.url/pkg/", ClientCIDR: null.StringFrom("10.0.0.1")},
+		{PackageID: tPkg.ID, URL: "http://sample.url/pkg/", Arch: null.IntFrom(42)},
+		{PackageID: tPkg.ID, URL: "http://sample.url/pkg/", GroupID: null.StringFrom(tGroup2.ID)},
+	} {
+		_, err = a.AddPackageMirror(mirror)
+		assert.Equal(t, ErrInvalidPackageMirror, err, mirror)
+	}
+
+	pkg, err := a.GetPackage(tPkg.ID)
+	require.NoError(t, err)
+	require.Len(t, pkg.Mirrors, 4)
+	assert.Equal(t, "http://canary.mirror/pkg/", pkg.Mirrors[0].URL)
+
+	// Mirrors matching more rules come first, mirrors not matching are
+	// left out.
+	assert.Equal(t, []string{"http://dc1-arm.mirror/pkg/", "http://canary.mirror/pkg/", "http://dc1.mirror/pkg/", "https://public.mirror/pkg/"}, pkg.MirrorURLs("10.1.200.1", tGroup.ID, ArchAArch64))
+	assert.Equal(t, []string{"http://dc1.mirror/pkg/", "https://public.mirror/pkg/"}, pkg.MirrorURLs("10.1.200.1", "", ArchAMD64))
+	assert.Equal(t, []string{"https://public.mirror/pkg/"}, pkg.MirrorURLs("192.168.1.1", "", ArchAMD64))
+	assert.Equal(t, []string{"https://public.mirror/pkg/"}, pkg.MirrorURLs("", "", ArchAMD64))
+
+	local.URL = "http://dc2.mirror/pkg/"
+	local.ClientCIDR = null.StringFrom("10.2.0.0/16")
+	require.NoError(t, a.UpdatePackageMirror(local))
+	mirrors, err := a.GetPackageMirrors(tPkg.ID)
+	require.NoError(t, err)
+	require.Len(t, mirrors, 4)
+	assert.Equal(t, "http://dc2.mirror/pkg/", mirrors[2].URL)
+	assert.Equal(t, "10.2.0.0/16", mirrors[2].ClientCIDR.String)
+
+	notFound := *local
+	notFound.PackageID = tApp.ID
+	assert.Equal(t, sql.ErrNoRows, a.UpdatePackageMirror(&notFound))
+
+	assert.Equal(t, ErrNoRowsAffected, a.DeletePackageMirror(tApp.ID, local.ID))
+	require.NoError(t, a.DeletePackageMirror(tPkg.ID, local.ID))
+	mirrors, err = a.GetPackageMirrors(tPkg.ID)
+	require.NoError(t, err)
+	assert.Len(t, mirrors, 3)
+
+	require.NoError(t, a.DeletePackage(tPkg.ID))
+	mirrors, err = a.GetPackageMirrors(tPkg.ID)
+	require.NoError(t, err)
+	assert.Empty(t, mirrors)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/doug-martin/goqu/v9"
+)
+
+var (
+	// ErrNotInTeam indicates that a resource referenced doesn't exist or
+	// doesn't belong to the team on behalf of which it was referenced.
+	ErrNotInTeam = errors.New("nebraska: resource not found in team")
+)
+
+// TeamResources identifies the resources referenced by a request made on
+// behalf of a team. Empty ids are not checked.
+type TeamResources struct {
+	AppID      string
+	GroupID    string
+	ChannelID  string
+	PackageID  string
+	InstanceID string
+}
+
+// CheckTeamOwnership checks that the resources provided belong to the given
+// team: the application must be owned by the team, and the group, channel and
+// package must belong to that application. Instances referenced without an
+// application must run at least one of the team's applications.
+func (api *API) CheckTeamOwnership(teamID string, r *TeamResources) error {
+	if r.AppID == "" {
+		if r.GroupID != "" || r.ChannelID != "" || r.PackageID != "" {
+			return ErrNotInTeam
+		}
+		if r.InstanceID == "" {
+			return nil
+		}
+		return api.checkExists(goqu.From(goqu.T("instance_application").As("ia")).
+			Join(goqu.T("application").As("a"), goqu.On(goqu.I("a.id").Eq(goqu.I("ia.application_id")))).
+			Where(goqu.I("ia.instance_id").Eq(r.InstanceID), goqu.I("a.team_id").Eq(teamID)))
+	}
+
+	if err := api.checkExists(goqu.From("application").
+		Where(goqu.C("id").Eq(r.AppID), goqu.C("team_id").Eq(teamID))); err != nil {
+		return err
+	}
+	children := []struct {
+		table string
+		id    string
+	}{
+		{"groups", r.GroupID},
+		{"channel", r.ChannelID},
+		{"package", r.PackageID},
+	}
+	for _, child := range children {
+		if child.id == "" {
+			continue
+		}
+		if err := api.checkExists(goqu.From(child.table).
+			Where(goqu.C("id").Eq(child.id), goqu.C("application_id").Eq(r.AppID))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkExists returns ErrNotInTeam if the query provided doesn't return any
+// row.
+func (api *API) checkExists(query *goqu.SelectDataset) error {
+	q, _, err := query.Select(goqu.L("1")).Limit(1).ToSQL()
+	if err != nil {
+		return err
+	}
+	var one int
+	switch err := api.db.QueryRow(q).Scan(&one); err {
+	case nil:
+		return nil
+	case sql.ErrNoRows:
+		return ErrNotInTeam
+	default:
+		return err
+	}
+}
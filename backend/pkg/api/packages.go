@@ -6,9 +6,9 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/blang/semver/v4"
 	"github.com/doug-martin/goqu/v9"
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 	"gopkg.in/guregu/null.v4"
 )
 
@@ -30,6 +30,11 @@ var (
 	// ErrBlacklistingChannel error indicates that the channel the package is
 	// trying to blacklist is already pointing to the package.
 	ErrBlacklistingChannel = errors.New("nebraska: channel trying to blacklist is already pointing to the package")
+
+	// ErrInvalidMinFromVersion indicates that the minimum version instances
+	// must be running to update to a package is not a valid semver older than
+	// the package version.
+	ErrInvalidMinFromVersion = errors.New("nebraska: invalid package min from version")
 )
 
 // Package represents a Nebraska application's package.
@@ -47,16 +52,32 @@ type Package struct {
 	ApplicationID     string         `db:"application_id" json:"application_id"`
 	FlatcarAction     *FlatcarAction `db:"flatcar_action" json:"flatcar_action"`
 	Arch              Arch           `db:"arch" json:"arch"`
+	Deltas            PackageDeltas  `db:"deltas" json:"deltas"`
+	// Mirrors are managed on their own, they are ignored when adding or
+	// updating a package.
+	Mirrors PackageMirrors `db:"mirrors" json:"mirrors"`
+	// MinFromVersion is the minimum version instances must be running to be
+	// updated to this package. Older instances are updated to an intermediate
+	// package first.
+	MinFromVersion null.String `db:"min_from_version" json:"min_from_version"`
 }
 
 // AddPackage registers the provided package.
 func (api *API) AddPackage(pkg *Package) (*Package, error) {
+	defer api.invalidateUpdateCache()
+
 	if !isValidSemver(pkg.Version) {
 		return nil, ErrInvalidSemver
 	}
 	if !pkg.Arch.IsValid() {
 		return nil, ErrInvalidArch
 	}
+	if err := validatePackageMinFromVersion(pkg); err != nil {
+		return nil, err
+	}
+	if err := validatePackageDeltas(pkg); err != nil {
+		return nil, err
+	}
 	if len(pkg.ChannelsBlacklist) > 0 {
 		blacklistedChannels, err := api.getSpecificChannels(pkg.ChannelsBlacklist...)
 		if err != nil {
@@ -80,7 +101,7 @@ func (api *API) AddPackage(pkg *Package) (*Package, error) {
 	}()
 
 	query, _, err := goqu.Insert("package").
-		Cols("type", "filename", "description", "size", "hash", "url", "version", "application_id", "arch").
+		Cols("type", "filename", "description", "size", "hash", "url", "version", "application_id", "arch", "min_from_version").
 		Vals(goqu.Vals{
 			pkg.Type,
 			pkg.Filename,
@@ -91,6 +112,7 @@ func (api *API) AddPackage(pkg *Package) (*Package, error) {
 			pkg.Version,
 			pkg.ApplicationID,
 			pkg.Arch,
+			pkg.MinFromVersion,
 		}).
 		Returning(goqu.T("package").All()).
 		ToSQL()
@@ -118,6 +140,13 @@ func (api *API) AddPackage(pkg *Package) (*Package, error) {
 		}
 	}
 
+	for _, delta := range pkg.Deltas {
+		delta.PackageID = pkg.ID
+		if err := insertPackageDelta(tx, delta); err != nil {
+			return nil, err
+		}
+	}
+
 	if pkg.Type == PkgTypeFlatcar && pkg.FlatcarAction != nil {
 		query, _, err := goqu.Insert("flatcar_action").
 			Cols("package_id", "sha256").
@@ -142,15 +171,29 @@ func (api *API) AddPackage(pkg *Package) (*Package, error) {
 	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
+	if err := api.resolveChannelPackages(pkg.ApplicationID); err != nil {
+		logger.Error().Err(err).Msg("AddPackage - could not resolve channels packages")
+	}
 	return pkg, nil
 }
 
 // UpdatePackage updates an existing package using the content of the package
 // provided.
+//
+// The package deltas are replaced by the ones in the package provided, unless
+// its Deltas field is nil, in which case they are left untouched.
 func (api *API) UpdatePackage(pkg *Package) error {
+	defer api.invalidateUpdateCache()
+
 	if !isValidSemver(pkg.Version) {
 		return ErrInvalidSemver
 	}
+	if err := validatePackageMinFromVersion(pkg); err != nil {
+		return err
+	}
+	if err := validatePackageDeltas(pkg); err != nil {
+		return err
+	}
 	tx, err := api.db.Beginx()
 	if err != nil {
 		return err
@@ -162,34 +205,40 @@ func (api *API) UpdatePackage(pkg *Package) error {
 	}()
 	query, _, err := goqu.Update("package").
 		Set(goqu.Record{
-			"type":        pkg.Type,
-			"filename":    pkg.Filename,
-			"description": pkg.Description,
-			"size":        pkg.Size,
-			"hash":        pkg.Hash,
-			"url":         pkg.URL,
-			"version":     pkg.Version,
+			"type":             pkg.Type,
+			"filename":         pkg.Filename,
+			"description":      pkg.Description,
+			"size":             pkg.Size,
+			"hash":             pkg.Hash,
+			"url":              pkg.URL,
+			"version":          pkg.Version,
+			"min_from_version": pkg.MinFromVersion,
 		}).
 		Where(goqu.C("id").Eq(pkg.ID)).
+		Returning("application_id").
 		ToSQL()
 	if err != nil {
 		return err
 	}
-	result, err := tx.Exec(query)
-	if err != nil {
-		return err
-	}
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	} else if rowsAffected == 0 {
+	var appID string
+	switch err := tx.QueryRowx(query).Scan(&appID); err {
+	case nil:
+	case sql.ErrNoRows:
 		return ErrNoRowsAffected
+	default:
+		return err
 	}
 
 	if err := api.updatePackageBlacklistedChannels(tx, pkg); err != nil {
 		return err
 	}
 
+	if pkg.Deltas != nil {
+		if err := api.updatePackageDeltas(tx, pkg); err != nil {
+			return err
+		}
+	}
+
 	if pkg.Type == PkgTypeFlatcar && pkg.FlatcarAction != nil {
 		if pkg.FlatcarAction.ID == "" {
 			pkg.FlatcarAction.ID = uuid.New().String()
@@ -212,28 +261,34 @@ func (api *API) UpdatePackage(pkg *Package) error {
 	if err := tx.Commit(); err != nil {
 		return err
 	}
+	if err := api.resolveChannelPackages(appID); err != nil {
+		logger.Error().Err(err).Msg("UpdatePackage - could not resolve channels packages")
+	}
 
 	return nil
 }
 
 // DeletePackage removes the package identified by the id provided.
 func (api *API) DeletePackage(pkgID string) error {
+	defer api.invalidateUpdateCache()
+
 	query, _, err := goqu.Delete("package").
 		Where(goqu.C("id").Eq(pkgID)).
+		Returning("application_id").
 		ToSQL()
 	if err != nil {
 		return err
 	}
-	result, err := api.db.Exec(query)
-	if err != nil {
-		return err
-	}
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
+	var appID string
+	switch err := api.db.QueryRowx(query).Scan(&appID); err {
+	case nil:
+	case sql.ErrNoRows:
+		return ErrNoRowsAffected
+	default:
 		return err
 	}
-	if rowsAffected == 0 {
-		return ErrNoRowsAffected
+	if err := api.resolveChannelPackages(appID); err != nil {
+		logger.Error().Err(err).Msg("DeletePackage - could not resolve channels packages")
 	}
 
 	return nil
@@ -288,6 +343,39 @@ func (api *API) GetPackages(appID string, page, perPage uint64) ([]*Package, err
 	return api.getPackagesFromQuery(query)
 }
 
+// GetPayloadFilenames returns the filenames of the payloads referenced by all
+// packages and package deltas. Hosted payloads not in this list belong to
+// packages that were deleted and can be removed.
+func (api *API) GetPayloadFilenames() ([]string, error) {
+	query, _, err := goqu.From("package").
+		Select("filename").
+		Where(goqu.C("filename").IsNotNull()).
+		Union(goqu.From("package_delta").
+			Select("filename").
+			Where(goqu.C("filename").IsNotNull())).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := api.db.Queryx(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var filenames []string
+	for rows.Next() {
+		var filename string
+		if err := rows.Scan(&filename); err != nil {
+			return nil, err
+		}
+		filenames = append(filenames, filename)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return filenames, nil
+}
+
 func (api *API) getPackagesFromQuery(query string) ([]*Package, error) {
 	var pkgs []*Package
 	rows, err := api.db.Queryx(query)
@@ -296,15 +384,17 @@ func (api *API) getPackagesFromQuery(query string) ([]*Package, error) {
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var err error
-		var flatcarAction *FlatcarAction
 		pkg := Package{}
-
-		err = rows.StructScan(&pkg)
-		if err != nil {
+		if err := rows.StructScan(&pkg); err != nil {
 			return nil, err
 		}
-		flatcarAction, err = api.getFlatcarAction(pkg.ID)
+		pkgs = append(pkgs, &pkg)
+	}
+	if err := closeRows(rows); err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		flatcarAction, err := api.getFlatcarAction(pkg.ID)
 		switch err {
 		case nil:
 			pkg.FlatcarAction = flatcarAction
@@ -313,10 +403,6 @@ func (api *API) getPackagesFromQuery(query string) ([]*Package, error) {
 		default:
 			return nil, err
 		}
-		pkgs = append(pkgs, &pkg)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
 	}
 
 	return pkgs, nil
@@ -329,7 +415,9 @@ func (api *API) getPackagesFromQuery(query string) ([]*Package, error) {
 func (api *API) packagesQuery() *goqu.SelectDataset {
 	query := goqu.From(goqu.L("package LEFT JOIN package_channel_blacklist pcb ON package.id = pcb.package_id")).
 		Select(goqu.L(`package.*,
-	    array_agg(pcb.channel_id) FILTER (WHERE pcb.channel_id IS NOT NULL) as channels_blacklist
+	    array_agg(pcb.channel_id) FILTER (WHERE pcb.channel_id IS NOT NULL) as channels_blacklist,
+	    (SELECT json_agg(pd ORDER BY pd.created_ts) FROM package_delta pd WHERE pd.package_id = package.id) as deltas,
+	    COALESCE((SELECT json_agg(pm ORDER BY pm.position, pm.created_ts) FROM package_mirror pm WHERE pm.package_id = package.id), '[]') as mirrors
 	    `)).
 		GroupBy("package.id").Order(goqu.L("regexp_matches(version, '(\\d+)\\.(\\d+)\\.(\\d+)')::int[]").Desc())
 	return query
@@ -381,7 +469,7 @@ func (api *API) getPackage(packageID null.String) (*Package, error) {
 // This method is part of the transaction that updates a package and when it's
 // called, the package has already been updated except for the channels
 // blacklist, that may happen here if needed.
-func (api *API) updatePackageBlacklistedChannels(tx *sqlx.Tx, pkg *Package) error {
+func (api *API) updatePackageBlacklistedChannels(tx transaction, pkg *Package) error {
 	pkgUpdated, err := api.GetPackage(pkg.ID)
 	if err != nil {
 		return err
@@ -441,3 +529,79 @@ func (api *API) updatePackageBlacklistedChannels(tx *sqlx.Tx, pkg *Package) erro
 
 	return nil
 }
+
+// validatePackageMinFromVersion checks that the minimum from-version of the
+// package provided, if any, is a valid semver older than the package version,
+// normalizing it so that an empty one is stored as NULL.
+func validatePackageMinFromVersion(pkg *Package) error {
+	if pkg.MinFromVersion.String == "" {
+		pkg.MinFromVersion = null.String{}
+		return nil
+	}
+	minFromSemver, err := semver.Make(pkg.MinFromVersion.String)
+	if err != nil {
+		return ErrInvalidMinFromVersion
+	}
+	pkgSemver, err := semver.Make(pkg.Version)
+	if err != nil {
+		return ErrInvalidSemver
+	}
+	if !minFromSemver.LT(pkgSemver) {
+		return ErrInvalidMinFromVersion
+	}
+	return nil
+}
+
+// packageVersion holds the versions of a package needed to choose the package
+// an instance should be updated to.
+type packageVersion struct {
+	ID      string
+	Version semver.Version
+	// MinFromVersion is the zero version if the package doesn't have one.
+	MinFromVersion semver.Version
+}
+
+// getPackageVersions returns the versions of the packages of the application
+// and architecture provided which haven't blacklisted the given channel.
+// Packages with an invalid version are skipped.
+func (api *API) getPackageVersions(appID string, arch Arch, channelID string) ([]*packageVersion, error) {
+	blacklistedQuery := goqu.From("package_channel_blacklist").
+		Select("package_id").
+		Where(goqu.C("channel_id").Eq(channelID))
+	query, _, err := goqu.From("package").
+		Select("id", "version", "min_from_version").
+		Where(goqu.C("application_id").Eq(appID), goqu.C("arch").Eq(arch)).
+		Where(goqu.L("id NOT IN ?", blacklistedQuery)).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := api.db.Queryx(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []*packageVersion
+	for rows.Next() {
+		var id, version string
+		var minFromVersion null.String
+		if err := rows.Scan(&id, &version, &minFromVersion); err != nil {
+			return nil, err
+		}
+		v := &packageVersion{ID: id}
+		if v.Version, err = semver.Make(version); err != nil {
+			continue
+		}
+		if minFromVersion.String != "" {
+			if v.MinFromVersion, err = semver.Make(minFromVersion.String); err != nil {
+				continue
+			}
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
@@ -296,3 +296,28 @@ func TestGetPackages(t *testing.T) {
 	_, err = a.GetPackages(uuid.New().String(), 0, 0)
 	assert.NoError(t, err, "should be no error for non existing appID")
 }
+
+func TestGetPayloadFilenames(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tPkg1, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/", Filename: null.StringFrom("pkg1.gz"), Version: "12.1.0", ApplicationID: tApp.ID})
+	_, _ = a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/", Filename: null.StringFrom("pkg2.gz"), Version: "12.2.0", ApplicationID: tApp.ID})
+	_, err := a.AddPackageDelta(&PackageDelta{PackageID: tPkg1.ID, FromVersion: "12.0.0", URL: "http://sample.url/", Filename: null.StringFrom("pkg1-delta.gz")})
+	assert.NoError(t, err)
+
+	filenames, err := a.GetPayloadFilenames()
+	assert.NoError(t, err)
+	assert.Subset(t, filenames, []string{"pkg1.gz", "pkg2.gz", "pkg1-delta.gz"})
+
+	err = a.DeletePackage(tPkg1.ID)
+	assert.NoError(t, err)
+
+	filenames, err = a.GetPayloadFilenames()
+	assert.NoError(t, err)
+	assert.Contains(t, filenames, "pkg2.gz")
+	assert.NotContains(t, filenames, "pkg1.gz")
+	assert.NotContains(t, filenames, "pkg1-delta.gz")
+}
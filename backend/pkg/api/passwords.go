@@ -0,0 +1,173 @@
+package api
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Parameters used to hash new passwords with argon2id. Hashes made with
+// different parameters are still verified, and replaced on the next
+// successful login.
+const (
+	argon2Time    = 2
+	argon2Memory  = 19 * 1024
+	argon2Threads = 1
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+
+	// argon2Scheme identifies the passwords hashed with argon2id.
+	argon2Scheme = "argon2id"
+	// legacyWrappedScheme identifies the legacy md5 digests that were
+	// hashed with argon2id by UpgradeLegacyUserSecrets, until the user logs
+	// in again and the password itself can be hashed.
+	legacyWrappedScheme = "md5+argon2id"
+)
+
+var (
+	// ErrInvalidPasswordHash indicates that the secret stored for a user is
+	// not in any of the formats supported.
+	ErrInvalidPasswordHash = errors.New("nebraska: invalid password hash")
+)
+
+// argon2Hash represents a password hash in PHC string format:
+// $<scheme>$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+type argon2Hash struct {
+	scheme  string
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (h *argon2Hash) String() string {
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		h.scheme,
+		argon2.Version,
+		h.memory,
+		h.time,
+		h.threads,
+		base64.RawStdEncoding.EncodeToString(h.salt),
+		base64.RawStdEncoding.EncodeToString(h.key))
+}
+
+// outdated checks if the hash was made with other parameters than the ones
+// currently used for new passwords.
+func (h *argon2Hash) outdated() bool {
+	return h.scheme != argon2Scheme ||
+		h.memory != argon2Memory ||
+		h.time != argon2Time ||
+		h.threads != argon2Threads ||
+		len(h.key) != argon2KeyLen
+}
+
+func (h *argon2Hash) matches(input string) bool {
+	key := argon2.IDKey([]byte(input), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+func parseArgon2Hash(secret string) (*argon2Hash, error) {
+	parts := strings.Split(secret, "$")
+	if len(parts) != 6 || parts[0] != "" {
+		return nil, ErrInvalidPasswordHash
+	}
+	h := &argon2Hash{scheme: parts[1]}
+	if h.scheme != argon2Scheme && h.scheme != legacyWrappedScheme {
+		return nil, ErrInvalidPasswordHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrInvalidPasswordHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return nil, ErrInvalidPasswordHash
+	}
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrInvalidPasswordHash
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, ErrInvalidPasswordHash
+	}
+	return h, nil
+}
+
+func newArgon2Hash(scheme, input string) (*argon2Hash, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return &argon2Hash{
+		scheme:  scheme,
+		memory:  argon2Memory,
+		time:    argon2Time,
+		threads: argon2Threads,
+		salt:    salt,
+		key:     argon2.IDKey([]byte(input), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen),
+	}, nil
+}
+
+// HashPassword returns the secret stored for a user with the password
+// provided, an argon2id hash in PHC string format.
+func HashPassword(password string) (string, error) {
+	h, err := newArgon2Hash(argon2Scheme, password)
+	if err != nil {
+		return "", err
+	}
+	return h.String(), nil
+}
+
+// legacyUserSecret returns the md5 digest (username:realm:password) used as
+// the user's secret by older versions of Nebraska.
+func legacyUserSecret(username, password string) string {
+	h := md5.New()
+	_, _ = io.WriteString(h, username+":"+Realm+":"+password)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// isLegacyUserSecret checks if the secret provided is a plain md5 digest.
+func isLegacyUserSecret(secret string) bool {
+	if len(secret) != md5.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(secret)
+	return err == nil
+}
+
+// checkPassword checks if the password provided matches the secret stored for
+// the user, and whether the secret must be replaced by a new hash of the
+// password because it uses a legacy format or outdated parameters.
+func checkPassword(username, password, secret string) (ok bool, rehash bool, err error) {
+	if isLegacyUserSecret(secret) {
+		expected := legacyUserSecret(username, password)
+		return subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(secret))) == 1, true, nil
+	}
+	h, err := parseArgon2Hash(secret)
+	if err != nil {
+		return false, false, err
+	}
+	input := password
+	if h.scheme == legacyWrappedScheme {
+		input = legacyUserSecret(username, password)
+	}
+	return h.matches(input), h.outdated(), nil
+}
+
+// wrapLegacyUserSecret hashes a legacy md5 secret with argon2id, so it isn't
+// stored as is while the password itself is unknown.
+func wrapLegacyUserSecret(secret string) (string, error) {
+	h, err := newArgon2Hash(legacyWrappedScheme, strings.ToLower(secret))
+	if err != nil {
+		return "", err
+	}
+	return h.String(), nil
+}
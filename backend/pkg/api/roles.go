@@ -0,0 +1,556 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/guregu/null.v4"
+)
+
+// Permissions that can be granted to users through roles. Permissions are
+// named after the resource they apply to and the action they allow.
+const (
+	PermissionAppsRead       = "apps:read"
+	PermissionAppsCreate     = "apps:create"
+	PermissionAppsUpdate     = "apps:update"
+	PermissionAppsDelete     = "apps:delete"
+	PermissionGroupsRead     = "groups:read"
+	PermissionGroupsCreate   = "groups:create"
+	PermissionGroupsUpdate   = "groups:update"
+	PermissionGroupsDelete   = "groups:delete"
+	PermissionChannelsRead   = "channels:read"
+	PermissionChannelsCreate = "channels:create"
+	PermissionChannelsUpdate = "channels:update"
+	PermissionChannelsDelete = "channels:delete"
+	PermissionPackagesRead   = "packages:read"
+	PermissionPackagesCreate = "packages:create"
+	PermissionPackagesUpdate = "packages:update"
+	PermissionPackagesDelete = "packages:delete"
+	PermissionInstancesRead  = "instances:read"
+	PermissionInstancesWrite = "instances:update"
+	PermissionActivityRead   = "activity:read"
+	PermissionAuditRead      = "audit:read"
+	PermissionTeamsRead      = "teams:read"
+	PermissionTeamsManage    = "teams:manage"
+	PermissionRolesRead      = "roles:read"
+	PermissionRolesManage    = "roles:manage"
+	PermissionTokensRead     = "tokens:read"
+	PermissionTokensManage   = "tokens:manage"
+	PermissionSyncerRead     = "syncer:read"
+	PermissionSyncerSync     = "syncer:sync"
+
+	// PermissionAll grants every permission. Permissions can also be
+	// granted for all the actions on a resource, e.g. "channels:*".
+	PermissionAll = "*"
+)
+
+// Subject types of role bindings.
+const (
+	SubjectTypeUser  = "user"
+	SubjectTypeGroup = "group"
+)
+
+var (
+	// Permissions contains all the permissions that can be granted.
+	Permissions = []string{
+		PermissionAppsRead, PermissionAppsCreate, PermissionAppsUpdate, PermissionAppsDelete,
+		PermissionGroupsRead, PermissionGroupsCreate, PermissionGroupsUpdate, PermissionGroupsDelete,
+		PermissionChannelsRead, PermissionChannelsCreate, PermissionChannelsUpdate, PermissionChannelsDelete,
+		PermissionPackagesRead, PermissionPackagesCreate, PermissionPackagesUpdate, PermissionPackagesDelete,
+		PermissionInstancesRead, PermissionInstancesWrite,
+		PermissionActivityRead, PermissionAuditRead,
+		PermissionTeamsRead, PermissionTeamsManage,
+		PermissionRolesRead, PermissionRolesManage,
+		PermissionTokensRead, PermissionTokensManage,
+		PermissionSyncerRead, PermissionSyncerSync,
+	}
+
+	// ErrInvalidPermission indicates that a permission provided is not
+	// one of the known permissions nor a wildcard matching some of them.
+	ErrInvalidPermission = errors.New("nebraska: invalid permission")
+
+	// ErrInvalidRoleBinding indicates that the role binding provided is
+	// not valid, e.g. because its subject is empty or its application
+	// belongs to another team.
+	ErrInvalidRoleBinding = errors.New("nebraska: invalid role binding")
+)
+
+// Role represents a named set of permissions that can be granted to users of
+// a team.
+type Role struct {
+	ID          string      `db:"id" json:"id"`
+	TeamID      string      `db:"team_id" json:"-"`
+	Name        string      `db:"name" json:"name"`
+	Description string      `db:"description" json:"description"`
+	Permissions StringArray `db:"permissions" json:"permissions"`
+	CreatedTs   time.Time   `db:"created_ts" json:"created_ts"`
+}
+
+// RoleBinding grants the permissions of a role to a user or to all users in
+// an OIDC group. When an application is set, the permissions only apply to
+// that application.
+type RoleBinding struct {
+	ID            string      `db:"id" json:"id"`
+	RoleID        string      `db:"role_id" json:"role_id"`
+	SubjectType   string      `db:"subject_type" json:"subject_type"`
+	Subject       string      `db:"subject" json:"subject"`
+	ApplicationID null.String `db:"application_id" json:"application_id"`
+	CreatedTs     time.Time   `db:"created_ts" json:"created_ts"`
+}
+
+// PermissionSet holds the permissions granted to a user, either on all the
+// applications of a team or on specific ones.
+type PermissionSet struct {
+	global []string
+	apps   map[string][]string
+}
+
+// NewPermissionSet creates a new permission set granting the permissions
+// provided on all applications.
+func NewPermissionSet(permissions ...string) *PermissionSet {
+	return &PermissionSet{
+		global: permissions,
+		apps:   make(map[string][]string),
+	}
+}
+
+// Grant grants the permissions provided on the given application, or on all
+// applications if the application id is empty.
+func (s *PermissionSet) Grant(appID string, permissions ...string) {
+	if appID == "" {
+		s.global = append(s.global, permissions...)
+		return
+	}
+	s.apps[appID] = append(s.apps[appID], permissions...)
+}
+
+// Allows checks if the permission provided is granted on the given
+// application. When no application is provided, only the permissions granted
+// on all applications are considered.
+func (s *PermissionSet) Allows(permission, appID string) bool {
+	for _, granted := range s.global {
+		if permissionMatches(granted, permission) {
+			return true
+		}
+	}
+	if appID == "" {
+		return false
+	}
+	for _, granted := range s.apps[appID] {
+		if permissionMatches(granted, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// Includes checks if all the permissions matched by the permission provided,
+// which may be a wildcard, are granted on all applications.
+func (s *PermissionSet) Includes(permission string) bool {
+	if permission == PermissionAll {
+		return s.Allows(PermissionAll, "")
+	}
+	for _, known := range Permissions {
+		if permissionMatches(permission, known) && !s.Allows(known, "") {
+			return false
+		}
+	}
+	return true
+}
+
+func permissionMatches(granted, permission string) bool {
+	if granted == PermissionAll || granted == permission {
+		return true
+	}
+	if resource := strings.TrimSuffix(granted, "*"); resource != granted {
+		return strings.HasPrefix(permission, resource)
+	}
+	return false
+}
+
+// ReadPermissions returns the permissions allowing to read the team's
+// resources, but not to modify them.
+func ReadPermissions() []string {
+	var permissions []string
+	for _, permission := range Permissions {
+		if strings.HasSuffix(permission, ":read") {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+func validatePermissions(permissions []string) error {
+	for _, permission := range permissions {
+		valid := false
+		for _, known := range Permissions {
+			if permission == known || (strings.HasSuffix(permission, ":*") && permissionMatches(permission, known)) {
+				valid = true
+				break
+			}
+		}
+		if !valid && permission != PermissionAll {
+			return ErrInvalidPermission
+		}
+	}
+	return nil
+}
+
+// AddRole registers the role provided.
+func (api *API) AddRole(role *Role) (*Role, error) {
+	if err := validatePermissions(role.Permissions); err != nil {
+		return nil, err
+	}
+
+	tx, err := api.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Error().Err(err).Msg("AddRole - could not roll back")
+		}
+	}()
+
+	query, _, err := goqu.Insert("role").
+		Cols("team_id", "name", "description").
+		Vals(goqu.Vals{role.TeamID, role.Name, role.Description}).
+		Returning("id", "created_ts").
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.QueryRowx(query).Scan(&role.ID, &role.CreatedTs); err != nil {
+		return nil, err
+	}
+	if err := insertRolePermissions(tx, role); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// UpdateRole updates an existing role of the team using the content of the
+// role provided. The permissions of the role are replaced by the ones
+// provided.
+func (api *API) UpdateRole(role *Role) error {
+	if err := validatePermissions(role.Permissions); err != nil {
+		return err
+	}
+
+	tx, err := api.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Error().Err(err).Msg("UpdateRole - could not roll back")
+		}
+	}()
+
+	query, _, err := goqu.Update("role").
+		Set(goqu.Record{"name": role.Name, "description": role.Description}).
+		Where(goqu.C("id").Eq(role.ID), goqu.C("team_id").Eq(role.TeamID)).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec(query)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNoRowsAffected
+	}
+
+	query, _, err = goqu.Delete("role_permission").
+		Where(goqu.C("role_id").Eq(role.ID)).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+	if err := insertRolePermissions(tx, role); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertRolePermissions(tx sqlx.Execer, role *Role) error {
+	if len(role.Permissions) == 0 {
+		return nil
+	}
+	records := make([]interface{}, 0, len(role.Permissions))
+	for _, permission := range role.Permissions {
+		records = append(records, goqu.Record{"role_id": role.ID, "permission": permission})
+	}
+	query, _, err := goqu.Insert("role_permission").
+		Rows(records...).
+		OnConflict(goqu.DoNothing()).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(query)
+	return err
+}
+
+// DeleteRole removes the role identified by the id provided from the team,
+// along with its bindings. The personal API tokens of the users the role was
+// bound to are revoked.
+func (api *API) DeleteRole(teamID, roleID string) error {
+	tx, err := api.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Error().Err(err).Msg("DeleteRole - could not roll back")
+		}
+	}()
+
+	query, _, err := goqu.From("role_binding").
+		Select("subject").
+		Where(goqu.C("role_id").Eq(roleID), goqu.C("subject_type").Eq(SubjectTypeUser)).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	var usernames []string
+	if err := tx.Select(&usernames, query); err != nil {
+		return err
+	}
+
+	query, _, err = goqu.Delete("role").
+		Where(goqu.C("id").Eq(roleID), goqu.C("team_id").Eq(teamID)).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec(query)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNoRowsAffected
+	}
+	for _, username := range usernames {
+		if err := revokeUserAPITokens(tx, teamID, username); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetRole returns the role of the team identified by the id provided.
+func (api *API) GetRole(teamID, roleID string) (*Role, error) {
+	query, _, err := api.rolesQuery().
+		Where(goqu.I("role.id").Eq(roleID), goqu.I("role.team_id").Eq(teamID)).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	var role Role
+	if err := api.db.QueryRowx(query).StructScan(&role); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// GetRoles returns all the roles of the team provided.
+func (api *API) GetRoles(teamID string) ([]*Role, error) {
+	query, _, err := api.rolesQuery().
+		Where(goqu.I("role.team_id").Eq(teamID)).
+		Order(goqu.I("role.name").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := api.db.Queryx(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var roles []*Role
+	for rows.Next() {
+		role := &Role{}
+		if err := rows.StructScan(role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// rolesQuery returns a SelectDataset prepared to return all roles along with
+// their permissions.
+func (api *API) rolesQuery() *goqu.SelectDataset {
+	return goqu.From(goqu.L("role LEFT JOIN role_permission rp ON role.id = rp.role_id")).
+		Select(goqu.L(`role.*,
+	    array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL) as permissions
+	    `)).
+		GroupBy("role.id")
+}
+
+// AddRoleBinding registers the role binding provided. The role and the
+// application of the binding, if any, must belong to the given team.
+func (api *API) AddRoleBinding(teamID string, binding *RoleBinding) (*RoleBinding, error) {
+	if binding.Subject == "" || (binding.SubjectType != SubjectTypeUser && binding.SubjectType != SubjectTypeGroup) {
+		return nil, ErrInvalidRoleBinding
+	}
+	if _, err := api.GetRole(teamID, binding.RoleID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidRoleBinding
+		}
+		return nil, err
+	}
+	if binding.ApplicationID.Valid {
+		if err := api.CheckTeamOwnership(teamID, &TeamResources{AppID: binding.ApplicationID.String}); err != nil {
+			if err == ErrNotInTeam {
+				return nil, ErrInvalidRoleBinding
+			}
+			return nil, err
+		}
+	}
+
+	query, _, err := goqu.Insert("role_binding").
+		Cols("role_id", "subject_type", "subject", "application_id").
+		Vals(goqu.Vals{binding.RoleID, binding.SubjectType, binding.Subject, binding.ApplicationID}).
+		Returning(goqu.T("role_binding").All()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	if err := api.db.QueryRowx(query).StructScan(binding); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// DeleteRoleBinding removes the role binding of the team identified by the id
+// provided. When the role was bound to a user, the personal API tokens of the
+// user are revoked.
+func (api *API) DeleteRoleBinding(teamID, bindingID string) error {
+	tx, err := api.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Error().Err(err).Msg("DeleteRoleBinding - could not roll back")
+		}
+	}()
+
+	query, _, err := goqu.Delete("role_binding").
+		Where(
+			goqu.C("id").Eq(bindingID),
+			goqu.C("role_id").In(goqu.From("role").Select("id").Where(goqu.C("team_id").Eq(teamID))),
+		).
+		Returning("subject_type", "subject").
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	var subjectType, subject string
+	switch err := tx.QueryRowx(query).Scan(&subjectType, &subject); err {
+	case nil:
+	case sql.ErrNoRows:
+		return ErrNoRowsAffected
+	default:
+		return err
+	}
+	if subjectType == SubjectTypeUser {
+		if err := revokeUserAPITokens(tx, teamID, subject); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetRoleBindings returns all the role bindings of the team provided.
+func (api *API) GetRoleBindings(teamID string) ([]*RoleBinding, error) {
+	query, _, err := goqu.From(goqu.T("role_binding").As("rb")).
+		Join(goqu.T("role").As("r"), goqu.On(goqu.I("r.id").Eq(goqu.I("rb.role_id")))).
+		Select(goqu.I("rb.id"), goqu.I("rb.role_id"), goqu.I("rb.subject_type"), goqu.I("rb.subject"), goqu.I("rb.application_id"), goqu.I("rb.created_ts")).
+		Where(goqu.I("r.team_id").Eq(teamID)).
+		Order(goqu.I("rb.created_ts").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := api.db.Queryx(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var bindings []*RoleBinding
+	for rows.Next() {
+		binding := &RoleBinding{}
+		if err := rows.StructScan(binding); err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, binding)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return bindings, nil
+}
+
+// GetUserPermissions returns the permissions granted in the given team to the
+// user identified by the username provided, either directly or through the
+// OIDC groups provided. The permissions in base are granted as well.
+func (api *API) GetUserPermissions(teamID, username string, oidcGroups []string, base *PermissionSet) (*PermissionSet, error) {
+	var subjects []exp.Expression
+	if username != "" {
+		subjects = append(subjects, goqu.And(goqu.I("rb.subject_type").Eq(SubjectTypeUser), goqu.I("rb.subject").Eq(username)))
+	}
+	if len(oidcGroups) > 0 {
+		subjects = append(subjects, goqu.And(goqu.I("rb.subject_type").Eq(SubjectTypeGroup), goqu.I("rb.subject").In(oidcGroups)))
+	}
+	if len(subjects) == 0 {
+		return base, nil
+	}
+
+	query, _, err := goqu.From(goqu.T("role_binding").As("rb")).
+		Join(goqu.T("role").As("r"), goqu.On(goqu.I("r.id").Eq(goqu.I("rb.role_id")))).
+		Join(goqu.T("role_permission").As("rp"), goqu.On(goqu.I("rp.role_id").Eq(goqu.I("r.id")))).
+		Select(goqu.COALESCE(goqu.Cast(goqu.I("rb.application_id"), "text"), ""), goqu.I("rp.permission")).
+		Where(goqu.I("r.team_id").Eq(teamID), goqu.Or(subjects...)).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := api.db.Queryx(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var appID, permission string
+		if err := rows.Scan(&appID, &permission); err != nil {
+			return nil, err
+		}
+		base.Grant(appID, permission)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return base, nil
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestRoles(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam1, _ := a.AddTeam(&Team{Name: "team1"})
+	tTeam2, _ := a.AddTeam(&Team{Name: "team2"})
+
+	_, err := a.AddRole(&Role{TeamID: tTeam1.ID, Name: "invalid", Permissions: []string{"channels:fly"}})
+	assert.Equal(t, ErrInvalidPermission, err)
+
+	role, err := a.AddRole(&Role{TeamID: tTeam1.ID, Name: "release manager", Permissions: []string{PermissionChannelsUpdate, "packages:*"}})
+	require.NoError(t, err)
+
+	_, err = a.AddRole(&Role{TeamID: tTeam1.ID, Name: "release manager"})
+	assert.Error(t, err, "Role names must be unique within a team.")
+
+	role, err = a.GetRole(tTeam1.ID, role.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "release manager", role.Name)
+	assert.ElementsMatch(t, []string{PermissionChannelsUpdate, "packages:*"}, role.Permissions)
+
+	_, err = a.GetRole(tTeam2.ID, role.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	role.Description = "Promotes releases"
+	role.Permissions = []string{PermissionAll}
+	assert.NoError(t, a.UpdateRole(role))
+	role, _ = a.GetRole(tTeam1.ID, role.ID)
+	assert.Equal(t, "Promotes releases", role.Description)
+	assert.Equal(t, StringArray{PermissionAll}, role.Permissions)
+
+	otherTeamRole := *role
+	otherTeamRole.TeamID = tTeam2.ID
+	assert.Equal(t, ErrNoRowsAffected, a.UpdateRole(&otherTeamRole))
+
+	roles, err := a.GetRoles(tTeam1.ID)
+	assert.NoError(t, err)
+	assert.Len(t, roles, 1)
+	roles, err = a.GetRoles(tTeam2.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, roles)
+
+	assert.Equal(t, ErrNoRowsAffected, a.DeleteRole(tTeam2.ID, role.ID))
+	assert.NoError(t, a.DeleteRole(tTeam1.ID, role.ID))
+	assert.Equal(t, ErrNoRowsAffected, a.DeleteRole(tTeam1.ID, role.ID))
+}
+
+func TestRoleBindings(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam1, _ := a.AddTeam(&Team{Name: "team1"})
+	tTeam2, _ := a.AddTeam(&Team{Name: "team2"})
+	tApp1, _ := a.AddApp(&Application{Name: "app1", TeamID: tTeam1.ID})
+	tApp2, _ := a.AddApp(&Application{Name: "app2", TeamID: tTeam1.ID})
+	tApp3, _ := a.AddApp(&Application{Name: "app3", TeamID: tTeam2.ID})
+	tRole, _ := a.AddRole(&Role{TeamID: tTeam1.ID, Name: "release manager", Permissions: []string{"channels:*"}})
+	tRole2, _ := a.AddRole(&Role{TeamID: tTeam1.ID, Name: "auditor", Permissions: []string{PermissionActivityRead}})
+
+	_, err := a.AddRoleBinding(tTeam1.ID, &RoleBinding{RoleID: tRole.ID, SubjectType: "robot", Subject: "alice"})
+	assert.Equal(t, ErrInvalidRoleBinding, err)
+	_, err = a.AddRoleBinding(tTeam2.ID, &RoleBinding{RoleID: tRole.ID, SubjectType: SubjectTypeUser, Subject: "alice"})
+	assert.Equal(t, ErrInvalidRoleBinding, err)
+	_, err = a.AddRoleBinding(tTeam1.ID, &RoleBinding{RoleID: tRole.ID, SubjectType: SubjectTypeUser, Subject: "alice", ApplicationID: null.StringFrom(tApp3.ID)})
+	assert.Equal(t, ErrInvalidRoleBinding, err)
+
+	binding, err := a.AddRoleBinding(tTeam1.ID, &RoleBinding{RoleID: tRole.ID, SubjectType: SubjectTypeUser, Subject: "alice", ApplicationID: null.StringFrom(tApp1.ID)})
+	require.NoError(t, err)
+	_, err = a.AddRoleBinding(tTeam1.ID, &RoleBinding{RoleID: tRole2.ID, SubjectType: SubjectTypeGroup, Subject: "auditors"})
+	require.NoError(t, err)
+
+	bindings, err := a.GetRoleBindings(tTeam1.ID)
+	assert.NoError(t, err)
+	assert.Len(t, bindings, 2)
+
+	permissions, err := a.GetUserPermissions(tTeam1.ID, "alice", nil, NewPermissionSet(ReadPermissions()...))
+	assert.NoError(t, err)
+	assert.True(t, permissions.Allows(PermissionAppsRead, ""))
+	assert.True(t, permissions.Allows(PermissionChannelsUpdate, tApp1.ID))
+	assert.True(t, permissions.Allows(PermissionChannelsDelete, tApp1.ID))
+	assert.False(t, permissions.Allows(PermissionChannelsUpdate, tApp2.ID))
+	assert.False(t, permissions.Allows(PermissionChannelsUpdate, ""))
+	assert.False(t, permissions.Allows(PermissionGroupsDelete, tApp1.ID))
+
+	permissions, err = a.GetUserPermissions(tTeam1.ID, "bob", []string{"auditors"}, NewPermissionSet())
+	assert.NoError(t, err)
+	assert.True(t, permissions.Allows(PermissionActivityRead, ""))
+	assert.False(t, permissions.Allows(PermissionChannelsUpdate, tApp1.ID))
+
+	permissions, err = a.GetUserPermissions(tTeam2.ID, "alice", []string{"auditors"}, NewPermissionSet())
+	assert.NoError(t, err)
+	assert.False(t, permissions.Allows(PermissionActivityRead, ""))
+
+	assert.Equal(t, ErrNoRowsAffected, a.DeleteRoleBinding(tTeam2.ID, binding.ID))
+	assert.NoError(t, a.DeleteRoleBinding(tTeam1.ID, binding.ID))
+	permissions, _ = a.GetUserPermissions(tTeam1.ID, "alice", nil, NewPermissionSet())
+	assert.False(t, permissions.Allows(PermissionChannelsUpdate, tApp1.ID))
+}
+
+func TestPermissionSet(t *testing.T) {
+	permissions := NewPermissionSet(PermissionAppsRead)
+	permissions.Grant("app1", "groups:*")
+
+	assert.True(t, permissions.Allows(PermissionAppsRead, ""))
+	assert.True(t, permissions.Allows(PermissionAppsRead, "app2"))
+	assert.True(t, permissions.Allows(PermissionGroupsDelete, "app1"))
+	assert.False(t, permissions.Allows(PermissionGroupsDelete, "app2"))
+	assert.False(t, permissions.Allows(PermissionChannelsRead, "app1"))
+
+	assert.True(t, NewPermissionSet(PermissionAll).Allows(PermissionRolesManage, ""))
+	assert.True(t, NewPermissionSet(PermissionAll).Includes(PermissionAll))
+	assert.True(t, NewPermissionSet("groups:*").Includes("groups:*"))
+	assert.True(t, permissions.Includes(PermissionAppsRead))
+	assert.False(t, permissions.Includes("groups:*"))
+	assert.False(t, NewPermissionSet(PermissionGroupsRead).Includes("groups:*"))
+	assert.False(t, NewPermissionSet("groups:*").Includes(PermissionAll))
+	assert.NotContains(t, ReadPermissions(), PermissionAppsUpdate)
+	assert.Contains(t, ReadPermissions(), PermissionActivityRead)
+}
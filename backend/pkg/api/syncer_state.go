@@ -0,0 +1,101 @@
+package api
+
+import (
+	"github.com/doug-martin/goqu/v9"
+	"gopkg.in/guregu/null.v4"
+)
+
+// Results of the syncer checks for updates.
+const (
+	SyncResultUpdated  = "updated"
+	SyncResultUpToDate = "up_to_date"
+	SyncResultError    = "error"
+)
+
+// SyncerState represents the state of a channel kept in sync with a track of
+// an upstream Omaha server by the syncer.
+type SyncerState struct {
+	ChannelID       string    `db:"channel_id" json:"channel_id"`
+	Source          string    `db:"source" json:"source"`
+	Track           string    `db:"track" json:"track"`
+	MachineID       string    `db:"machine_id" json:"-"`
+	UpstreamVersion string    `db:"upstream_version" json:"upstream_version"`
+	LastCheckTs     null.Time `db:"last_check_ts" json:"last_check_ts"`
+	LastSuccessTs   null.Time `db:"last_success_ts" json:"last_success_ts"`
+	LastResult      string    `db:"last_result" json:"last_result"`
+	LastError       string    `db:"last_error" json:"last_error"`
+
+	// Details of the channel, only filled when getting the states of a team.
+	ApplicationID string `db:"application_id" json:"application_id,omitempty"`
+	ChannelName   string `db:"channel_name" json:"channel_name,omitempty"`
+	Arch          Arch   `db:"arch" json:"arch"`
+}
+
+// SetSyncerState creates or replaces the syncer state of the channel it
+// references.
+func (api *API) SetSyncerState(state *SyncerState) error {
+	query, _, err := goqu.Insert("syncer_state").
+		Cols("channel_id", "source", "track", "machine_id", "upstream_version", "last_check_ts", "last_success_ts", "last_result", "last_error").
+		Vals(goqu.Vals{
+			state.ChannelID,
+			state.Source,
+			state.Track,
+			state.MachineID,
+			state.UpstreamVersion,
+			state.LastCheckTs,
+			state.LastSuccessTs,
+			state.LastResult,
+			state.LastError,
+		}).
+		OnConflict(goqu.DoUpdate("ON CONSTRAINT syncer_state_pkey", goqu.Record{
+			"source":           state.Source,
+			"track":            state.Track,
+			"machine_id":       state.MachineID,
+			"upstream_version": state.UpstreamVersion,
+			"last_check_ts":    state.LastCheckTs,
+			"last_success_ts":  state.LastSuccessTs,
+			"last_result":      state.LastResult,
+			"last_error":       state.LastError,
+		})).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	_, err = api.db.Exec(query)
+	return err
+}
+
+// GetSyncerState returns the syncer state of the channel provided.
+func (api *API) GetSyncerState(channelID string) (*SyncerState, error) {
+	var state SyncerState
+	query, _, err := goqu.From("syncer_state").
+		Where(goqu.C("channel_id").Eq(channelID)).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	if err := api.db.QueryRowx(query).StructScan(&state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// GetSyncerStates returns the syncer state of the channels of the team
+// provided, sorted by application, channel name and architecture.
+func (api *API) GetSyncerStates(teamID string) ([]*SyncerState, error) {
+	query, _, err := goqu.From(goqu.T("syncer_state").As("s")).
+		Join(goqu.T("channel").As("c"), goqu.On(goqu.I("c.id").Eq(goqu.I("s.channel_id")))).
+		Join(goqu.T("application").As("a"), goqu.On(goqu.I("a.id").Eq(goqu.I("c.application_id")))).
+		Select(goqu.I("s.*"), goqu.I("c.application_id"), goqu.I("c.name").As("channel_name"), goqu.I("c.arch")).
+		Where(goqu.I("a.team_id").Eq(teamID)).
+		Order(goqu.I("a.name").Asc(), goqu.I("c.name").Asc(), goqu.I("c.arch").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	states := []*SyncerState{}
+	if err := api.db.Select(&states, query); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
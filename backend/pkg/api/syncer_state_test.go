@@ -0,0 +1,58 @@
+package api
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestSyncerState(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tTeam2, _ := a.AddTeam(&Team{Name: "test_team2"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tChannel, _ := a.AddChannel(&Channel{Name: "stable", Color: "blue", ApplicationID: tApp.ID, Arch: ArchAMD64})
+	tChannel2, _ := a.AddChannel(&Channel{Name: "beta", Color: "blue", ApplicationID: tApp.ID, Arch: ArchAMD64})
+
+	_, err := a.GetSyncerState(tChannel.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	checkTs := time.Now().UTC().Truncate(time.Second)
+	err = a.SetSyncerState(&SyncerState{ChannelID: tChannel.ID, Source: "flatcar", Track: "stable", MachineID: "{machine}", LastCheckTs: null.TimeFrom(checkTs), LastResult: SyncResultError, LastError: "connection refused"})
+	require.NoError(t, err)
+	err = a.SetSyncerState(&SyncerState{ChannelID: tChannel2.ID, Source: "flatcar", Track: "beta", MachineID: "{machine2}", UpstreamVersion: "1.1.0", LastCheckTs: null.TimeFrom(checkTs), LastSuccessTs: null.TimeFrom(checkTs), LastResult: SyncResultUpdated})
+	require.NoError(t, err)
+
+	err = a.SetSyncerState(&SyncerState{ChannelID: tChannel.ID, Source: "flatcar", Track: "stable", MachineID: "{machine}", UpstreamVersion: "1.0.0", LastCheckTs: null.TimeFrom(checkTs), LastSuccessTs: null.TimeFrom(checkTs), LastResult: SyncResultUpToDate})
+	require.NoError(t, err)
+	state, err := a.GetSyncerState(tChannel.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "{machine}", state.MachineID)
+	assert.Equal(t, "1.0.0", state.UpstreamVersion)
+	assert.Equal(t, SyncResultUpToDate, state.LastResult)
+	assert.Empty(t, state.LastError)
+	assert.True(t, checkTs.Equal(state.LastSuccessTs.Time))
+
+	states, err := a.GetSyncerStates(tTeam.ID)
+	require.NoError(t, err)
+	require.Len(t, states, 2)
+	assert.Equal(t, tChannel2.ID, states[0].ChannelID)
+	assert.Equal(t, "beta", states[0].ChannelName)
+	assert.Equal(t, tApp.ID, states[0].ApplicationID)
+	assert.Equal(t, ArchAMD64, states[0].Arch)
+	assert.Equal(t, tChannel.ID, states[1].ChannelID)
+
+	states, err = a.GetSyncerStates(tTeam2.ID)
+	require.NoError(t, err)
+	assert.Empty(t, states)
+
+	require.NoError(t, a.DeleteChannel(tChannel.ID))
+	_, err = a.GetSyncerState(tChannel.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+)
+
+var (
+	// ErrInvalidTeamMember indicates that the team member provided is not
+	// valid, its username can't be empty.
+	ErrInvalidTeamMember = errors.New("nebraska: invalid team member")
+
+	// ErrInvalidTeamOIDCGroup indicates that the OIDC group provided to be
+	// mapped to a team is not valid, its name can't be empty.
+	ErrInvalidTeamOIDCGroup = errors.New("nebraska: invalid team oidc group")
+)
+
+// AddTeamMember makes the user identified by the username provided a member
+// of the given team. Adding an existing member again is not an error.
+func (api *API) AddTeamMember(teamID, username string) error {
+	if username == "" {
+		return ErrInvalidTeamMember
+	}
+	query, _, err := goqu.Insert("team_member").
+		Cols("team_id", "username").
+		Vals(goqu.Vals{teamID, username}).
+		OnConflict(goqu.DoNothing()).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	_, err = api.db.Exec(query)
+	return err
+}
+
+// RemoveTeamMember removes the user identified by the username provided from
+// the members of the given team, revoking the personal API tokens the user
+// has in the team.
+func (api *API) RemoveTeamMember(teamID, username string) error {
+	tx, err := api.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Error().Err(err).Msg("RemoveTeamMember - could not roll back")
+		}
+	}()
+
+	query, _, err := goqu.Delete("team_member").
+		Where(goqu.C("team_id").Eq(teamID), goqu.C("username").Eq(username)).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec(query)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNoRowsAffected
+	}
+	if err := revokeUserAPITokens(tx, teamID, username); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetTeamMembers returns the usernames of the members of the team provided.
+func (api *API) GetTeamMembers(teamID string) ([]string, error) {
+	query, _, err := goqu.From("team_member").
+		Select("username").
+		Where(goqu.C("team_id").Eq(teamID)).
+		Order(goqu.C("username").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	return api.getStrings(query)
+}
+
+// AddTeamOIDCGroup maps the OIDC group provided to the given team, so that
+// all users in that group are considered members of the team.
+func (api *API) AddTeamOIDCGroup(teamID, group string) error {
+	if group == "" {
+		return ErrInvalidTeamOIDCGroup
+	}
+	query, _, err := goqu.Insert("team_oidc_group").
+		Cols("team_id", "group_name").
+		Vals(goqu.Vals{teamID, group}).
+		OnConflict(goqu.DoNothing()).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	_, err = api.db.Exec(query)
+	return err
+}
+
+// RemoveTeamOIDCGroup removes the mapping between the OIDC group provided and
+// the given team.
+func (api *API) RemoveTeamOIDCGroup(teamID, group string) error {
+	query, _, err := goqu.Delete("team_oidc_group").
+		Where(goqu.C("team_id").Eq(teamID), goqu.C("group_name").Eq(group)).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+	return api.execAffectingRows(query)
+}
+
+// GetTeamOIDCGroups returns the OIDC groups mapped to the team provided.
+func (api *API) GetTeamOIDCGroups(teamID string) ([]string, error) {
+	query, _, err := goqu.From("team_oidc_group").
+		Select("group_name").
+		Where(goqu.C("team_id").Eq(teamID)).
+		Order(goqu.C("group_name").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	return api.getStrings(query)
+}
+
+// GetUserTeams returns the teams the user identified by the username provided
+// belongs to, either because they are a member of the team or because one of
+// the OIDC groups provided is mapped to it.
+func (api *API) GetUserTeams(username string, oidcGroups []string) ([]*Team, error) {
+	var conditions []exp.Expression
+	if username != "" {
+		conditions = append(conditions, goqu.C("id").In(
+			goqu.From("team_member").Select("team_id").Where(goqu.C("username").Eq(username)),
+		))
+	}
+	if len(oidcGroups) > 0 {
+		conditions = append(conditions, goqu.C("id").In(
+			goqu.From("team_oidc_group").Select("team_id").Where(goqu.C("group_name").In(oidcGroups)),
+		))
+	}
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	query, _, err := goqu.From("team").
+		Select("id", "name", "created_ts").
+		Where(goqu.Or(conditions...)).
+		Order(goqu.C("name").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := api.db.Queryx(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var teams []*Team
+	for rows.Next() {
+		team := &Team{}
+		if err := rows.StructScan(team); err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return teams, nil
+}
+
+func (api *API) getStrings(query string) ([]string, error) {
+	rows, err := api.db.Queryx(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (api *API) execAffectingRows(query string) error {
+	result, err := api.db.Exec(query)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNoRowsAffected
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTeamMembers(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam1, _ := a.AddTeam(&Team{Name: "team1"})
+	tTeam2, _ := a.AddTeam(&Team{Name: "team2"})
+	tTeam3, _ := a.AddTeam(&Team{Name: "team3"})
+
+	assert.Equal(t, ErrInvalidTeamMember, a.AddTeamMember(tTeam1.ID, ""))
+	assert.Equal(t, ErrInvalidTeamOIDCGroup, a.AddTeamOIDCGroup(tTeam1.ID, ""))
+
+	require.NoError(t, a.AddTeamMember(tTeam1.ID, "alice"))
+	require.NoError(t, a.AddTeamMember(tTeam1.ID, "alice"))
+	require.NoError(t, a.AddTeamMember(tTeam1.ID, "bob"))
+	require.NoError(t, a.AddTeamMember(tTeam2.ID, "alice"))
+	require.NoError(t, a.AddTeamOIDCGroup(tTeam3.ID, "ops"))
+
+	members, err := a.GetTeamMembers(tTeam1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, members)
+
+	groups, err := a.GetTeamOIDCGroups(tTeam3.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ops"}, groups)
+
+	teamIDs := func(teams []*Team) []string {
+		var ids []string
+		for _, team := range teams {
+			ids = append(ids, team.ID)
+		}
+		return ids
+	}
+
+	teams, err := a.GetUserTeams("alice", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{tTeam1.ID, tTeam2.ID}, teamIDs(teams))
+
+	teams, err = a.GetUserTeams("bob", []string{"ops", "unknown"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{tTeam1.ID, tTeam3.ID}, teamIDs(teams))
+
+	teams, err = a.GetUserTeams("", []string{"ops"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{tTeam3.ID}, teamIDs(teams))
+
+	teams, err = a.GetUserTeams("", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, teams)
+
+	assert.NoError(t, a.RemoveTeamMember(tTeam1.ID, "alice"))
+	assert.Equal(t, ErrNoRowsAffected, a.RemoveTeamMember(tTeam1.ID, "alice"))
+	assert.NoError(t, a.RemoveTeamOIDCGroup(tTeam3.ID, "ops"))
+	assert.Equal(t, ErrNoRowsAffected, a.RemoveTeamOIDCGroup(tTeam3.ID, "ops"))
+
+	teams, err = a.GetUserTeams("alice", []string{"ops"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{tTeam2.ID}, teamIDs(teams))
+}
+
+func TestCheckTeamOwnership(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam1, _ := a.AddTeam(&Team{Name: "team1"})
+	tTeam2, _ := a.AddTeam(&Team{Name: "team2"})
+	tApp1, _ := a.AddApp(&Application{Name: "app1", TeamID: tTeam1.ID})
+	tApp2, _ := a.AddApp(&Application{Name: "app2", TeamID: tTeam2.ID})
+	tChannel1, _ := a.AddChannel(&Channel{Name: "channel1", Color: "blue", ApplicationID: tApp1.ID})
+	tChannel2, _ := a.AddChannel(&Channel{Name: "channel2", Color: "blue", ApplicationID: tApp2.ID})
+	tPkg1, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "1.0.0", ApplicationID: tApp1.ID})
+	tPkg2, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "1.0.0", ApplicationID: tApp2.ID})
+	tGroup1, _ := a.AddGroup(&Group{Name: "group1", ApplicationID: tApp1.ID, PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes"})
+	tGroup2, _ := a.AddGroup(&Group{Name: "group2", ApplicationID: tApp2.ID, PolicyUpdatesEnabled: true, PolicySafeMode: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes"})
+	tInstance1, _ := a.RegisterInstance(uuid.New().String(), "", "10.0.0.1", "1.0.0", tApp1.ID, tGroup1.ID)
+	tInstance2, _ := a.RegisterInstance(uuid.New().String(), "", "10.0.0.2", "1.0.0", tApp2.ID, tGroup2.ID)
+
+	assert.NoError(t, a.CheckTeamOwnership(tTeam1.ID, &TeamResources{}))
+	assert.NoError(t, a.CheckTeamOwnership(tTeam1.ID, &TeamResources{AppID: tApp1.ID, GroupID: tGroup1.ID, ChannelID: tChannel1.ID, PackageID: tPkg1.ID}))
+	assert.NoError(t, a.CheckTeamOwnership(tTeam1.ID, &TeamResources{InstanceID: tInstance1.ID}))
+
+	assert.Equal(t, ErrNotInTeam, a.CheckTeamOwnership(tTeam1.ID, &TeamResources{AppID: tApp2.ID}))
+	assert.Equal(t, ErrNotInTeam, a.CheckTeamOwnership(tTeam1.ID, &TeamResources{AppID: uuid.New().String()}))
+	assert.Equal(t, ErrNotInTeam, a.CheckTeamOwnership(tTeam1.ID, &TeamResources{AppID: tApp1.ID, GroupID: tGroup2.ID}))
+	assert.Equal(t, ErrNotInTeam, a.CheckTeamOwnership(tTeam1.ID, &TeamResources{AppID: tApp1.ID, ChannelID: tChannel2.ID}))
+	assert.Equal(t, ErrNotInTeam, a.CheckTeamOwnership(tTeam1.ID, &TeamResources{AppID: tApp1.ID, PackageID: tPkg2.ID}))
+	assert.Equal(t, ErrNotInTeam, a.CheckTeamOwnership(tTeam1.ID, &TeamResources{GroupID: tGroup1.ID}))
+	assert.Equal(t, ErrNotInTeam, a.CheckTeamOwnership(tTeam1.ID, &TeamResources{InstanceID: tInstance2.ID}))
+}
@@ -8,9 +8,9 @@ import (
 
 // Team represents a Nebraska team.
 type Team struct {
-	ID        string    `db:"id"`
-	Name      string    `db:"name"`
-	CreatedTs time.Time `db:"created_ts"`
+	ID        string    `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	CreatedTs time.Time `db:"created_ts" json:"created_ts"`
 }
 
 func (api *API) GetTeams() ([]*Team, error) {
@@ -57,6 +57,22 @@ func (api *API) GetTeam() (*Team, error) {
 	return team, nil
 }
 
+// GetTeamByID returns the team identified by the id provided.
+func (api *API) GetTeamByID(teamID string) (*Team, error) {
+	var team Team
+	query, _, err := goqu.From("team").
+		Select("id", "name", "created_ts").
+		Where(goqu.C("id").Eq(teamID)).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	if err := api.db.QueryRowx(query).StructScan(&team); err != nil {
+		return nil, err
+	}
+	return &team, nil
+}
+
 func (api *API) UpdateTeam(team *Team) error {
 	query, _, err := goqu.Update("team").
 		Set(goqu.Record{"name": team.Name}).
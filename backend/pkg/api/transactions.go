@@ -0,0 +1,146 @@
+package api
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// queryer is implemented by the database connections pool and the
+// transactions used to run the API operations.
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	QueryRowx(query string, args ...interface{}) *sqlx.Row
+	Queryx(query string, args ...interface{}) (*sqlx.Rows, error)
+	Select(dest interface{}, query string, args ...interface{}) error
+}
+
+// transaction represents a database transaction, or a savepoint within one.
+type transaction interface {
+	queryer
+	Commit() error
+	Rollback() error
+}
+
+// database is what the API runs its operations on: the connections pool, or
+// a transaction when the API is running in one (see RunInTransaction).
+type database interface {
+	queryer
+	Beginx() (transaction, error)
+}
+
+// dbPool is the database backed by the connections pool.
+type dbPool struct {
+	*sqlx.DB
+}
+
+func (p dbPool) Beginx() (transaction, error) {
+	tx, err := p.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// txDatabase is the database backed by a transaction. Operations starting
+// their own transaction use a savepoint instead.
+type txDatabase struct {
+	transaction
+}
+
+// savepointName is the name of the savepoints created within transactions.
+// Savepoints are always released or rolled back in the reverse order they
+// were created in, so reusing the name refers to the innermost one.
+const savepointName = "nebraska_savepoint"
+
+func (d txDatabase) Beginx() (transaction, error) {
+	if _, err := d.Exec("SAVEPOINT " + savepointName); err != nil {
+		return nil, err
+	}
+	return &savepoint{transaction: d.transaction}, nil
+}
+
+// savepoint is a transaction nested in another one.
+type savepoint struct {
+	transaction
+	done bool
+}
+
+func (s *savepoint) Commit() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	s.done = true
+	_, err := s.Exec("RELEASE SAVEPOINT " + savepointName)
+	return err
+}
+
+func (s *savepoint) Rollback() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	s.done = true
+	_, err := s.Exec("ROLLBACK TO SAVEPOINT " + savepointName)
+	return err
+}
+
+// RunInTransaction calls fn with an API instance running all its operations
+// in a single database transaction, which is committed if fn succeeds and
+// rolled back otherwise. The notifications about the activity entries
+// created are only sent once the transaction has been committed.
+func (api *API) RunInTransaction(fn func(*API) error) error {
+	tx, err := api.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Error().Err(err).Msg("RunInTransaction - could not roll back")
+		}
+	}()
+
+	txAPI := *api
+	txAPI.db = txDatabase{tx}
+	if api.committed == nil {
+		txAPI.committed = &[]func(*API){}
+	}
+	pending := len(*txAPI.committed)
+	if err := fn(&txAPI); err != nil {
+		*txAPI.committed = (*txAPI.committed)[:pending]
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		*txAPI.committed = (*txAPI.committed)[:pending]
+		return err
+	}
+
+	// The functions waiting for the changes to be committed are run by
+	// the outermost transaction.
+	if api.committed == nil {
+		for _, fn := range *txAPI.committed {
+			go fn(api)
+		}
+	}
+	return nil
+}
+
+// afterCommit runs fn in a goroutine once the changes made so far have been
+// committed, right away when the API isn't running in a transaction.
+func (api *API) afterCommit(fn func(*API)) {
+	if api.committed == nil {
+		go fn(api)
+		return
+	}
+	*api.committed = append(*api.committed, fn)
+}
+
+// closeRows closes the rows provided once they have all been read, returning
+// the error hit while reading them, if any. Queries loading related entities
+// must run after that, as a transaction can only run one query at a time.
+func closeRows(rows *sqlx.Rows) error {
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return rows.Close()
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunInTransaction(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+
+	// Everything is rolled back when the function fails.
+	errTest := errors.New("test error")
+	err := a.RunInTransaction(func(tx *API) error {
+		app, err := tx.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+		require.NoError(t, err)
+		_, err = tx.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.1.0", ApplicationID: app.ID})
+		require.NoError(t, err)
+		return errTest
+	})
+	assert.Equal(t, errTest, err)
+	apps, err := a.GetApps(tTeam.ID, 1, 10)
+	require.NoError(t, err)
+	assert.Empty(t, apps)
+
+	// Operations failing within the transaction only roll back their own
+	// changes.
+	var appID string
+	err = a.RunInTransaction(func(tx *API) error {
+		app, err := tx.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+		if err != nil {
+			return err
+		}
+		appID = app.ID
+		_, err = tx.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.1.0", ApplicationID: app.ID})
+		if err != nil {
+			return err
+		}
+		_, err = tx.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.1.0", ApplicationID: app.ID})
+		assert.Error(t, err)
+		return nil
+	})
+	require.NoError(t, err)
+	app, err := a.GetApp(appID)
+	require.NoError(t, err)
+	pkgs, err := a.GetPackages(app.ID, 1, 10)
+	require.NoError(t, err)
+	assert.Len(t, pkgs, 1)
+}
@@ -0,0 +1,487 @@
+package api
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxUpdateWindowDuration is the longest duration allowed for update
+	// windows defined using a cron expression.
+	maxUpdateWindowDuration = 7 * 24 * time.Hour
+
+	blackoutDateLayout = "2006-01-02"
+)
+
+var (
+	// ErrInvalidUpdateWindow error indicates that an update window provided
+	// is not valid.
+	ErrInvalidUpdateWindow = errors.New("nebraska: invalid update window")
+
+	// ErrInvalidBlackoutPeriod error indicates that a blackout period provided
+	// is not valid.
+	ErrInvalidBlackoutPeriod = errors.New("nebraska: invalid blackout period")
+
+	// officeHoursWindow is the update window used for groups that have the
+	// PolicyOfficeHours flag enabled.
+	officeHoursWindow = UpdateWindow{
+		Name:     "office-hours",
+		Weekdays: []string{"mon", "tue", "wed", "thu", "fri"},
+		Start:    "09:00",
+		End:      "17:00",
+	}
+
+	cronWeekdays = strings.NewReplacer("sun", "0", "mon", "1", "tue", "2", "wed", "3", "thu", "4", "fri", "5", "sat", "6")
+
+	weekdayNames = map[string]time.Weekday{
+		"sun": time.Sunday, "sunday": time.Sunday,
+		"mon": time.Monday, "monday": time.Monday,
+		"tue": time.Tuesday, "tuesday": time.Tuesday,
+		"wed": time.Wednesday, "wednesday": time.Wednesday,
+		"thu": time.Thursday, "thursday": time.Thursday,
+		"fri": time.Friday, "friday": time.Friday,
+		"sat": time.Saturday, "saturday": time.Saturday,
+	}
+)
+
+// UpdateWindow represents a named period of time in which updates can be
+// granted to the instances of a group. A window is defined either by a cron
+// expression setting when it opens along with its duration (e.g. "0 22 * * 6"
+// and "4h"), or by a time range in a set of weekdays (e.g. "mon" to "fri"
+// from "09:00" to "17:00"). Time ranges ending before they start span past
+// midnight. Times are evaluated in the group's timezone.
+type UpdateWindow struct {
+	Name     string   `json:"name"`
+	Cron     string   `json:"cron,omitempty"`
+	Duration string   `json:"duration,omitempty"`
+	Weekdays []string `json:"weekdays,omitempty"`
+	Start    string   `json:"start,omitempty"`
+	End      string   `json:"end,omitempty"`
+
+	// schedule and duration hold the parsed cron expression and duration of
+	// cron windows. They are set when the windows are decoded (e.g. when the
+	// group is loaded), so they don't have to be parsed on every check.
+	schedule *cronExpression
+	duration time.Duration
+}
+
+// BlackoutPeriod represents a named range of dates (both inclusive, in the
+// YYYY-MM-DD format) in which no updates will be granted to the instances of
+// a group, regardless of its update windows.
+type BlackoutPeriod struct {
+	Name  string `json:"name"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// UpdateWindows represents a list of update windows stored as JSON.
+type UpdateWindows []UpdateWindow
+
+// Scan implements the sql.Scanner interface.
+func (w *UpdateWindows) Scan(src interface{}) error {
+	return scanJSON(src, w)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. The windows are
+// replaced instead of decoding the new ones over the existing ones, so none
+// of their fields are kept when decoding into a group already loaded. The
+// cron windows are parsed once decoded.
+func (w *UpdateWindows) UnmarshalJSON(data []byte) error {
+	var windows []UpdateWindow
+	if err := json.Unmarshal(data, &windows); err != nil {
+		return err
+	}
+	for i := range windows {
+		windows[i].parseSchedule()
+	}
+	*w = windows
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (w UpdateWindows) Value() (driver.Value, error) {
+	if w == nil {
+		return "[]", nil
+	}
+	return valueJSON(w)
+}
+
+// BlackoutPeriods represents a list of blackout periods stored as JSON.
+type BlackoutPeriods []BlackoutPeriod
+
+// Scan implements the sql.Scanner interface.
+func (b *BlackoutPeriods) Scan(src interface{}) error {
+	return scanJSON(src, b)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, replacing the
+// existing blackout periods like UpdateWindows does.
+func (b *BlackoutPeriods) UnmarshalJSON(data []byte) error {
+	var periods []BlackoutPeriod
+	if err := json.Unmarshal(data, &periods); err != nil {
+		return err
+	}
+	*b = periods
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (b BlackoutPeriods) Value() (driver.Value, error) {
+	if b == nil {
+		return "[]", nil
+	}
+	return valueJSON(b)
+}
+
+func scanJSON(src interface{}, dest interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return json.Unmarshal(src, dest)
+	case string:
+		return json.Unmarshal([]byte(src), dest)
+	case nil:
+		return nil
+	}
+	return fmt.Errorf("nebraska: cannot convert %T to %T", src, dest)
+}
+
+func valueJSON(v interface{}) (driver.Value, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// validateUpdateWindows checks if the update windows and blackout periods of
+// the group provided are valid.
+func validateUpdateWindows(group *Group) error {
+	names := make(map[string]struct{}, len(group.PolicyUpdateWindows))
+	for _, w := range group.PolicyUpdateWindows {
+		if w.Name == "" {
+			return ErrInvalidUpdateWindow
+		}
+		if _, ok := names[w.Name]; ok {
+			return ErrInvalidUpdateWindow
+		}
+		names[w.Name] = struct{}{}
+		if err := w.validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range group.PolicyBlackoutPeriods {
+		if err := b.validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *UpdateWindow) validate() error {
+	if w.Cron != "" {
+		if len(w.Weekdays) > 0 || w.Start != "" || w.End != "" {
+			return ErrInvalidUpdateWindow
+		}
+		if _, err := parseCronExpression(w.Cron); err != nil {
+			return ErrInvalidUpdateWindow
+		}
+		duration, err := time.ParseDuration(w.Duration)
+		if err != nil || duration < time.Minute || duration > maxUpdateWindowDuration {
+			return ErrInvalidUpdateWindow
+		}
+		return nil
+	}
+
+	if w.Duration != "" {
+		return ErrInvalidUpdateWindow
+	}
+	start, err := parseClockTime(w.Start)
+	if err != nil {
+		return ErrInvalidUpdateWindow
+	}
+	end, err := parseClockTime(w.End)
+	if err != nil || start == end {
+		return ErrInvalidUpdateWindow
+	}
+	for _, day := range w.Weekdays {
+		if _, ok := weekdayNames[strings.ToLower(day)]; !ok {
+			return ErrInvalidUpdateWindow
+		}
+	}
+	return nil
+}
+
+func (b *BlackoutPeriod) validate() error {
+	if b.Name == "" {
+		return ErrInvalidBlackoutPeriod
+	}
+	start, err := time.Parse(blackoutDateLayout, b.Start)
+	if err != nil {
+		return ErrInvalidBlackoutPeriod
+	}
+	if b.End == "" {
+		return nil
+	}
+	end, err := time.Parse(blackoutDateLayout, b.End)
+	if err != nil || end.Before(start) {
+		return ErrInvalidBlackoutPeriod
+	}
+	return nil
+}
+
+// updatesAllowedNow checks if the update windows and blackout periods of the
+// group provided allow granting updates now.
+func updatesAllowedNow(group *Group) bool {
+	return updatesAllowedAt(group, time.Now())
+}
+
+// updatesAllowedAt checks if the update windows and blackout periods of the
+// group provided allow granting updates at the given time. Groups without
+// update windows allow updates at any time not covered by a blackout period.
+func updatesAllowedAt(group *Group, t time.Time) bool {
+	windows := group.PolicyUpdateWindows
+	if group.PolicyOfficeHours {
+		windows = append(UpdateWindows{officeHoursWindow}, windows...)
+	}
+	if len(windows) == 0 && len(group.PolicyBlackoutPeriods) == 0 {
+		return true
+	}
+
+	location, err := time.LoadLocation(group.PolicyTimezone.String)
+	if err != nil || group.PolicyTimezone.String == "" {
+		return false
+	}
+	t = t.In(location)
+
+	date := t.Format(blackoutDateLayout)
+	for _, b := range group.PolicyBlackoutPeriods {
+		end := b.End
+		if end == "" {
+			end = b.Start
+		}
+		if date >= b.Start && date <= end {
+			return false
+		}
+	}
+
+	if len(windows) == 0 {
+		return true
+	}
+	for _, w := range windows {
+		if w.isOpenAt(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSchedule parses the cron expression and duration of cron windows.
+// Invalid windows are left unparsed, they are never open.
+func (w *UpdateWindow) parseSchedule() {
+	if w.Cron == "" {
+		return
+	}
+	expr, err := parseCronExpression(w.Cron)
+	if err != nil {
+		return
+	}
+	duration, err := time.ParseDuration(w.Duration)
+	if err != nil {
+		return
+	}
+	w.schedule, w.duration = expr, duration
+}
+
+// isOpenAt checks if the update window is open at the given time.
+func (w *UpdateWindow) isOpenAt(t time.Time) bool {
+	if w.Cron != "" {
+		if w.schedule == nil {
+			// Windows not decoded from JSON, e.g. built by a caller.
+			w.parseSchedule()
+			if w.schedule == nil {
+				return false
+			}
+		}
+		// The window is open if it was opened by the cron expression within
+		// the last duration.
+		now := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, t.Location())
+		start, ok := w.schedule.prev(now, now.Add(-w.duration))
+		return ok && now.Sub(start) < w.duration
+	}
+
+	start, err := parseClockTime(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClockTime(w.End)
+	if err != nil {
+		return false
+	}
+	now := t.Hour()*60 + t.Minute()
+	if start < end {
+		return w.includesWeekday(t.Weekday()) && now >= start && now < end
+	}
+	// Time ranges ending before they start span past midnight, so they can
+	// have started the day before.
+	if now >= start {
+		return w.includesWeekday(t.Weekday())
+	}
+	return now < end && w.includesWeekday((t.Weekday()+6)%7)
+}
+
+func (w *UpdateWindow) includesWeekday(weekday time.Weekday) bool {
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, day := range w.Weekdays {
+		if d, ok := weekdayNames[strings.ToLower(day)]; ok && d == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClockTime parses a time of the day in the HH:MM format, returning the
+// number of minutes since midnight.
+func parseClockTime(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// cronExpression represents a parsed standard five fields cron expression
+// (minute, hour, day of month, month and day of week).
+type cronExpression struct {
+	minutes, hours, daysOfMonth, months, daysOfWeek []bool
+	anyDayOfMonth, anyDayOfWeek                     bool
+}
+
+// parseCronExpression parses a standard five fields cron expression. Each
+// field supports "*", single values, ranges ("1-5"), lists ("1,3,5") and
+// steps ("*/15", "0-30/10"). Days of the week can also be given by their
+// abbreviated names ("mon-fri").
+func parseCronExpression(s string) (*cronExpression, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields", s)
+	}
+
+	var expr cronExpression
+	var err error
+	if expr.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if expr.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if expr.daysOfMonth, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if expr.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if expr.daysOfWeek, err = parseCronField(cronWeekdays.Replace(strings.ToLower(fields[4])), 0, 7); err != nil {
+		return nil, err
+	}
+	// Both 0 and 7 stand for Sunday.
+	expr.daysOfWeek[0] = expr.daysOfWeek[0] || expr.daysOfWeek[7]
+	// As in standard cron, day fields starting with "*" (like "*" or "*/2")
+	// are unrestricted when combining the days of the month and the week.
+	expr.anyDayOfMonth = strings.HasPrefix(fields[2], "*")
+	expr.anyDayOfWeek = strings.HasPrefix(fields[4], "*")
+
+	return &expr, nil
+}
+
+func parseCronField(field string, min, max int) ([]bool, error) {
+	values := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid cron step in %q", part)
+			}
+			rangePart = part[:i]
+		}
+
+		low, high := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid cron value in %q", part)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid cron value in %q", part)
+				}
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("cron value out of range in %q", part)
+		}
+
+		for v := low; v <= high; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// prev returns the latest time (with minute precision) at or before t
+// matched by the cron expression, not looking further back than the day of
+// limit. It returns false when there is none.
+func (c *cronExpression) prev(t, limit time.Time) (time.Time, bool) {
+	limitDay := time.Date(limit.Year(), limit.Month(), limit.Day(), 0, 0, 0, 0, limit.Location())
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	maxHour, maxMinute := t.Hour(), t.Minute()
+	for !day.Before(limitDay) {
+		if c.matchesDay(day) {
+			for hour := maxHour; hour >= 0; hour-- {
+				if !c.hours[hour] {
+					continue
+				}
+				minute := 59
+				if hour == maxHour {
+					minute = maxMinute
+				}
+				for ; minute >= 0; minute-- {
+					if c.minutes[minute] {
+						return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location()), true
+					}
+				}
+			}
+		}
+		day = day.AddDate(0, 0, -1)
+		maxHour, maxMinute = 23, 59
+	}
+	return time.Time{}, false
+}
+
+// matchesDay checks if the cron expression matches the day of the given
+// time.
+func (c *cronExpression) matchesDay(t time.Time) bool {
+	if !c.months[t.Month()] {
+		return false
+	}
+
+	dayOfMonth := c.daysOfMonth[t.Day()]
+	dayOfWeek := c.daysOfWeek[t.Weekday()]
+	// As in standard cron, when both day fields are restricted, matching
+	// any of them is enough.
+	if !c.anyDayOfMonth && !c.anyDayOfWeek {
+		return dayOfMonth || dayOfWeek
+	}
+	return dayOfMonth && dayOfWeek
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestUpdatesAllowedAt(t *testing.T) {
+	group := &Group{
+		PolicyTimezone: null.StringFrom("Europe/Berlin"),
+		PolicyUpdateWindows: UpdateWindows{
+			{Name: "weeknights", Weekdays: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "22:00", End: "04:00"},
+			{Name: "saturday-morning", Cron: "0 6 * * sat", Duration: "2h"},
+		},
+		PolicyBlackoutPeriods: BlackoutPeriods{
+			{Name: "holidays", Start: "2020-12-24", End: "2020-12-26"},
+		},
+	}
+	location, _ := time.LoadLocation("Europe/Berlin")
+
+	// Monday 2020-12-07
+	assert.True(t, updatesAllowedAt(group, time.Date(2020, 12, 7, 23, 0, 0, 0, location)))
+	assert.True(t, updatesAllowedAt(group, time.Date(2020, 12, 8, 3, 59, 0, 0, location)))
+	assert.False(t, updatesAllowedAt(group, time.Date(2020, 12, 8, 4, 0, 0, 0, location)))
+	assert.False(t, updatesAllowedAt(group, time.Date(2020, 12, 7, 12, 0, 0, 0, location)))
+	// Monday early morning belongs to Sunday night, which is not in the window.
+	assert.False(t, updatesAllowedAt(group, time.Date(2020, 12, 7, 1, 0, 0, 0, location)))
+	// Saturday 2020-12-12
+	assert.True(t, updatesAllowedAt(group, time.Date(2020, 12, 12, 6, 0, 0, 0, location)))
+	assert.True(t, updatesAllowedAt(group, time.Date(2020, 12, 12, 7, 59, 0, 0, location)))
+	assert.False(t, updatesAllowedAt(group, time.Date(2020, 12, 12, 8, 0, 0, 0, location)))
+	// Thursday 2020-12-24, in a blackout period.
+	assert.False(t, updatesAllowedAt(group, time.Date(2020, 12, 24, 23, 0, 0, 0, location)))
+	// Windows are evaluated in the group's timezone.
+	assert.True(t, updatesAllowedAt(group, time.Date(2020, 12, 7, 22, 0, 0, 0, time.UTC)))
+
+	assert.True(t, updatesAllowedAt(&Group{}, time.Now()))
+	assert.False(t, updatesAllowedAt(&Group{PolicyOfficeHours: true}, time.Now()), "Timezone is required")
+
+	officeHours := &Group{PolicyOfficeHours: true, PolicyTimezone: null.StringFrom("UTC")}
+	assert.True(t, updatesAllowedAt(officeHours, time.Date(2020, 12, 7, 9, 0, 0, 0, time.UTC)))
+	assert.False(t, updatesAllowedAt(officeHours, time.Date(2020, 12, 7, 17, 0, 0, 0, time.UTC)))
+	assert.False(t, updatesAllowedAt(officeHours, time.Date(2020, 12, 6, 12, 0, 0, 0, time.UTC)))
+}
+
+func TestCronUpdateWindows(t *testing.T) {
+	var windows UpdateWindows
+	require.NoError(t, json.Unmarshal([]byte(`[{"name": "weekend", "cron": "30 22 * * fri", "duration": "36h"}]`), &windows))
+	require.NotNil(t, windows[0].schedule, "Cron windows are parsed when decoded")
+	group := &Group{PolicyTimezone: null.StringFrom("UTC"), PolicyUpdateWindows: windows}
+
+	// From Friday 2020-12-11 22:30 to Sunday 10:30.
+	assert.False(t, updatesAllowedAt(group, time.Date(2020, 12, 11, 22, 29, 0, 0, time.UTC)))
+	assert.True(t, updatesAllowedAt(group, time.Date(2020, 12, 11, 22, 30, 0, 0, time.UTC)))
+	assert.True(t, updatesAllowedAt(group, time.Date(2020, 12, 12, 23, 0, 0, 0, time.UTC)))
+	assert.True(t, updatesAllowedAt(group, time.Date(2020, 12, 13, 10, 29, 59, 0, time.UTC)))
+	assert.False(t, updatesAllowedAt(group, time.Date(2020, 12, 13, 10, 30, 0, 0, time.UTC)))
+	assert.False(t, updatesAllowedAt(group, time.Date(2020, 12, 16, 12, 0, 0, 0, time.UTC)))
+
+	// As in standard cron, a day of the week field like "*/1" is
+	// unrestricted, so only the first day of the month matches.
+	group.PolicyUpdateWindows = UpdateWindows{{Name: "monthly", Cron: "0 2 1 * */1", Duration: "1h"}}
+	assert.True(t, updatesAllowedAt(group, time.Date(2020, 12, 1, 2, 30, 0, 0, time.UTC)))
+	assert.False(t, updatesAllowedAt(group, time.Date(2020, 12, 2, 2, 30, 0, 0, time.UTC)))
+
+	// When both day fields are restricted, matching any of them is enough.
+	group.PolicyUpdateWindows = UpdateWindows{{Name: "monthly-or-mondays", Cron: "0 2 1 * mon", Duration: "1h"}}
+	assert.True(t, updatesAllowedAt(group, time.Date(2020, 12, 1, 2, 30, 0, 0, time.UTC)))
+	assert.True(t, updatesAllowedAt(group, time.Date(2020, 12, 7, 2, 30, 0, 0, time.UTC)))
+	assert.False(t, updatesAllowedAt(group, time.Date(2020, 12, 8, 2, 30, 0, 0, time.UTC)))
+}
+
+func TestValidateUpdateWindows(t *testing.T) {
+	valid := []UpdateWindow{
+		{Name: "w", Start: "09:00", End: "17:00"},
+		{Name: "w", Weekdays: []string{"Monday", "sun"}, Start: "22:00", End: "02:00"},
+		{Name: "w", Cron: "*/30 1-5,23 * * 1-5", Duration: "15m"},
+		{Name: "w", Cron: "0 0 1 * *", Duration: "168h"},
+	}
+	for _, w := range valid {
+		assert.NoError(t, validateUpdateWindows(&Group{PolicyUpdateWindows: UpdateWindows{w}}), w)
+	}
+
+	invalid := []UpdateWindow{
+		{Start: "09:00", End: "17:00"},
+		{Name: "w", Start: "09:00", End: "09:00"},
+		{Name: "w", Start: "9am", End: "17:00"},
+		{Name: "w", Weekdays: []string{"someday"}, Start: "09:00", End: "17:00"},
+		{Name: "w", Start: "09:00", End: "17:00", Duration: "1h"},
+		{Name: "w", Cron: "0 0 * *", Duration: "1h"},
+		{Name: "w", Cron: "60 0 * * *", Duration: "1h"},
+		{Name: "w", Cron: "0 0 * * *"},
+		{Name: "w", Cron: "0 0 * * *", Duration: "169h"},
+		{Name: "w", Cron: "0 0 * * *", Duration: "1h", Start: "09:00"},
+	}
+	for _, w := range invalid {
+		assert.Equal(t, ErrInvalidUpdateWindow, validateUpdateWindows(&Group{PolicyUpdateWindows: UpdateWindows{w}}), w)
+	}
+
+	duplicated := UpdateWindows{{Name: "w", Start: "09:00", End: "17:00"}, {Name: "w", Start: "18:00", End: "19:00"}}
+	assert.Equal(t, ErrInvalidUpdateWindow, validateUpdateWindows(&Group{PolicyUpdateWindows: duplicated}))
+
+	assert.NoError(t, validateUpdateWindows(&Group{PolicyBlackoutPeriods: BlackoutPeriods{{Name: "b", Start: "2020-12-24"}}}))
+	for _, b := range []BlackoutPeriod{
+		{Start: "2020-12-24"},
+		{Name: "b", Start: "24/12/2020"},
+		{Name: "b", Start: "2020-12-24", End: "2020-12-23"},
+	} {
+		assert.Equal(t, ErrInvalidBlackoutPeriod, validateUpdateWindows(&Group{PolicyBlackoutPeriods: BlackoutPeriods{b}}), b)
+	}
+}
@@ -1,10 +1,14 @@
 package api
 
 import (
+	"database/sql"
 	"errors"
-	"time"
+	"hash/fnv"
+	"strconv"
+	"strings"
 
 	"github.com/blang/semver/v4"
+	"gopkg.in/guregu/null.v4"
 )
 
 const (
@@ -52,11 +56,27 @@ var (
 	// ErrGrantingUpdate indicates that something went wrong while granting an
 	// update.
 	ErrGrantingUpdate = errors.New("nebraska: error granting update")
+
+	// ErrRolloutStepLimitReached indicates that the instance is not part of
+	// the share of the group's instances allowed to update in the current
+	// rollout step.
+	ErrRolloutStepLimitReached = errors.New("nebraska: rollout step limit reached")
 )
 
 // GetUpdatePackage returns an update package for the instance/application
 // provided. The instance details and the application it's running will be
 // registered in Nebraska (or updated if it's already registered).
+//
+// The instance override, if any, takes precedence over the group settings:
+// instances excluded from updates won't get any, instances pinned to a version
+// will get the package of that version (and won't go past it) and instances
+// moved to another group will be handled as members of that group.
+//
+// Instances running a version older than the minimum version of the group's
+// channel are first updated to the package of that version, a stepping stone
+// they must go through before getting the channel's package. Likewise,
+// instances older than the minimum from-version of the package they should
+// get are updated to an intermediate package first (see getIntermediatePackage).
 func (api *API) GetUpdatePackage(instanceID, instanceAlias, instanceIP, instanceVersion, appID, groupID string) (*Package, error) {
 	instance, err := api.RegisterInstance(instanceID, instanceAlias, instanceIP, instanceVersion, appID, groupID)
 	if err != nil {
@@ -74,7 +94,12 @@ func (api *API) GetUpdatePackage(instanceID, instanceAlias, instanceIP, instance
 		}
 	}
 
-	group, err := api.GetGroup(groupID)
+	override := instance.Application.Override
+	if override != nil && override.GroupID.Valid {
+		groupID = override.GroupID.String
+	}
+
+	group, err := api.getGroupForUpdate(groupID)
 	if err != nil {
 		return nil, err
 	}
@@ -86,7 +111,33 @@ func (api *API) GetUpdatePackage(instanceID, instanceAlias, instanceIP, instance
 		return nil, ErrNoPackageFound
 	}
 
-	for _, blacklistedChannelID := range group.Channel.Package.ChannelsBlacklist {
+	instanceSemver, _ := semver.Make(instanceVersion)
+
+	pkg := group.Channel.Package
+	if override != nil && override.PinnedVersion.Valid {
+		pkg, err = api.getPackageForUpdate(group.ApplicationID, override.PinnedVersion.String, group.Channel.Arch)
+		if err != nil {
+			logger.Error().Err(err).Str("instance", instanceID).Str("version", override.PinnedVersion.String).Msg("GetUpdatePackage - could not get pinned package (propagates as ErrNoPackageFound)")
+			return nil, ErrNoPackageFound
+		}
+	} else if minVersion := group.Channel.MinVersion.String; minVersion != "" {
+		minSemver, _ := semver.Make(minVersion)
+		channelSemver, _ := semver.Make(pkg.Version)
+		if instanceSemver.LT(minSemver) && minSemver.LT(channelSemver) {
+			pkg, err = api.getPackageForUpdate(group.ApplicationID, minVersion, group.Channel.Arch)
+			if err != nil {
+				logger.Error().Err(err).Str("instance", instanceID).Str("version", minVersion).Msg("GetUpdatePackage - could not get stepping stone package (propagates as ErrNoPackageFound)")
+				return nil, ErrNoPackageFound
+			}
+		}
+	}
+
+	if pkg, err = api.getIntermediatePackage(pkg, instanceSemver, group.Channel); err != nil {
+		logger.Error().Err(err).Str("instance", instanceID).Msg("GetUpdatePackage - could not get intermediate package (propagates as ErrNoPackageFound)")
+		return nil, ErrNoPackageFound
+	}
+
+	for _, blacklistedChannelID := range pkg.ChannelsBlacklist {
 		if blacklistedChannelID == group.Channel.ID {
 			if updateAlreadyGranted {
 				if err := api.updateInstanceObjStatus(instance, InstanceStatusComplete); err != nil {
@@ -97,8 +148,7 @@ func (api *API) GetUpdatePackage(instanceID, instanceAlias, instanceIP, instance
 		}
 	}
 
-	instanceSemver, _ := semver.Make(instanceVersion)
-	packageSemver, _ := semver.Make(group.Channel.Package.Version)
+	packageSemver, _ := semver.Make(pkg.Version)
 	if !instanceSemver.LT(packageSemver) {
 		if updateAlreadyGranted {
 			if err := api.updateInstanceObjStatus(instance, InstanceStatusComplete); err != nil {
@@ -108,20 +158,30 @@ func (api *API) GetUpdatePackage(instanceID, instanceAlias, instanceIP, instance
 		return nil, ErrNoUpdatePackageAvailable
 	}
 
+	if override != nil && override.NeverUpdate {
+		return nil, ErrUpdatesDisabled
+	}
+
 	if updateAlreadyGranted {
-		return group.Channel.Package, nil
+		return pkg, nil
 	}
 
 	if err := api.enforceRolloutPolicy(instance, group); err != nil {
 		return nil, err
 	}
 
-	version := group.Channel.Package.Version
+	version := pkg.Version
 
 	if err := api.grantUpdate(instance, version); err != nil {
 		logger.Error().Err(err).Msg("GetUpdatePackage - grantUpdate error (propagates as ErrGrantingUpdate):")
 	}
 
+	// Updates to a pinned version, to the channel's stepping stone or to an
+	// intermediate package are not part of the group's rollout.
+	if pkg != group.Channel.Package {
+		return pkg, nil
+	}
+
 	if !api.hasRecentActivity(activityRolloutStarted, ActivityQueryParams{Severity: activityInfo, AppID: appID, Version: version, GroupID: group.ID}) {
 		if err := api.newGroupActivityEntry(activityRolloutStarted, activityInfo, version, appID, group.ID); err != nil {
 			logger.Error().Err(err).Msg("GetUpdatePackage - could not add new group activity entry")
@@ -134,7 +194,64 @@ func (api *API) GetUpdatePackage(instanceID, instanceAlias, instanceIP, instance
 		}
 	}
 
-	return group.Channel.Package, nil
+	return pkg, nil
+}
+
+// getIntermediatePackage returns the package an instance running the version
+// provided has to be updated to on its way to the target package. That's the
+// target package itself, unless the instance is older than its minimum
+// from-version (see findIntermediatePackage).
+func (api *API) getIntermediatePackage(target *Package, instanceSemver semver.Version, channel *Channel) (*Package, error) {
+	if target.MinFromVersion.String == "" {
+		return target, nil
+	}
+	minFromSemver, err := semver.Make(target.MinFromVersion.String)
+	if err != nil {
+		return nil, err
+	}
+	if !instanceSemver.LT(minFromSemver) {
+		return target, nil
+	}
+
+	versions, err := api.getPackageVersions(target.ApplicationID, target.Arch, channel.ID)
+	if err != nil {
+		return nil, err
+	}
+	targetSemver, err := semver.Make(target.Version)
+	if err != nil {
+		return nil, err
+	}
+	intermediate := findIntermediatePackage(versions, &packageVersion{ID: target.ID, Version: targetSemver, MinFromVersion: minFromSemver}, instanceSemver)
+	if intermediate == nil {
+		return nil, sql.ErrNoRows
+	}
+	return api.getPackage(null.StringFrom(intermediate.ID))
+}
+
+// findIntermediatePackage returns the package an instance running the version
+// provided has to be updated to on its way to the target package, or nil if
+// there isn't a suitable one.
+//
+// When the instance is older than the minimum from-version of the target, it
+// must first get the highest package that is not older than that version (but
+// older than the target). The same applies to that intermediate package in
+// turn, so the instance ends up getting the highest mandatory intermediate
+// package it can be updated to directly.
+func findIntermediatePackage(versions []*packageVersion, target *packageVersion, instanceSemver semver.Version) *packageVersion {
+	for instanceSemver.LT(target.MinFromVersion) {
+		var highest *packageVersion
+		for _, v := range versions {
+			if v.Version.GTE(target.MinFromVersion) && v.Version.LT(target.Version) &&
+				(highest == nil || v.Version.GT(highest.Version)) {
+				highest = v
+			}
+		}
+		if highest == nil {
+			return nil
+		}
+		target = highest
+	}
+	return target
 }
 
 // enforceRolloutPolicy validates if an update should be provided to the
@@ -147,10 +264,16 @@ func (api *API) enforceRolloutPolicy(instance *Instance, group *Group) error {
 		return ErrUpdatesDisabled
 	}
 
-	if group.PolicyOfficeHours && !inOfficeHoursNow(group.PolicyTimezone.String) {
+	if !updatesAllowedNow(group) {
 		return ErrUpdatesDisabled
 	}
 
+	if group.PolicyRolloutSteps != "" {
+		if err := api.enforceRolloutSteps(instance, group); err != nil {
+			return err
+		}
+	}
+
 	effectiveMaxUpdates := group.PolicyMaxUpdatesPerPeriod
 
 	// If no policy enforcement is needed, then we skip getting the update stats below.
@@ -197,36 +320,107 @@ func (api *API) enforceRolloutPolicy(instance *Instance, group *Group) error {
 	return nil
 }
 
-// grantUpdate grants an update for the provided instance in the context of the
-// given application.
-func (api *API) grantUpdate(instance *Instance, version string) error {
-	instanceData := make(map[string]interface{})
-	instanceData["last_update_granted_ts"] = nowUTC()
-	instanceData["last_update_version"] = version
-	instanceData["status"] = InstanceStatusUpdateGranted
-	instanceData["update_in_progress"] = true
+// enforceRolloutSteps checks if the instance provided belongs to the share of
+// the group's instances that can be updated in the current rollout step,
+// advancing the rollout to the next step when its interval has elapsed or its
+// health threshold has been met. Rollouts start again from the first step
+// whenever the version in the group's channel changes.
+func (api *API) enforceRolloutSteps(instance *Instance, group *Group) error {
+	steps, err := parseRolloutSteps(group.PolicyRolloutSteps)
+	if err != nil {
+		return err
+	}
+	version := group.Channel.Package.Version
 
-	return api.updateInstanceData(instance, instanceData)
+	step := group.RolloutStep
+	if group.RolloutStepVersion != version {
+		step = 0
+		if err := api.setGroupRolloutStep(group.ID, step, version); err != nil {
+			logger.Error().Err(err).Msg("enforceRolloutSteps - could not reset rollout step")
+		}
+	} else if step < len(steps)-1 {
+		advanced, err := api.maybeAdvanceRolloutStep(group, step)
+		if err != nil {
+			logger.Error().Err(err).Msg("enforceRolloutSteps - could not advance rollout step")
+		}
+		if advanced {
+			step++
+		}
+	}
+	if step >= len(steps) {
+		step = len(steps) - 1
+	}
+
+	if instanceRolloutBucket(instance.ID) >= steps[step] {
+		if err := api.updateInstanceStatus(instance.ID, instance.Application.ApplicationID, InstanceStatusOnHold); err != nil {
+			logger.Error().Err(err).Msg("enforceRolloutSteps - could not update instance status")
+		}
+		return ErrRolloutStepLimitReached
+	}
+
+	return nil
 }
 
-// inOfficeHoursNow checks if the provided timezone is now in office hours.
-func inOfficeHoursNow(tz string) bool {
-	if tz == "" {
-		return false
+// maybeAdvanceRolloutStep advances the group's rollout past the step provided
+// if the step interval has elapsed or if the share of successful updates
+// granted during the step has reached the step health threshold.
+func (api *API) maybeAdvanceRolloutStep(group *Group, step int) (bool, error) {
+	if group.PolicyRolloutStepHealthThreshold > 0 && group.RolloutStepStartedTs.Valid {
+		stats, err := api.getGroupRolloutStepStats(group)
+		if err != nil {
+			return false, err
+		}
+		if stats.UpdatesGranted > 0 && stats.UpdatesSucceeded*100 >= stats.UpdatesGranted*group.PolicyRolloutStepHealthThreshold {
+			return api.advanceGroupRolloutStep(group.ID, step, "")
+		}
 	}
 
-	location, err := time.LoadLocation(tz)
-	if err != nil {
-		return false
+	if group.PolicyRolloutStepInterval != "" {
+		return api.advanceGroupRolloutStep(group.ID, step, group.PolicyRolloutStepInterval)
 	}
 
-	now := time.Now().In(location)
-	if now.Weekday() == time.Saturday || now.Weekday() == time.Sunday {
-		return false
+	return false, nil
+}
+
+// parseRolloutSteps parses a comma separated list of rollout step percentages.
+// The percentages must be strictly increasing and between 1 and 100.
+func parseRolloutSteps(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
 	}
-	if now.Hour() < 9 || now.Hour() >= 17 {
-		return false
+
+	var steps []int
+	for _, field := range strings.Split(s, ",") {
+		percentage, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || percentage < 1 || percentage > 100 {
+			return nil, ErrInvalidRolloutSteps
+		}
+		if len(steps) > 0 && percentage <= steps[len(steps)-1] {
+			return nil, ErrInvalidRolloutSteps
+		}
+		steps = append(steps, percentage)
 	}
 
-	return true
+	return steps, nil
+}
+
+// instanceRolloutBucket deterministically maps the instance id provided to a
+// bucket in the [0, 100) range, so that the same instances always make up the
+// share of a group updated in a given rollout step.
+func instanceRolloutBucket(instanceID string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(instanceID))
+	return int(h.Sum32() % 100)
+}
+
+// grantUpdate grants an update for the provided instance in the context of the
+// given application.
+func (api *API) grantUpdate(instance *Instance, version string) error {
+	instanceData := make(map[string]interface{})
+	instanceData["last_update_granted_ts"] = nowUTC()
+	instanceData["last_update_version"] = version
+	instanceData["status"] = InstanceStatusUpdateGranted
+	instanceData["update_in_progress"] = true
+
+	return api.updateInstanceData(instance, instanceData)
 }
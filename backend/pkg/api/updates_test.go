@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/blang/semver/v4"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/guregu/null.v4"
@@ -370,3 +371,269 @@ func TestGetUpdatePackage_InstanceStatusHistory(t *testing.T) {
 	assert.Equal(t, InstanceStatusUpdateGranted, instanceStatusHistory[2].Status)
 	assert.Equal(t, tPkg.Version, instanceStatusHistory[2].Version)
 }
+
+func TestGetUpdatePackage_InstanceOverrides(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tPkg1, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.0.0", ApplicationID: tApp.ID})
+	tPkg2, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.1.0", ApplicationID: tApp.ID})
+	tPkg3, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "13.0.0", ApplicationID: tApp.ID})
+	tChannel, _ := a.AddChannel(&Channel{Name: "test_channel", Color: "blue", ApplicationID: tApp.ID, PackageID: null.StringFrom(tPkg2.ID)})
+	tChannel2, _ := a.AddChannel(&Channel{Name: "test_channel2", Color: "green", ApplicationID: tApp.ID, PackageID: null.StringFrom(tPkg3.ID)})
+	tGroup, _ := a.AddGroup(&Group{Name: "group", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: false, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 10, PolicyUpdateTimeout: "60 minutes"})
+	tGroup2, _ := a.AddGroup(&Group{Name: "group2", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel2.ID), PolicyUpdatesEnabled: true, PolicySafeMode: false, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 10, PolicyUpdateTimeout: "60 minutes"})
+
+	tInstance1, _ := a.RegisterInstance(uuid.New().String(), "", "10.0.0.1", "1.0.0", tApp.ID, tGroup.ID)
+	tInstance2, _ := a.RegisterInstance(uuid.New().String(), "", "10.0.0.2", "1.0.0", tApp.ID, tGroup.ID)
+	tInstance3, _ := a.RegisterInstance(uuid.New().String(), "", "10.0.0.3", "1.0.0", tApp.ID, tGroup.ID)
+
+	_, err := a.SetInstanceOverride(&InstanceOverride{InstanceID: tInstance1.ID, ApplicationID: tApp.ID, NeverUpdate: true})
+	assert.NoError(t, err)
+	_, err = a.GetUpdatePackage(tInstance1.ID, "", "10.0.0.1", "1.0.0", tApp.ID, tGroup.ID)
+	assert.Equal(t, ErrUpdatesDisabled, err, "Instance excluded from updates.")
+
+	// Instances excluded after being granted an update keep their status.
+	tInstance4, _ := a.RegisterInstance(uuid.New().String(), "", "10.0.0.4", "1.0.0", tApp.ID, tGroup.ID)
+	_, err = a.GetUpdatePackage(tInstance4.ID, "", "10.0.0.4", "1.0.0", tApp.ID, tGroup.ID)
+	assert.NoError(t, err)
+	_, err = a.SetInstanceOverride(&InstanceOverride{InstanceID: tInstance4.ID, ApplicationID: tApp.ID, NeverUpdate: true})
+	assert.NoError(t, err)
+	_, err = a.GetUpdatePackage(tInstance4.ID, "", "10.0.0.4", "1.0.0", tApp.ID, tGroup.ID)
+	assert.Equal(t, ErrUpdatesDisabled, err)
+	instance, err := a.GetInstance(tInstance4.ID, tApp.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, null.IntFrom(int64(InstanceStatusUpdateGranted)), instance.Application.Status)
+
+	_, err = a.SetInstanceOverride(&InstanceOverride{InstanceID: tInstance2.ID, ApplicationID: tApp.ID, PinnedVersion: null.StringFrom(tPkg1.Version)})
+	assert.NoError(t, err)
+	pkg, err := a.GetUpdatePackage(tInstance2.ID, "", "10.0.0.2", "1.0.0", tApp.ID, tGroup.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tPkg1.ID, pkg.ID, "Instance pinned to an older version than the channel's.")
+	_ = a.RegisterEvent(tInstance2.ID, tApp.ID, tGroup.ID, EventUpdateComplete, ResultSuccessReboot, "", "")
+	_, err = a.GetUpdatePackage(tInstance2.ID, "", "10.0.0.2", tPkg1.Version, tApp.ID, tGroup.ID)
+	assert.Equal(t, ErrNoUpdatePackageAvailable, err, "Instance already running the pinned version.")
+
+	_, err = a.SetInstanceOverride(&InstanceOverride{InstanceID: tInstance2.ID, ApplicationID: tApp.ID, PinnedVersion: null.StringFrom("12.5.0")})
+	assert.NoError(t, err)
+	_, err = a.GetUpdatePackage(tInstance2.ID, "", "10.0.0.2", tPkg1.Version, tApp.ID, tGroup.ID)
+	assert.Equal(t, ErrNoPackageFound, err, "No package for the pinned version.")
+
+	_, err = a.SetInstanceOverride(&InstanceOverride{InstanceID: tInstance3.ID, ApplicationID: tApp.ID, GroupID: null.StringFrom(tGroup2.ID)})
+	assert.NoError(t, err)
+	pkg, err = a.GetUpdatePackage(tInstance3.ID, "", "10.0.0.3", "1.0.0", tApp.ID, tGroup.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tPkg3.ID, pkg.ID, "Instance moved to another group.")
+	instance, err = a.GetInstance(tInstance3.ID, tApp.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tGroup2.ID, instance.Application.GroupID.String)
+
+	err = a.DeleteInstanceOverride(tInstance1.ID, tApp.ID)
+	assert.NoError(t, err)
+	pkg, err = a.GetUpdatePackage(tInstance1.ID, "", "10.0.0.1", "1.0.0", tApp.ID, tGroup.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tPkg2.ID, pkg.ID, "Override removed.")
+}
+
+func TestGetUpdatePackage_ChannelMinVersion(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tPkg1, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "3000.0.0", ApplicationID: tApp.ID})
+	tPkg2, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "3100.1.0", ApplicationID: tApp.ID})
+	tChannel, _ := a.AddChannel(&Channel{Name: "test_channel", Color: "blue", ApplicationID: tApp.ID, VersionConstraint: null.StringFrom("~3100"), MinVersion: null.StringFrom(tPkg1.Version)})
+	tGroup, _ := a.AddGroup(&Group{Name: "group", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: false, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 10, PolicyUpdateTimeout: "60 minutes"})
+
+	instanceID := uuid.New().String()
+
+	pkg, err := a.GetUpdatePackage(instanceID, "", "10.0.0.1", "2900.0.0", tApp.ID, tGroup.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tPkg1.ID, pkg.ID, "Instances below the min version get the stepping stone first.")
+
+	pkg, err = a.GetUpdatePackage(instanceID, "", "10.0.0.1", "2900.0.0", tApp.ID, tGroup.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tPkg1.ID, pkg.ID, "Update already granted.")
+
+	_ = a.RegisterEvent(instanceID, tApp.ID, tGroup.ID, EventUpdateComplete, ResultSuccessReboot, "2900.0.0", "")
+
+	pkg, err = a.GetUpdatePackage(instanceID, "", "10.0.0.1", tPkg1.Version, tApp.ID, tGroup.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tPkg2.ID, pkg.ID, "Instances at the min version get the channel's package.")
+
+	pkg, err = a.GetUpdatePackage(uuid.New().String(), "", "10.0.0.2", "3050.0.0", tApp.ID, tGroup.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tPkg2.ID, pkg.ID, "Instances above the min version get the channel's package.")
+}
+
+func TestGetUpdatePackage_IntermediatePackage(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+
+	_, err := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "2.0.0", ApplicationID: tApp.ID, MinFromVersion: null.StringFrom("2.0.0")})
+	assert.Equal(t, ErrInvalidMinFromVersion, err, "Min from version must be older than the package version.")
+
+	_, err = a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "2.0.0", ApplicationID: tApp.ID, MinFromVersion: null.StringFrom("1.x")})
+	assert.Equal(t, ErrInvalidMinFromVersion, err, "Min from version must be a valid semver.")
+
+	tPkg1, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "2.0.0", ApplicationID: tApp.ID})
+	tPkg2, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "3.0.0", ApplicationID: tApp.ID, MinFromVersion: null.StringFrom("2.0.0")})
+	tPkg3, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "4.0.0", ApplicationID: tApp.ID, MinFromVersion: null.StringFrom("3.0.0")})
+	tChannel, _ := a.AddChannel(&Channel{Name: "test_channel", Color: "blue", ApplicationID: tApp.ID, PackageID: null.StringFrom(tPkg3.ID)})
+	tGroup, _ := a.AddGroup(&Group{Name: "group", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: false, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 10, PolicyUpdateTimeout: "60 minutes"})
+
+	pkg, err := a.GetUpdatePackage(uuid.New().String(), "", "10.0.0.1", "1.0.0", tApp.ID, tGroup.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tPkg1.ID, pkg.ID, "Highest mandatory intermediate package the instance can update to.")
+
+	pkg, err = a.GetUpdatePackage(uuid.New().String(), "", "10.0.0.2", "2.5.0", tApp.ID, tGroup.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tPkg2.ID, pkg.ID)
+
+	pkg, err = a.GetUpdatePackage(uuid.New().String(), "", "10.0.0.3", "3.0.0", tApp.ID, tGroup.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tPkg3.ID, pkg.ID)
+
+	tPkg1.ChannelsBlacklist = []string{tChannel.ID}
+	err = a.UpdatePackage(tPkg1)
+	assert.NoError(t, err)
+	_, err = a.GetUpdatePackage(uuid.New().String(), "", "10.0.0.4", "1.0.0", tApp.ID, tGroup.ID)
+	assert.Equal(t, ErrNoPackageFound, err, "Intermediate packages blacklisting the channel can't be used.")
+}
+
+func TestGetUpdatePackage_RolloutSteps(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tPkg, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.1.0", ApplicationID: tApp.ID})
+	tChannel, _ := a.AddChannel(&Channel{Name: "test_channel", Color: "blue", ApplicationID: tApp.ID, PackageID: null.StringFrom(tPkg.ID)})
+	tGroup, _ := a.AddGroup(&Group{Name: "group", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: false, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 100, PolicyUpdateTimeout: "60 minutes", PolicyRolloutSteps: "50,100"})
+
+	var canaryID, restID string
+	for canaryID == "" || restID == "" {
+		id := uuid.New().String()
+		if instanceRolloutBucket(id) < 50 {
+			canaryID = id
+		} else {
+			restID = id
+		}
+	}
+
+	_, err := a.GetUpdatePackage(restID, "", "10.0.0.1", "12.0.0", tApp.ID, tGroup.ID)
+	assert.Equal(t, ErrRolloutStepLimitReached, err)
+
+	_, err = a.GetUpdatePackage(canaryID, "", "10.0.0.2", "12.0.0", tApp.ID, tGroup.ID)
+	assert.NoError(t, err)
+
+	group, _ := a.GetGroup(tGroup.ID)
+	assert.Equal(t, 0, group.RolloutStep)
+	assert.Equal(t, tPkg.Version, group.RolloutStepVersion)
+
+	advanced, err := a.advanceGroupRolloutStep(tGroup.ID, 0, "")
+	assert.NoError(t, err)
+	assert.True(t, advanced)
+
+	_, err = a.GetUpdatePackage(restID, "", "10.0.0.1", "12.0.0", tApp.ID, tGroup.ID)
+	assert.NoError(t, err)
+}
+
+func TestGetUpdatePackage_RolloutStepsHealthThreshold(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	tTeam, _ := a.AddTeam(&Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&Application{Name: "test_app", TeamID: tTeam.ID})
+	tPkg, _ := a.AddPackage(&Package{Type: PkgTypeOther, URL: "http://sample.url/pkg", Version: "12.1.0", ApplicationID: tApp.ID})
+	tChannel, _ := a.AddChannel(&Channel{Name: "test_channel", Color: "blue", ApplicationID: tApp.ID, PackageID: null.StringFrom(tPkg.ID)})
+	tGroup, _ := a.AddGroup(&Group{Name: "group", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: false, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 100, PolicyUpdateTimeout: "60 minutes", PolicyRolloutSteps: "50,100", PolicyRolloutStepHealthThreshold: 100})
+
+	var canaryID, restID string
+	for canaryID == "" || restID == "" {
+		id := uuid.New().String()
+		if instanceRolloutBucket(id) < 50 {
+			canaryID = id
+		} else {
+			restID = id
+		}
+	}
+
+	_, err := a.GetUpdatePackage(canaryID, "", "10.0.0.1", "12.0.0", tApp.ID, tGroup.ID)
+	assert.NoError(t, err)
+
+	_, err = a.GetUpdatePackage(restID, "", "10.0.0.2", "12.0.0", tApp.ID, tGroup.ID)
+	assert.Equal(t, ErrRolloutStepLimitReached, err, "Canary update hasn't completed yet.")
+
+	_ = a.RegisterEvent(canaryID, tApp.ID, tGroup.ID, EventUpdateComplete, ResultSuccessReboot, "", "")
+
+	_, err = a.GetUpdatePackage(restID, "", "10.0.0.2", "12.0.0", tApp.ID, tGroup.ID)
+	assert.NoError(t, err)
+
+	group, _ := a.GetGroup(tGroup.ID)
+	assert.Equal(t, 1, group.RolloutStep)
+}
+
+func TestParseRolloutSteps(t *testing.T) {
+	steps, err := parseRolloutSteps("5, 25,100")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{5, 25, 100}, steps)
+
+	steps, err = parseRolloutSteps("")
+	assert.NoError(t, err)
+	assert.Nil(t, steps)
+
+	for _, s := range []string{"0,100", "5,101", "25,5", "5,5", "5,,100", "abc"} {
+		_, err = parseRolloutSteps(s)
+		assert.Equal(t, ErrInvalidRolloutSteps, err, s)
+	}
+}
+
+func TestInstanceRolloutBucket(t *testing.T) {
+	instanceID := uuid.New().String()
+	bucket := instanceRolloutBucket(instanceID)
+	assert.True(t, bucket >= 0 && bucket < 100)
+	assert.Equal(t, bucket, instanceRolloutBucket(instanceID))
+}
+
+func TestFindIntermediatePackage(t *testing.T) {
+	newVersion := func(id, version, minFromVersion string) *packageVersion {
+		v := &packageVersion{ID: id, Version: semver.MustParse(version)}
+		if minFromVersion != "" {
+			v.MinFromVersion = semver.MustParse(minFromVersion)
+		}
+		return v
+	}
+	versions := []*packageVersion{
+		newVersion("1.0", "1.0.0", ""),
+		newVersion("2.0", "2.0.0", ""),
+		newVersion("2.1", "2.1.0", ""),
+		newVersion("3.0", "3.0.0", "2.0.0"),
+		newVersion("3.1", "3.1.0", "2.0.0"),
+		newVersion("4.0", "4.0.0", "3.0.0"),
+	}
+	target := versions[5]
+
+	for _, tt := range []struct {
+		instanceVersion string
+		expected        string
+	}{
+		{"3.0.0", "4.0"},
+		{"2.1.0", "3.1"},
+		{"1.0.0", "2.1"},
+		{"0.1.0", "2.1"},
+	} {
+		intermediate := findIntermediatePackage(versions, target, semver.MustParse(tt.instanceVersion))
+		if assert.NotNil(t, intermediate, tt.instanceVersion) {
+			assert.Equal(t, tt.expected, intermediate.ID, tt.instanceVersion)
+		}
+	}
+
+	assert.Nil(t, findIntermediatePackage(versions[3:], target, semver.MustParse("1.0.0")), "No package satisfying the 3.x min from version.")
+}
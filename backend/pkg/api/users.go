@@ -1,10 +1,9 @@
 package api
 
 import (
-	"crypto/md5"
+	"database/sql"
 	"errors"
-	"fmt"
-	"io"
+	"sync"
 	"time"
 
 	"github.com/doug-martin/goqu/v9"
@@ -13,19 +12,38 @@ import (
 const (
 	// Realm used for basic authentication.
 	Realm = "nebraska"
+
+	// MinPasswordLength is the minimum length of the passwords of the
+	// users.
+	MinPasswordLength = 8
 )
 
 var (
 	// ErrUpdatingPassword indicates that something went wrong while updating
 	// the user's password.
 	ErrUpdatingPassword = errors.New("nebraska: error updating password")
+
+	// ErrInvalidCredentials indicates that the user doesn't exist or the
+	// password provided doesn't match the one stored.
+	ErrInvalidCredentials = errors.New("nebraska: invalid credentials")
+
+	// ErrPasswordTooShort indicates that the password provided is shorter
+	// than MinPasswordLength.
+	ErrPasswordTooShort = errors.New("nebraska: password too short")
+)
+
+var (
+	// dummyUserSecret is checked against the passwords of unknown users,
+	// so they take as long to be rejected as the ones of existing users.
+	dummyUserSecret     string
+	dummyUserSecretOnce sync.Once
 )
 
 // User represents a Nebraska user.
 type User struct {
 	ID        string    `db:"id" json:"id"`
 	Username  string    `db:"username" json:"username"`
-	Secret    string    `db:"secret" json:"secret"`
+	Secret    string    `db:"secret" json:"-"`
 	CreatedTs time.Time `db:"created_ts" json:"-"`
 	TeamID    string    `db:"team_id" json:"team_id"`
 }
@@ -93,13 +111,26 @@ func (api *API) GetUsersInTeam(teamID string) ([]*User, error) {
 
 // UpdateUserPassword updates the password of the provided user.
 func (api *API) UpdateUserPassword(username, newPassword string) error {
-	secret, err := api.GenerateUserSecret(username, newPassword)
+	if len(newPassword) < MinPasswordLength {
+		return ErrPasswordTooShort
+	}
+	secret, err := HashPassword(newPassword)
 	if err != nil {
 		return err
 	}
+	return api.updateUserSecret(username, secret, "")
+}
+
+// updateUserSecret replaces the secret of the user provided. When oldSecret
+// is not empty, the secret is only replaced if it hasn't changed meanwhile.
+func (api *API) updateUserSecret(username, secret, oldSecret string) error {
+	where := goqu.Ex{"username": username}
+	if oldSecret != "" {
+		where["secret"] = oldSecret
+	}
 	query, _, err := goqu.Update("users").
 		Set(goqu.Record{"secret": secret}).
-		Where(goqu.C("username").Eq(username)).
+		Where(where).
 		ToSQL()
 	if err != nil {
 		return err
@@ -119,13 +150,90 @@ func (api *API) UpdateUserPassword(username, newPassword string) error {
 	return nil
 }
 
-// GenerateUserSecret generates a md5 hash from the username and password
-// provided (username:realm:password).
-func (api *API) GenerateUserSecret(username, password string) (string, error) {
-	h := md5.New()
-	if _, err := io.WriteString(h, username+":"+Realm+":"+password); err != nil {
-		return "", err
+// AuthenticateUser returns the user identified by the username provided if
+// the password matches the one stored. Secrets in a legacy format or hashed
+// with outdated parameters are replaced by a new hash of the password.
+func (api *API) AuthenticateUser(username, password string) (*User, error) {
+	user, err := api.GetUser(username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			dummyUserSecretOnce.Do(func() {
+				dummyUserSecret, _ = HashPassword(Realm)
+			})
+			_, _, _ = checkPassword(username, password, dummyUserSecret)
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	ok, rehash, err := checkPassword(username, password, user.Secret)
+	if err != nil {
+		logger.Error().Err(err).Str("username", username).Msg("AuthenticateUser - checking password")
+		return nil, ErrInvalidCredentials
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if rehash {
+		secret, err := HashPassword(password)
+		if err == nil {
+			err = api.updateUserSecret(username, secret, user.Secret)
+		}
+		if err != nil {
+			logger.Error().Err(err).Str("username", username).Msg("AuthenticateUser - rehashing password")
+		} else {
+			user.Secret = secret
+		}
+	}
+	return user, nil
+}
+
+// UpgradeLegacyUserSecrets hashes with argon2id the legacy md5 secrets of the
+// users who haven't logged in since passwords are hashed, so no md5 digest
+// is kept in the database. It returns the number of secrets upgraded.
+func (api *API) UpgradeLegacyUserSecrets() (int, error) {
+	query, _, err := goqu.From("users").
+		Select("username", "secret").
+		Where(goqu.C("secret").NotLike("$%")).
+		ToSQL()
+	if err != nil {
+		return 0, err
 	}
+	rows, err := api.db.Queryx(query)
+	if err != nil {
+		return 0, err
+	}
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := rows.StructScan(&user); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, err
+	}
+	rows.Close()
 
-	return fmt.Sprintf("%x", h.Sum(nil)), nil
+	upgraded := 0
+	for _, user := range users {
+		if !isLegacyUserSecret(user.Secret) {
+			continue
+		}
+		secret, err := wrapLegacyUserSecret(user.Secret)
+		if err != nil {
+			return upgraded, err
+		}
+		switch err := api.updateUserSecret(user.Username, secret, user.Secret); err {
+		case nil:
+			upgraded++
+		case ErrUpdatingPassword:
+			// The user logged in or changed the password meanwhile.
+		default:
+			return upgraded, err
+		}
+	}
+	return upgraded, nil
 }
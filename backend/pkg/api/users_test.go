@@ -1,9 +1,12 @@
 package api
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
 )
 
 const (
@@ -31,6 +34,9 @@ func TestUpdateUserPassword(t *testing.T) {
 	err := a.UpdateUserPassword("non-existent", "new-password")
 	assert.Error(t, err)
 
+	err = a.UpdateUserPassword("admin", "short")
+	assert.Equal(t, ErrPasswordTooShort, err)
+
 	err = a.UpdateUserPassword("admin", "new-password")
 	assert.NoError(t, err)
 
@@ -39,5 +45,104 @@ func TestUpdateUserPassword(t *testing.T) {
 	assert.Equal(t, "admin", user.Username)
 	assert.Equal(t, defaultTeamID, user.TeamID)
 	assert.NotEqual(t, "8b31292d4778582c0e5fa96aee5513f1", user.Secret)
-	assert.Equal(t, "c01e8daa7a6c135909f218ff2bea1cfe", user.Secret)
+	assert.True(t, strings.HasPrefix(user.Secret, "$argon2id$"))
+
+	_, err = a.AuthenticateUser("admin", "admin")
+	assert.Equal(t, ErrInvalidCredentials, err)
+	_, err = a.AuthenticateUser("admin", "new-password")
+	assert.NoError(t, err)
+}
+
+func TestAuthenticateUser(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	_, err := a.AuthenticateUser("non-existent", "admin")
+	assert.Equal(t, ErrInvalidCredentials, err)
+	_, err = a.AuthenticateUser("admin", "wrong")
+	assert.Equal(t, ErrInvalidCredentials, err)
+
+	// The legacy md5 secret is replaced by an argon2id hash on login.
+	user, err := a.AuthenticateUser("admin", "admin")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Secret, "$argon2id$"))
+	user, err = a.GetUser("admin")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Secret, "$argon2id$"))
+
+	_, err = a.AuthenticateUser("admin", "admin")
+	assert.NoError(t, err)
+}
+
+func TestUpgradeLegacyUserSecrets(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+
+	upgraded, err := a.UpgradeLegacyUserSecrets()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, upgraded)
+
+	user, err := a.GetUser("admin")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Secret, "$md5+argon2id$"))
+
+	upgraded, err = a.UpgradeLegacyUserSecrets()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, upgraded)
+
+	// The password itself is hashed on the next login.
+	_, err = a.AuthenticateUser("admin", "wrong")
+	assert.Equal(t, ErrInvalidCredentials, err)
+	user, err = a.AuthenticateUser("admin", "admin")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Secret, "$argon2id$"))
+}
+
+func TestCheckPassword(t *testing.T) {
+	secret, err := HashPassword("s3cr3t")
+	require.NoError(t, err)
+	assert.NotEqual(t, secret, mustHashPassword(t, "s3cr3t"), "Hashes must be salted.")
+
+	ok, rehash, err := checkPassword("alice", "s3cr3t", secret)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	ok, _, err = checkPassword("alice", "other", secret)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	legacy := legacyUserSecret("alice", "s3cr3t")
+	ok, rehash, err = checkPassword("alice", "s3cr3t", legacy)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	wrapped, err := wrapLegacyUserSecret(legacy)
+	require.NoError(t, err)
+	ok, rehash, err = checkPassword("alice", "s3cr3t", wrapped)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+	ok, _, _ = checkPassword("bob", "s3cr3t", wrapped)
+	assert.False(t, ok)
+
+	// Hashes made with other parameters are verified but flagged.
+	weak := &argon2Hash{scheme: argon2Scheme, memory: 1024, time: 1, threads: 1, salt: []byte("0123456789abcdef")}
+	weak.key = argon2.IDKey([]byte("s3cr3t"), weak.salt, weak.time, weak.memory, weak.threads, argon2KeyLen)
+	ok, rehash, err = checkPassword("alice", "s3cr3t", weak.String())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	for _, invalid := range []string{"", "reset-required", "$2a$10$abc", "$argon2id$v=19$m=1,t=1,p=1$!!$!!"} {
+		_, _, err = checkPassword("alice", "s3cr3t", invalid)
+		assert.Equal(t, ErrInvalidPasswordHash, err, invalid)
+	}
+}
+
+func mustHashPassword(t *testing.T, password string) string {
+	secret, err := HashPassword(password)
+	require.NoError(t, err)
+	return secret
 }
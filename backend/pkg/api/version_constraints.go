@@ -0,0 +1,84 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver/v4"
+)
+
+var (
+	// ErrInvalidVersionConstraint indicates that the version constraint of a
+	// channel could not be parsed, or that the channel also points to a
+	// specific package.
+	ErrInvalidVersionConstraint = errors.New("nebraska: invalid version constraint")
+)
+
+// parseVersionConstraint parses the version constraint of a channel. It uses
+// the syntax of blang/semver ranges (e.g. ">=3100.0.0 <3200.0.0", "3100.x" or
+// "<3000.0.0 || >=3033.2.0"), extended with the tilde and caret operators:
+// "~3100.1" matches any 3100.1.x version and "^3100.1.2" any version of the
+// 3100 major release from 3100.1.2 on.
+func parseVersionConstraint(constraint string) (semver.Range, error) {
+	fields := strings.Fields(constraint)
+	if len(fields) == 0 {
+		return nil, ErrInvalidVersionConstraint
+	}
+	expanded := make([]string, 0, len(fields))
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if (field == "~" || field == "^") && i+1 < len(fields) {
+			i++
+			field += fields[i]
+		}
+		if strings.HasPrefix(field, "~") || strings.HasPrefix(field, "^") {
+			comparisons, err := expandVersionConstraintOperator(field[:1], field[1:])
+			if err != nil {
+				return nil, err
+			}
+			field = comparisons
+		}
+		expanded = append(expanded, field)
+	}
+
+	versionRange, err := semver.ParseRange(strings.Join(expanded, " "))
+	if err != nil {
+		return nil, ErrInvalidVersionConstraint
+	}
+	return versionRange, nil
+}
+
+// expandVersionConstraintOperator returns the range comparisons equivalent to
+// the tilde or caret operator applied to the (possibly partial) version
+// provided, following the npm semantics for them.
+func expandVersionConstraintOperator(operator, version string) (string, error) {
+	parts := strings.Split(version, ".")
+	if len(parts) > 3 {
+		return "", ErrInvalidVersionConstraint
+	}
+	var numbers [3]uint64
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return "", ErrInvalidVersionConstraint
+		}
+		numbers[i] = n
+	}
+
+	lower := semver.Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}
+	upper := semver.Version{Major: lower.Major + 1}
+	switch {
+	case operator == "~" && len(parts) > 1:
+		upper = semver.Version{Major: lower.Major, Minor: lower.Minor + 1}
+	case operator == "^" && lower.Major == 0 && len(parts) > 1:
+		if lower.Minor > 0 || len(parts) == 2 {
+			upper = semver.Version{Minor: lower.Minor + 1}
+		} else {
+			upper = semver.Version{Patch: lower.Patch + 1}
+		}
+	}
+
+	return fmt.Sprintf(">=%s <%s", lower, upper), nil
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/blang/semver/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersionConstraint(t *testing.T) {
+	for _, tt := range []struct {
+		constraint string
+		matching   []string
+		other      []string
+	}{
+		{
+			constraint: ">=3100.0.0 <3200.0.0",
+			matching:   []string{"3100.0.0", "3139.2.1"},
+			other:      []string{"3033.2.4", "3200.0.0"},
+		},
+		{
+			constraint: "3100.x",
+			matching:   []string{"3100.0.0", "3100.9.3"},
+			other:      []string{"3101.0.0", "3099.1.0"},
+		},
+		{
+			constraint: "~3100",
+			matching:   []string{"3100.0.0", "3100.9.3"},
+			other:      []string{"3101.0.0"},
+		},
+		{
+			constraint: "~3100.1",
+			matching:   []string{"3100.1.0", "3100.1.7"},
+			other:      []string{"3100.0.9", "3100.2.0"},
+		},
+		{
+			constraint: "~ 3100.1.2",
+			matching:   []string{"3100.1.2", "3100.1.7"},
+			other:      []string{"3100.1.1", "3100.2.0"},
+		},
+		{
+			constraint: "^3100.1.2",
+			matching:   []string{"3100.1.2", "3100.9.0"},
+			other:      []string{"3100.1.1", "3101.0.0"},
+		},
+		{
+			constraint: "^0.2.3",
+			matching:   []string{"0.2.3", "0.2.9"},
+			other:      []string{"0.3.0"},
+		},
+		{
+			constraint: "^0.0.3",
+			matching:   []string{"0.0.3"},
+			other:      []string{"0.0.4"},
+		},
+		{
+			constraint: "~3033.2 || ^3100.1.0",
+			matching:   []string{"3033.2.4", "3100.3.0"},
+			other:      []string{"3033.3.0", "3100.0.1"},
+		},
+	} {
+		versionRange, err := parseVersionConstraint(tt.constraint)
+		require.NoError(t, err, tt.constraint)
+		for _, v := range tt.matching {
+			assert.True(t, versionRange(semver.MustParse(v)), "%s should match %s", v, tt.constraint)
+		}
+		for _, v := range tt.other {
+			assert.False(t, versionRange(semver.MustParse(v)), "%s should not match %s", v, tt.constraint)
+		}
+	}
+
+	for _, constraint := range []string{"", "latest", "~3100.x", "^a.b", "~1.2.3.4", ">=3100"} {
+		_, err := parseVersionConstraint(constraint)
+		assert.Equal(t, ErrInvalidVersionConstraint, err, constraint)
+	}
+}
@@ -0,0 +1,587 @@
+package declarative
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+)
+
+// Kinds of resources changed when applying a configuration, named after the
+// resources in the permissions required to change them.
+const (
+	KindApplication = "apps"
+	KindPackage     = "packages"
+	KindChannel     = "channels"
+	KindGroup       = "groups"
+)
+
+// Actions taken on the resources when applying a configuration.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+)
+
+var (
+	// ErrInvalidConfig indicates that the configuration provided is not
+	// valid, e.g. because it refers to a channel that doesn't exist.
+	ErrInvalidConfig = errors.New("nebraska: invalid declarative configuration")
+)
+
+// Change represents a change made, or to be made in a dry run, to apply a
+// configuration. For updates, Changes holds the fields that differ along
+// with their values before and after the change.
+type Change struct {
+	Action        string        `json:"action"`
+	Kind          string        `json:"kind"`
+	ApplicationID string        `json:"application_id,omitempty"`
+	Application   string        `json:"application"`
+	Name          string        `json:"name"`
+	Changes       api.AuditData `json:"changes,omitempty"`
+}
+
+// Permission returns the permission required to make the change.
+func (c *Change) Permission() string {
+	return c.Kind + ":" + c.Action
+}
+
+// String returns a human readable description of the change, in a diff-like
+// format.
+func (c *Change) String() string {
+	var sb strings.Builder
+	sign := "~"
+	if c.Action == ActionCreate {
+		sign = "+"
+	}
+	fmt.Fprintf(&sb, "%s %s %s", sign, c.Kind, c.Application)
+	if c.Kind != KindApplication {
+		fmt.Fprintf(&sb, "/%s", c.Name)
+	}
+	names := make([]string, 0, len(c.Changes))
+	for name := range c.Changes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		change, _ := c.Changes[name].(map[string]interface{})
+		fmt.Fprintf(&sb, "\n    %s: %v -> %v", name, change["before"], change["after"])
+	}
+	return sb.String()
+}
+
+// Apply brings the applications of the team provided in line with the
+// configuration, creating or updating them along with their packages,
+// channels and groups. Resources not in the configuration are left as they
+// are. In a dry run the changes are only computed. It returns the changes
+// made, so applying the same configuration again returns none.
+//
+// The configuration is applied in a single transaction. When authorize is
+// not nil, it's called with each change made before committing it, and the
+// transaction is rolled back if it returns an error, as when applying the
+// configuration fails: no change is made then.
+func Apply(a *api.API, teamID string, config *Config, dryRun bool, authorize func(*Change) error) ([]*Change, error) {
+	if err := normalize(config); err != nil {
+		return nil, err
+	}
+	var changes []*Change
+	err := a.RunInTransaction(func(tx *api.API) error {
+		apps, err := getApps(tx, teamID)
+		if err != nil {
+			return err
+		}
+		ap := &applier{
+			api:    tx,
+			teamID: teamID,
+			dryRun: dryRun,
+			apps:   apps,
+		}
+		for _, app := range config.Applications {
+			if err := ap.applyApp(app); err != nil {
+				return fmt.Errorf("application %q: %w", app.Name, err)
+			}
+		}
+		if authorize != nil {
+			for _, change := range ap.changes {
+				if err := authorize(change); err != nil {
+					return err
+				}
+			}
+		}
+		changes = ap.changes
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// normalize validates the configuration provided and sorts its lists the way
+// they are exported, so they can be compared with the current state.
+func normalize(config *Config) error {
+	appNames := map[string]bool{}
+	for _, app := range config.Applications {
+		if app.Name == "" {
+			return fmt.Errorf("%w: application without name", ErrInvalidConfig)
+		}
+		if appNames[app.Name] || (app.ID != "" && appNames[app.ID]) {
+			return fmt.Errorf("%w: duplicated application %q", ErrInvalidConfig, app.Name)
+		}
+		appNames[app.Name] = true
+		if app.ID != "" {
+			appNames[app.ID] = true
+		}
+
+		keys := map[string]bool{}
+		for _, pkg := range app.Packages {
+			arch, err := api.ArchFromString(pkg.Arch)
+			if err != nil {
+				return fmt.Errorf("%w: package %q: invalid arch %q", ErrInvalidConfig, pkg.Version, pkg.Arch)
+			}
+			key := resourceKey(pkg.Version, arch)
+			if keys[key] {
+				return fmt.Errorf("%w: duplicated package %s", ErrInvalidConfig, key)
+			}
+			keys[key] = true
+			sort.Strings(pkg.ChannelsBlacklist)
+			sort.Slice(pkg.Deltas, func(i, j int) bool {
+				return pkg.Deltas[i].FromVersion < pkg.Deltas[j].FromVersion
+			})
+		}
+
+		keys = map[string]bool{}
+		for _, channel := range app.Channels {
+			arch, err := api.ArchFromString(channel.Arch)
+			if err != nil {
+				return fmt.Errorf("%w: channel %q: invalid arch %q", ErrInvalidConfig, channel.Name, channel.Arch)
+			}
+			key := resourceKey(channel.Name, arch)
+			if channel.Name == "" || keys[key] {
+				return fmt.Errorf("%w: missing or duplicated channel name %q", ErrInvalidConfig, channel.Name)
+			}
+			keys[key] = true
+		}
+
+		keys = map[string]bool{}
+		for _, group := range app.Groups {
+			if group.Name == "" || keys[group.Name] || (group.ID != "" && keys[group.ID]) {
+				return fmt.Errorf("%w: missing or duplicated group name %q", ErrInvalidConfig, group.Name)
+			}
+			keys[group.Name] = true
+			if group.ID != "" {
+				keys[group.ID] = true
+			}
+			if group.Channel != nil {
+				if _, err := api.ArchFromString(group.Channel.Arch); err != nil {
+					return fmt.Errorf("%w: group %q: invalid channel arch %q", ErrInvalidConfig, group.Name, group.Channel.Arch)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resourceKey returns the key identifying a package or a channel within an
+// application.
+func resourceKey(name string, arch api.Arch) string {
+	return fmt.Sprintf("%s (%s)", name, arch)
+}
+
+type applier struct {
+	api     *api.API
+	teamID  string
+	dryRun  bool
+	apps    []*api.Application
+	changes []*Change
+}
+
+// appState keeps track of the state of an application while its
+// configuration is applied. In a dry run, the resources to be created are
+// represented by placeholders without id.
+type appState struct {
+	app          *api.Application
+	pkgs         map[string]*api.Package
+	channels     map[string]*api.Channel
+	pkgsByID     map[string]*api.Package
+	channelsByID map[string]*api.Channel
+}
+
+func (ap *applier) record(action, kind string, app *api.Application, name string, changes api.AuditData) {
+	ap.changes = append(ap.changes, &Change{
+		Action:        action,
+		Kind:          kind,
+		ApplicationID: app.ID,
+		Application:   app.Name,
+		Name:          name,
+		Changes:       changes,
+	})
+}
+
+func (ap *applier) findApp(spec *Application) *api.Application {
+	for _, app := range ap.apps {
+		if spec.ID != "" && app.ID == spec.ID {
+			return app
+		}
+	}
+	if spec.ID != "" {
+		return nil
+	}
+	for _, app := range ap.apps {
+		if app.Name == spec.Name {
+			return app
+		}
+	}
+	return nil
+}
+
+func (ap *applier) applyApp(spec *Application) error {
+	st := &appState{
+		pkgs:         map[string]*api.Package{},
+		channels:     map[string]*api.Channel{},
+		pkgsByID:     map[string]*api.Package{},
+		channelsByID: map[string]*api.Channel{},
+	}
+	current := ap.findApp(spec)
+	if current == nil {
+		if spec.ID != "" {
+			if _, err := ap.api.GetApp(spec.ID); err != sql.ErrNoRows {
+				if err == nil {
+					return fmt.Errorf("%w: application id %s is already in use", ErrInvalidConfig, spec.ID)
+				}
+				return err
+			}
+		}
+		st.app = &api.Application{ID: spec.ID, Name: spec.Name, Description: spec.Description, TeamID: ap.teamID}
+		ap.record(ActionCreate, KindApplication, st.app, spec.Name, nil)
+		if !ap.dryRun {
+			app, err := ap.api.AddApp(st.app)
+			if err != nil {
+				return err
+			}
+			st.app = app
+		}
+	} else {
+		st.app = current
+		before := fields(&Application{Name: current.Name, Description: current.Description})
+		after := fields(&Application{Name: spec.Name, Description: spec.Description})
+		if changes := api.AuditChanges(before, after); len(changes) > 0 {
+			ap.record(ActionUpdate, KindApplication, current, spec.Name, changes)
+			if !ap.dryRun {
+				app := *current
+				app.Name = spec.Name
+				app.Description = spec.Description
+				if err := ap.api.UpdateApp(&app); err != nil {
+					return err
+				}
+			}
+		}
+
+		pkgs, err := getPackages(ap.api, current.ID)
+		if err != nil {
+			return err
+		}
+		for _, pkg := range pkgs {
+			st.pkgs[resourceKey(pkg.Version, pkg.Arch)] = pkg
+			st.pkgsByID[pkg.ID] = pkg
+		}
+		for _, channel := range current.Channels {
+			st.channels[resourceKey(channel.Name, channel.Arch)] = channel
+			st.channelsByID[channel.ID] = channel
+		}
+	}
+
+	pending, err := ap.applyPackages(st, spec.Packages)
+	if err != nil {
+		return err
+	}
+	if err := ap.applyChannels(st, spec.Channels); err != nil {
+		return err
+	}
+	if err := ap.applyBlacklists(st, pending); err != nil {
+		return err
+	}
+	return ap.applyGroups(st, current, spec.Groups)
+}
+
+// applyPackages creates or updates the packages provided. Channels are only
+// removed from the packages' blacklists at this point, as the channels to be
+// blacklisted may not exist yet or still point to the package. The packages
+// whose blacklist must be completed once the channels are applied are
+// returned.
+func (ap *applier) applyPackages(st *appState, specs []*Package) ([]*Package, error) {
+	var pending []*Package
+	for _, spec := range specs {
+		arch, _ := api.ArchFromString(spec.Arch)
+		key := resourceKey(spec.Version, arch)
+		current := st.pkgs[key]
+
+		if current == nil {
+			ap.record(ActionCreate, KindPackage, st.app, key, nil)
+			pkg := newPackage(spec, st.app.ID, arch)
+			if !ap.dryRun {
+				var err error
+				if pkg, err = ap.api.AddPackage(pkg); err != nil {
+					return nil, fmt.Errorf("package %s: %w", key, err)
+				}
+			}
+			st.pkgs[key] = pkg
+			if len(spec.ChannelsBlacklist) > 0 {
+				pending = append(pending, spec)
+			}
+			continue
+		}
+
+		before := exportPackage(current, st.channelsByID)
+		desired := *spec
+		if desired.FlatcarSha256 == "" {
+			// Flatcar actions can't be removed from packages.
+			desired.FlatcarSha256 = before.FlatcarSha256
+		}
+		changes := api.AuditChanges(fields(before), fields(&desired))
+		if len(changes) == 0 {
+			continue
+		}
+		ap.record(ActionUpdate, KindPackage, st.app, key, changes)
+		if _, ok := changes["channels_blacklist"]; ok {
+			pending = append(pending, spec)
+		}
+		if ap.dryRun {
+			continue
+		}
+		pkg := updatedPackage(spec, current)
+		for _, channelID := range current.ChannelsBlacklist {
+			if channel, ok := st.channelsByID[channelID]; ok && contains(spec.ChannelsBlacklist, channel.Name) {
+				pkg.ChannelsBlacklist = append(pkg.ChannelsBlacklist, channelID)
+			}
+		}
+		if err := ap.api.UpdatePackage(pkg); err != nil {
+			return nil, fmt.Errorf("package %s: %w", key, err)
+		}
+		st.pkgs[key] = pkg
+	}
+	return pending, nil
+}
+
+// applyBlacklists completes the blacklists of the packages provided, once
+// the channels they refer to have been applied.
+func (ap *applier) applyBlacklists(st *appState, specs []*Package) error {
+	for _, spec := range specs {
+		arch, _ := api.ArchFromString(spec.Arch)
+		key := resourceKey(spec.Version, arch)
+		pkg := updatedPackage(spec, st.pkgs[key])
+		for _, name := range spec.ChannelsBlacklist {
+			channel, ok := st.channels[resourceKey(name, arch)]
+			if !ok {
+				return fmt.Errorf("%w: package %s: unknown blacklisted channel %q", ErrInvalidConfig, key, name)
+			}
+			pkg.ChannelsBlacklist = append(pkg.ChannelsBlacklist, channel.ID)
+		}
+		if ap.dryRun {
+			continue
+		}
+		if err := ap.api.UpdatePackage(pkg); err != nil {
+			return fmt.Errorf("package %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (ap *applier) applyChannels(st *appState, specs []*Channel) error {
+	for _, spec := range specs {
+		arch, _ := api.ArchFromString(spec.Arch)
+		key := resourceKey(spec.Name, arch)
+		channel := &api.Channel{
+			Name:              spec.Name,
+			Color:             spec.Color,
+			ApplicationID:     st.app.ID,
+			Arch:              arch,
+			VersionConstraint: nullString(spec.VersionConstraint),
+			MinVersion:        nullString(spec.MinVersion),
+		}
+		if spec.Package != "" {
+			pkg, ok := st.pkgs[resourceKey(spec.Package, arch)]
+			if !ok {
+				return fmt.Errorf("%w: channel %s: unknown package %q", ErrInvalidConfig, key, spec.Package)
+			}
+			channel.PackageID = nullString(pkg.ID)
+		}
+
+		current := st.channels[key]
+		if current == nil {
+			ap.record(ActionCreate, KindChannel, st.app, key, nil)
+			if !ap.dryRun {
+				var err error
+				if channel, err = ap.api.AddChannel(channel); err != nil {
+					return fmt.Errorf("channel %s: %w", key, err)
+				}
+			}
+			st.channels[key] = channel
+			continue
+		}
+
+		changes := api.AuditChanges(fields(exportChannel(current, st.pkgsByID)), fields(spec))
+		if len(changes) == 0 {
+			continue
+		}
+		ap.record(ActionUpdate, KindChannel, st.app, key, changes)
+		if ap.dryRun {
+			continue
+		}
+		channel.ID = current.ID
+		if err := ap.api.UpdateChannel(channel); err != nil {
+			return fmt.Errorf("channel %s: %w", key, err)
+		}
+		st.channels[key] = channel
+	}
+	return nil
+}
+
+func (ap *applier) applyGroups(st *appState, app *api.Application, specs []*Group) error {
+	var groups []*api.Group
+	if app != nil {
+		groups = app.Groups
+	}
+	for _, spec := range specs {
+		current := findGroup(groups, spec)
+		if current == nil && spec.ID != "" {
+			if _, err := ap.api.GetGroup(spec.ID); err != sql.ErrNoRows {
+				if err == nil {
+					return fmt.Errorf("%w: group id %s is already in use", ErrInvalidConfig, spec.ID)
+				}
+				return err
+			}
+		}
+
+		group := &api.Group{
+			ID:                               spec.ID,
+			Name:                             spec.Name,
+			Description:                      spec.Description,
+			ApplicationID:                    st.app.ID,
+			Track:                            spec.Track,
+			PolicyUpdatesEnabled:             spec.PolicyUpdatesEnabled,
+			PolicySafeMode:                   spec.PolicySafeMode,
+			PolicyOfficeHours:                spec.PolicyOfficeHours,
+			PolicyTimezone:                   nullString(spec.PolicyTimezone),
+			PolicyPeriodInterval:             spec.PolicyPeriodInterval,
+			PolicyMaxUpdatesPerPeriod:        spec.PolicyMaxUpdatesPerPeriod,
+			PolicyUpdateTimeout:              spec.PolicyUpdateTimeout,
+			PolicyRolloutSteps:               spec.PolicyRolloutSteps,
+			PolicyRolloutStepInterval:        spec.PolicyRolloutStepInterval,
+			PolicyRolloutStepHealthThreshold: spec.PolicyRolloutStepHealthThreshold,
+			PolicyMaxFailureRate:             spec.PolicyMaxFailureRate,
+			PolicyFailureRateWindow:          spec.PolicyFailureRateWindow,
+			PolicyRollbackOnFailure:          spec.PolicyRollbackOnFailure,
+			PolicyUpdateWindows:              spec.PolicyUpdateWindows,
+			PolicyBlackoutPeriods:            spec.PolicyBlackoutPeriods,
+		}
+		if spec.Channel != nil {
+			arch, _ := api.ArchFromString(spec.Channel.Arch)
+			channel, ok := st.channels[resourceKey(spec.Channel.Name, arch)]
+			if !ok {
+				return fmt.Errorf("%w: group %q: unknown channel %q (%s)", ErrInvalidConfig, spec.Name, spec.Channel.Name, spec.Channel.Arch)
+			}
+			group.ChannelID = nullString(channel.ID)
+		}
+
+		if current == nil {
+			ap.record(ActionCreate, KindGroup, st.app, spec.Name, nil)
+			if !ap.dryRun {
+				if _, err := ap.api.AddGroup(group); err != nil {
+					return fmt.Errorf("group %q: %w", spec.Name, err)
+				}
+			}
+			continue
+		}
+
+		before := exportGroup(current, st.channelsByID)
+		desired := *spec
+		desired.ID = before.ID
+		if desired.Track == "" {
+			desired.Track = before.Track
+		}
+		changes := api.AuditChanges(fields(before), fields(&desired))
+		if len(changes) == 0 {
+			continue
+		}
+		ap.record(ActionUpdate, KindGroup, st.app, spec.Name, changes)
+		if ap.dryRun {
+			continue
+		}
+		group.ID = current.ID
+		group.Track = desired.Track
+		if err := ap.api.UpdateGroup(group); err != nil {
+			return fmt.Errorf("group %q: %w", spec.Name, err)
+		}
+	}
+	return nil
+}
+
+func findGroup(groups []*api.Group, spec *Group) *api.Group {
+	for _, group := range groups {
+		if spec.ID != "" && group.ID == spec.ID {
+			return group
+		}
+		if spec.ID == "" && group.Name == spec.Name {
+			return group
+		}
+	}
+	return nil
+}
+
+// newPackage returns the package described by the configuration provided,
+// without blacklisted channels.
+func newPackage(spec *Package, appID string, arch api.Arch) *api.Package {
+	pkg := &api.Package{
+		Type:           spec.Type,
+		Version:        spec.Version,
+		URL:            spec.URL,
+		Filename:       nullString(spec.Filename),
+		Description:    nullString(spec.Description),
+		Size:           nullString(spec.Size),
+		Hash:           nullString(spec.Hash),
+		ApplicationID:  appID,
+		Arch:           arch,
+		MinFromVersion: nullString(spec.MinFromVersion),
+		Deltas:         []*api.PackageDelta{},
+	}
+	if spec.FlatcarSha256 != "" {
+		pkg.FlatcarAction = &api.FlatcarAction{Sha256: spec.FlatcarSha256}
+	}
+	for _, delta := range spec.Deltas {
+		pkg.Deltas = append(pkg.Deltas, &api.PackageDelta{
+			FromVersion:          delta.FromVersion,
+			URL:                  delta.URL,
+			Filename:             nullString(delta.Filename),
+			Size:                 nullString(delta.Size),
+			Hash:                 nullString(delta.Hash),
+			Sha256:               nullString(delta.Sha256),
+			MetadataSignatureRsa: delta.MetadataSignatureRsa,
+			MetadataSize:         delta.MetadataSize,
+		})
+	}
+	return pkg
+}
+
+// updatedPackage returns the package described by the configuration
+// provided as an update of the current package, without blacklisted
+// channels.
+func updatedPackage(spec *Package, current *api.Package) *api.Package {
+	pkg := newPackage(spec, current.ApplicationID, current.Arch)
+	pkg.ID = current.ID
+	if pkg.FlatcarAction != nil && current.FlatcarAction != nil {
+		pkg.FlatcarAction.ID = current.FlatcarAction.ID
+	}
+	return pkg
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
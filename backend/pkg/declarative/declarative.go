@@ -0,0 +1,324 @@
+// Package declarative describes the applications of a team, along with their
+// packages, channels and groups, as a declarative configuration that can be
+// kept in version control, and applies such configurations to Nebraska.
+package declarative
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"gopkg.in/guregu/null.v4"
+	"gopkg.in/yaml.v2"
+
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+)
+
+const (
+	// pageSize is the number of applications or packages requested at once
+	// while exporting them.
+	pageSize = 100
+)
+
+// Config represents the declarative configuration of the applications of a
+// team.
+type Config struct {
+	Applications []*Application `yaml:"applications" json:"applications"`
+}
+
+// Application represents an application along with its packages, channels
+// and groups. Applications are identified by their id when provided, or by
+// their name otherwise.
+type Application struct {
+	ID          string     `yaml:"id,omitempty" json:"id,omitempty"`
+	Name        string     `yaml:"name" json:"name"`
+	Description string     `yaml:"description,omitempty" json:"description,omitempty"`
+	Packages    []*Package `yaml:"packages,omitempty" json:"packages,omitempty"`
+	Channels    []*Channel `yaml:"channels,omitempty" json:"channels,omitempty"`
+	Groups      []*Group   `yaml:"groups,omitempty" json:"groups,omitempty"`
+}
+
+// Package represents the metadata of a package, identified by its version
+// and architecture. Blacklisted channels are referred to by their name, in
+// the package's architecture.
+type Package struct {
+	Version           string          `yaml:"version" json:"version"`
+	Arch              string          `yaml:"arch" json:"arch"`
+	Type              int             `yaml:"type" json:"type"`
+	URL               string          `yaml:"url" json:"url"`
+	Filename          string          `yaml:"filename,omitempty" json:"filename,omitempty"`
+	Description       string          `yaml:"description,omitempty" json:"description,omitempty"`
+	Size              string          `yaml:"size,omitempty" json:"size,omitempty"`
+	Hash              string          `yaml:"hash,omitempty" json:"hash,omitempty"`
+	FlatcarSha256     string          `yaml:"flatcar_sha256,omitempty" json:"flatcar_sha256,omitempty"`
+	MinFromVersion    string          `yaml:"min_from_version,omitempty" json:"min_from_version,omitempty"`
+	ChannelsBlacklist []string        `yaml:"channels_blacklist,omitempty" json:"channels_blacklist,omitempty"`
+	Deltas            []*PackageDelta `yaml:"deltas,omitempty" json:"deltas,omitempty"`
+}
+
+// PackageDelta represents a delta payload updating instances from an older
+// version to the package.
+type PackageDelta struct {
+	FromVersion          string `yaml:"from_version" json:"from_version"`
+	URL                  string `yaml:"url" json:"url"`
+	Filename             string `yaml:"filename,omitempty" json:"filename,omitempty"`
+	Size                 string `yaml:"size,omitempty" json:"size,omitempty"`
+	Hash                 string `yaml:"hash,omitempty" json:"hash,omitempty"`
+	Sha256               string `yaml:"sha256,omitempty" json:"sha256,omitempty"`
+	MetadataSignatureRsa string `yaml:"metadata_signature_rsa,omitempty" json:"metadata_signature_rsa,omitempty"`
+	MetadataSize         string `yaml:"metadata_size,omitempty" json:"metadata_size,omitempty"`
+}
+
+// Channel represents a channel, identified by its name and architecture. The
+// package it points to is referred to by its version.
+type Channel struct {
+	Name              string `yaml:"name" json:"name"`
+	Arch              string `yaml:"arch" json:"arch"`
+	Color             string `yaml:"color,omitempty" json:"color,omitempty"`
+	Package           string `yaml:"package,omitempty" json:"package,omitempty"`
+	VersionConstraint string `yaml:"version_constraint,omitempty" json:"version_constraint,omitempty"`
+	MinVersion        string `yaml:"min_version,omitempty" json:"min_version,omitempty"`
+}
+
+// ChannelRef refers to a channel of the same application by its name and
+// architecture.
+type ChannelRef struct {
+	Name string `yaml:"name" json:"name"`
+	Arch string `yaml:"arch" json:"arch"`
+}
+
+// Group represents a group along with all its policy fields. Groups are
+// identified by their id when provided, or by their name otherwise. An empty
+// track keeps the current one.
+type Group struct {
+	ID                               string               `yaml:"id,omitempty" json:"id,omitempty"`
+	Name                             string               `yaml:"name" json:"name"`
+	Description                      string               `yaml:"description,omitempty" json:"description,omitempty"`
+	Track                            string               `yaml:"track,omitempty" json:"track,omitempty"`
+	Channel                          *ChannelRef          `yaml:"channel,omitempty" json:"channel,omitempty"`
+	PolicyUpdatesEnabled             bool                 `yaml:"policy_updates_enabled" json:"policy_updates_enabled"`
+	PolicySafeMode                   bool                 `yaml:"policy_safe_mode" json:"policy_safe_mode"`
+	PolicyOfficeHours                bool                 `yaml:"policy_office_hours" json:"policy_office_hours"`
+	PolicyTimezone                   string               `yaml:"policy_timezone,omitempty" json:"policy_timezone,omitempty"`
+	PolicyPeriodInterval             string               `yaml:"policy_period_interval" json:"policy_period_interval"`
+	PolicyMaxUpdatesPerPeriod        int                  `yaml:"policy_max_updates_per_period" json:"policy_max_updates_per_period"`
+	PolicyUpdateTimeout              string               `yaml:"policy_update_timeout" json:"policy_update_timeout"`
+	PolicyRolloutSteps               string               `yaml:"policy_rollout_steps,omitempty" json:"policy_rollout_steps,omitempty"`
+	PolicyRolloutStepInterval        string               `yaml:"policy_rollout_step_interval,omitempty" json:"policy_rollout_step_interval,omitempty"`
+	PolicyRolloutStepHealthThreshold int                  `yaml:"policy_rollout_step_health_threshold,omitempty" json:"policy_rollout_step_health_threshold,omitempty"`
+	PolicyMaxFailureRate             int                  `yaml:"policy_max_failure_rate,omitempty" json:"policy_max_failure_rate,omitempty"`
+	PolicyFailureRateWindow          string               `yaml:"policy_failure_rate_window,omitempty" json:"policy_failure_rate_window,omitempty"`
+	PolicyRollbackOnFailure          bool                 `yaml:"policy_rollback_on_failure,omitempty" json:"policy_rollback_on_failure,omitempty"`
+	PolicyUpdateWindows              []api.UpdateWindow   `yaml:"policy_update_windows,omitempty" json:"policy_update_windows,omitempty"`
+	PolicyBlackoutPeriods            []api.BlackoutPeriod `yaml:"policy_blackout_periods,omitempty" json:"policy_blackout_periods,omitempty"`
+}
+
+// Read decodes the YAML configuration provided.
+func Read(r io.Reader) (*Config, error) {
+	config := &Config{}
+	if err := yaml.NewDecoder(r).Decode(config); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Write encodes the configuration provided as YAML.
+func Write(w io.Writer, config *Config) error {
+	encoder := yaml.NewEncoder(w)
+	if err := encoder.Encode(config); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// Export returns the configuration of the applications of the team provided.
+// When application ids are provided, only those applications are exported.
+func Export(a *api.API, teamID string, appIDs ...string) (*Config, error) {
+	apps, err := getApps(a, teamID)
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool, len(appIDs))
+	for _, id := range appIDs {
+		wanted[id] = true
+	}
+	config := &Config{Applications: []*Application{}}
+	for _, app := range apps {
+		if len(appIDs) > 0 && !wanted[app.ID] {
+			continue
+		}
+		pkgs, err := getPackages(a, app.ID)
+		if err != nil {
+			return nil, err
+		}
+		config.Applications = append(config.Applications, exportApp(app, pkgs))
+	}
+	return config, nil
+}
+
+func getApps(a *api.API, teamID string) ([]*api.Application, error) {
+	var apps []*api.Application
+	for page := uint64(1); ; page++ {
+		batch, err := a.GetApps(teamID, page, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, batch...)
+		if len(batch) < pageSize {
+			return apps, nil
+		}
+	}
+}
+
+func getPackages(a *api.API, appID string) ([]*api.Package, error) {
+	var pkgs []*api.Package
+	for page := uint64(1); ; page++ {
+		batch, err := a.GetPackages(appID, page, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, batch...)
+		if len(batch) < pageSize {
+			return pkgs, nil
+		}
+	}
+}
+
+func exportApp(app *api.Application, pkgs []*api.Package) *Application {
+	result := &Application{
+		ID:          app.ID,
+		Name:        app.Name,
+		Description: app.Description,
+	}
+	channelsByID := make(map[string]*api.Channel, len(app.Channels))
+	for _, channel := range app.Channels {
+		channelsByID[channel.ID] = channel
+	}
+	pkgsByID := make(map[string]*api.Package, len(pkgs))
+	for _, pkg := range pkgs {
+		pkgsByID[pkg.ID] = pkg
+		result.Packages = append(result.Packages, exportPackage(pkg, channelsByID))
+	}
+	sort.Slice(result.Packages, func(i, j int) bool {
+		if result.Packages[i].Version != result.Packages[j].Version {
+			return result.Packages[i].Version < result.Packages[j].Version
+		}
+		return result.Packages[i].Arch < result.Packages[j].Arch
+	})
+	for _, channel := range app.Channels {
+		result.Channels = append(result.Channels, exportChannel(channel, pkgsByID))
+	}
+	sort.Slice(result.Channels, func(i, j int) bool {
+		if result.Channels[i].Name != result.Channels[j].Name {
+			return result.Channels[i].Name < result.Channels[j].Name
+		}
+		return result.Channels[i].Arch < result.Channels[j].Arch
+	})
+	for _, group := range app.Groups {
+		result.Groups = append(result.Groups, exportGroup(group, channelsByID))
+	}
+	sort.Slice(result.Groups, func(i, j int) bool {
+		return result.Groups[i].Name < result.Groups[j].Name
+	})
+	return result
+}
+
+func exportPackage(pkg *api.Package, channelsByID map[string]*api.Channel) *Package {
+	result := &Package{
+		Version:        pkg.Version,
+		Arch:           pkg.Arch.String(),
+		Type:           pkg.Type,
+		URL:            pkg.URL,
+		Filename:       pkg.Filename.String,
+		Description:    pkg.Description.String,
+		Size:           pkg.Size.String,
+		Hash:           pkg.Hash.String,
+		MinFromVersion: pkg.MinFromVersion.String,
+	}
+	if pkg.FlatcarAction != nil {
+		result.FlatcarSha256 = pkg.FlatcarAction.Sha256
+	}
+	for _, channelID := range pkg.ChannelsBlacklist {
+		if channel, ok := channelsByID[channelID]; ok {
+			result.ChannelsBlacklist = append(result.ChannelsBlacklist, channel.Name)
+		}
+	}
+	sort.Strings(result.ChannelsBlacklist)
+	for _, delta := range pkg.Deltas {
+		result.Deltas = append(result.Deltas, &PackageDelta{
+			FromVersion:          delta.FromVersion,
+			URL:                  delta.URL,
+			Filename:             delta.Filename.String,
+			Size:                 delta.Size.String,
+			Hash:                 delta.Hash.String,
+			Sha256:               delta.Sha256.String,
+			MetadataSignatureRsa: delta.MetadataSignatureRsa,
+			MetadataSize:         delta.MetadataSize,
+		})
+	}
+	sort.Slice(result.Deltas, func(i, j int) bool {
+		return result.Deltas[i].FromVersion < result.Deltas[j].FromVersion
+	})
+	return result
+}
+
+func exportChannel(channel *api.Channel, pkgsByID map[string]*api.Package) *Channel {
+	result := &Channel{
+		Name:              channel.Name,
+		Arch:              channel.Arch.String(),
+		Color:             channel.Color,
+		VersionConstraint: channel.VersionConstraint.String,
+		MinVersion:        channel.MinVersion.String,
+	}
+	if pkg, ok := pkgsByID[channel.PackageID.String]; ok {
+		result.Package = pkg.Version
+	}
+	return result
+}
+
+func exportGroup(group *api.Group, channelsByID map[string]*api.Channel) *Group {
+	result := &Group{
+		ID:                               group.ID,
+		Name:                             group.Name,
+		Description:                      group.Description,
+		Track:                            group.Track,
+		PolicyUpdatesEnabled:             group.PolicyUpdatesEnabled,
+		PolicySafeMode:                   group.PolicySafeMode,
+		PolicyOfficeHours:                group.PolicyOfficeHours,
+		PolicyTimezone:                   group.PolicyTimezone.String,
+		PolicyPeriodInterval:             group.PolicyPeriodInterval,
+		PolicyMaxUpdatesPerPeriod:        group.PolicyMaxUpdatesPerPeriod,
+		PolicyUpdateTimeout:              group.PolicyUpdateTimeout,
+		PolicyRolloutSteps:               group.PolicyRolloutSteps,
+		PolicyRolloutStepInterval:        group.PolicyRolloutStepInterval,
+		PolicyRolloutStepHealthThreshold: group.PolicyRolloutStepHealthThreshold,
+		PolicyMaxFailureRate:             group.PolicyMaxFailureRate,
+		PolicyFailureRateWindow:          group.PolicyFailureRateWindow,
+		PolicyRollbackOnFailure:          group.PolicyRollbackOnFailure,
+		PolicyUpdateWindows:              group.PolicyUpdateWindows,
+		PolicyBlackoutPeriods:            group.PolicyBlackoutPeriods,
+	}
+	if channel, ok := channelsByID[group.ChannelID.String]; ok {
+		result.Channel = &ChannelRef{Name: channel.Name, Arch: channel.Arch.String()}
+	}
+	return result
+}
+
+// fields returns the JSON representation of the resource provided as a map,
+// used to find the fields that differ between two states of a resource.
+func fields(resource interface{}) api.AuditData {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return nil
+	}
+	var result api.AuditData
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil
+	}
+	return result
+}
+
+// nullString returns the string provided as a null.String, null if empty.
+func nullString(s string) null.String {
+	return null.NewString(s, s != "")
+}
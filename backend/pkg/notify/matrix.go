@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// MatrixNotifier is a Notifier sending notifications as notices to a Matrix
+// room using the client-server API.
+type MatrixNotifier struct {
+	homeserver  string
+	roomID      string
+	accessToken string
+	httpClient  *http.Client
+}
+
+var _ Notifier = &MatrixNotifier{}
+
+// NewMatrixNotifier creates a new MatrixNotifier sending messages to the room
+// provided on the given homeserver.
+func NewMatrixNotifier(homeserver, roomID, accessToken string, httpClient *http.Client) *MatrixNotifier {
+	return &MatrixNotifier{
+		homeserver:  strings.TrimSuffix(homeserver, "/"),
+		roomID:      roomID,
+		accessToken: accessToken,
+		httpClient:  httpClient,
+	}
+}
+
+// Notify sends the notification provided to the Matrix room.
+func (m *MatrixNotifier) Notify(n *Notification) error {
+	body, err := json.Marshal(map[string]string{
+		"msgtype": "m.notice",
+		"body":    n.Text(),
+	})
+	if err != nil {
+		return err
+	}
+	// The transaction id is derived from the notification so that the
+	// homeserver can deduplicate the requests sent when retrying.
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	txnID := "nebraska-" + hmacSHA256(m.roomID, payload)[:32]
+	sendURL := fmt.Sprintf("%s/_matrix/client/r0/rooms/%s/send/m.room.message/%s", m.homeserver, url.PathEscape(m.roomID), txnID)
+	headers := map[string]string{"Authorization": "Bearer " + m.accessToken}
+	return postJSON(m.httpClient, http.MethodPut, sendURL, body, headers)
+}
@@ -0,0 +1,316 @@
+// Package notify provides the backends used to send notifications about
+// Nebraska activity entries to external services (generic webhooks, Slack,
+// Matrix and email) and the routing of those notifications.
+package notify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/kinvolk/nebraska/backend/pkg/util"
+)
+
+const (
+	defaultRetryAttempts = 3
+	defaultRetryBackoff  = time.Second
+	defaultHTTPTimeout   = 10 * time.Second
+)
+
+var (
+	logger = util.NewLogger("notify")
+
+	// ErrUnknownNotifierType indicates that the type of a notifier in the
+	// configuration is not supported.
+	ErrUnknownNotifierType = errors.New("notify: unknown notifier type")
+
+	// ErrMissingNotifierSetting indicates that a setting required by a
+	// notifier is missing from the configuration.
+	ErrMissingNotifierSetting = errors.New("notify: missing notifier setting")
+)
+
+// Notification represents a Nebraska activity entry to be notified.
+type Notification struct {
+	Class       string    `json:"class"`
+	Severity    string    `json:"severity"`
+	Version     string    `json:"version"`
+	AppID       string    `json:"app_id"`
+	AppName     string    `json:"app_name"`
+	GroupID     string    `json:"group_id,omitempty"`
+	GroupName   string    `json:"group_name,omitempty"`
+	ChannelID   string    `json:"channel_id,omitempty"`
+	ChannelName string    `json:"channel_name,omitempty"`
+	InstanceID  string    `json:"instance_id,omitempty"`
+	Message     string    `json:"message"`
+	CreatedTs   time.Time `json:"created_ts"`
+}
+
+// Text returns a plain text representation of the notification.
+func (n *Notification) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] %s", n.Severity, n.AppName)
+	if n.GroupName != "" {
+		fmt.Fprintf(&b, " > %s", n.GroupName)
+	}
+	fmt.Fprintf(&b, ": %s", n.Message)
+	return b.String()
+}
+
+// Notifier is the interface implemented by the notification backends.
+type Notifier interface {
+	// Notify sends the notification provided, returning an error if it
+	// could not be delivered.
+	Notify(n *Notification) error
+}
+
+// Route sends the notifications matching its filters to a notifier. Empty
+// filters match any notification.
+type Route struct {
+	Name       string
+	Notifier   Notifier
+	Classes    []string
+	Severities []string
+	// Apps contains the ids or names of the applications to match.
+	Apps []string
+}
+
+// Matches checks if the notification provided passes the route filters.
+func (r *Route) Matches(n *Notification) bool {
+	return matchesAny(r.Classes, n.Class) && matchesAny(r.Severities, n.Severity) &&
+		(matchesAny(r.Apps, n.AppID) || matchesAny(r.Apps, n.AppName))
+}
+
+func matchesAny(filter []string, value string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, f := range filter {
+		if strings.EqualFold(f, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatcher is a Notifier routing notifications to the notifiers of the
+// matching routes, retrying failed deliveries with an exponential backoff.
+type Dispatcher struct {
+	routes        []*Route
+	retryAttempts int
+	retryBackoff  time.Duration
+}
+
+var _ Notifier = &Dispatcher{}
+
+// NewDispatcher creates a new Dispatcher with the routes provided. Failed
+// deliveries are attempted up to retryAttempts times, waiting retryBackoff
+// after the first failure and doubling the wait after each further failure.
+func NewDispatcher(routes []*Route, retryAttempts int, retryBackoff time.Duration) *Dispatcher {
+	if retryAttempts < 1 {
+		retryAttempts = 1
+	}
+	return &Dispatcher{
+		routes:        routes,
+		retryAttempts: retryAttempts,
+		retryBackoff:  retryBackoff,
+	}
+}
+
+// Notify sends the notification provided through all the matching routes.
+// It returns the last delivery error, if any.
+func (d *Dispatcher) Notify(n *Notification) error {
+	var lastErr error
+	for _, route := range d.routes {
+		if !route.Matches(n) {
+			continue
+		}
+		if err := d.notifyWithRetry(route, n); err != nil {
+			logger.Error().Err(err).Str("route", route.Name).Str("class", n.Class).Msg("Notify - could not deliver notification")
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (d *Dispatcher) notifyWithRetry(route *Route, n *Notification) error {
+	backoff := d.retryBackoff
+	var err error
+	for attempt := 1; attempt <= d.retryAttempts; attempt++ {
+		if err = route.Notifier.Notify(n); err == nil {
+			return nil
+		}
+		if attempt < d.retryAttempts {
+			logger.Debug().Err(err).Str("route", route.Name).Int("attempt", attempt).Msg("notifyWithRetry - retrying")
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return err
+}
+
+// Config represents the notifications configuration file.
+type Config struct {
+	Retry struct {
+		Attempts int    `yaml:"attempts"`
+		Backoff  string `yaml:"backoff"`
+	} `yaml:"retry"`
+	Notifiers []NotifierConfig `yaml:"notifiers"`
+}
+
+// NotifierConfig represents the configuration of a notifier and the filters
+// of the route using it. The settings used depend on the notifier type.
+type NotifierConfig struct {
+	Name       string   `yaml:"name"`
+	Type       string   `yaml:"type"`
+	Classes    []string `yaml:"classes"`
+	Severities []string `yaml:"severities"`
+	Apps       []string `yaml:"apps"`
+
+	// webhook, slack
+	URL    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+
+	// matrix
+	Homeserver  string `yaml:"homeserver"`
+	RoomID      string `yaml:"room_id"`
+	AccessToken string `yaml:"access_token"`
+
+	// smtp
+	Address  string   `yaml:"address"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// LoadConfig reads the notifications configuration from the YAML file in
+// the path provided. Environment variables references in the notifiers
+// settings (e.g. ${SLACK_WEBHOOK_URL}) are expanded, so secrets don't need to
+// be stored in it.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, err
+	}
+	for i := range config.Notifiers {
+		config.Notifiers[i].expandEnv()
+	}
+	return &config, nil
+}
+
+// expandEnv expands the environment variables references in the notifier
+// settings. The filters and the email addresses are left as they are.
+func (nc *NotifierConfig) expandEnv() {
+	for _, setting := range []*string{
+		&nc.URL,
+		&nc.Secret,
+		&nc.Homeserver,
+		&nc.RoomID,
+		&nc.AccessToken,
+		&nc.Address,
+		&nc.Username,
+		&nc.Password,
+	} {
+		*setting = os.ExpandEnv(*setting)
+	}
+}
+
+// NewDispatcherFromConfig creates a Dispatcher using the notifiers and retry
+// settings in the configuration provided.
+func NewDispatcherFromConfig(config *Config) (*Dispatcher, error) {
+	httpClient := &http.Client{Timeout: defaultHTTPTimeout}
+
+	var routes []*Route
+	for i, nc := range config.Notifiers {
+		notifier, err := newNotifier(&nc, httpClient)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %d (%s): %w", i, nc.Name, err)
+		}
+		name := nc.Name
+		if name == "" {
+			name = fmt.Sprintf("%s-%d", nc.Type, i)
+		}
+		routes = append(routes, &Route{
+			Name:       name,
+			Notifier:   notifier,
+			Classes:    nc.Classes,
+			Severities: nc.Severities,
+			Apps:       nc.Apps,
+		})
+	}
+
+	attempts := config.Retry.Attempts
+	if attempts == 0 {
+		attempts = defaultRetryAttempts
+	}
+	backoff := defaultRetryBackoff
+	if config.Retry.Backoff != "" {
+		var err error
+		if backoff, err = time.ParseDuration(config.Retry.Backoff); err != nil {
+			return nil, fmt.Errorf("invalid retry backoff: %w", err)
+		}
+	}
+
+	return NewDispatcher(routes, attempts, backoff), nil
+}
+
+func newNotifier(nc *NotifierConfig, httpClient *http.Client) (Notifier, error) {
+	switch nc.Type {
+	case "webhook":
+		if nc.URL == "" {
+			return nil, ErrMissingNotifierSetting
+		}
+		return NewWebhookNotifier(nc.URL, nc.Secret, httpClient), nil
+	case "slack":
+		if nc.URL == "" {
+			return nil, ErrMissingNotifierSetting
+		}
+		return NewSlackNotifier(nc.URL, httpClient), nil
+	case "matrix":
+		if nc.Homeserver == "" || nc.RoomID == "" || nc.AccessToken == "" {
+			return nil, ErrMissingNotifierSetting
+		}
+		return NewMatrixNotifier(nc.Homeserver, nc.RoomID, nc.AccessToken, httpClient), nil
+	case "smtp":
+		if nc.Address == "" || nc.From == "" || len(nc.To) == 0 {
+			return nil, ErrMissingNotifierSetting
+		}
+		return NewSMTPNotifier(nc.Address, nc.Username, nc.Password, nc.From, nc.To), nil
+	default:
+		return nil, ErrUnknownNotifierType
+	}
+}
+
+// postJSON sends the JSON body provided to the url using the given method,
+// returning an error if the response status is not a successful one.
+func postJSON(httpClient *http.Client, method, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notify: unexpected response status %d from %s", resp.StatusCode, req.URL.Host)
+	}
+	return nil
+}
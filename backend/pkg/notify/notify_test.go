@@ -0,0 +1,264 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("NEBRASKA_SKIP_TESTS") != "" {
+		return
+	}
+
+	os.Exit(m.Run())
+}
+
+type recordedRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// newStandIn returns a test server recording the requests it receives and
+// replying with the statuses provided in order (the last one is repeated).
+func newStandIn(t *testing.T, statuses ...int) (*httptest.Server, func() []recordedRequest) {
+	var mu sync.Mutex
+	var requests []recordedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, recordedRequest{r.Method, r.URL.EscapedPath(), r.Header.Clone(), body})
+		status := statuses[len(statuses)-1]
+		if len(requests) <= len(statuses) {
+			status = statuses[len(requests)-1]
+		}
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []recordedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]recordedRequest(nil), requests...)
+	}
+}
+
+func testNotification() *Notification {
+	return &Notification{
+		Class:     "rollout_failed",
+		Severity:  "error",
+		Version:   "2.0.0",
+		AppID:     "e96281a6-d1af-4bde-9a0a-97b76e56dc57",
+		AppName:   "Flatcar",
+		GroupID:   "5b810680-e36a-4879-b98a-4f989e80b899",
+		GroupName: "Stable",
+		Message:   "There was an error rolling out version 2.0.0",
+		CreatedTs: time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	srv, requests := newStandIn(t, http.StatusOK)
+	n := testNotification()
+
+	err := NewWebhookNotifier(srv.URL+"/hook", "s3cr3t", srv.Client()).Notify(n)
+	require.NoError(t, err)
+
+	reqs := requests()
+	require.Len(t, reqs, 1)
+	assert.Equal(t, http.MethodPost, reqs[0].method)
+	assert.Equal(t, "/hook", reqs[0].path)
+	assert.Equal(t, "application/json", reqs[0].header.Get("Content-Type"))
+	timestamp, err := strconv.ParseInt(reqs[0].header.Get(TimestampHeader), 10, 64)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), time.Unix(timestamp, 0), time.Minute)
+	assert.Equal(t, "sha256="+Sign("s3cr3t", reqs[0].header.Get(TimestampHeader), reqs[0].body), reqs[0].header.Get(SignatureHeader))
+	assert.NotEqual(t, Sign("s3cr3t", "0", reqs[0].body), Sign("s3cr3t", reqs[0].header.Get(TimestampHeader), reqs[0].body))
+
+	var received Notification
+	require.NoError(t, json.Unmarshal(reqs[0].body, &received))
+	assert.Equal(t, *n, received)
+
+	err = NewWebhookNotifier(srv.URL, "", srv.Client()).Notify(n)
+	require.NoError(t, err)
+	assert.Empty(t, requests()[1].header.Get(SignatureHeader))
+	assert.Empty(t, requests()[1].header.Get(TimestampHeader))
+}
+
+func TestWebhookNotifier_ErrorStatus(t *testing.T) {
+	srv, _ := newStandIn(t, http.StatusInternalServerError)
+
+	err := NewWebhookNotifier(srv.URL, "", srv.Client()).Notify(testNotification())
+	assert.Error(t, err)
+}
+
+func TestSlackNotifier(t *testing.T) {
+	srv, requests := newStandIn(t, http.StatusOK)
+
+	err := NewSlackNotifier(srv.URL+"/services/T0/B0/X", srv.Client()).Notify(testNotification())
+	require.NoError(t, err)
+
+	reqs := requests()
+	require.Len(t, reqs, 1)
+	assert.Equal(t, http.MethodPost, reqs[0].method)
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(reqs[0].body, &body))
+	assert.Equal(t, "[error] Flatcar > Stable: There was an error rolling out version 2.0.0", body["text"])
+}
+
+func TestMatrixNotifier(t *testing.T) {
+	srv, requests := newStandIn(t, http.StatusOK)
+	n := testNotification()
+	notifier := NewMatrixNotifier(srv.URL+"/", "!room:example.org", "token", srv.Client())
+
+	require.NoError(t, notifier.Notify(n))
+	require.NoError(t, notifier.Notify(n))
+
+	reqs := requests()
+	require.Len(t, reqs, 2)
+	assert.Equal(t, http.MethodPut, reqs[0].method)
+	assert.True(t, strings.HasPrefix(reqs[0].path, "/_matrix/client/r0/rooms/%21room:example.org/send/m.room.message/nebraska-"))
+	assert.Equal(t, "Bearer token", reqs[0].header.Get("Authorization"))
+	assert.Equal(t, reqs[0].path, reqs[1].path, "retried notifications must reuse the transaction id")
+
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(reqs[0].body, &body))
+	assert.Equal(t, "m.notice", body["msgtype"])
+	assert.Equal(t, n.Text(), body["body"])
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	var gotAddr, gotFrom string
+	var gotTo []string
+	var gotMsg []byte
+	notifier := NewSMTPNotifier("127.0.0.1:2525", "user", "pass", "nebraska@example.org", []string{"ops@example.org"})
+	notifier.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotFrom, gotTo, gotMsg = addr, from, to, msg
+		assert.NotNil(t, a)
+		return nil
+	}
+
+	require.NoError(t, notifier.Notify(testNotification()))
+	assert.Equal(t, "127.0.0.1:2525", gotAddr)
+	assert.Equal(t, "nebraska@example.org", gotFrom)
+	assert.Equal(t, []string{"ops@example.org"}, gotTo)
+	assert.Contains(t, string(gotMsg), "Subject: [Nebraska] Flatcar: rollout failed 2.0.0\r\n")
+	assert.Contains(t, string(gotMsg), "\r\n\r\n[error] Flatcar > Stable: ")
+}
+
+type fakeNotifier struct {
+	failures int
+	calls    int
+}
+
+func (f *fakeNotifier) Notify(n *Notification) error {
+	f.calls++
+	if f.calls <= f.failures {
+		return errors.New("delivery failed")
+	}
+	return nil
+}
+
+func TestDispatcher_Routing(t *testing.T) {
+	all := &fakeNotifier{}
+	errorsOnly := &fakeNotifier{}
+	otherApp := &fakeNotifier{}
+	rollouts := &fakeNotifier{}
+	d := NewDispatcher([]*Route{
+		{Name: "all", Notifier: all},
+		{Name: "errors", Notifier: errorsOnly, Severities: []string{"error"}, Apps: []string{"flatcar"}},
+		{Name: "other", Notifier: otherApp, Apps: []string{"b0b5c2b5-6c7f-4b8c-8f3c-0d3a2bb1e6f4"}},
+		{Name: "rollouts", Notifier: rollouts, Classes: []string{"rollout_started", "rollout_finished"}},
+	}, 1, 0)
+
+	require.NoError(t, d.Notify(testNotification()))
+	assert.Equal(t, 1, all.calls)
+	assert.Equal(t, 1, errorsOnly.calls)
+	assert.Equal(t, 0, otherApp.calls)
+	assert.Equal(t, 0, rollouts.calls)
+
+	n := testNotification()
+	n.Class, n.Severity = "rollout_started", "info"
+	require.NoError(t, d.Notify(n))
+	assert.Equal(t, 2, all.calls)
+	assert.Equal(t, 1, errorsOnly.calls)
+	assert.Equal(t, 1, rollouts.calls)
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	flaky := &fakeNotifier{failures: 2}
+	d := NewDispatcher([]*Route{{Name: "flaky", Notifier: flaky}}, 3, time.Millisecond)
+	assert.NoError(t, d.Notify(testNotification()))
+	assert.Equal(t, 3, flaky.calls)
+
+	broken := &fakeNotifier{failures: 10}
+	d = NewDispatcher([]*Route{{Name: "broken", Notifier: broken}}, 2, time.Millisecond)
+	assert.Error(t, d.Notify(testNotification()))
+	assert.Equal(t, 2, broken.calls)
+}
+
+func TestDispatcher_RetryAgainstStandIn(t *testing.T) {
+	srv, requests := newStandIn(t, http.StatusBadGateway, http.StatusOK)
+	d := NewDispatcher([]*Route{{Name: "webhook", Notifier: NewWebhookNotifier(srv.URL, "", srv.Client())}}, 3, time.Millisecond)
+
+	assert.NoError(t, d.Notify(testNotification()))
+	assert.Len(t, requests(), 2)
+}
+
+func TestLoadConfig(t *testing.T) {
+	os.Setenv("NEBRASKA_TEST_SLACK_URL", "https://hooks.slack.example/services/T0/B0/X")
+	defer os.Unsetenv("NEBRASKA_TEST_SLACK_URL")
+
+	path := filepath.Join(t.TempDir(), "notifications.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+retry:
+  attempts: 5
+  backoff: 2s
+notifiers:
+  - name: ops-slack
+    type: slack
+    url: ${NEBRASKA_TEST_SLACK_URL}
+    severities: [warning, error]
+  - type: webhook
+    url: https://hooks.example.org/nebraska
+    secret: s3cr3t
+    apps: [flatcar, "${NEBRASKA_TEST_SLACK_URL}"]
+`), 0600))
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, 5, config.Retry.Attempts)
+	require.Len(t, config.Notifiers, 2)
+	assert.Equal(t, "https://hooks.slack.example/services/T0/B0/X", config.Notifiers[0].URL)
+	assert.Equal(t, []string{"warning", "error"}, config.Notifiers[0].Severities)
+	// Only the settings are expanded.
+	assert.Equal(t, []string{"flatcar", "${NEBRASKA_TEST_SLACK_URL}"}, config.Notifiers[1].Apps)
+
+	d, err := NewDispatcherFromConfig(config)
+	require.NoError(t, err)
+	assert.Equal(t, 5, d.retryAttempts)
+	assert.Equal(t, 2*time.Second, d.retryBackoff)
+	require.Len(t, d.routes, 2)
+	assert.Equal(t, "ops-slack", d.routes[0].Name)
+	assert.Equal(t, "webhook-1", d.routes[1].Name)
+
+	_, err = NewDispatcherFromConfig(&Config{Notifiers: []NotifierConfig{{Type: "hipchat"}}})
+	assert.True(t, errors.Is(err, ErrUnknownNotifierType))
+	_, err = NewDispatcherFromConfig(&Config{Notifiers: []NotifierConfig{{Type: "matrix", RoomID: "!room:example.org"}}})
+	assert.True(t, errors.Is(err, ErrMissingNotifierSetting))
+}
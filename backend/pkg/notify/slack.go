@@ -0,0 +1,33 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// SlackNotifier is a Notifier posting notifications to a Slack incoming
+// webhook.
+type SlackNotifier struct {
+	url        string
+	httpClient *http.Client
+}
+
+var _ Notifier = &SlackNotifier{}
+
+// NewSlackNotifier creates a new SlackNotifier posting to the incoming
+// webhook url provided.
+func NewSlackNotifier(url string, httpClient *http.Client) *SlackNotifier {
+	return &SlackNotifier{
+		url:        url,
+		httpClient: httpClient,
+	}
+}
+
+// Notify posts the notification provided to Slack.
+func (s *SlackNotifier) Notify(n *Notification) error {
+	body, err := json.Marshal(map[string]string{"text": n.Text()})
+	if err != nil {
+		return err
+	}
+	return postJSON(s.httpClient, http.MethodPost, s.url, body, nil)
+}
@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// SMTPNotifier is a Notifier sending notifications by email.
+type SMTPNotifier struct {
+	address  string
+	username string
+	password string
+	from     string
+	to       []string
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+var _ Notifier = &SMTPNotifier{}
+
+// NewSMTPNotifier creates a new SMTPNotifier sending emails to the recipients
+// provided through the SMTP server at the given address (host:port). Plain
+// authentication is used when a username is provided.
+func NewSMTPNotifier(address, username, password, from string, to []string) *SMTPNotifier {
+	return &SMTPNotifier{
+		address:  address,
+		username: username,
+		password: password,
+		from:     from,
+		to:       to,
+		sendMail: smtp.SendMail,
+	}
+}
+
+// Notify sends the notification provided by email.
+func (s *SMTPNotifier) Notify(n *Notification) error {
+	var auth smtp.Auth
+	if s.username != "" {
+		host, _, err := net.SplitHostPort(s.address)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.username, s.password, host)
+	}
+	return s.sendMail(s.address, auth, s.from, s.to, s.message(n))
+}
+
+func (s *SMTPNotifier) message(n *Notification) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&b, "Subject: [Nebraska] %s: %s %s\r\n", n.AppName, strings.ReplaceAll(n.Class, "_", " "), n.Version)
+	fmt.Fprintf(&b, "Date: %s\r\n", n.CreatedTs.Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(n.Text())
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
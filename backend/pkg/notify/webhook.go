@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// SignatureHeader is the header holding the HMAC-SHA256 signature of
+	// the requests sent by the webhook notifier (see Sign).
+	SignatureHeader = "X-Nebraska-Signature"
+
+	// TimestampHeader is the header holding the time the requests sent by
+	// the webhook notifier were signed at, as a unix timestamp. Receivers
+	// can reject old requests to prevent them from being replayed.
+	TimestampHeader = "X-Nebraska-Timestamp"
+)
+
+// WebhookNotifier is a Notifier posting notifications as JSON documents to a
+// generic webhook. When a secret is set, requests are signed so that
+// receivers can verify they were sent by Nebraska.
+type WebhookNotifier struct {
+	url        string
+	secret     string
+	httpClient *http.Client
+}
+
+var _ Notifier = &WebhookNotifier{}
+
+// NewWebhookNotifier creates a new WebhookNotifier posting to the url
+// provided.
+func NewWebhookNotifier(url, secret string, httpClient *http.Client) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:        url,
+		secret:     secret,
+		httpClient: httpClient,
+	}
+}
+
+// Notify posts the notification provided to the webhook.
+func (w *WebhookNotifier) Notify(n *Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{}
+	if w.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		headers[TimestampHeader] = timestamp
+		headers[SignatureHeader] = "sha256=" + Sign(w.secret, timestamp, body)
+	}
+	return postJSON(w.httpClient, http.MethodPost, w.url, body, headers)
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the timestamp and the body
+// provided, joined by a dot, using the given secret.
+func Sign(secret, timestamp string, body []byte) string {
+	return hmacSHA256(secret, []byte(timestamp+"."), body)
+}
+
+// hmacSHA256 returns the hex encoded HMAC-SHA256 of the concatenation of the
+// data provided using the given key.
+func hmacSHA256(key string, data ...[]byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	for _, d := range data {
+		_, _ = mac.Write(d)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,217 @@
+package omaha
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Client Update Protocol (CUP) parameters, following the ECDSA flavour used
+// by Chromium's updater. Clients send the version of the key they trust and a
+// nonce in the cup2key query parameter (as "<version>:<nonce>"), and may send
+// the hex encoded SHA-256 of the request body in cup2hreq. The response is
+// signed over the request, the response and the cup2key value, and the proof
+// is returned in the CUPServerProofHeader header, as
+// "<hex DER signature>:<hex SHA-256 of the request>".
+const (
+	CUPKeyParam          = "cup2key"
+	CUPRequestHashParam  = "cup2hreq"
+	CUPServerProofHeader = "X-Cup-Server-Proof"
+)
+
+var (
+	// ErrCUPInvalidKeyParam error indicates that the cup2key parameter of a
+	// request is not a key version followed by a valid nonce.
+	ErrCUPInvalidKeyParam = errors.New("omaha: invalid cup2key parameter")
+
+	// ErrCUPUnknownKeyVersion error indicates that the key version requested
+	// is not one of the signing keys loaded.
+	ErrCUPUnknownKeyVersion = errors.New("omaha: unknown cup key version")
+
+	// ErrCUPRequestHashMismatch error indicates that the cup2hreq parameter
+	// of a request doesn't match the request received.
+	ErrCUPRequestHashMismatch = errors.New("omaha: cup request hash mismatch")
+
+	// ErrCUPNoKeys error indicates that no signing keys were found.
+	ErrCUPNoKeys = errors.New("omaha: no cup signing keys found")
+
+	// Nonces are 8 to 64 characters of base64 (url or standard alphabets) or
+	// hex, clients are expected to send at least 32 bits of randomness.
+	cupNonceRegexp = regexp.MustCompile(`^[A-Za-z0-9_\-+/=]{8,64}$`)
+
+	cupKeyFileRegexp = regexp.MustCompile(`^([0-9]+)\.pem$`)
+)
+
+// CUPSigner signs Omaha responses with ECDSA P-256 keys. Several versions of
+// the key can be loaded at the same time, so keys can be rotated while
+// clients trusting the previous version are still around: each request is
+// signed with the key version it asks for.
+type CUPSigner struct {
+	keys   map[int]*ecdsa.PrivateKey
+	latest int
+}
+
+// NewCUPSigner creates a signer using the keys provided, indexed by version.
+func NewCUPSigner(keys map[int]*ecdsa.PrivateKey) (*CUPSigner, error) {
+	if len(keys) == 0 {
+		return nil, ErrCUPNoKeys
+	}
+	s := &CUPSigner{keys: make(map[int]*ecdsa.PrivateKey, len(keys)), latest: -1}
+	for version, key := range keys {
+		if version < 0 {
+			return nil, fmt.Errorf("invalid cup key version %d", version)
+		}
+		if key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("cup key version %d: only P-256 keys are supported", version)
+		}
+		s.keys[version] = key
+		if version > s.latest {
+			s.latest = version
+		}
+	}
+	return s, nil
+}
+
+// LoadCUPSigner creates a signer using the keys found in the directory
+// provided. Keys are PEM encoded ECDSA P-256 private keys (SEC 1 or PKCS #8),
+// stored in files named after their version, like 1.pem, 2.pem, etc. Other
+// files are ignored.
+func LoadCUPSigner(dir string) (*CUPSigner, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[int]*ecdsa.PrivateKey)
+	for _, file := range files {
+		matches := cupKeyFileRegexp.FindStringSubmatch(file.Name())
+		if file.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, fmt.Errorf("cup key %s: %w", file.Name(), err)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		key, err := parseCUPKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("cup key %s: %w", file.Name(), err)
+		}
+		keys[version] = key
+	}
+	return NewCUPSigner(keys)
+}
+
+func parseCUPKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		ecKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("not an ECDSA key")
+		}
+		return ecKey, nil
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+}
+
+// LatestKeyVersion returns the highest version of the keys loaded.
+func (s *CUPSigner) LatestKeyVersion() int {
+	return s.latest
+}
+
+// Validate checks that the request provided can be signed using the key
+// version and nonce in cup2key, and that the request hash sent by the client
+// in cup2hreq, if any, matches it. Requests should be validated before being
+// processed, so that requests whose response can't be signed don't have any
+// effect.
+func (s *CUPSigner) Validate(cup2key, cup2hreq string, request []byte) error {
+	_, err := s.signingKey(cup2key, cup2hreq, request)
+	return err
+}
+
+// Sign signs the response to the request provided, using the key version and
+// nonce in cup2key. The request is validated like in Validate. It returns the
+// value of the CUPServerProofHeader.
+func (s *CUPSigner) Sign(cup2key, cup2hreq string, request, response []byte) (string, error) {
+	key, err := s.signingKey(cup2key, cup2hreq, request)
+	if err != nil {
+		return "", err
+	}
+
+	requestHash := sha256.Sum256(request)
+	digest := CUPSignedDigest(cup2key, request, response)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(signature) + ":" + hex.EncodeToString(requestHash[:]), nil
+}
+
+// signingKey returns the key the response to the request provided must be
+// signed with, validating the request's CUP parameters.
+func (s *CUPSigner) signingKey(cup2key, cup2hreq string, request []byte) (*ecdsa.PrivateKey, error) {
+	version, err := parseCUPKeyParam(cup2key)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := s.keys[version]
+	if !ok {
+		return nil, ErrCUPUnknownKeyVersion
+	}
+
+	requestHash := sha256.Sum256(request)
+	if cup2hreq != "" && !strings.EqualFold(cup2hreq, hex.EncodeToString(requestHash[:])) {
+		return nil, ErrCUPRequestHashMismatch
+	}
+	return key, nil
+}
+
+// CUPSignedDigest returns the digest signed for the exchange provided: the
+// SHA-256 of the request hash, the response hash and the cup2key value.
+func CUPSignedDigest(cup2key string, request, response []byte) [sha256.Size]byte {
+	requestHash := sha256.Sum256(request)
+	responseHash := sha256.Sum256(response)
+	message := make([]byte, 0, 2*sha256.Size+len(cup2key))
+	message = append(message, requestHash[:]...)
+	message = append(message, responseHash[:]...)
+	message = append(message, cup2key...)
+	return sha256.Sum256(message)
+}
+
+// parseCUPKeyParam returns the key version of the cup2key parameter provided,
+// validating its nonce.
+func parseCUPKeyParam(cup2key string) (int, error) {
+	parts := strings.SplitN(cup2key, ":", 2)
+	if len(parts) != 2 || !cupNonceRegexp.MatchString(parts[1]) {
+		return 0, ErrCUPInvalidKeyParam
+	}
+	version, err := strconv.Atoi(parts[0])
+	if err != nil || version < 0 {
+		return 0, ErrCUPInvalidKeyParam
+	}
+	return version, nil
+}
@@ -0,0 +1,85 @@
+package omaha
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCUPSigner(t *testing.T) {
+	key1, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	key2, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "nebraska-cup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	der, err := x509.MarshalECPrivateKey(key1)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "1.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600))
+	der, err = x509.MarshalPKCS8PrivateKey(key2)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "2.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README"), []byte("ignored"), 0600))
+
+	signer, err := LoadCUPSigner(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, signer.LatestKeyVersion())
+
+	request := []byte(`<request protocol="3.0"></request>`)
+	response := []byte(`<response protocol="3.0"></response>`)
+	requestHash := sha256.Sum256(request)
+
+	// Requests are signed with the key version they ask for.
+	for version, key := range map[string]*ecdsa.PrivateKey{"1": key1, "2": key2} {
+		cup2key := version + ":c3VwZXJzZWNyZXRub25jZQ"
+		proof, err := signer.Sign(cup2key, hex.EncodeToString(requestHash[:]), request, response)
+		require.NoError(t, err)
+		parts := strings.Split(proof, ":")
+		require.Len(t, parts, 2)
+		assert.Equal(t, hex.EncodeToString(requestHash[:]), parts[1])
+		signature, err := hex.DecodeString(parts[0])
+		require.NoError(t, err)
+		digest := CUPSignedDigest(cup2key, request, response)
+		assert.True(t, ecdsa.VerifyASN1(&key.PublicKey, digest[:], signature))
+		tampered := CUPSignedDigest(cup2key, request, []byte(`<response protocol="3.0"><app/></response>`))
+		assert.False(t, ecdsa.VerifyASN1(&key.PublicKey, tampered[:], signature))
+	}
+
+	// Requests are validated before being processed, and when signing.
+	assert.NoError(t, signer.Validate("1:c3VwZXJzZWNyZXRub25jZQ", "", request))
+	assert.Equal(t, ErrCUPUnknownKeyVersion, signer.Validate("3:c3VwZXJzZWNyZXRub25jZQ", "", request))
+	_, err = signer.Sign("3:c3VwZXJzZWNyZXRub25jZQ", "", request, response)
+	assert.Equal(t, ErrCUPUnknownKeyVersion, err)
+	assert.Equal(t, ErrCUPRequestHashMismatch, signer.Validate("1:c3VwZXJzZWNyZXRub25jZQ", hex.EncodeToString(requestHash[:4]), request))
+	_, err = signer.Sign("1:c3VwZXJzZWNyZXRub25jZQ", hex.EncodeToString(requestHash[:4]), request, response)
+	assert.Equal(t, ErrCUPRequestHashMismatch, err)
+	for _, cup2key := range []string{"", "1", "1:", "1:short", "a:c3VwZXJzZWNyZXRub25jZQ", "-1:c3VwZXJzZWNyZXRub25jZQ", "1:not a valid nonce", "1:" + strings.Repeat("a", 65)} {
+		assert.Equal(t, ErrCUPInvalidKeyParam, signer.Validate(cup2key, "", request), cup2key)
+		_, err = signer.Sign(cup2key, "", request, response)
+		assert.Equal(t, ErrCUPInvalidKeyParam, err, cup2key)
+	}
+}
+
+func TestNewCUPSigner(t *testing.T) {
+	_, err := NewCUPSigner(nil)
+	assert.Equal(t, ErrCUPNoKeys, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	_, err = NewCUPSigner(map[int]*ecdsa.PrivateKey{1: key})
+	assert.Error(t, err, "Only P-256 keys are supported.")
+}
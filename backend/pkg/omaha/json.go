@@ -0,0 +1,237 @@
+package omaha
+
+import (
+	omahaSpec "github.com/kinvolk/go-omaha/omaha"
+)
+
+// jsonProtocolVersion is the version of the Omaha protocol reported in JSON
+// responses, the first one defining a JSON encoding.
+const jsonProtocolVersion = "3.1"
+
+// The types below describe the JSON flavour of the Omaha protocol. Requests
+// are converted to their XML counterparts after being decoded, and responses
+// are built from the XML ones, so that both flavours go through the same
+// request processing logic.
+
+type jsonRequest struct {
+	Request *jsonRequestBody `json:"request"`
+}
+
+type jsonRequestBody struct {
+	Protocol string            `json:"protocol"`
+	OS       *jsonOS           `json:"os,omitempty"`
+	Apps     []*jsonAppRequest `json:"app"`
+}
+
+type jsonOS struct {
+	Platform    string `json:"platform,omitempty"`
+	Version     string `json:"version,omitempty"`
+	ServicePack string `json:"sp,omitempty"`
+	Arch        string `json:"arch,omitempty"`
+}
+
+type jsonAppRequest struct {
+	ID           string              `json:"appid"`
+	Version      string              `json:"version"`
+	Track        string              `json:"track,omitempty"`
+	MachineID    string              `json:"machineid,omitempty"`
+	MachineAlias string              `json:"machinealias,omitempty"`
+	Board        string              `json:"board,omitempty"`
+	UpdateCheck  *struct{}           `json:"updatecheck,omitempty"`
+	Ping         *struct{}           `json:"ping,omitempty"`
+	Events       []*jsonEventRequest `json:"event,omitempty"`
+}
+
+type jsonEventRequest struct {
+	Type            int    `json:"eventtype"`
+	Result          int    `json:"eventresult"`
+	PreviousVersion string `json:"previousversion,omitempty"`
+	ErrorCode       int    `json:"errorcode,omitempty"`
+}
+
+type jsonResponse struct {
+	Response *jsonResponseBody `json:"response"`
+}
+
+type jsonResponseBody struct {
+	Protocol string             `json:"protocol"`
+	Server   string             `json:"server"`
+	Apps     []*jsonAppResponse `json:"app"`
+}
+
+type jsonAppResponse struct {
+	ID          string              `json:"appid"`
+	Status      string              `json:"status"`
+	UpdateCheck *jsonUpdateResponse `json:"updatecheck,omitempty"`
+	Ping        *jsonStatus         `json:"ping,omitempty"`
+	Events      []*jsonStatus       `json:"event,omitempty"`
+}
+
+type jsonStatus struct {
+	Status string `json:"status"`
+}
+
+type jsonUpdateResponse struct {
+	Status   string        `json:"status"`
+	URLs     *jsonURLs     `json:"urls,omitempty"`
+	Manifest *jsonManifest `json:"manifest,omitempty"`
+}
+
+type jsonURLs struct {
+	URLs []*jsonURL `json:"url"`
+}
+
+type jsonURL struct {
+	CodeBase string `json:"codebase"`
+}
+
+type jsonManifest struct {
+	Version  string        `json:"version"`
+	Packages *jsonPackages `json:"packages,omitempty"`
+	Actions  *jsonActions  `json:"actions,omitempty"`
+}
+
+type jsonPackages struct {
+	Packages []*jsonPackage `json:"package"`
+}
+
+type jsonPackage struct {
+	Name     string `json:"name"`
+	Hash     string `json:"hash"`
+	Size     uint64 `json:"size"`
+	Required bool   `json:"required"`
+}
+
+type jsonActions struct {
+	Actions []*jsonAction `json:"action"`
+}
+
+// jsonAction keeps the attribute names used by the Flatcar postinstall
+// action in XML responses.
+type jsonAction struct {
+	Event                 string `json:"event"`
+	DisplayVersion        string `json:"ChromeOSVersion,omitempty"`
+	SHA256                string `json:"sha256,omitempty"`
+	NeedsAdmin            bool   `json:"needsadmin"`
+	IsDeltaPayload        bool   `json:"IsDeltaPayload"`
+	DisablePayloadBackoff bool   `json:"DisablePayloadBackoff,omitempty"`
+	MetadataSignatureRsa  string `json:"MetadataSignatureRsa,omitempty"`
+	MetadataSize          string `json:"MetadataSize,omitempty"`
+	Deadline              string `json:"deadline,omitempty"`
+}
+
+// omahaRequest converts the JSON request into its XML counterpart.
+func (r *jsonRequest) omahaRequest() (*omahaSpec.Request, error) {
+	if r.Request == nil {
+		return nil, ErrMalformedRequest
+	}
+
+	omahaReq := &omahaSpec.Request{}
+	if os := r.Request.OS; os != nil {
+		omahaReq.OS = &omahaSpec.OS{
+			Platform:    os.Platform,
+			Version:     os.Version,
+			ServicePack: os.ServicePack,
+			Arch:        os.Arch,
+		}
+	}
+
+	for _, app := range r.Request.Apps {
+		if app == nil {
+			return nil, ErrMalformedRequest
+		}
+		appReq := omahaReq.AddApp(app.ID, app.Version)
+		appReq.Track = app.Track
+		appReq.MachineID = app.MachineID
+		appReq.MachineAlias = app.MachineAlias
+		appReq.Board = app.Board
+		if app.UpdateCheck != nil {
+			appReq.AddUpdateCheck()
+		}
+		if app.Ping != nil {
+			appReq.AddPing()
+		}
+		for _, event := range app.Events {
+			if event == nil {
+				return nil, ErrMalformedRequest
+			}
+			eventReq := appReq.AddEvent()
+			eventReq.Type = omahaSpec.EventType(event.Type)
+			eventReq.Result = omahaSpec.EventResult(event.Result)
+			eventReq.PreviousVersion = event.PreviousVersion
+			eventReq.ErrorCode = event.ErrorCode
+		}
+	}
+
+	return omahaReq, nil
+}
+
+// newJSONResponse converts the XML response provided into its JSON
+// counterpart.
+func newJSONResponse(omahaResp *omahaSpec.Response) *jsonResponse {
+	body := &jsonResponseBody{
+		Protocol: jsonProtocolVersion,
+		Server:   omahaResp.Server,
+		Apps:     []*jsonAppResponse{},
+	}
+
+	for _, respApp := range omahaResp.Apps {
+		app := &jsonAppResponse{
+			ID:     respApp.ID,
+			Status: string(respApp.Status),
+		}
+		if respApp.Ping != nil {
+			app.Ping = &jsonStatus{Status: respApp.Ping.Status}
+		}
+		for _, event := range respApp.Events {
+			app.Events = append(app.Events, &jsonStatus{Status: event.Status})
+		}
+		if updateCheck := respApp.UpdateCheck; updateCheck != nil {
+			app.UpdateCheck = &jsonUpdateResponse{Status: string(updateCheck.Status)}
+			if len(updateCheck.URLs) > 0 {
+				app.UpdateCheck.URLs = &jsonURLs{}
+				for _, u := range updateCheck.URLs {
+					app.UpdateCheck.URLs.URLs = append(app.UpdateCheck.URLs.URLs, &jsonURL{CodeBase: u.CodeBase})
+				}
+			}
+			if updateCheck.Manifest != nil {
+				app.UpdateCheck.Manifest = newJSONManifest(updateCheck.Manifest)
+			}
+		}
+		body.Apps = append(body.Apps, app)
+	}
+
+	return &jsonResponse{Response: body}
+}
+
+func newJSONManifest(manifest *omahaSpec.Manifest) *jsonManifest {
+	m := &jsonManifest{Version: manifest.Version}
+	if len(manifest.Packages) > 0 {
+		m.Packages = &jsonPackages{}
+		for _, p := range manifest.Packages {
+			m.Packages.Packages = append(m.Packages.Packages, &jsonPackage{
+				Name:     p.Name,
+				Hash:     p.SHA1,
+				Size:     p.Size,
+				Required: p.Required,
+			})
+		}
+	}
+	if len(manifest.Actions) > 0 {
+		m.Actions = &jsonActions{}
+		for _, a := range manifest.Actions {
+			m.Actions.Actions = append(m.Actions.Actions, &jsonAction{
+				Event:                 a.Event,
+				DisplayVersion:        a.DisplayVersion,
+				SHA256:                a.SHA256,
+				NeedsAdmin:            a.NeedsAdmin,
+				IsDeltaPayload:        a.IsDeltaPayload,
+				DisablePayloadBackoff: a.DisablePayloadBackoff,
+				MetadataSignatureRsa:  a.MetadataSignatureRsa,
+				MetadataSize:          a.MetadataSize,
+				Deadline:              a.Deadline,
+			})
+		}
+	}
+	return m
+}
@@ -1,6 +1,7 @@
 package omaha
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -46,10 +47,14 @@ type Handler struct {
 }
 
 // NewHandler creates a new Handler instance.
-func NewHandler(crAPI *api.API) *Handler {
-	return &Handler{
+func NewHandler(crAPI *api.API, options ...func(*Handler)) *Handler {
+	h := &Handler{
 		crAPI: crAPI,
 	}
+	for _, option := range options {
+		option(h)
+	}
+	return h
 }
 
 // Handle is in charge of processing an Omaha request.
@@ -60,16 +65,50 @@ func (h *Handler) Handle(rawReq io.Reader, respWriter io.Writer, ip string) erro
 		logger.Warn().Msgf("Handle - malformed omaha request error %s", err.Error())
 		return fmt.Errorf("%s: %w", ErrMalformedRequest, err)
 	}
+
+	omahaResp, err := h.handleRequest(omahaReq, ip)
+	if err != nil {
+		return err
+	}
+
+	return xml.NewEncoder(respWriter).Encode(omahaResp)
+}
+
+// HandleJSON is in charge of processing an Omaha request encoded using the
+// JSON flavour of the protocol (Omaha 3.1). The response is encoded in JSON
+// as well.
+func (h *Handler) HandleJSON(rawReq io.Reader, respWriter io.Writer, ip string) error {
+	var jsonReq jsonRequest
+
+	if err := json.NewDecoder(rawReq).Decode(&jsonReq); err != nil {
+		logger.Warn().Msgf("HandleJSON - malformed omaha request error %s", err.Error())
+		return fmt.Errorf("%s: %w", ErrMalformedRequest, err)
+	}
+	omahaReq, err := jsonReq.omahaRequest()
+	if err != nil {
+		logger.Warn().Msgf("HandleJSON - malformed omaha request error %s", err.Error())
+		return err
+	}
+
+	omahaResp, err := h.handleRequest(omahaReq, ip)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(respWriter).Encode(newJSONResponse(omahaResp))
+}
+
+func (h *Handler) handleRequest(omahaReq *omahaSpec.Request, ip string) (*omahaSpec.Response, error) {
 	trace(omahaReq)
 
 	omahaResp, err := h.buildOmahaResponse(omahaReq, ip)
 	if err != nil {
 		logger.Warn().Msgf("Handle - error building omaha response error %s", err.Error())
-		return ErrMalformedResponse
+		return nil, ErrMalformedResponse
 	}
 	trace(omahaResp)
 
-	return xml.NewEncoder(respWriter).Encode(omahaResp)
+	return omahaResp, nil
 }
 
 func getArch(os *omahaSpec.OS, appReq *omahaSpec.AppRequest) api.Arch {
@@ -91,58 +130,105 @@ func (h *Handler) buildOmahaResponse(omahaReq *omahaSpec.Request, ip string) (*o
 	omahaResp := omahaSpec.NewResponse()
 	omahaResp.Server = "nebraska"
 
+	// Each app is evaluated on its own, so an app failing doesn't prevent
+	// the other apps in the request from getting their response.
 	for _, reqApp := range omahaReq.Apps {
 		respApp := omahaResp.AddApp(reqApp.ID, omahaSpec.AppOK)
+		h.buildAppResponse(omahaReq, reqApp, respApp, ip)
+	}
 
-		// Use the Omaha track field to find the group. It preferably contains the group's track name
-		// but also allows the old hard-coded CoreOS group UUIDs until we now that they are not used.
-		group := reqApp.Track
-		if trackName, ok := initialFlatcarGroups[group]; ok {
-			logger.Info().Str("machineId", reqApp.MachineID).Str("uuid", group).Msgf("buildOmahaResponse - found client using a hard-coded group UUID")
-			group = trackName
-		}
-		groupID, err := h.crAPI.GetGroupID(group, getArch(omahaReq.OS, reqApp))
-		if err == nil {
-			group = groupID
-		} else {
-			logger.Info().Str("machineId", reqApp.MachineID).Str("track", group).Msgf("buildOmahaResponse - no group found for track and arch error %s", err.Error())
-			respApp.Status = h.getStatusMessage(err)
+	return omahaResp, nil
+}
+
+// buildAppResponse processes the events, ping and update check of an app in
+// the request, filling its response. Failures are reported in the status of
+// the app response.
+func (h *Handler) buildAppResponse(omahaReq *omahaSpec.Request, reqApp *omahaSpec.AppRequest, respApp *omahaSpec.AppResponse, ip string) {
+	// Use the Omaha track field to find the group. It preferably contains the group's track name
+	// but also allows the old hard-coded CoreOS group UUIDs until we now that they are not used.
+	group := reqApp.Track
+	if trackName, ok := initialFlatcarGroups[group]; ok {
+		logger.Info().Str("machineId", reqApp.MachineID).Str("uuid", group).Msgf("buildOmahaResponse - found client using a hard-coded group UUID")
+		group = trackName
+	}
+	arch := getArch(omahaReq.OS, reqApp)
+	groupID, err := h.crAPI.GetGroupID(group, arch)
+	if err != nil {
+		logger.Info().Str("machineId", reqApp.MachineID).Str("appID", reqApp.ID).Str("track", group).Msgf("buildOmahaResponse - no group found for track and arch error %s", err.Error())
+		respApp.Status = h.getStatusMessage(err)
+		if reqApp.UpdateCheck != nil {
 			respApp.AddUpdateCheck(omahaSpec.UpdateInternalError)
-			return omahaResp, nil
 		}
+		return
+	}
+	group = groupID
 
-		for _, event := range reqApp.Events {
-			if err := h.processEvent(reqApp.MachineID, reqApp.ID, group, event); err != nil {
-				logger.Debug().Str("machineId", reqApp.MachineID).Msgf("processEvent error %s", err.Error())
-			}
-			respApp.AddEvent()
+	// The events and the ping of the app are registered in a transaction,
+	// so the update check sees all of their consequences or none. Most
+	// requests only have a ping, which doesn't need one.
+	if len(reqApp.Events) == 0 {
+		if reqApp.Ping != nil {
+			h.processPing(h.crAPI, reqApp, ip, group)
 		}
+	} else if err := h.crAPI.RunInTransaction(func(tx *api.API) error {
+		h.processEventsAndPing(tx, reqApp, ip, group)
+		return nil
+	}); err != nil {
+		logger.Error().Err(err).Str("machineId", reqApp.MachineID).Str("appID", reqApp.ID).Msg("buildAppResponse - registering events")
+	}
+	for range reqApp.Events {
+		respApp.AddEvent()
+	}
+	if reqApp.Ping != nil {
+		respApp.AddPing()
+	}
 
-		if reqApp.Ping != nil {
-			if _, err := h.crAPI.RegisterInstance(reqApp.MachineID, reqApp.MachineAlias, ip, reqApp.Version, reqApp.ID, group); err != nil {
-				logger.Debug().Str("machineId", reqApp.MachineID).Msgf("processPing error %s", err.Error())
-			}
-			respApp.AddPing()
+	if reqApp.UpdateCheck != nil {
+		pkg, err := h.crAPI.GetUpdatePackage(reqApp.MachineID, reqApp.MachineAlias, ip, reqApp.Version, reqApp.ID, group)
+		if err != nil && err != api.ErrNoUpdatePackageAvailable {
+			respApp.Status = h.getStatusMessage(err)
+			respApp.AddUpdateCheck(omahaSpec.UpdateInternalError)
+		} else {
+			h.prepareUpdateCheck(respApp, pkg, reqApp.Version, ip, group, arch)
 		}
+	}
+}
 
-		if reqApp.UpdateCheck != nil {
-			pkg, err := h.crAPI.GetUpdatePackage(reqApp.MachineID, reqApp.MachineAlias, ip, reqApp.Version, reqApp.ID, group)
-			if err != nil && err != api.ErrNoUpdatePackageAvailable {
-				respApp.Status = h.getStatusMessage(err)
-				respApp.AddUpdateCheck(omahaSpec.UpdateInternalError)
-			} else {
-				h.prepareUpdateCheck(respApp, pkg)
-			}
+// processEventsAndPing registers the events and the ping of an app in the
+// transaction the API provided runs in. Each of them is registered in a
+// nested transaction, so one failing doesn't leave partial changes behind
+// nor prevent the others from being registered.
+func (h *Handler) processEventsAndPing(tx *api.API, reqApp *omahaSpec.AppRequest, ip, group string) {
+	// Events are registered one at a time, in the order they were sent, as
+	// the consequences of an event (like an update completing) decide
+	// whether the next ones are accepted.
+	for _, event := range reqApp.Events {
+		if err := tx.RunInTransaction(func(tx *api.API) error {
+			return h.processEvent(tx, reqApp.MachineID, reqApp.ID, group, event)
+		}); err != nil {
+			logger.Debug().Str("machineId", reqApp.MachineID).Str("appID", reqApp.ID).Msgf("processEvent error %s", err.Error())
 		}
 	}
 
-	return omahaResp, nil
+	if reqApp.Ping != nil {
+		_ = tx.RunInTransaction(func(tx *api.API) error {
+			return h.processPing(tx, reqApp, ip, group)
+		})
+	}
+}
+
+func (h *Handler) processPing(crAPI *api.API, reqApp *omahaSpec.AppRequest, ip, group string) error {
+	_, err := crAPI.RegisterInstance(reqApp.MachineID, reqApp.MachineAlias, ip, reqApp.Version, reqApp.ID, group)
+	if err != nil {
+		logger.Debug().Str("machineId", reqApp.MachineID).Str("appID", reqApp.ID).Msgf("processPing error %s", err.Error())
+	}
+	return err
 }
 
-func (h *Handler) processEvent(machineID string, appID string, group string, event *omahaSpec.EventRequest) error {
+func (h *Handler) processEvent(crAPI *api.API, machineID string, appID string, group string, event *omahaSpec.EventRequest) error {
 	logger.Info().Str("machineId", machineID).Str("appID", appID).Str("group", group).Str("event", event.Type.String()+"."+event.Result.String()).Str("previousVersion", event.PreviousVersion).Msgf("processEvent eventError %d", event.ErrorCode)
 
-	return h.crAPI.RegisterEvent(machineID, appID, group, int(event.Type), int(event.Result), event.PreviousVersion, strconv.Itoa(event.ErrorCode))
+	return crAPI.RegisterEvent(machineID, appID, group, int(event.Type), int(event.Result), event.PreviousVersion, strconv.Itoa(event.ErrorCode))
 }
 
 func (h *Handler) getStatusMessage(crErr error) omahaSpec.AppStatus {
@@ -179,33 +265,51 @@ func (h *Handler) getStatusMessageStr(crErr error) string {
 	return "error-failedToRetrieveUpdatePackageInfo"
 }
 
-func (h *Handler) prepareUpdateCheck(appResp *omahaSpec.AppResponse, pkg *api.Package) {
+// prepareUpdateCheck adds to the app response the update check for the
+// package provided. When the package has a delta payload generated from the
+// version the instance is running, the delta is advertised instead of the
+// package's full payload. The mirrors of the package offered to the instance
+// (based on its ip, group and arch) are advertised before the package's url
+// along with the full payload only, as mirrors may not carry the deltas.
+func (h *Handler) prepareUpdateCheck(appResp *omahaSpec.AppResponse, pkg *api.Package, instanceVersion, ip, groupID string, arch api.Arch) {
 	if pkg == nil {
 		appResp.AddUpdateCheck(omahaSpec.NoUpdate)
 		return
 	}
 
+	url, filename, hash, size := pkg.URL, pkg.Filename, pkg.Hash, pkg.Size
+	var mirrors []string
+	delta := pkg.DeltaFrom(instanceVersion)
+	if delta != nil {
+		url, filename, hash, size = delta.URL, delta.Filename, delta.Hash, delta.Size
+	} else {
+		mirrors = pkg.MirrorURLs(ip, groupID, arch)
+	}
+
 	// Create a manifest, but do not add it to UpdateCheck until it's successful
 	manifest := &omahaSpec.Manifest{Version: pkg.Version}
 	mpkg := manifest.AddPackage()
-	mpkg.Name = pkg.Filename.String
-	mpkg.SHA1 = pkg.Hash.String
-	if pkg.Size.Valid {
-		size, err := strconv.ParseUint(pkg.Size.String, 10, 64)
+	mpkg.Name = filename.String
+	mpkg.SHA1 = hash.String
+	if size.Valid {
+		sizeBytes, err := strconv.ParseUint(size.String, 10, 64)
 		if err != nil {
 			logger.Warn().Msgf("prepareUpdateCheck bad package size %s", err.Error())
 		} else {
-			mpkg.Size = size
+			mpkg.Size = sizeBytes
 		}
 	}
 	mpkg.Required = true
 
 	switch pkg.Type {
 	case api.PkgTypeFlatcar:
-		cra, err := h.crAPI.GetFlatcarAction(pkg.ID)
-		if err != nil {
-			appResp.AddUpdateCheck(omahaSpec.UpdateInternalError)
-			return
+		cra := pkg.FlatcarAction
+		if cra == nil {
+			var err error
+			if cra, err = h.crAPI.GetFlatcarAction(pkg.ID); err != nil {
+				appResp.AddUpdateCheck(omahaSpec.UpdateInternalError)
+				return
+			}
 		}
 		a := manifest.AddAction(cra.Event)
 		a.DisplayVersion = cra.ChromeOSVersion
@@ -216,11 +320,22 @@ func (h *Handler) prepareUpdateCheck(appResp *omahaSpec.AppResponse, pkg *api.Pa
 		a.MetadataSignatureRsa = cra.MetadataSignatureRsa
 		a.MetadataSize = cra.MetadataSize
 		a.Deadline = cra.Deadline
+		if delta != nil {
+			a.SHA256 = delta.Sha256.String
+			a.IsDeltaPayload = true
+			a.MetadataSignatureRsa = delta.MetadataSignatureRsa
+			a.MetadataSize = delta.MetadataSize
+		}
 	}
 
 	updateCheck := appResp.AddUpdateCheck(omahaSpec.UpdateOK)
 	updateCheck.Manifest = manifest
-	updateCheck.AddURL(pkg.URL)
+	for _, mirror := range mirrors {
+		if mirror != url {
+			updateCheck.AddURL(mirror)
+		}
+	}
+	updateCheck.AddURL(url)
 }
 
 func trace(v interface{}) {
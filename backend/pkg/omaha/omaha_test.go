@@ -2,7 +2,9 @@ package omaha
 
 import (
 	"bytes"
+	"encoding/json"
 	"encoding/xml"
+	"fmt"
 	"log"
 	"os"
 	"testing"
@@ -87,6 +89,98 @@ func TestInvalidRequests(t *testing.T) {
 	checkOmahaResponse(t, omahaResp, tApp.ID, omahaSpec.AppStatus("error-instanceRegistrationFailed"))
 }
 
+func TestMultiAppRequests(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+	h := NewHandler(a)
+
+	tTeam, _ := a.AddTeam(&api.Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&api.Application{Name: "test_app", Description: "Test app", TeamID: tTeam.ID})
+	tApp2, _ := a.AddApp(&api.Application{Name: "test_app2", Description: "Test app 2", TeamID: tTeam.ID})
+	tApp3, _ := a.AddApp(&api.Application{Name: "test_app3", Description: "Test app 3", TeamID: tTeam.ID})
+	tPkg, _ := a.AddPackage(&api.Package{Type: api.PkgTypeOther, URL: "http://sample.url/pkg", Filename: null.StringFrom("update.tgz"), Version: "2.0.0", ApplicationID: tApp.ID, Arch: api.ArchAMD64})
+	tChannel, _ := a.AddChannel(&api.Channel{Name: "test_channel", Color: "blue", ApplicationID: tApp.ID, PackageID: null.StringFrom(tPkg.ID), Arch: api.ArchAMD64})
+	tGroup, _ := a.AddGroup(&api.Group{Name: "test_group", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: false, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes"})
+	tPkg3, _ := a.AddPackage(&api.Package{Type: api.PkgTypeOther, URL: "http://sample.url/pkg", Filename: null.StringFrom("update.tgz"), Version: "1.0.0", ApplicationID: tApp3.ID, Arch: api.ArchAMD64})
+	tChannel3, _ := a.AddChannel(&api.Channel{Name: "test_channel3", Color: "blue", ApplicationID: tApp3.ID, PackageID: null.StringFrom(tPkg3.ID), Arch: api.ArchAMD64})
+	tGroup3, _ := a.AddGroup(&api.Group{Name: "test_group3", ApplicationID: tApp3.ID, ChannelID: null.StringFrom(tChannel3.ID), PolicyUpdatesEnabled: true, PolicySafeMode: false, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 2, PolicyUpdateTimeout: "60 minutes"})
+
+	machineID := "c2a4ce8b-5d10-4a5f-9d9b-3a6d1f0e2b7c"
+	omahaReq := omahaSpec.NewRequest()
+	omahaReq.OS.Platform = reqPlatform
+	omahaReq.OS.Arch = reqArch
+	// The app failing comes first, so it can't prevent the other apps from
+	// being evaluated.
+	for _, app := range []struct {
+		id, track string
+	}{{tApp2.ID, "invalid-track"}, {tApp.ID, tGroup.ID}, {tApp3.ID, tGroup3.ID}} {
+		appReq := omahaReq.AddApp(app.id, "1.0.0")
+		appReq.MachineID = machineID
+		appReq.Track = app.track
+		appReq.AddUpdateCheck()
+		appReq.AddPing()
+		event := appReq.AddEvent()
+		event.Type = omahaSpec.EventTypeUpdateDownloadStarted
+		event.Result = omahaSpec.EventResultSuccess
+	}
+	omahaReqXML, err := xml.Marshal(omahaReq)
+	require.NoError(t, err)
+
+	var omahaRespXML bytes.Buffer
+	require.NoError(t, h.Handle(bytes.NewReader(omahaReqXML), &omahaRespXML, "127.0.0.1"))
+	var omahaResp *omahaSpec.Response
+	require.NoError(t, xml.NewDecoder(&omahaRespXML).Decode(&omahaResp))
+	require.Len(t, omahaResp.Apps, 3)
+
+	appResp := omahaResp.Apps[0]
+	assert.Equal(t, tApp2.ID, appResp.ID)
+	assert.Equal(t, omahaSpec.AppStatus("error-failedToRetrieveUpdatePackageInfo"), appResp.Status)
+	require.NotNil(t, appResp.UpdateCheck)
+	assert.Equal(t, omahaSpec.UpdateInternalError, appResp.UpdateCheck.Status)
+	assert.Nil(t, appResp.Ping)
+	assert.Empty(t, appResp.Events)
+	_, err = a.GetInstance(machineID, tApp2.ID)
+	assert.Error(t, err, "Instance shouldn't be registered for an app without group.")
+
+	appResp = omahaResp.Apps[1]
+	assert.Equal(t, tApp.ID, appResp.ID)
+	assert.Equal(t, omahaSpec.AppOK, appResp.Status)
+	require.NotNil(t, appResp.UpdateCheck)
+	assert.Equal(t, omahaSpec.UpdateOK, appResp.UpdateCheck.Status)
+	assert.Equal(t, tPkg.Version, appResp.UpdateCheck.Manifest.Version)
+	require.NotNil(t, appResp.Ping)
+	assert.Equal(t, "ok", appResp.Ping.Status)
+	assert.Len(t, appResp.Events, 1)
+
+	appResp = omahaResp.Apps[2]
+	assert.Equal(t, tApp3.ID, appResp.ID)
+	assert.Equal(t, omahaSpec.AppOK, appResp.Status)
+	require.NotNil(t, appResp.UpdateCheck)
+	assert.Equal(t, omahaSpec.NoUpdate, appResp.UpdateCheck.Status)
+	require.NotNil(t, appResp.Ping)
+	assert.Len(t, appResp.Events, 1)
+	instance, err := a.GetInstance(machineID, tApp3.ID)
+	require.NoError(t, err)
+	assert.Equal(t, tGroup3.ID, instance.Application.GroupID.String)
+
+	// The download started event is accepted now that the update of the
+	// first app was granted, so its update check fails, which doesn't affect
+	// the other apps either.
+	omahaRespXML.Reset()
+	require.NoError(t, h.Handle(bytes.NewReader(omahaReqXML), &omahaRespXML, "127.0.0.1"))
+	omahaResp = nil
+	require.NoError(t, xml.NewDecoder(&omahaRespXML).Decode(&omahaResp))
+	require.Len(t, omahaResp.Apps, 3)
+	assert.Equal(t, omahaSpec.AppStatus("error-failedToRetrieveUpdatePackageInfo"), omahaResp.Apps[0].Status)
+	assert.Equal(t, omahaSpec.AppStatus("error-updateInProgressOnInstance"), omahaResp.Apps[1].Status)
+	assert.Equal(t, omahaSpec.UpdateInternalError, omahaResp.Apps[1].UpdateCheck.Status)
+	assert.Equal(t, omahaSpec.AppOK, omahaResp.Apps[2].Status)
+	assert.Equal(t, omahaSpec.NoUpdate, omahaResp.Apps[2].UpdateCheck.Status)
+	instance, err = a.GetInstance(machineID, tApp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(api.InstanceStatusDownloading), instance.Application.Status.Int64)
+}
+
 func TestAppNoUpdateForAppWithChannelAndPackageName(t *testing.T) {
 	a := newForTest(t)
 	defer a.Close()
@@ -222,6 +316,83 @@ func TestAppUpdateForAppWithChannelAndPackageName(t *testing.T) {
 	checkOmahaUpdateResponse(t, omahaResp, tPkgFlatcar640.Version, "", "", omahaSpec.NoUpdate)
 }
 
+func TestAppUpdateWithDeltaPayload(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+	h := NewHandler(a)
+
+	tAppFlatcar, _ := a.GetApp(flatcarAppID)
+	tFilenameFlatcar := "flatcarupdate.tgz"
+	tFilenameDelta := "flatcarupdate-delta-610.0.0.tgz"
+	tPkgFlatcar640, _ := a.AddPackage(&api.Package{Type: api.PkgTypeFlatcar, URL: "http://sample.url/pkg", Filename: null.StringFrom(tFilenameFlatcar), Version: "99640.0.0", ApplicationID: tAppFlatcar.ID, Arch: api.ArchAMD64, Deltas: []*api.PackageDelta{
+		{FromVersion: "610.0.0", URL: "http://sample.url/delta", Filename: null.StringFrom(tFilenameDelta), Size: null.StringFrom("1024"), Sha256: null.StringFrom("deltasha256"), MetadataSize: "42"},
+	}})
+	tChannel, _ := a.AddChannel(&api.Channel{Name: "mychannel", Color: "white", ApplicationID: tAppFlatcar.ID, PackageID: null.StringFrom(tPkgFlatcar640.ID), Arch: api.ArchAMD64})
+	tGroup, _ := a.AddGroup(&api.Group{Name: "Production", ApplicationID: tAppFlatcar.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 10, PolicyUpdateTimeout: "60 minutes"})
+	flatcarAction, _ := a.AddFlatcarAction(&api.FlatcarAction{Event: "postinstall", Sha256: "fsdkjjfghsdakjfgaksdjfasd", PackageID: tPkgFlatcar640.ID})
+
+	// Instances running the delta source version get the delta payload
+	omahaResp := doOmahaRequest(t, h, tAppFlatcar.ID, "610.0.0", "65e1266d-6f54-4b87-9080-23b99ca9c12f", tGroup.ID, "127.0.0.1", false, true, nil)
+	checkOmahaResponse(t, omahaResp, tAppFlatcar.ID, omahaSpec.AppOK)
+	checkOmahaUpdateResponse(t, omahaResp, tPkgFlatcar640.Version, tFilenameDelta, "http://sample.url/delta", omahaSpec.UpdateOK)
+	assert.Equal(t, uint64(1024), omahaResp.Apps[0].UpdateCheck.Manifest.Packages[0].Size)
+	action := omahaResp.Apps[0].UpdateCheck.Manifest.Actions[0]
+	assert.True(t, action.IsDeltaPayload)
+	assert.Equal(t, "deltasha256", action.SHA256)
+	assert.Equal(t, "42", action.MetadataSize)
+	assert.Equal(t, flatcarAction.Event, action.Event)
+
+	// Other instances fall back to the full payload
+	omahaResp = doOmahaRequest(t, h, tAppFlatcar.ID, "600.0.0", "a7a4ff49-1a8c-4ba0-92fa-1b8ec2a5e3d4", tGroup.ID, "127.0.0.1", false, true, nil)
+	checkOmahaResponse(t, omahaResp, tAppFlatcar.ID, omahaSpec.AppOK)
+	checkOmahaUpdateResponse(t, omahaResp, tPkgFlatcar640.Version, tFilenameFlatcar, tPkgFlatcar640.URL, omahaSpec.UpdateOK)
+	checkOmahaFlatcarAction(t, flatcarAction, omahaResp.Apps[0].UpdateCheck.Manifest.Actions[0])
+}
+
+func TestAppUpdateWithMirrors(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+	h := NewHandler(a)
+
+	tTeam, _ := a.AddTeam(&api.Team{Name: "test_team"})
+	tApp, _ := a.AddApp(&api.Application{Name: "test_app", Description: "Test app", TeamID: tTeam.ID})
+	tPkg, _ := a.AddPackage(&api.Package{Type: api.PkgTypeOther, URL: "https://sample.url/pkg/", Filename: null.StringFrom("update.tgz"), Version: "2.0.0", ApplicationID: tApp.ID, Arch: api.ArchAMD64, Deltas: []*api.PackageDelta{
+		{FromVersion: "1.5.0", URL: "https://sample.url/delta/", Filename: null.StringFrom("update-delta.tgz")},
+	}})
+	tChannel, _ := a.AddChannel(&api.Channel{Name: "test_channel", Color: "blue", ApplicationID: tApp.ID, PackageID: null.StringFrom(tPkg.ID), Arch: api.ArchAMD64})
+	tGroup, _ := a.AddGroup(&api.Group{Name: "test_group", ApplicationID: tApp.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicySafeMode: false, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 10, PolicyUpdateTimeout: "60 minutes"})
+	_, err := a.AddPackageMirror(&api.PackageMirror{PackageID: tPkg.ID, URL: "https://public.mirror/pkg/"})
+	require.NoError(t, err)
+	_, err = a.AddPackageMirror(&api.PackageMirror{PackageID: tPkg.ID, URL: "http://dc1.mirror/pkg/", ClientCIDR: null.StringFrom("10.1.0.0/16")})
+	require.NoError(t, err)
+	_, err = a.AddPackageMirror(&api.PackageMirror{PackageID: tPkg.ID, URL: "http://arm.mirror/pkg/", Arch: null.IntFrom(int64(api.ArchAArch64))})
+	require.NoError(t, err)
+
+	codebases := func(omahaResp *omahaSpec.Response) []string {
+		var urls []string
+		for _, u := range omahaResp.Apps[0].UpdateCheck.URLs {
+			urls = append(urls, u.CodeBase)
+		}
+		return urls
+	}
+
+	omahaResp := doOmahaRequest(t, h, tApp.ID, "1.0.0", "instance-dc1", tGroup.ID, "10.1.3.4", true, true, nil)
+	checkOmahaResponse(t, omahaResp, tApp.ID, omahaSpec.AppOK)
+	require.Equal(t, omahaSpec.UpdateOK, omahaResp.Apps[0].UpdateCheck.Status)
+	assert.Equal(t, []string{"http://dc1.mirror/pkg/", "https://public.mirror/pkg/", "https://sample.url/pkg/"}, codebases(omahaResp))
+
+	omahaResp = doOmahaRequest(t, h, tApp.ID, "1.0.0", "instance-elsewhere", tGroup.ID, "192.168.3.4", true, true, nil)
+	checkOmahaResponse(t, omahaResp, tApp.ID, omahaSpec.AppOK)
+	require.Equal(t, omahaSpec.UpdateOK, omahaResp.Apps[0].UpdateCheck.Status)
+	assert.Equal(t, []string{"https://public.mirror/pkg/", "https://sample.url/pkg/"}, codebases(omahaResp))
+
+	// Deltas are only advertised with their own url.
+	omahaResp = doOmahaRequest(t, h, tApp.ID, "1.5.0", "instance-delta", tGroup.ID, "10.1.3.4", true, true, nil)
+	checkOmahaResponse(t, omahaResp, tApp.ID, omahaSpec.AppOK)
+	require.Equal(t, omahaSpec.UpdateOK, omahaResp.Apps[0].UpdateCheck.Status)
+	assert.Equal(t, []string{"https://sample.url/delta/"}, codebases(omahaResp))
+}
+
 func TestFlatcarGroupNamesConversionToIds(t *testing.T) {
 	a := newForTest(t)
 	defer a.Close()
@@ -241,6 +412,77 @@ func TestFlatcarGroupNamesConversionToIds(t *testing.T) {
 	checkOmahaResponse(t, omahaResp, flatcarAppIDWithCurlyBraces, omahaSpec.AppOK)
 }
 
+func TestJSONRequests(t *testing.T) {
+	a := newForTest(t)
+	defer a.Close()
+	h := NewHandler(a)
+
+	tAppFlatcar, _ := a.GetApp(flatcarAppID)
+	tFilenameFlatcar := "flatcarupdate.tgz"
+	tPkgFlatcar640, _ := a.AddPackage(&api.Package{Type: api.PkgTypeFlatcar, URL: "http://sample.url/pkg", Filename: null.StringFrom(tFilenameFlatcar), Version: "99640.0.0", ApplicationID: tAppFlatcar.ID, Arch: api.ArchAMD64})
+	tChannel, _ := a.AddChannel(&api.Channel{Name: "mychannel", Color: "white", ApplicationID: tAppFlatcar.ID, PackageID: null.StringFrom(tPkgFlatcar640.ID), Arch: api.ArchAMD64})
+	tGroup, _ := a.AddGroup(&api.Group{Name: "Production", ApplicationID: tAppFlatcar.ID, ChannelID: null.StringFrom(tChannel.ID), PolicyUpdatesEnabled: true, PolicyPeriodInterval: "15 minutes", PolicyMaxUpdatesPerPeriod: 10, PolicyUpdateTimeout: "60 minutes"})
+	flatcarAction, _ := a.AddFlatcarAction(&api.FlatcarAction{Event: "postinstall", Sha256: "fsdkjjfghsdakjfgaksdjfasd", PackageID: tPkgFlatcar640.ID})
+
+	jsonResp := doOmahaJSONRequest(t, h, fmt.Sprintf(`{"request": {
+		"protocol": "3.1",
+		"os": {"platform": "coreos", "version": "3", "sp": "linux", "arch": "x64"},
+		"app": [{
+			"appid": %q,
+			"version": "610.0.0",
+			"track": %q,
+			"machineid": "65e1266d-6f54-4b87-9080-23b99ca9c12f",
+			"ping": {"r": 1},
+			"updatecheck": {}
+		}]
+	}}`, tAppFlatcar.ID, tGroup.ID))
+	require.Len(t, jsonResp.Response.Apps, 1)
+	appResp := jsonResp.Response.Apps[0]
+	assert.Equal(t, jsonProtocolVersion, jsonResp.Response.Protocol)
+	assert.Equal(t, tAppFlatcar.ID, appResp.ID)
+	assert.Equal(t, string(omahaSpec.AppOK), appResp.Status)
+	assert.Equal(t, "ok", appResp.Ping.Status)
+	require.NotNil(t, appResp.UpdateCheck)
+	assert.Equal(t, string(omahaSpec.UpdateOK), appResp.UpdateCheck.Status)
+	assert.Equal(t, tPkgFlatcar640.URL, appResp.UpdateCheck.URLs.URLs[0].CodeBase)
+	assert.Equal(t, tPkgFlatcar640.Version, appResp.UpdateCheck.Manifest.Version)
+	assert.Equal(t, tFilenameFlatcar, appResp.UpdateCheck.Manifest.Packages.Packages[0].Name)
+	assert.Equal(t, flatcarAction.Event, appResp.UpdateCheck.Manifest.Actions.Actions[0].Event)
+	assert.Equal(t, flatcarAction.Sha256, appResp.UpdateCheck.Manifest.Actions.Actions[0].SHA256)
+
+	// The same request sent as XML by another instance gets an equivalent response
+	omahaResp := doOmahaRequest(t, h, tAppFlatcar.ID, "610.0.0", "a7a4ff49-1a8c-4ba0-92fa-1b8ec2a5e3d4", tGroup.ID, "127.0.0.1", true, true, nil)
+	assert.Equal(t, jsonResp, newJSONResponse(omahaResp))
+
+	// Events are processed as well
+	jsonResp = doOmahaJSONRequest(t, h, fmt.Sprintf(`{"request": {
+		"protocol": "3.1",
+		"app": [{
+			"appid": %q,
+			"version": "610.0.0",
+			"track": %q,
+			"machineid": "65e1266d-6f54-4b87-9080-23b99ca9c12f",
+			"event": [{"eventtype": 13, "eventresult": 1}]
+		}]
+	}}`, tAppFlatcar.ID, tGroup.ID))
+	appResp = jsonResp.Response.Apps[0]
+	assert.Equal(t, string(omahaSpec.AppOK), appResp.Status)
+	require.Len(t, appResp.Events, 1)
+	assert.Equal(t, "ok", appResp.Events[0].Status)
+	assert.Nil(t, appResp.Ping)
+	assert.Nil(t, appResp.UpdateCheck)
+
+	instance, err := a.GetInstance("65e1266d-6f54-4b87-9080-23b99ca9c12f", tAppFlatcar.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(api.InstanceStatusDownloading), instance.Application.Status.Int64)
+
+	// Malformed requests are rejected
+	for _, body := range []string{`<request protocol="3.0"></request>`, `{"response": {}}`, `{"request": {"app": [null]}}`} {
+		err := h.HandleJSON(bytes.NewBufferString(body), new(bytes.Buffer), "127.0.0.1")
+		assert.Error(t, err, body)
+	}
+}
+
 type eventInfo struct {
 	Type            omahaSpec.EventType
 	Result          omahaSpec.EventResult
@@ -354,3 +596,16 @@ func checkOmahaFlatcarAction(t *testing.T, c *api.FlatcarAction, r *omahaSpec.Ac
 	assert.Equal(t, c.NeedsAdmin, r.NeedsAdmin)
 	assert.Equal(t, c.MetadataSignatureRsa, r.MetadataSignatureRsa)
 }
+
+func doOmahaJSONRequest(t *testing.T, h *Handler, body string) *jsonResponse {
+	omahaRespJSON := new(bytes.Buffer)
+	err := h.HandleJSON(bytes.NewBufferString(body), omahaRespJSON, "127.0.0.1")
+	require.NoError(t, err)
+
+	var jsonResp *jsonResponse
+	err = json.NewDecoder(omahaRespJSON).Decode(&jsonResp)
+	require.NoError(t, err)
+	require.NotNil(t, jsonResp.Response)
+
+	return jsonResp
+}
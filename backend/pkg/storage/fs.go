@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// FSStore is a PackageStore keeping payloads in a local directory, which is
+// expected to be served by Nebraska at baseURL.
+type FSStore struct {
+	dir     string
+	baseURL string
+}
+
+var _ PackageStore = &FSStore{}
+
+// NewFSStore creates a new FSStore storing payloads in the directory provided.
+func NewFSStore(dir, baseURL string) *FSStore {
+	return &FSStore{
+		dir:     dir,
+		baseURL: baseURL,
+	}
+}
+
+// Put stores the payload in the store directory. The payload is written to a
+// temporary file first, so that a partially written payload is never served.
+func (s *FSStore) Put(name string, r io.Reader, size int64) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	tmpFile, err := ioutil.TempFile(s.dir, "tmp_payload_")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := io.Copy(tmpFile, r); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), filepath.Join(s.dir, name))
+}
+
+// Delete removes the payload from the store directory.
+func (s *FSStore) Delete(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List returns the payloads in the store directory.
+func (s *FSStore) List() ([]*Object, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]*Object, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() || validateName(entry.Name()) != nil {
+			continue
+		}
+		objects = append(objects, &Object{
+			Name:         entry.Name(),
+			Size:         entry.Size(),
+			LastModified: entry.ModTime(),
+		})
+	}
+	return objects, nil
+}
+
+// URL returns the url Nebraska serves the payload at.
+func (s *FSStore) URL(name string) (string, error) {
+	if err := validateName(name); err != nil {
+		return "", err
+	}
+	return s.baseURL + url.PathEscape(name), nil
+}
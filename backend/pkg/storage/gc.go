@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"time"
+)
+
+// CollectGarbage deletes the payloads in the store whose name isn't in the
+// list of referenced payloads provided, returning the names of the payloads
+// deleted. Payloads modified in the last minAge are kept, as they may belong
+// to a package that is still being created.
+func CollectGarbage(store PackageStore, referenced []string, minAge time.Duration) ([]string, error) {
+	objects, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	inUse := make(map[string]struct{}, len(referenced))
+	for _, name := range referenced {
+		inUse[name] = struct{}{}
+	}
+
+	var deleted []string
+	threshold := time.Now().Add(-minAge)
+	for _, object := range objects {
+		if _, ok := inUse[object.Name]; ok || object.LastModified.After(threshold) {
+			continue
+		}
+		if err := store.Delete(object.Name); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, object.Name)
+	}
+	return deleted, nil
+}
+
+// GarbageCollector represents a process in charge of periodically removing
+// from a PackageStore the payloads no longer referenced by any package, for
+// example after the packages using them were deleted.
+type GarbageCollector struct {
+	store      PackageStore
+	referenced func() ([]string, error)
+	interval   time.Duration
+	minAge     time.Duration
+	stopCh     chan struct{}
+}
+
+// NewGarbageCollector creates a new GarbageCollector instance, which will get
+// the names of the payloads in use from the referenced function provided.
+func NewGarbageCollector(store PackageStore, referenced func() ([]string, error), interval, minAge time.Duration) *GarbageCollector {
+	return &GarbageCollector{
+		store:      store,
+		referenced: referenced,
+		interval:   interval,
+		minAge:     minAge,
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// Start makes the garbage collector run every interval until it's asked to
+// stop.
+func (gc *GarbageCollector) Start() {
+	ticker := time.NewTicker(gc.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			gc.collect()
+		case <-gc.stopCh:
+			return
+		}
+	}
+}
+
+// Stop stops the garbage collector.
+func (gc *GarbageCollector) Stop() {
+	gc.stopCh <- struct{}{}
+}
+
+func (gc *GarbageCollector) collect() {
+	referenced, err := gc.referenced()
+	if err != nil {
+		logger.Error().Err(err).Msg("collect - could not get the payloads in use")
+		return
+	}
+	deleted, err := CollectGarbage(gc.store, referenced, gc.minAge)
+	for _, name := range deleted {
+		logger.Info().Str("payload", name).Msg("deleted unreferenced package payload")
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("collect - could not delete unreferenced payloads")
+	}
+}
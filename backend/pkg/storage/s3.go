@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	defaultS3Region    = "us-east-1"
+	defaultS3URLExpiry = time.Hour
+
+	// maxS3URLExpiry is the longest validity accepted by S3 for presigned
+	// urls.
+	maxS3URLExpiry = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrInvalidS3Config error indicates that the configuration provided to
+	// create a S3Store is not valid.
+	ErrInvalidS3Config = errors.New("storage: invalid s3 configuration")
+)
+
+// S3Config represents the configuration used to create a new S3Store.
+type S3Config struct {
+	// Endpoint is the base url of the S3 compatible service, for example
+	// https://s3.eu-central-1.amazonaws.com or http://minio:9000. Buckets
+	// are addressed using the path style.
+	Endpoint string
+	Bucket   string
+	// Prefix is prepended to the payloads names to build the objects keys.
+	// Only the objects under the prefix are listed, and garbage collected.
+	Prefix          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// URLExpiry is how long the presigned urls returned by URL are valid.
+	URLExpiry time.Duration
+	// Transport is the http transport used to talk to the service, the
+	// default one is used when nil.
+	Transport http.RoundTripper
+}
+
+// S3Store is a PackageStore keeping payloads in a bucket of a S3 compatible
+// service. Payloads are downloaded by clients using presigned urls.
+type S3Store struct {
+	client    *minio.Client
+	bucket    string
+	prefix    string
+	urlExpiry time.Duration
+}
+
+var _ PackageStore = &S3Store{}
+
+// NewS3Store creates a new S3Store using the configuration provided.
+func NewS3Store(conf *S3Config) (*S3Store, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(conf.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("%w: endpoint must be an http(s) url", ErrInvalidS3Config)
+	}
+	if endpoint.Path != "" {
+		return nil, fmt.Errorf("%w: endpoint can't have a path", ErrInvalidS3Config)
+	}
+	if conf.Bucket == "" || conf.AccessKeyID == "" || conf.SecretAccessKey == "" {
+		return nil, fmt.Errorf("%w: bucket and credentials are required", ErrInvalidS3Config)
+	}
+	prefix := strings.Trim(conf.Prefix, "/")
+	if prefix != "" {
+		for _, segment := range strings.Split(prefix, "/") {
+			if validateName(segment) != nil {
+				return nil, fmt.Errorf("%w: invalid prefix %q", ErrInvalidS3Config, conf.Prefix)
+			}
+		}
+		prefix += "/"
+	}
+	region := conf.Region
+	if region == "" {
+		region = defaultS3Region
+	}
+	urlExpiry := conf.URLExpiry
+	if urlExpiry == 0 {
+		urlExpiry = defaultS3URLExpiry
+	}
+	if urlExpiry < time.Second || urlExpiry > maxS3URLExpiry {
+		return nil, fmt.Errorf("%w: url expiry must be between 1s and %s", ErrInvalidS3Config, maxS3URLExpiry)
+	}
+
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(conf.AccessKeyID, conf.SecretAccessKey, ""),
+		Secure:       endpoint.Scheme == "https",
+		Region:       region,
+		BucketLookup: minio.BucketLookupPath,
+		Transport:    conf.Transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidS3Config, err)
+	}
+
+	return &S3Store{
+		client:    client,
+		bucket:    conf.Bucket,
+		prefix:    prefix,
+		urlExpiry: urlExpiry,
+	}, nil
+}
+
+// Put uploads the payload to the bucket.
+func (s *S3Store) Put(name string, r io.Reader, size int64) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	_, err := s.client.PutObject(context.Background(), s.bucket, s.prefix+name, r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	return err
+}
+
+// Delete removes the payload from the bucket.
+func (s *S3Store) Delete(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	return s.client.RemoveObject(context.Background(), s.bucket, s.prefix+name, minio.RemoveObjectOptions{})
+}
+
+// List returns the payloads stored in the bucket under the store prefix.
+// Objects in nested "directories" are ignored.
+func (s *S3Store) List() ([]*Object, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var objects []*Object
+	for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		name := strings.TrimPrefix(info.Key, s.prefix)
+		if validateName(name) != nil {
+			continue
+		}
+		objects = append(objects, &Object{
+			Name:         name,
+			Size:         info.Size,
+			LastModified: info.LastModified,
+		})
+	}
+	return objects, nil
+}
+
+// URL returns a presigned url to download the payload from the bucket.
+func (s *S3Store) URL(name string) (string, error) {
+	if err := validateName(name); err != nil {
+		return "", err
+	}
+	u, err := s.client.PresignedGetObject(context.Background(), s.bucket, s.prefix+name, s.urlExpiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,58 @@
+// Package storage provides the backends where the package payloads hosted by
+// Nebraska are stored (a local directory or an S3 compatible bucket), and the
+// garbage collection of the payloads no longer referenced by any package.
+package storage
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/kinvolk/nebraska/backend/pkg/util"
+)
+
+var (
+	logger = util.NewLogger("storage")
+
+	// ErrInvalidName error indicates that the name provided can't be used to
+	// store a payload. Names can only contain letters, digits, dots, dashes
+	// and underscores.
+	ErrInvalidName = errors.New("storage: invalid payload name")
+
+	validName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+)
+
+// Object describes a payload stored in a PackageStore.
+type Object struct {
+	Name         string
+	Size         int64
+	LastModified time.Time
+}
+
+// PackageStore is the interface implemented by the backends package payloads
+// can be stored in. Payloads are identified by their name, which is the
+// filename used by the package or package delta referencing them.
+type PackageStore interface {
+	// Put stores the payload of the given size read from r under the name
+	// provided, replacing the existing one if any.
+	Put(name string, r io.Reader, size int64) error
+
+	// Delete removes the payload stored under the name provided. Deleting
+	// a payload that doesn't exist is not an error.
+	Delete(name string) error
+
+	// List returns the payloads stored.
+	List() ([]*Object, error)
+
+	// URL returns the url the payload stored under the name provided can be
+	// downloaded from. The url may only be valid for a limited time.
+	URL(name string) (string, error)
+}
+
+func validateName(name string) error {
+	if !validName.MatchString(name) || name == "." || name == ".." {
+		return ErrInvalidName
+	}
+	return nil
+}
@@ -0,0 +1,415 @@
+package syncer
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kinvolk/nebraska/backend/pkg/storage"
+)
+
+const (
+	defaultDownloadConcurrency  = 2
+	defaultDownloadRetries      = 3
+	defaultDownloadRetryBackoff = 5 * time.Second
+
+	// downloadStallTimeout is how long a download can go without receiving
+	// any data before it's aborted and retried.
+	downloadStallTimeout = time.Minute
+
+	// progressReportInterval is how often the progress of a download is
+	// reported in the metrics.
+	progressReportInterval = time.Second
+)
+
+var (
+	// ErrDownloadSizeMismatch error indicates that the size of a downloaded
+	// payload is not the one expected.
+	ErrDownloadSizeMismatch = errors.New("downloaded file size mismatch")
+
+	// ErrDownloadHashMismatch error indicates that the hash of a downloaded
+	// payload is not the one expected.
+	ErrDownloadHashMismatch = errors.New("downloaded file hash mismatch")
+
+	downloadBytesMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "nebraska",
+			Subsystem: "syncer",
+			Name:      "download_bytes_total",
+			Help:      "Bytes of package payloads downloaded by the syncer",
+		},
+		[]string{"source"},
+	)
+
+	downloadsMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "nebraska",
+			Subsystem: "syncer",
+			Name:      "downloads_total",
+			Help:      "Package payloads downloads finished by the syncer, by result (success or failure)",
+		},
+		[]string{"source", "result"},
+	)
+
+	downloadRetriesMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "nebraska",
+			Subsystem: "syncer",
+			Name:      "download_retries_total",
+			Help:      "Package payloads download attempts retried by the syncer",
+		},
+		[]string{"source"},
+	)
+
+	downloadProgressMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "nebraska",
+			Subsystem: "syncer",
+			Name:      "download_progress_ratio",
+			Help:      "Progress of the package payloads being downloaded by the syncer, between 0 and 1",
+		},
+		[]string{"source", "filename"},
+	)
+)
+
+// RegisterMetrics registers the syncer metrics with the DefaultRegisterer.
+func RegisterMetrics() error {
+	for _, c := range []prometheus.Collector{downloadBytesMetric, downloadsMetric, downloadRetriesMetric, downloadProgressMetric} {
+		if err := prometheus.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Download represents a package payload to download into the package store.
+// The hashes are base64 encoded, as in the Omaha responses; the payload is
+// verified against all the ones provided.
+type Download struct {
+	Source   string
+	URL      string
+	Filename string
+	Size     int64
+	SHA1     string
+	SHA256   string
+}
+
+// DownloadManagerConfig represents the configuration used to create a new
+// DownloadManager instance.
+type DownloadManagerConfig struct {
+	PackageStore storage.PackageStore
+	// Concurrency is the maximum number of payloads downloaded at once.
+	Concurrency int
+	// Retries is how many times a failed download is retried, resuming
+	// it where it stopped when possible.
+	Retries int
+	// RetryBackoff is the time waited before the first retry, doubled
+	// after each one.
+	RetryBackoff time.Duration
+	// TempDir is where the payloads are downloaded before being verified
+	// and stored, the default directory for temporary files if empty.
+	TempDir    string
+	HTTPClient *http.Client
+}
+
+// DownloadManager downloads package payloads into a package store, with
+// bounded concurrency. Downloads are verified and retried with backoff,
+// resuming them with HTTP range requests when the server supports them.
+type DownloadManager struct {
+	store        storage.PackageStore
+	retries      int
+	retryBackoff time.Duration
+	tempDir      string
+	httpClient   *http.Client
+	slots        chan struct{}
+}
+
+// NewDownloadManager creates a new DownloadManager instance.
+func NewDownloadManager(conf *DownloadManagerConfig) (*DownloadManager, error) {
+	if conf.PackageStore == nil {
+		return nil, ErrInvalidPackageStore
+	}
+	m := &DownloadManager{
+		store:        conf.PackageStore,
+		retries:      conf.Retries,
+		retryBackoff: conf.RetryBackoff,
+		tempDir:      conf.TempDir,
+		httpClient:   conf.HTTPClient,
+	}
+	concurrency := conf.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultDownloadConcurrency
+	}
+	m.slots = make(chan struct{}, concurrency)
+	if m.retries < 0 {
+		m.retries = 0
+	}
+	if m.retryBackoff <= 0 {
+		m.retryBackoff = defaultDownloadRetryBackoff
+	}
+	if m.tempDir == "" {
+		m.tempDir = os.TempDir()
+	}
+	if m.httpClient == nil {
+		m.httpClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           (&net.Dialer{Timeout: 30 * time.Second}).DialContext,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: 30 * time.Second,
+			},
+		}
+	}
+	return m, nil
+}
+
+// Download downloads the payload provided into the package store, waiting
+// for a free slot first. Failed attempts are retried, the payload is only
+// stored once it has been completely downloaded and verified. The data
+// downloaded is kept when all the attempts fail, so the next download of the
+// payload resumes from it, unless it failed verification.
+func (m *DownloadManager) Download(ctx context.Context, d *Download) error {
+	select {
+	case m.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-m.slots }()
+
+	partPath := filepath.Join(m.tempDir, "nebraska-download-"+d.Filename+".part")
+	defer downloadProgressMetric.DeleteLabelValues(d.Source, d.Filename)
+
+	backoff := m.retryBackoff
+	var err error
+	for attempt := 0; attempt <= m.retries; attempt++ {
+		if attempt > 0 {
+			downloadRetriesMetric.WithLabelValues(d.Source).Inc()
+			logger.Warn().Err(err).Str("url", d.URL).Int("attempt", attempt).Msg("downloadPackage, retrying")
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			backoff *= 2
+		}
+		if err = m.download(ctx, d, partPath); err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, ErrDownloadSizeMismatch) || errors.Is(err, ErrDownloadHashMismatch) {
+			// Start over, the data downloaded so far can't be trusted.
+			os.Remove(partPath)
+		}
+	}
+	if err != nil {
+		downloadsMetric.WithLabelValues(d.Source, "failure").Inc()
+		return err
+	}
+
+	f, err := os.Open(partPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := m.store.Put(d.Filename, f, info.Size()); err != nil {
+		downloadsMetric.WithLabelValues(d.Source, "failure").Inc()
+		return err
+	}
+	f.Close()
+	os.Remove(partPath)
+	downloadsMetric.WithLabelValues(d.Source, "success").Inc()
+	return nil
+}
+
+// download makes an attempt at downloading the payload provided into the
+// file in the path given, resuming from the data already in it, and
+// verifies it once complete.
+func (m *DownloadManager) download(ctx context.Context, d *Download, partPath string) error {
+	f, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The hashes of the data already downloaded are computed again, so the
+	// whole payload is verified once complete.
+	hashes := newPayloadHashes(d)
+	offset, err := io.Copy(hashes, f)
+	if err != nil {
+		return err
+	}
+	if d.Size > 0 && offset > d.Size {
+		return ErrDownloadSizeMismatch
+	}
+	if d.Size == 0 || offset < d.Size {
+		if offset, err = m.fetch(ctx, d, f, hashes, offset); err != nil {
+			return err
+		}
+	}
+
+	if d.Size > 0 && offset != d.Size {
+		return ErrDownloadSizeMismatch
+	}
+	return hashes.verify()
+}
+
+// fetch requests the payload from the offset provided, appending it to the
+// file given. It returns the size of the file afterwards.
+func (m *DownloadManager) fetch(ctx context.Context, d *Download, f *os.File, hashes *payloadHashes, offset int64) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.URL, nil)
+	if err != nil {
+		return offset, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	logger.Debug().Str("url", d.URL).Int64("offset", offset).Msg("downloadPackage, downloading..")
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return offset, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The payload of unknown size was already completely downloaded.
+		if offset > 0 && d.Size == 0 {
+			return offset, nil
+		}
+		return offset, fmt.Errorf("received unexpected status code (%d)", resp.StatusCode)
+	case http.StatusOK:
+		// The server doesn't support ranges, the download starts over.
+		if offset > 0 {
+			if err := f.Truncate(0); err != nil {
+				return offset, err
+			}
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return offset, err
+			}
+			offset = 0
+			hashes.reset()
+		}
+	default:
+		return offset, fmt.Errorf("received unexpected status code (%d)", resp.StatusCode)
+	}
+
+	progress := &progressWriter{
+		gauge:    downloadProgressMetric.WithLabelValues(d.Source, d.Filename),
+		bytes:    downloadBytesMetric.WithLabelValues(d.Source),
+		written:  offset,
+		expected: d.Size,
+	}
+	stall := time.AfterFunc(downloadStallTimeout, cancel)
+	defer stall.Stop()
+	body := &stallReader{r: resp.Body, timer: stall}
+
+	n, err := io.Copy(io.MultiWriter(f, hashes, progress), body)
+	progress.report()
+	return offset + n, err
+}
+
+// payloadHashes computes the hashes of a payload being downloaded, for the
+// ones known in advance.
+type payloadHashes struct {
+	d      *Download
+	sha1   hash.Hash
+	sha256 hash.Hash
+}
+
+func newPayloadHashes(d *Download) *payloadHashes {
+	h := &payloadHashes{d: d}
+	h.reset()
+	return h
+}
+
+func (h *payloadHashes) reset() {
+	h.sha1, h.sha256 = nil, nil
+	if h.d.SHA1 != "" {
+		h.sha1 = sha1.New()
+	}
+	if h.d.SHA256 != "" {
+		h.sha256 = sha256.New()
+	}
+}
+
+func (h *payloadHashes) Write(p []byte) (int, error) {
+	if h.sha1 != nil {
+		h.sha1.Write(p)
+	}
+	if h.sha256 != nil {
+		h.sha256.Write(p)
+	}
+	return len(p), nil
+}
+
+func (h *payloadHashes) verify() error {
+	if h.sha1 != nil && base64.StdEncoding.EncodeToString(h.sha1.Sum(nil)) != h.d.SHA1 {
+		return fmt.Errorf("%w (sha1)", ErrDownloadHashMismatch)
+	}
+	if h.sha256 != nil && base64.StdEncoding.EncodeToString(h.sha256.Sum(nil)) != h.d.SHA256 {
+		return fmt.Errorf("%w (sha256)", ErrDownloadHashMismatch)
+	}
+	return nil
+}
+
+// progressWriter reports the progress of a download in the metrics.
+type progressWriter struct {
+	gauge      prometheus.Gauge
+	bytes      prometheus.Counter
+	written    int64
+	expected   int64
+	lastReport time.Time
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.written += int64(len(p))
+	w.bytes.Add(float64(len(p)))
+	if time.Since(w.lastReport) >= progressReportInterval {
+		w.report()
+	}
+	return len(p), nil
+}
+
+func (w *progressWriter) report() {
+	w.lastReport = time.Now()
+	if w.expected > 0 {
+		w.gauge.Set(float64(w.written) / float64(w.expected))
+	}
+}
+
+// stallReader pushes back the timer provided every time data is read, so it
+// only fires when the download stalls.
+type stallReader struct {
+	r     io.Reader
+	timer *time.Timer
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.timer.Reset(downloadStallTimeout)
+	}
+	return n, err
+}
@@ -0,0 +1,226 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kinvolk/nebraska/backend/pkg/storage"
+)
+
+var testPayload = bytes.Repeat([]byte("nebraska payload "), 4096)
+
+func newDownloadForTest(url, filename string) *Download {
+	sha1Sum := sha1.Sum(testPayload)
+	sha256Sum := sha256.Sum256(testPayload)
+	return &Download{
+		Source:   "test",
+		URL:      url,
+		Filename: filename,
+		Size:     int64(len(testPayload)),
+		SHA1:     base64.StdEncoding.EncodeToString(sha1Sum[:]),
+		SHA256:   base64.StdEncoding.EncodeToString(sha256Sum[:]),
+	}
+}
+
+func newDownloadManagerForTest(t *testing.T, concurrency int) (*DownloadManager, string) {
+	dir := t.TempDir()
+	m, err := NewDownloadManager(&DownloadManagerConfig{
+		PackageStore: storage.NewFSStore(dir, "http://localhost:8000/flatcar/"),
+		Concurrency:  concurrency,
+		Retries:      2,
+		RetryBackoff: time.Millisecond,
+		TempDir:      t.TempDir(),
+	})
+	require.NoError(t, err)
+	return m, dir
+}
+
+func servePayload(w http.ResponseWriter, r *http.Request) {
+	http.ServeContent(w, r, "payload", time.Time{}, bytes.NewReader(testPayload))
+}
+
+func assertStored(t *testing.T, dir, filename string) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, filename))
+	require.NoError(t, err)
+	assert.Equal(t, testPayload, data)
+}
+
+func TestDownload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(servePayload))
+	defer server.Close()
+	m, dir := newDownloadManagerForTest(t, 1)
+
+	require.NoError(t, m.Download(context.Background(), newDownloadForTest(server.URL, "payload.gz")))
+	assertStored(t, dir, "payload.gz")
+
+	_, err := NewDownloadManager(&DownloadManagerConfig{})
+	assert.Equal(t, ErrInvalidPackageStore, err)
+}
+
+func TestDownloadResume(t *testing.T) {
+	var requests int32
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if atomic.AddInt32(&requests, 1) > 1 {
+			servePayload(w, r)
+			return
+		}
+		// Drop the connection after sending half of the payload.
+		w.Header().Set("Content-Length", strconv.Itoa(len(testPayload)))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(testPayload[:len(testPayload)/2])
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		conn.Close()
+	}))
+	defer server.Close()
+	m, dir := newDownloadManagerForTest(t, 1)
+
+	require.NoError(t, m.Download(context.Background(), newDownloadForTest(server.URL, "payload.gz")))
+	assertStored(t, dir, "payload.gz")
+	assert.Equal(t, []string{"", fmt.Sprintf("bytes=%d-", len(testPayload)/2)}, ranges)
+}
+
+func TestDownloadResumeAfterFailure(t *testing.T) {
+	var requests int32
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			w.Header().Set("Content-Length", strconv.Itoa(len(testPayload)))
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(testPayload[:len(testPayload)/2])
+			w.(http.Flusher).Flush()
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			conn.Close()
+		case 2, 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			servePayload(w, r)
+		}
+	}))
+	defer server.Close()
+	m, dir := newDownloadManagerForTest(t, 1)
+
+	// The data downloaded is kept when all the attempts fail...
+	assert.Error(t, m.Download(context.Background(), newDownloadForTest(server.URL, "payload.gz")))
+	partPath := filepath.Join(m.tempDir, "nebraska-download-payload.gz.part")
+	info, err := os.Stat(partPath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(testPayload)/2), info.Size())
+
+	// ...and the next download resumes from it.
+	require.NoError(t, m.Download(context.Background(), newDownloadForTest(server.URL, "payload.gz")))
+	assertStored(t, dir, "payload.gz")
+	assert.Equal(t, fmt.Sprintf("bytes=%d-", len(testPayload)/2), ranges[3])
+	_, err = os.Stat(partPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadVerification(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		servePayload(w, r)
+	}))
+	defer server.Close()
+	m, dir := newDownloadManagerForTest(t, 1)
+
+	d := newDownloadForTest(server.URL, "bad-sha1.gz")
+	d.SHA1 = base64.StdEncoding.EncodeToString(make([]byte, sha1.Size))
+	assert.ErrorIs(t, m.Download(context.Background(), d), ErrDownloadHashMismatch)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	d = newDownloadForTest(server.URL, "bad-sha256.gz")
+	d.SHA256 = base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	assert.ErrorIs(t, m.Download(context.Background(), d), ErrDownloadHashMismatch)
+
+	d = newDownloadForTest(server.URL, "bad-size.gz")
+	d.Size++
+	assert.ErrorIs(t, m.Download(context.Background(), d), ErrDownloadSizeMismatch)
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestDownloadErrors(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		servePayload(w, r)
+	}))
+	defer server.Close()
+	m, dir := newDownloadManagerForTest(t, 1)
+
+	require.NoError(t, m.Download(context.Background(), newDownloadForTest(server.URL, "payload.gz")))
+	assertStored(t, dir, "payload.gz")
+
+	assert.Error(t, m.Download(context.Background(), newDownloadForTest(server.URL+"/missing", "missing.gz")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, m.Download(ctx, newDownloadForTest(server.URL+"/missing", "missing.gz")))
+}
+
+func TestDownloadConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		servePayload(w, r)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer server.Close()
+	m, dir := newDownloadManagerForTest(t, 2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(filename string) {
+			defer wg.Done()
+			assert.NoError(t, m.Download(context.Background(), newDownloadForTest(server.URL, filename)))
+		}(fmt.Sprintf("payload-%d.gz", i))
+	}
+	wg.Wait()
+	for i := 0; i < 6; i++ {
+		assertStored(t, dir, fmt.Sprintf("payload-%d.gz", i))
+	}
+	assert.Equal(t, 2, maxInFlight)
+}
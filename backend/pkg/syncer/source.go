@@ -0,0 +1,193 @@
+package syncer
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+)
+
+const (
+	// defaultInitialVersion is the version reported to upstream for the
+	// channels that don't point to any package yet.
+	defaultInitialVersion = "0.0.0"
+
+	// flatcarInitialVersion is the version reported to the Flatcar servers
+	// for the channels that don't point to any package yet.
+	flatcarInitialVersion = "766.0.0"
+
+	// versionPlaceholder is replaced by the current version in the OS
+	// service pack sent in the Omaha requests.
+	versionPlaceholder = "{version}"
+)
+
+var (
+	// ErrInvalidSource error indicates that the configuration of a sync
+	// source is not valid.
+	ErrInvalidSource = errors.New("invalid sync source")
+)
+
+// SourcesConfig represents the configuration file of the upstream sources
+// the syncer gets updates from.
+type SourcesConfig struct {
+	Sources []*Source `yaml:"sources"`
+}
+
+// Source represents an upstream Omaha server the syncer checks for updates
+// of a remote application, and the local channels kept in sync with the
+// remote tracks.
+type Source struct {
+	// Name identifies the source in the logs and the hosted packages
+	// filenames.
+	Name string `yaml:"name"`
+	// URL is the Omaha endpoint of the upstream server.
+	URL string `yaml:"url"`
+	// AppID is the id of the application in the upstream server.
+	AppID string `yaml:"app_id"`
+	// PackageType is the type of the packages created, Flatcar packages
+	// (1) get the Flatcar action offered by upstream.
+	PackageType int `yaml:"package_type"`
+	// InitialVersion is the version reported to upstream for the channels
+	// that don't point to any package yet.
+	InitialVersion string `yaml:"initial_version"`
+	// Request customizes the Omaha requests sent upstream.
+	Request RequestConfig `yaml:"request"`
+	// Channels maps the remote tracks and architectures to local channels.
+	Channels []*ChannelMapping `yaml:"channels"`
+}
+
+// RequestConfig represents the details about the OS and the updater sent in
+// the Omaha requests, for upstream servers depending on them.
+type RequestConfig struct {
+	OSPlatform     string `yaml:"os_platform"`
+	OSVersion      string `yaml:"os_version"`
+	OSServicePack  string `yaml:"os_service_pack"`
+	UpdaterVersion string `yaml:"updater_version"`
+}
+
+// ChannelMapping maps a track and an architecture of the remote application
+// to a local channel.
+type ChannelMapping struct {
+	// Track is the remote track (channel) name.
+	Track string `yaml:"track"`
+	// Arch is the remote architecture, in Omaha format (e.g. x64).
+	Arch string `yaml:"arch"`
+	// App is the id of the local application, the remote one by default.
+	App string `yaml:"app"`
+	// Channel is the name of the local channel, the track by default.
+	Channel string `yaml:"channel"`
+	// LocalArch is the architecture of the local channel (e.g. amd64),
+	// the remote one by default.
+	LocalArch string `yaml:"local_arch"`
+}
+
+// LoadSourcesConfig reads the sync sources configuration from the YAML file
+// in the path provided. Environment variables references in the sources urls
+// are expanded.
+func LoadSourcesConfig(path string) (*SourcesConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config SourcesConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, err
+	}
+	for i, source := range config.Sources {
+		source.URL = os.ExpandEnv(source.URL)
+		if err := source.validate(); err != nil {
+			return nil, fmt.Errorf("source %d (%s): %w", i, source.Name, err)
+		}
+	}
+	return &config, nil
+}
+
+// validate checks the source configuration and fills in the defaults.
+func (src *Source) validate() error {
+	if src.Name == "" || src.URL == "" || src.AppID == "" {
+		return fmt.Errorf("%w: name, url and app_id are required", ErrInvalidSource)
+	}
+	if src.PackageType == 0 {
+		src.PackageType = api.PkgTypeOther
+	}
+	if src.InitialVersion == "" {
+		src.InitialVersion = defaultInitialVersion
+	}
+	if len(src.Channels) == 0 {
+		return fmt.Errorf("%w: no channels", ErrInvalidSource)
+	}
+	for _, mapping := range src.Channels {
+		if mapping.Track == "" || mapping.Arch == "" {
+			return fmt.Errorf("%w: track and arch are required in channel mappings", ErrInvalidSource)
+		}
+		if mapping.App == "" {
+			mapping.App = src.AppID
+		}
+		if mapping.Channel == "" {
+			mapping.Channel = mapping.Track
+		}
+		if mapping.LocalArch == "" {
+			arch, err := api.ArchFromOmahaString(mapping.Arch)
+			if err != nil {
+				return fmt.Errorf("%w: unknown remote arch %q, local_arch is required", ErrInvalidSource, mapping.Arch)
+			}
+			mapping.LocalArch = arch.String()
+		}
+		if _, err := api.ArchFromString(mapping.LocalArch); err != nil {
+			return fmt.Errorf("%w: invalid local arch %q", ErrInvalidSource, mapping.LocalArch)
+		}
+	}
+	return nil
+}
+
+// servicePack returns the OS service pack sent in the requests of a channel
+// currently at the version provided.
+func (rc *RequestConfig) servicePack(version string) string {
+	return strings.Replace(rc.OSServicePack, versionPlaceholder, version, -1)
+}
+
+// isFlatcarChannel checks if the channel provided is one of the official
+// Flatcar channels.
+func isFlatcarChannel(channel *api.Channel) bool {
+	switch channel.Name {
+	case "stable", "beta", "alpha", "edge":
+		return true
+	}
+	return strings.HasPrefix(channel.Name, "lts-")
+}
+
+// flatcarSource returns the source syncing the official channels of the
+// Flatcar application in Nebraska from the Flatcar update servers.
+func flatcarSource(updatesURL string, flatcarApp *api.Application) *Source {
+	src := &Source{
+		Name:           "flatcar",
+		URL:            updatesURL,
+		AppID:          flatcarAppID,
+		PackageType:    api.PkgTypeFlatcar,
+		InitialVersion: flatcarInitialVersion,
+		Request: RequestConfig{
+			OSPlatform:     "CoreOS",
+			OSVersion:      "Chateau",
+			OSServicePack:  versionPlaceholder + "_x86_64",
+			UpdaterVersion: "CoreOSUpdateEngine-0.1.0.0",
+		},
+	}
+	for _, c := range flatcarApp.Channels {
+		if !isFlatcarChannel(c) {
+			continue
+		}
+		src.Channels = append(src.Channels, &ChannelMapping{
+			Track:     c.Name,
+			Arch:      c.Arch.OmahaString(),
+			App:       flatcarAppID,
+			Channel:   c.Name,
+			LocalArch: c.Arch.String(),
+		})
+	}
+	return src
+}
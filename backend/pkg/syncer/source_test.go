@@ -0,0 +1,103 @@
+package syncer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kinvolk/go-omaha/omaha"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+)
+
+func writeSourcesConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "syncer")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "sources.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadSourcesConfig(t *testing.T) {
+	os.Setenv("TEST_SYNC_UPSTREAM", "https://nebraska.example.org")
+	defer os.Unsetenv("TEST_SYNC_UPSTREAM")
+
+	path := writeSourcesConfig(t, `
+sources:
+- name: upstream
+  url: ${TEST_SYNC_UPSTREAM}/v1/update/
+  app_id: remote-app
+  request:
+    os_platform: ${TEST_SYNC_UPSTREAM}
+    os_service_pack: "{version}_custom"
+  channels:
+  - track: stable
+    arch: x64
+  - track: beta
+    arch: arm
+    app: local-app
+    channel: testing
+    local_arch: aarch64
+`)
+	config, err := LoadSourcesConfig(path)
+	require.NoError(t, err)
+	require.Len(t, config.Sources, 1)
+
+	src := config.Sources[0]
+	assert.Equal(t, "https://nebraska.example.org/v1/update/", src.URL)
+	// Only the urls are expanded.
+	assert.Equal(t, "${TEST_SYNC_UPSTREAM}", src.Request.OSPlatform)
+	assert.Equal(t, api.PkgTypeOther, src.PackageType)
+	assert.Equal(t, defaultInitialVersion, src.InitialVersion)
+	assert.Equal(t, "1.2.3_custom", src.Request.servicePack("1.2.3"))
+	assert.Equal(t, &ChannelMapping{Track: "stable", Arch: "x64", App: "remote-app", Channel: "stable", LocalArch: "amd64"}, src.Channels[0])
+	assert.Equal(t, &ChannelMapping{Track: "beta", Arch: "arm", App: "local-app", Channel: "testing", LocalArch: "aarch64"}, src.Channels[1])
+}
+
+func TestLoadSourcesConfigInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"missing url":       "sources:\n- name: a\n  app_id: b\n  channels:\n  - track: stable\n    arch: x64\n",
+		"no channels":       "sources:\n- name: a\n  url: http://a\n  app_id: b\n",
+		"missing track":     "sources:\n- name: a\n  url: http://a\n  app_id: b\n  channels:\n  - arch: x64\n",
+		"unknown arch":      "sources:\n- name: a\n  url: http://a\n  app_id: b\n  channels:\n  - track: stable\n    arch: sparc\n",
+		"invalid localarch": "sources:\n- name: a\n  url: http://a\n  app_id: b\n  channels:\n  - track: stable\n    arch: x64\n    local_arch: sparc\n",
+	} {
+		_, err := LoadSourcesConfig(writeSourcesConfig(t, content))
+		assert.ErrorIs(t, err, ErrInvalidSource, name)
+	}
+
+	_, err := LoadSourcesConfig(writeSourcesConfig(t, "sources:\n- name: a\n  unknown_field: b\n"))
+	assert.Error(t, err)
+}
+
+func TestFlatcarSource(t *testing.T) {
+	app := &api.Application{
+		Channels: []*api.Channel{
+			{Name: "stable", Arch: api.ArchAMD64},
+			{Name: "lts-2022", Arch: api.ArchAArch64},
+			{Name: "custom", Arch: api.ArchAMD64},
+		},
+	}
+	src := flatcarSource("https://updates.example.org/", app)
+	assert.Equal(t, api.PkgTypeFlatcar, src.PackageType)
+	assert.Equal(t, "3000.0.0_x86_64", src.Request.servicePack("3000.0.0"))
+	require.Len(t, src.Channels, 2)
+	assert.Equal(t, &ChannelMapping{Track: "stable", Arch: "x64", App: flatcarAppID, Channel: "stable", LocalArch: "amd64"}, src.Channels[0])
+	assert.Equal(t, &ChannelMapping{Track: "lts-2022", Arch: "arm", App: flatcarAppID, Channel: "lts-2022", LocalArch: "aarch64"}, src.Channels[1])
+}
+
+func TestHostedFilename(t *testing.T) {
+	update := &omaha.UpdateResponse{Manifest: &omaha.Manifest{Version: "1.2.3"}}
+	update.Manifest.AddPackage().Name = "payload/app.tgz"
+
+	flatcar := &syncTarget{source: &Source{Name: "flatcar", PackageType: api.PkgTypeFlatcar}, arch: api.ArchAMD64}
+	assert.Equal(t, "flatcar-amd64-1.2.3.gz", flatcar.hostedFilename(update, ""))
+	assert.Equal(t, "flatcar-amd64-1.2.3-delta-1.0.0.gz", flatcar.hostedFilename(update, "-delta-1.0.0"))
+
+	other := &syncTarget{source: &Source{Name: "upstream", PackageType: api.PkgTypeOther}, arch: api.ArchAArch64}
+	assert.Equal(t, "upstream-aarch64-1.2.3-app.tgz", other.hostedFilename(update, ""))
+}
@@ -2,32 +2,50 @@ package syncer
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"encoding/base64"
+	"context"
+	"database/sql"
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
 	"path"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/kinvolk/go-omaha/omaha"
+	"github.com/rs/zerolog"
 	"gopkg.in/guregu/null.v4"
 
 	"github.com/kinvolk/nebraska/backend/pkg/api"
+	"github.com/kinvolk/nebraska/backend/pkg/storage"
 	"github.com/kinvolk/nebraska/backend/pkg/util"
 )
 
 const (
 	flatcarAppID = "{e96281a6-d1af-4bde-9a0a-97b76e56dc57}"
+
+	// fullPayloadVersion is the version reported to upstream when asking for
+	// the full payload of an update for which a delta payload was offered.
+	// The Omaha protocol has no way to ask for the full payload, but servers
+	// only offer the deltas generated from the version the client runs, and
+	// none can be generated from 0.0.0. Servers answering that version with
+	// another update, e.g. because of a minimum from-version, can't be synced
+	// from when they offer deltas (see processUpdate).
+	fullPayloadVersion = "0.0.0"
+
+	// maxConcurrentChecks is the maximum number of tracks checked for updates
+	// at once.
+	maxConcurrentChecks = 4
+
+	// omahaRequestTimeout is the time limit for the Omaha requests sent
+	// upstream.
+	omahaRequestTimeout = 30 * time.Second
 )
 
 var (
@@ -36,42 +54,83 @@ var (
 	// ErrInvalidAPIInstance error indicates that no valid api instance was
 	// provided to the syncer constructor.
 	ErrInvalidAPIInstance = errors.New("invalid api instance")
+
+	// ErrInvalidPackageStore error indicates that hosting packages was
+	// requested but no package store was provided to the syncer constructor.
+	ErrInvalidPackageStore = errors.New("invalid package store")
+
+	// ErrFullPayloadUnavailable error indicates that upstream offered a delta
+	// payload for an update but not its full payload.
+	ErrFullPayloadUnavailable = errors.New("full payload unavailable")
+
+	// ErrInvalidOmahaResponse error indicates that the response of upstream
+	// doesn't include the application requested, or lacks the payload of
+	// the update offered.
+	ErrInvalidOmahaResponse = errors.New("invalid omaha response")
 )
 
-type channelDescriptor struct {
-	name string
-	arch api.Arch
+// syncTarget represents a local channel kept in sync with a track of an
+// upstream source.
+type syncTarget struct {
+	source    *Source
+	mapping   *ChannelMapping
+	appID     string
+	channelID string
+	arch      api.Arch
+	machineID string
+	bootID    string
+	version   string
+	state     *api.SyncerState
 }
 
-// Syncer represents a process in charge of checking for updates in the
-// different official Flatcar channels and updating the Flatcar application in
-// Nebraska as needed (creating new packages and updating channels to point
-// to them). When hostPackages is enabled, packages payloads will be downloaded
-// into packagesPath and package url/filename will be rewritten.
+// logEvent adds the fields identifying the target to the log event provided.
+func (t *syncTarget) logEvent(e *zerolog.Event) *zerolog.Event {
+	return e.Str("source", t.source.Name).Str("channel", t.mapping.Channel).Str("arch", t.arch.String())
+}
+
+// Syncer represents a process in charge of checking for updates in upstream
+// Omaha servers, by default the different official Flatcar channels, and
+// updating the applications in Nebraska as needed (creating new packages and
+// updating channels to point to them). When hostPackages is enabled, packages
+// payloads will be downloaded into packageStore and package url/filename will
+// be rewritten.
 type Syncer struct {
 	api               *api.API
 	hostPackages      bool
-	packagesPath      string
+	packageStore      storage.PackageStore
 	packagesURL       string
 	checkFrequency    time.Duration
 	flatcarUpdatesURL string
+	sources           []*Source
+	targets           []*syncTarget
+	downloads         *DownloadManager
+	packageLocks      *keyedMutex
+	ctx               context.Context
+	cancel            context.CancelFunc
+	syncing           int32
+	syncCh            chan struct{}
 	stopCh            chan struct{}
-	machinesIDs       map[channelDescriptor]string
-	bootIDs           map[channelDescriptor]string
-	versions          map[channelDescriptor]string
-	channelsIDs       map[channelDescriptor]string
 	httpClient        *http.Client
 	ticker            *time.Ticker
 }
 
 // Config represents the configuration used to create a new Syncer instance.
+// When no sources are provided, the official Flatcar channels are synced from
+// FlatcarUpdatesURL.
 type Config struct {
 	API               *api.API
 	HostPackages      bool
-	PackagesPath      string
+	PackageStore      storage.PackageStore
 	PackagesURL       string
 	FlatcarUpdatesURL string
+	Sources           []*Source
 	CheckFrequency    time.Duration
+	// DownloadConcurrency is the maximum number of package payloads
+	// downloaded at once when hosting packages.
+	DownloadConcurrency int
+	// DownloadRetries is how many times a failed package payload download
+	// is retried.
+	DownloadRetries int
 }
 
 // New creates a new Syncer instance.
@@ -79,20 +138,35 @@ func New(conf *Config) (*Syncer, error) {
 	if conf.API == nil {
 		return nil, ErrInvalidAPIInstance
 	}
+	if conf.HostPackages && conf.PackageStore == nil {
+		return nil, ErrInvalidPackageStore
+	}
 
 	s := &Syncer{
 		api:               conf.API,
 		hostPackages:      conf.HostPackages,
-		packagesPath:      conf.PackagesPath,
+		packageStore:      conf.PackageStore,
 		packagesURL:       conf.PackagesURL,
 		flatcarUpdatesURL: conf.FlatcarUpdatesURL,
+		sources:           conf.Sources,
 		checkFrequency:    conf.CheckFrequency,
+		packageLocks:      newKeyedMutex(),
+		syncCh:            make(chan struct{}, 1),
 		stopCh:            make(chan struct{}),
-		machinesIDs:       make(map[channelDescriptor]string, 8),
-		bootIDs:           make(map[channelDescriptor]string, 8),
-		channelsIDs:       make(map[channelDescriptor]string, 8),
-		versions:          make(map[channelDescriptor]string, 8),
-		httpClient:        &http.Client{},
+		httpClient:        &http.Client{Timeout: omahaRequestTimeout},
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	if conf.HostPackages {
+		downloads, err := NewDownloadManager(&DownloadManagerConfig{
+			PackageStore: conf.PackageStore,
+			Concurrency:  conf.DownloadConcurrency,
+			Retries:      conf.DownloadRetries,
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.downloads = downloads
 	}
 
 	if err := s.initialize(); err != nil {
@@ -103,18 +177,20 @@ func New(conf *Config) (*Syncer, error) {
 }
 
 // Start makes the syncer start working. It will check for updates every
-// checkFrequency until it's asked to stop.
+// checkFrequency, or when asked to by SyncNow, until it's asked to stop.
 func (s *Syncer) Start() {
 	logger.Debug().Msg("syncer ready!")
 	s.ticker = time.NewTicker(s.checkFrequency)
 
-	_ = s.checkForUpdates()
+	s.sync()
 
 L:
 	for {
 		select {
 		case <-s.ticker.C:
-			_ = s.checkForUpdates()
+			s.sync()
+		case <-s.syncCh:
+			s.sync()
 		case <-s.stopCh:
 			break L
 		}
@@ -123,93 +199,224 @@ L:
 	s.api.Close()
 }
 
-// Stop stops the polling for updates.
+// Stop stops the polling for updates, aborting the requests and downloads in
+// progress.
 func (s *Syncer) Stop() {
 	s.ticker.Stop()
 	logger.Debug().Msg("stopping syncer..")
+	s.cancel()
 	s.stopCh <- struct{}{}
 }
 
+// SyncNow asks the syncer to check for updates right away, instead of waiting
+// for the next check. It returns false if a check was already requested and
+// hasn't started yet.
+func (s *Syncer) SyncNow() bool {
+	select {
+	case s.syncCh <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Syncing returns whether the syncer is checking for updates at the moment.
+func (s *Syncer) Syncing() bool {
+	return atomic.LoadInt32(&s.syncing) == 1
+}
+
+func (s *Syncer) sync() {
+	atomic.StoreInt32(&s.syncing, 1)
+	defer atomic.StoreInt32(&s.syncing, 0)
+	_ = s.checkForUpdates(s.ctx)
+}
+
 // initialize does some initial setup to prepare the syncer, checking in
-// Nebraska the last versions we know about for the different channels in the
-// Flatcar application and keeping track of some ids.
+// Nebraska the last versions we know about for the channels synced and
+// restoring the state of their last sync, like the machine id used for them.
 func (s *Syncer) initialize() error {
-	flatcarApp, err := s.api.GetApp(flatcarAppID)
-	if err != nil {
-		return err
+	sources := s.sources
+	if len(sources) == 0 {
+		flatcarApp, err := s.api.GetApp(flatcarAppID)
+		if err != nil {
+			return err
+		}
+		sources = []*Source{flatcarSource(s.flatcarUpdatesURL, flatcarApp)}
 	}
 
-	for _, c := range flatcarApp.Channels {
-		if c.Name == "stable" || c.Name == "beta" || c.Name == "alpha" || c.Name == "edge" || strings.HasPrefix(c.Name, "lts-") {
-			descriptor := channelDescriptor{
-				name: c.Name,
-				arch: c.Arch,
+	apps := make(map[string]*api.Application)
+	for _, src := range sources {
+		for _, mapping := range src.Channels {
+			app, ok := apps[mapping.App]
+			if !ok {
+				var err error
+				if app, err = s.api.GetApp(mapping.App); err != nil {
+					return fmt.Errorf("source %s: getting application %s: %w", src.Name, mapping.App, err)
+				}
+				apps[mapping.App] = app
+			}
+			arch, err := api.ArchFromString(mapping.LocalArch)
+			if err != nil {
+				return fmt.Errorf("source %s: %w", src.Name, err)
+			}
+			channel := findChannel(app, mapping.Channel, arch)
+			if channel == nil {
+				return fmt.Errorf("%w: source %s: channel %s (%s) not found in application %s", ErrInvalidSource, src.Name, mapping.Channel, arch, app.Name)
+			}
+
+			state, err := s.api.GetSyncerState(channel.ID)
+			if err != nil && err != sql.ErrNoRows {
+				return fmt.Errorf("source %s: getting state of channel %s: %w", src.Name, channel.ID, err)
+			}
+			if state == nil || state.Source != src.Name || state.Track != mapping.Track {
+				state = &api.SyncerState{
+					ChannelID: channel.ID,
+					Source:    src.Name,
+					Track:     mapping.Track,
+					MachineID: "{" + uuid.New().String() + "}",
+				}
+			}
+
+			t := &syncTarget{
+				source:    src,
+				mapping:   mapping,
+				appID:     app.ID,
+				channelID: channel.ID,
+				arch:      arch,
+				machineID: state.MachineID,
+				bootID:    "{" + uuid.New().String() + "}",
+				version:   src.InitialVersion,
+				state:     state,
 			}
-			s.machinesIDs[descriptor] = "{" + uuid.New().String() + "}"
-			s.bootIDs[descriptor] = "{" + uuid.New().String() + "}"
-			s.channelsIDs[descriptor] = c.ID
-
-			if c.Package != nil {
-				s.versions[descriptor] = c.Package.Version
-			} else {
-				s.versions[descriptor] = "766.0.0"
+			if channel.Package != nil {
+				t.version = channel.Package.Version
 			}
+			s.targets = append(s.targets, t)
 		}
 	}
 
 	return nil
 }
 
-// checkForUpdates polls the public Flatcar servers looking for updates in the
-// official channels (stable, beta, alpha, edge) sending Omaha requests. When an
-// update is received we'll process it, creating packages and updating channels
-// in Nebraska as needed.
-func (s *Syncer) checkForUpdates() error {
-	for descriptor, currentVersion := range s.versions {
-		logger.Debug().Str("channel", descriptor.name).Str("arch", descriptor.arch.String()).Str("currentVersion", currentVersion).Msg("checking for updates")
-
-		update, err := s.doOmahaRequest(descriptor, currentVersion)
-		if err != nil {
-			return err
+func findChannel(app *api.Application, name string, arch api.Arch) *api.Channel {
+	for _, c := range app.Channels {
+		if c.Name == name && c.Arch == arch {
+			return c
 		}
-		if update != nil && update.Status == "ok" {
-			logger.Debug().Str("channel", descriptor.name).Str("arch", descriptor.arch.String()).Str("currentVersion", currentVersion).Str("availableVersion", update.Manifest.Version).Send()
-			if err := s.processUpdate(descriptor, update); err != nil {
-				return err
+	}
+	return nil
+}
+
+// checkForUpdates polls the upstream servers looking for updates in the
+// tracks synced sending Omaha requests. When an update is received we'll
+// process it, creating packages and updating channels in Nebraska as needed.
+// Up to maxConcurrentChecks tracks are checked at once, the first error found
+// is returned once all of them have been checked.
+func (s *Syncer) checkForUpdates(ctx context.Context) error {
+	targets := make(chan *syncTarget)
+	errs := make(chan error, len(s.targets))
+	var wg sync.WaitGroup
+	for i := 0; i < maxConcurrentChecks && i < len(s.targets); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range targets {
+				result, err := s.checkTarget(ctx, t)
+				if ctx.Err() != nil {
+					// The syncer is stopping, the check is not over.
+					continue
+				}
+				s.saveState(t, result, err)
+				if err != nil {
+					errs <- err
+				}
 			}
-			s.versions[descriptor] = update.Manifest.Version
-			s.bootIDs[descriptor] = "{" + uuid.New().String() + "}"
-		} else {
-			logger.Debug().Str("channel", descriptor.name).Str("arch", descriptor.arch.String()).Str("currentVersion", currentVersion).Msgf("checkForUpdates, no update available updateStatus %v", update.Status)
-		}
+		}()
+	}
 
+L:
+	for _, t := range s.targets {
 		select {
-		case <-time.After(5 * time.Second):
-		case <-s.stopCh:
-			break
+		case targets <- t:
+		case <-ctx.Done():
+			break L
 		}
 	}
+	close(targets)
+	wg.Wait()
+	close(errs)
 
-	return nil
+	return <-errs
+}
+
+// checkTarget checks for updates in the track of a single target, processing
+// the update received if any. It returns the result of the check, which is
+// only meaningful when there is no error.
+func (s *Syncer) checkTarget(ctx context.Context, t *syncTarget) (string, error) {
+	t.logEvent(logger.Debug()).Str("currentVersion", t.version).Msg("checking for updates")
+
+	update, err := s.doOmahaRequest(ctx, t, t.version)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case update != nil && update.Status == "ok" && !hasPayload(update):
+		t.logEvent(logger.Error()).Str("currentVersion", t.version).Msg("checkForUpdates, update payload missing")
+		return "", fmt.Errorf("%w: update payload missing", ErrInvalidOmahaResponse)
+	case update != nil && update.Status == "ok":
+		t.logEvent(logger.Debug()).Str("currentVersion", t.version).Str("availableVersion", update.Manifest.Version).Send()
+		t.state.UpstreamVersion = update.Manifest.Version
+		if err := s.processUpdate(ctx, t, update, t.version); err != nil {
+			return "", err
+		}
+		t.version = update.Manifest.Version
+		t.bootID = "{" + uuid.New().String() + "}"
+		return api.SyncResultUpdated, nil
+	case update != nil && update.Status != "noupdate":
+		t.logEvent(logger.Error()).Str("currentVersion", t.version).Msgf("checkForUpdates, unexpected updateStatus %v", update.Status)
+		return "", fmt.Errorf("%w: update status %s", ErrInvalidOmahaResponse, update.Status)
+	}
+
+	t.logEvent(logger.Debug()).Str("currentVersion", t.version).Msg("checkForUpdates, no update available")
+	t.state.UpstreamVersion = t.version
+	return api.SyncResultUpToDate, nil
+}
+
+// saveState records in the database the result of the last check for
+// updates of the target provided.
+func (s *Syncer) saveState(t *syncTarget, result string, err error) {
+	now := null.TimeFrom(time.Now())
+	t.state.LastCheckTs = now
+	t.state.LastResult, t.state.LastError = result, ""
+	if err != nil {
+		t.state.LastResult, t.state.LastError = api.SyncResultError, err.Error()
+	} else {
+		t.state.LastSuccessTs = now
+	}
+	if err := s.api.SetSyncerState(t.state); err != nil {
+		t.logEvent(logger.Error()).Err(err).Msg("saveState, saving syncer state")
+	}
 }
 
 // doOmahaRequest sends an Omaha request checking if there is an update for a
-// specific Flatcar channel, returning the update check to the caller.
-func (s *Syncer) doOmahaRequest(descriptor channelDescriptor, currentVersion string) (*omaha.UpdateResponse, error) {
+// specific track of the remote application, returning the update check to the
+// caller.
+func (s *Syncer) doOmahaRequest(ctx context.Context, t *syncTarget, currentVersion string) (*omaha.UpdateResponse, error) {
+	rc := &t.source.Request
 	req := omaha.NewRequest()
-	req.OS.Version = "Chateau"
-	req.OS.Platform = "CoreOS"
-	req.OS.ServicePack = currentVersion + "_x86_64"
-	req.OS.Arch = descriptor.arch.OmahaString()
-	req.Version = "CoreOSUpdateEngine-0.1.0.0"
-	req.UpdaterVersion = "CoreOSUpdateEngine-0.1.0.0"
+	req.OS.Version = rc.OSVersion
+	req.OS.Platform = rc.OSPlatform
+	req.OS.ServicePack = rc.servicePack(currentVersion)
+	req.OS.Arch = t.mapping.Arch
+	req.Version = rc.UpdaterVersion
+	req.UpdaterVersion = rc.UpdaterVersion
 	req.InstallSource = "scheduler"
 	req.IsMachine = 1
-	app := req.AddApp(flatcarAppID, currentVersion)
+	app := req.AddApp(t.source.AppID, currentVersion)
 	app.AddUpdateCheck()
-	app.MachineID = s.machinesIDs[descriptor]
-	app.BootID = s.bootIDs[descriptor]
-	app.Track = descriptor.name
+	app.MachineID = t.machineID
+	app.BootID = t.bootID
+	app.Track = t.mapping.Track
 
 	payload, err := xml.Marshal(req)
 	if err != nil {
@@ -218,7 +425,12 @@ func (s *Syncer) doOmahaRequest(descriptor channelDescriptor, currentVersion str
 	}
 	logger.Debug().Str("request", string(payload)).Msg("doOmahaRequest")
 
-	resp, err := s.httpClient.Post(s.flatcarUpdatesURL, "text/xml", bytes.NewReader(payload))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.source.URL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "text/xml")
+	resp, err := s.httpClient.Do(httpReq)
 	if err != nil {
 		logger.Error().Err(err).Msg("checkForUpdates, posting omaha response")
 		return nil, err
@@ -238,124 +450,240 @@ func (s *Syncer) doOmahaRequest(descriptor channelDescriptor, currentVersion str
 		logger.Error().Err(err).Msg("checkForUpdates, unmarshalling omaha response")
 		return nil, err
 	}
+	if len(oresp.Apps) == 0 {
+		t.logEvent(logger.Error()).Msg("checkForUpdates, no application in omaha response")
+		return nil, ErrInvalidOmahaResponse
+	}
 
 	return oresp.Apps[0].UpdateCheck, nil
 }
 
-// processUpdate is in charge of creating packages in the Flatcar application in
-// Nebraska and updating the appropriate channel to point to the new channel.
-func (s *Syncer) processUpdate(descriptor channelDescriptor, update *omaha.UpdateResponse) error {
-	// Create new package and action for Flatcar application in Nebraska if
+// processUpdate is in charge of creating packages in the local application
+// in Nebraska and updating the appropriate channel to point to the new
+// package. When upstream offers a delta payload from the current version, the
+// package is created using the full payload and the delta is added to it.
+// Tracks getting the same package are processed one after the other, so it's
+// only created and downloaded once.
+func (s *Syncer) processUpdate(ctx context.Context, t *syncTarget, update *omaha.UpdateResponse, currentVersion string) error {
+	var deltaUpdate *omaha.UpdateResponse
+	if isDeltaUpdate(update) {
+		fullUpdate, err := s.doOmahaRequest(ctx, t, fullPayloadVersion)
+		if err != nil {
+			return err
+		}
+		if fullUpdate == nil || fullUpdate.Status != "ok" || !hasPayload(fullUpdate) || isDeltaUpdate(fullUpdate) || fullUpdate.Manifest.Version != update.Manifest.Version {
+			t.logEvent(logger.Error()).Msg("processUpdate, getting full payload")
+			return ErrFullPayloadUnavailable
+		}
+		deltaUpdate, update = update, fullUpdate
+	}
+
+	unlock := s.packageLocks.lock(t.appID + "/" + update.Manifest.Version + "/" + t.arch.String())
+	defer unlock()
+
+	// Create new package (and action for Flatcar packages) in Nebraska if
 	// needed (package may already exist and we just need to update the channel
 	// reference to it)
-	pkg, err := s.api.GetPackageByVersionAndArch(flatcarAppID, update.Manifest.Version, descriptor.arch)
+	pkg, err := s.api.GetPackageByVersionAndArch(t.appID, update.Manifest.Version, t.arch)
 	if err != nil {
 		url := update.URLs[0].CodeBase
 		filename := update.Manifest.Packages[0].Name
 
 		if s.hostPackages {
 			url = s.packagesURL
-			filename = fmt.Sprintf("flatcar-%s-%s.gz", getArchString(descriptor.arch), update.Manifest.Version)
-			if err := s.downloadPackage(update, filename); err != nil {
-				logger.Error().Err(err).Str("channel", descriptor.name).Str("arch", descriptor.arch.String()).Msg("processUpdate, downloading package")
+			filename = t.hostedFilename(update, "")
+			if err := s.downloadPackage(ctx, t, update, filename); err != nil {
+				t.logEvent(logger.Error()).Err(err).Msg("processUpdate, downloading package")
 				return err
 			}
 		}
 
 		pkg = &api.Package{
-			Type:          api.PkgTypeFlatcar,
+			Type:          t.source.PackageType,
 			URL:           url,
 			Version:       update.Manifest.Version,
 			Filename:      null.StringFrom(filename),
 			Size:          null.StringFrom(strconv.FormatUint(update.Manifest.Packages[0].Size, 10)),
 			Hash:          null.StringFrom(update.Manifest.Packages[0].SHA1),
-			ApplicationID: flatcarAppID,
-			Arch:          descriptor.arch,
+			ApplicationID: t.appID,
+			Arch:          t.arch,
 		}
 		if _, err = s.api.AddPackage(pkg); err != nil {
-			logger.Error().Err(err).Str("channel", descriptor.name).Str("arch", descriptor.arch.String()).Msg("processUpdate, adding package")
+			t.logEvent(logger.Error()).Err(err).Msg("processUpdate, adding package")
 			return err
 		}
 
-		flatcarAction := &api.FlatcarAction{
-			Event:                 update.Manifest.Actions[0].Event,
-			ChromeOSVersion:       update.Manifest.Actions[0].DisplayVersion,
-			Sha256:                update.Manifest.Actions[0].SHA256,
-			NeedsAdmin:            update.Manifest.Actions[0].NeedsAdmin,
-			IsDelta:               update.Manifest.Actions[0].IsDeltaPayload,
-			DisablePayloadBackoff: update.Manifest.Actions[0].DisablePayloadBackoff,
-			MetadataSignatureRsa:  update.Manifest.Actions[0].MetadataSignatureRsa,
-			MetadataSize:          update.Manifest.Actions[0].MetadataSize,
-			Deadline:              update.Manifest.Actions[0].Deadline,
-			PackageID:             pkg.ID,
-		}
-		if _, err = s.api.AddFlatcarAction(flatcarAction); err != nil {
-			logger.Error().Err(err).Str("channel", descriptor.name).Str("arch", descriptor.arch.String()).Msgf("processUpdate, adding flatcar action")
+		if err := s.addFlatcarAction(t, pkg, update); err != nil {
 			return err
 		}
 	}
 
+	if deltaUpdate != nil && pkg.DeltaFrom(currentVersion) == nil {
+		if err := s.addPackageDelta(ctx, t, pkg, currentVersion, deltaUpdate); err != nil {
+			t.logEvent(logger.Error()).Err(err).Str("fromVersion", currentVersion).Msg("processUpdate, adding package delta")
+		}
+	}
+
 	// Update channel to point to the package with the new version
-	channel, err := s.api.GetChannel(s.channelsIDs[descriptor])
+	channel, err := s.api.GetChannel(t.channelID)
 	if err != nil {
-		logger.Error().Err(err).Str("channel", descriptor.name).Str("arch", descriptor.arch.String()).Msg("processUpdate, getting channel to update")
+		t.logEvent(logger.Error()).Err(err).Msg("processUpdate, getting channel to update")
 		return err
 	}
 	channel.PackageID = null.StringFrom(pkg.ID)
 	if err = s.api.UpdateChannel(channel); err != nil {
-		logger.Error().Err(err).Str("channel", descriptor.name).Str("arch", descriptor.arch.String()).Msg("processUpdate, updating")
+		t.logEvent(logger.Error()).Err(err).Msg("processUpdate, updating")
 		return err
 	}
 
 	return nil
 }
 
+// addFlatcarAction adds to a Flatcar package the action offered by upstream
+// in the update provided.
+func (s *Syncer) addFlatcarAction(t *syncTarget, pkg *api.Package, update *omaha.UpdateResponse) error {
+	if pkg.Type != api.PkgTypeFlatcar || len(update.Manifest.Actions) == 0 {
+		return nil
+	}
+	flatcarAction := &api.FlatcarAction{
+		Event:                 update.Manifest.Actions[0].Event,
+		ChromeOSVersion:       update.Manifest.Actions[0].DisplayVersion,
+		Sha256:                update.Manifest.Actions[0].SHA256,
+		NeedsAdmin:            update.Manifest.Actions[0].NeedsAdmin,
+		IsDelta:               update.Manifest.Actions[0].IsDeltaPayload,
+		DisablePayloadBackoff: update.Manifest.Actions[0].DisablePayloadBackoff,
+		MetadataSignatureRsa:  update.Manifest.Actions[0].MetadataSignatureRsa,
+		MetadataSize:          update.Manifest.Actions[0].MetadataSize,
+		Deadline:              update.Manifest.Actions[0].Deadline,
+		PackageID:             pkg.ID,
+	}
+	if _, err := s.api.AddFlatcarAction(flatcarAction); err != nil {
+		t.logEvent(logger.Error()).Err(err).Msg("processUpdate, adding flatcar action")
+		return err
+	}
+	return nil
+}
+
+// addPackageDelta adds the delta payload from the version provided offered in
+// the update to the package given.
+func (s *Syncer) addPackageDelta(ctx context.Context, t *syncTarget, pkg *api.Package, fromVersion string, update *omaha.UpdateResponse) error {
+	if !hasPayload(update) {
+		return fmt.Errorf("%w: delta payload missing", ErrInvalidOmahaResponse)
+	}
+	url := update.URLs[0].CodeBase
+	filename := update.Manifest.Packages[0].Name
+
+	if s.hostPackages {
+		url = s.packagesURL
+		filename = t.hostedFilename(update, "-delta-"+fromVersion)
+		if err := s.downloadPackage(ctx, t, update, filename); err != nil {
+			return err
+		}
+	}
+
+	action := update.Manifest.Actions[0]
+	delta := &api.PackageDelta{
+		PackageID:            pkg.ID,
+		FromVersion:          fromVersion,
+		URL:                  url,
+		Filename:             null.StringFrom(filename),
+		Size:                 null.StringFrom(strconv.FormatUint(update.Manifest.Packages[0].Size, 10)),
+		Hash:                 null.StringFrom(update.Manifest.Packages[0].SHA1),
+		Sha256:               null.StringFrom(action.SHA256),
+		MetadataSignatureRsa: action.MetadataSignatureRsa,
+		MetadataSize:         action.MetadataSize,
+	}
+	_, err := s.api.AddPackageDelta(delta)
+	return err
+}
+
+// hasPayload checks that the update provided has the url and the package
+// needed to get its payload, which malformed upstream responses may lack.
+func hasPayload(update *omaha.UpdateResponse) bool {
+	return update.Manifest != nil && len(update.URLs) > 0 && len(update.Manifest.Packages) > 0
+}
+
+// isDeltaUpdate checks if the update provided offers a delta payload.
+func isDeltaUpdate(update *omaha.UpdateResponse) bool {
+	return update.Manifest != nil && len(update.Manifest.Actions) > 0 && update.Manifest.Actions[0].IsDeltaPayload
+}
+
 func getArchString(arch api.Arch) string {
 	return strings.TrimSuffix(arch.CoreosString(), "-usr")
 }
 
-// downloadPackage downloads and verifies the package payload referenced in the
-// update provided. The downloaded package payload is stored in packagesPath
-// using the filename provided.
-func (s *Syncer) downloadPackage(update *omaha.UpdateResponse, filename string) error {
-	tmpFile, err := ioutil.TempFile(s.packagesPath, "tmp_flatcar_pkg_")
-	if err != nil {
-		return err
+// hostedFilename returns the filename used to store the payload of the update
+// provided when packages are hosted. Flatcar payloads keep the name they've
+// always had, the others are prefixed by the source name and keep the
+// upstream filename. The update must have a payload (see hasPayload).
+func (t *syncTarget) hostedFilename(update *omaha.UpdateResponse, suffix string) string {
+	if t.source.PackageType == api.PkgTypeFlatcar {
+		return fmt.Sprintf("%s-%s-%s%s.gz", t.source.Name, getArchString(t.arch), update.Manifest.Version, suffix)
 	}
-	defer os.Remove(tmpFile.Name())
+	return fmt.Sprintf("%s-%s-%s%s-%s", t.source.Name, t.arch, update.Manifest.Version, suffix, path.Base(update.Manifest.Packages[0].Name))
+}
 
+// downloadPackage downloads the package payload referenced in the update
+// provided into packageStore, using the filename provided. The payload is
+// verified against the size and hashes of the package, and against the sha256
+// hash of the action in Flatcar updates.
+func (s *Syncer) downloadPackage(ctx context.Context, t *syncTarget, update *omaha.UpdateResponse, filename string) error {
+	if !hasPayload(update) {
+		return fmt.Errorf("%w: payload missing", ErrInvalidOmahaResponse)
+	}
 	updateURL, err := url.Parse(update.URLs[0].CodeBase)
 	if err != nil {
 		return err
 	}
-
 	updateURL.Path = path.Join(updateURL.Path, update.Manifest.Packages[0].Name)
 
-	pkgURL := updateURL.String()
-	resp, err := http.Get(pkgURL)
-	if err != nil {
-		return err
+	d := &Download{
+		Source:   t.source.Name,
+		URL:      updateURL.String(),
+		Filename: filename,
+		Size:     int64(update.Manifest.Packages[0].Size),
+		SHA1:     update.Manifest.Packages[0].SHA1,
 	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("received unexpected status code (%d)", resp.StatusCode)
+	if len(update.Manifest.Actions) > 0 {
+		d.SHA256 = update.Manifest.Actions[0].SHA256
 	}
-	defer resp.Body.Close()
+	return s.downloads.Download(ctx, d)
+}
 
-	hashSha256 := sha256.New()
-	logger.Debug().Msgf("downloadPackage, downloading.. url %s", pkgURL)
-	if _, err := io.Copy(io.MultiWriter(tmpFile, hashSha256), resp.Body); err != nil {
-		return err
-	}
-	if base64.StdEncoding.EncodeToString(hashSha256.Sum(nil)) != update.Manifest.Actions[0].SHA256 {
-		return errors.New("downloaded file hash mismatch")
-	}
+// keyedMutex provides a lock per key, the locks are dropped once nobody
+// holds or waits for them.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
 
-	if err := tmpFile.Close(); err != nil {
-		return err
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: make(map[string]*keyedLock)}
+}
+
+// lock locks the key provided, returning the function unlocking it.
+func (km *keyedMutex) lock(key string) func() {
+	km.mu.Lock()
+	l, ok := km.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		km.locks[key] = l
 	}
-	if err := os.Rename(tmpFile.Name(), filepath.Join(s.packagesPath, filename)); err != nil {
-		return err
+	l.refs++
+	km.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		km.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(km.locks, key)
+		}
+		km.mu.Unlock()
 	}
-
-	return nil
 }
@@ -19,6 +19,29 @@ export interface Group {
   policy_update_timeout: string;
   channel: Channel;
   track: string;
+  policy_rollout_steps?: string;
+  policy_rollout_step_interval?: string;
+  policy_rollout_step_health_threshold?: number;
+  policy_max_failure_rate?: number;
+  policy_failure_rate_window?: string;
+  policy_rollback_on_failure?: boolean;
+  policy_update_windows?: UpdateWindow[] | null;
+  policy_blackout_periods?: BlackoutPeriod[] | null;
+}
+
+export interface UpdateWindow {
+  name: string;
+  weekdays?: string[];
+  start?: string;
+  end?: string;
+  cron?: string;
+  duration?: string;
+}
+
+export interface BlackoutPeriod {
+  name: string;
+  start: string;
+  end: string;
 }
 
 export interface Channel {
@@ -30,6 +53,8 @@ export interface Channel {
   package_id: null | string;
   package: Package;
   arch: Arch;
+  version_constraint?: string | null;
+  min_version?: string | null;
 }
 
 export interface Package {
@@ -46,6 +71,7 @@ export interface Package {
   application_id: string;
   flatcar_action?: FlatcarAction;
   arch: Arch;
+  min_from_version?: null | string;
 }
 
 export interface FlatcarAction {
@@ -107,6 +133,16 @@ export interface InstanceApplication {
   created_ts: string | Date | number;
   status: null | number;
   last_check_for_updates: string;
+  override?: InstanceOverride;
+}
+
+export interface InstanceOverride {
+  instance_id: string;
+  application_id: string;
+  never_update: boolean;
+  pinned_version: string | null;
+  group_id: string | null;
+  created_ts: string | Date | number;
 }
 
 export interface InstanceStatusHistory {
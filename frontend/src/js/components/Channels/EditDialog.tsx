@@ -53,6 +53,8 @@ function EditDialog(props: { data: any; create?: boolean; show: boolean; onHide:
       application_id: string;
       package_id?: string;
       id?: string;
+      version_constraint?: string | null;
+      min_version?: string | null;
     } = {
       name: values.name,
       arch: arch,
@@ -70,6 +72,9 @@ function EditDialog(props: { data: any; create?: boolean; show: boolean; onHide:
       channelFunctionCall = applicationsStore.createChannel(data as Channel);
     } else {
       data['id'] = props.data.channel.id;
+      // Keep the version settings, which can't be edited from here yet.
+      data['version_constraint'] = props.data.channel.version_constraint;
+      data['min_version'] = props.data.channel.min_version;
       channelFunctionCall = applicationsStore.updateChannel(data as Channel);
     }
 
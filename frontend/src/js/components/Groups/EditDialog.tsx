@@ -78,6 +78,19 @@ function EditDialog(props: {
       packageFunctionCall = applicationsStore.createGroup(data as Group);
     } else {
       data['id'] = props.data.group.id;
+      // Keep the policies which can't be edited from here yet.
+      for (const policy of [
+        'policy_rollout_steps',
+        'policy_rollout_step_interval',
+        'policy_rollout_step_health_threshold',
+        'policy_max_failure_rate',
+        'policy_failure_rate_window',
+        'policy_rollback_on_failure',
+        'policy_update_windows',
+        'policy_blackout_periods',
+      ]) {
+        data[policy] = props.data.group[policy];
+      }
       packageFunctionCall = applicationsStore.updateGroup(data as Group);
     }
 
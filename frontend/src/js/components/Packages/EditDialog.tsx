@@ -78,6 +78,7 @@ function EditDialog(props: { data: any; show: boolean; create?: boolean; onHide:
       application_id:
         isCreation && props.data.appID ? props.data.appID : props.data.channel.application_id,
       channels_blacklist: values.channelsBlacklist ? values.channelsBlacklist : [],
+      min_from_version: values.minFromVersion ? values.minFromVersion : null,
     };
 
     if (isFlatcarType(packageType)) {
@@ -210,6 +211,17 @@ function EditDialog(props: { data: any; show: boolean; create?: boolean; onHide:
               />
             </Grid>
           </Grid>
+          <Field
+            name="minFromVersion"
+            component={TextField}
+            margin="dense"
+            label={t('packages|Minimum From Version')}
+            type="text"
+            helperText={t(
+              'packages|Instances running an older version are updated to an intermediate package first'
+            )}
+            fullWidth
+          />
           <Field
             name="hash"
             component={TextField}
@@ -293,6 +305,10 @@ function EditDialog(props: { data: any; show: boolean; create?: boolean; onHide:
     version: Yup.string()
       .matches(REGEX_SEMVER, t('packages|Enter a valid semver (1.0.1)'))
       .required(t('frequent|Required')),
+    minFromVersion: Yup.string().matches(REGEX_SEMVER, {
+      message: t('packages|Enter a valid semver (1.0.1)'),
+      excludeEmptyString: true,
+    }),
     size: Yup.number()
       .integer(t('packages|Must be an integer number'))
       .positive(t('packages|Must be a positive number'))
@@ -315,6 +331,7 @@ function EditDialog(props: { data: any; show: boolean; create?: boolean; onHide:
       version: props.data.channel.version,
       size: props.data.channel.size,
       hash: props.data.channel.hash,
+      minFromVersion: props.data.channel.min_from_version || '',
       channelsBlacklist: props.data.channel.channels_blacklist
         ? props.data.channel.channels_blacklist
         : [],
@@ -0,0 +1,92 @@
+package helpers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	cupKeyParam          = "cup2key"
+	cupRequestHashParam  = "cup2hreq"
+	cupServerProofHeader = "X-Cup-Server-Proof"
+)
+
+var (
+	// ErrInvalidResponseSignature error indicates that the signature of the
+	// omaha response received from CR was missing or invalid.
+	ErrInvalidResponseSignature = errors.New("invalid omaha response signature")
+)
+
+// CUPVerifier verifies the Omaha responses signed by Nebraska using the Client
+// Update Protocol, so responses can be trusted even if fetched through an
+// untrusted proxy.
+type CUPVerifier struct {
+	keyVersion int
+	publicKey  *ecdsa.PublicKey
+}
+
+// NewCUPVerifier creates a verifier trusting the PEM encoded ECDSA P-256
+// public key provided, which Nebraska knows as keyVersion.
+func NewCUPVerifier(keyVersion int, publicKeyPEM []byte) (*CUPVerifier, error) {
+	block, _ := pem.Decode(publicKeyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, ok := key.(*ecdsa.PublicKey)
+	if !ok || publicKey.Curve != elliptic.P256() {
+		return nil, errors.New("not an ECDSA P-256 public key")
+	}
+	return &CUPVerifier{keyVersion: keyVersion, publicKey: publicKey}, nil
+}
+
+// NewKeyParam returns a cup2key parameter for a new request, with the key
+// version trusted and a random nonce.
+func (v *CUPVerifier) NewKeyParam() (string, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return strconv.Itoa(v.keyVersion) + ":" + base64.RawURLEncoding.EncodeToString(nonce), nil
+}
+
+// Verify checks the server proof received along with the response to the
+// request sent with the cup2key parameter provided. The digest signed must
+// match the one computed by Nebraska (see omaha.CUPSignedDigest).
+func (v *CUPVerifier) Verify(cup2key string, request, response []byte, proof string) error {
+	parts := strings.SplitN(proof, ":", 2)
+	if len(parts) != 2 {
+		return ErrInvalidResponseSignature
+	}
+	signature, err := hex.DecodeString(parts[0])
+	if err != nil {
+		return ErrInvalidResponseSignature
+	}
+	requestHash := sha256.Sum256(request)
+	if !strings.EqualFold(parts[1], hex.EncodeToString(requestHash[:])) {
+		return ErrInvalidResponseSignature
+	}
+
+	responseHash := sha256.Sum256(response)
+	message := make([]byte, 0, 2*sha256.Size+len(cup2key))
+	message = append(message, requestHash[:]...)
+	message = append(message, responseHash[:]...)
+	message = append(message, cup2key...)
+	digest := sha256.Sum256(message)
+	if !ecdsa.VerifyASN1(v.publicKey, digest[:], signature) {
+		return ErrInvalidResponseSignature
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package helpers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kinvolk/nebraska/backend/pkg/omaha"
+)
+
+func newTestCUPKeys(t *testing.T, version int) (*omaha.CUPSigner, *CUPVerifier) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := omaha.NewCUPSigner(map[int]*ecdsa.PrivateKey{version: key})
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	verifier, err := NewCUPVerifier(version, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	require.NoError(t, err)
+	return signer, verifier
+}
+
+func TestCUPVerifier(t *testing.T) {
+	signer, verifier := newTestCUPKeys(t, 2)
+
+	request := []byte(`<request protocol="3.0"></request>`)
+	response := []byte(`<response protocol="3.0"></response>`)
+	cup2key, err := verifier.NewKeyParam()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(cup2key, "2:"))
+	proof, err := signer.Sign(cup2key, "", request, response)
+	require.NoError(t, err)
+	assert.NoError(t, verifier.Verify(cup2key, request, response, proof))
+
+	// Responses signed for another exchange aren't trusted.
+	otherKey, err := verifier.NewKeyParam()
+	require.NoError(t, err)
+	assert.NotEqual(t, cup2key, otherKey)
+	assert.Equal(t, ErrInvalidResponseSignature, verifier.Verify(otherKey, request, response, proof))
+	assert.Equal(t, ErrInvalidResponseSignature, verifier.Verify(cup2key, request, []byte(`<response protocol="3.0"><app/></response>`), proof))
+	assert.Equal(t, ErrInvalidResponseSignature, verifier.Verify(cup2key, []byte(`<request protocol="3.0"><app/></request>`), response, proof))
+
+	// Responses signed with another key aren't trusted.
+	_, otherVerifier := newTestCUPKeys(t, 2)
+	assert.Equal(t, ErrInvalidResponseSignature, otherVerifier.Verify(cup2key, request, response, proof))
+
+	for _, proof := range []string{"", proof[:strings.Index(proof, ":")], "zz" + proof, proof[:strings.Index(proof, ":")] + ":00"} {
+		assert.Equal(t, ErrInvalidResponseSignature, verifier.Verify(cup2key, request, response, proof), proof)
+	}
+
+	_, err = NewCUPVerifier(1, []byte("not a key"))
+	assert.Error(t, err)
+}
+
+func TestClientSignedResponses(t *testing.T) {
+	signer, verifier := newTestCUPKeys(t, 1)
+
+	response := []byte(`<response protocol="3.0"><app appid="app1" status="ok"><updatecheck status="noupdate"></updatecheck></app></response>`)
+	var signed, tamper bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		cup2key := r.URL.Query().Get("cup2key")
+		signed = cup2key != ""
+		if signed {
+			requestHash := sha256.Sum256(request)
+			assert.Equal(t, hex.EncodeToString(requestHash[:]), r.URL.Query().Get("cup2hreq"))
+			proof, err := signer.Sign(cup2key, r.URL.Query().Get("cup2hreq"), request, response)
+			require.NoError(t, err)
+			w.Header().Set("X-Cup-Server-Proof", proof)
+		}
+		if tamper {
+			_, _ = w.Write([]byte(strings.Replace(string(response), "noupdate", "ok", 1)))
+			return
+		}
+		_, _ = w.Write(response)
+	}))
+	defer server.Close()
+
+	client := NewClient(OptionOmahaURL(server.URL), OptionCUPVerifier(verifier))
+	_, err := client.GetUpdate("instance1", "app1", "group1", "1.0.0")
+	assert.Equal(t, ErrNoUpdate, err)
+	assert.True(t, signed)
+
+	tamper = true
+	_, err = client.GetUpdate("instance1", "app1", "group1", "1.0.0")
+	assert.Equal(t, ErrInvalidResponseSignature, err)
+
+	// Clients without a verifier don't ask for signed responses.
+	tamper = false
+	_, err = NewClient(OptionOmahaURL(server.URL)).GetUpdate("instance1", "app1", "group1", "1.0.0")
+	assert.Equal(t, ErrNoUpdate, err)
+	assert.False(t, signed)
+}
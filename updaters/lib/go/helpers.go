@@ -2,10 +2,13 @@ package helpers
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/xml"
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 
 	"github.com/kinvolk/go-omaha/omaha"
@@ -33,11 +36,79 @@ var (
 	ErrNoUpdate = errors.New("no update available")
 )
 
+// Client sends the omaha requests of an updater to CR.
+type Client struct {
+	omahaURL    string
+	cupVerifier *CUPVerifier
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// OptionOmahaURL makes the client send its requests to the omaha url
+// provided, instead of the one in the CR_OMAHA_URL environment variable.
+func OptionOmahaURL(omahaURL string) ClientOption {
+	return func(c *Client) {
+		c.omahaURL = omahaURL
+	}
+}
+
+// OptionCUPVerifier makes the client ask for signed responses, checking them
+// with the verifier provided.
+func OptionCUPVerifier(v *CUPVerifier) ClientOption {
+	return func(c *Client) {
+		c.cupVerifier = v
+	}
+}
+
+// NewClient creates a client configured with the options provided.
+func NewClient(opts ...ClientOption) *Client {
+	c := &Client{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// defaultClient is the client used by the package level functions.
+var defaultClient = NewClient()
+
 // GetUpdate asks CR for an update for the given instance in the context of the
-// application and group provided.
+// application and group provided, using the default client.
 func GetUpdate(instanceID, appID, groupID, version string) (*Update, error) {
+	return defaultClient.GetUpdate(instanceID, appID, groupID, version)
+}
+
+// EventDownloadStarted posts an event to CR to indicate that the download of
+// the update has started, using the default client.
+func EventDownloadStarted(instanceID, appID, groupID string) error {
+	return defaultClient.EventDownloadStarted(instanceID, appID, groupID)
+}
+
+// EventDownloadFinished posts an event to CR to indicate that the download of
+// the update has finished, using the default client.
+func EventDownloadFinished(instanceID, appID, groupID string) error {
+	return defaultClient.EventDownloadFinished(instanceID, appID, groupID)
+}
+
+// EventUpdateSucceeded posts an event to CR to indicate that the update was
+// installed successfully and the new version is working fine, using the
+// default client.
+func EventUpdateSucceeded(instanceID, appID, groupID string) error {
+	return defaultClient.EventUpdateSucceeded(instanceID, appID, groupID)
+}
+
+// EventUpdateFailed posts an event to CR to indicate that the update process
+// complete but it didn't succeed, using the default client.
+func EventUpdateFailed(instanceID, appID, groupID string) error {
+	return defaultClient.EventUpdateFailed(instanceID, appID, groupID)
+}
+
+// GetUpdate asks CR for an update for the given instance in the context of the
+// application and group provided.
+func (c *Client) GetUpdate(instanceID, appID, groupID, version string) (*Update, error) {
 	req := buildOmahaUpdateRequest(instanceID, appID, groupID, version)
-	resp, err := doOmahaRequest(req)
+	resp, err := c.doOmahaRequest(req)
 	if err != nil {
 		return nil, err
 	}
@@ -70,36 +141,36 @@ func GetUpdate(instanceID, appID, groupID, version string) (*Update, error) {
 
 // EventDownloadStarted posts an event to CR to indicate that the download of
 // the update has started.
-func EventDownloadStarted(instanceID, appID, groupID string) error {
+func (c *Client) EventDownloadStarted(instanceID, appID, groupID string) error {
 	req := buildOmahaEventRequest(instanceID, appID, groupID, omaha.EventTypeDownloadStarted, omaha.EventResultSuccess)
-	_, err := doOmahaRequest(req)
+	_, err := c.doOmahaRequest(req)
 
 	return err
 }
 
 // EventDownloadFinished posts an event to CR to indicate that the download of
 // the update has finished.
-func EventDownloadFinished(instanceID, appID, groupID string) error {
+func (c *Client) EventDownloadFinished(instanceID, appID, groupID string) error {
 	req := buildOmahaEventRequest(instanceID, appID, groupID, omaha.EventTypeUpdateDownloadFinished, omaha.EventResultSuccess)
-	_, err := doOmahaRequest(req)
+	_, err := c.doOmahaRequest(req)
 
 	return err
 }
 
 // EventUpdateSucceeded posts an event to CR to indicate that the update was
 // installed successfully and the new version is working fine.
-func EventUpdateSucceeded(instanceID, appID, groupID string) error {
+func (c *Client) EventUpdateSucceeded(instanceID, appID, groupID string) error {
 	req := buildOmahaEventRequest(instanceID, appID, groupID, omaha.EventTypeUpdateComplete, omaha.EventResultSuccessReboot)
-	_, err := doOmahaRequest(req)
+	_, err := c.doOmahaRequest(req)
 
 	return err
 }
 
 // EventUpdateFailed posts an event to CR to indicate that the update process
 // complete but it didn't succeed.
-func EventUpdateFailed(instanceID, appID, groupID string) error {
+func (c *Client) EventUpdateFailed(instanceID, appID, groupID string) error {
 	req := buildOmahaEventRequest(instanceID, appID, groupID, omaha.EventTypeUpdateComplete, omaha.EventResultError)
-	_, err := doOmahaRequest(req)
+	_, err := c.doOmahaRequest(req)
 
 	return err
 }
@@ -128,8 +199,11 @@ func buildOmahaEventRequest(instanceID, appID, groupID string, eventType omaha.E
 	return req
 }
 
-func doOmahaRequest(req *omaha.Request) (*omaha.Response, error) {
-	omahaURL := os.Getenv("CR_OMAHA_URL")
+func (c *Client) doOmahaRequest(req *omaha.Request) (*omaha.Response, error) {
+	omahaURL := c.omahaURL
+	if omahaURL == "" {
+		omahaURL = os.Getenv("CR_OMAHA_URL")
+	}
 	if omahaURL == "" {
 		omahaURL = defaultOmahaURL
 	}
@@ -141,6 +215,13 @@ func doOmahaRequest(req *omaha.Request) (*omaha.Response, error) {
 		return nil, err
 	}
 
+	var cup2key string
+	if c.cupVerifier != nil {
+		if omahaURL, cup2key, err = addCUPParams(omahaURL, c.cupVerifier, payload); err != nil {
+			return nil, err
+		}
+	}
+
 	resp, err := httpClient.Post(omahaURL, "text/xml", bytes.NewReader(payload))
 	if err != nil {
 		return nil, err
@@ -152,6 +233,12 @@ func doOmahaRequest(req *omaha.Request) (*omaha.Response, error) {
 		return nil, err
 	}
 
+	if c.cupVerifier != nil {
+		if err := c.cupVerifier.Verify(cup2key, payload, body, resp.Header.Get(cupServerProofHeader)); err != nil {
+			return nil, err
+		}
+	}
+
 	oresp := &omaha.Response{}
 	if err = xml.Unmarshal(body, oresp); err != nil {
 		return nil, err
@@ -159,3 +246,23 @@ func doOmahaRequest(req *omaha.Request) (*omaha.Response, error) {
 
 	return oresp, nil
 }
+
+// addCUPParams adds the parameters asking for a response signed with the key
+// trusted by the verifier provided to the omaha url, returning the new url
+// along with its cup2key parameter.
+func addCUPParams(omahaURL string, v *CUPVerifier, payload []byte) (string, string, error) {
+	u, err := url.Parse(omahaURL)
+	if err != nil {
+		return "", "", err
+	}
+	cup2key, err := v.NewKeyParam()
+	if err != nil {
+		return "", "", err
+	}
+	requestHash := sha256.Sum256(payload)
+	query := u.Query()
+	query.Set(cupKeyParam, cup2key)
+	query.Set(cupRequestHashParam, hex.EncodeToString(requestHash[:]))
+	u.RawQuery = query.Encode()
+	return u.String(), cup2key, nil
+}